@@ -20,6 +20,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
 	"os/signal"
 	"strings"
@@ -31,6 +32,7 @@ import (
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/informers"
 	clientset "k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
@@ -40,14 +42,21 @@ import (
 	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	"k8s.io/client-go/tools/record"
 
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
 	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/batchscheduler"
 	crclientset "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/clientset/versioned"
 	crinformers "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/informers/externalversions"
 	operatorConfig "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
 	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/controller/scheduledsparkapplication"
 	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/controller/sparkapplication"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/controller/sparkquota"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/notification"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/render"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/tracing"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/uiproxy"
 	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/util"
 	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/webhook"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/webhook/resourceusage"
 )
 
 var (
@@ -58,10 +67,32 @@ var (
 	namespace                      = flag.String("namespace", apiv1.NamespaceAll, "The Kubernetes namespace to manage. Will manage custom resource objects of the managed CRD types for the whole cluster if unset.")
 	labelSelectorFilter            = flag.String("label-selector-filter", "", "A comma-separated list of key=value, or key labels to filter resources during watch and list based on the specified labels.")
 	enableWebhook                  = flag.Bool("enable-webhook", false, "Whether to enable the mutating admission webhook for admitting and patching Spark pods.")
+	enablePodTemplateMutation      = flag.Bool("enable-pod-template-mutation", false, "Whether to render the customizations of driver and executor pods into pod templates passed to Spark, so that they are applied without the webhook.")
+	podTemplateDir                 = flag.String("pod-template-dir", os.TempDir(), "Directory the pod template files of applications are written to while they are submitted.")
+	unmutatedPodPolicy             = flag.String("unmutated-pod-policy", "Warn", "How to react to driver and executor pods created without the customizations of their application, e.g., because the webhook was unavailable: Ignore, Warn to record a Warning event and condition, Fail to also fail the application, or Resubmit to also rerun it. Pods are only verified if the webhook or pod template mutation is enabled.")
 	webhookTimeout                 = flag.Int("webhook-timeout", 30, "Webhook Timeout in seconds before the webhook returns a timeout")
 	enableResourceQuotaEnforcement = flag.Bool("enable-resource-quota-enforcement", false, "Whether to enable ResourceQuota enforcement for SparkApplication resources. Requires the webhook to be enabled.")
+	dynamicAllocationExecutors     = flag.String("resource-quota-dynamic-allocation-executors", "Max", "How many executors of applications with dynamic allocation enabled are charged against ResourceQuotas when they are admitted: Initial, Min or Max. The initial executors are charged instead of the maximum if maxExecutors isn't set. Executor pods beyond the charged executors are only created if they fit into the ResourceQuotas.")
+	enableSparkQuotas              = flag.Bool("enable-spark-quotas", false, "Whether to enforce SparkQuotas, which limit the concurrent applications and their resources across the namespaces they select. Applications are held back from submission while they don't fit.")
 	ingressURLFormat               = flag.String("ingress-url-format", "", "Ingress URL format.")
 	enableUIService                = flag.Bool("enable-ui-service", true, "Enable Spark service UI.")
+	enableUIProxy                  = flag.Bool("enable-ui-proxy", false, "Whether to serve the Spark UIs of all running applications through a reverse proxy in the operator instead of per-application Ingresses.")
+	uiProxyPort                    = flag.Int("ui-proxy-port", 8090, "Port the Spark UI proxy listens on.")
+	uiProxyBaseURL                 = flag.String("ui-proxy-base-url", "", "External base URL of the Spark UI proxy, used to populate the UI address of applications. Required if the UI proxy is enabled.")
+	uiProxyNamespaces              = flag.String("ui-proxy-namespaces", "", "A comma-separated list of the namespaces whose Spark UIs are served by the UI proxy. The UIs of all managed namespaces are served if unset.")
+	enableRenderEndpoint           = flag.Bool("enable-render-endpoint", false, "Whether to serve dry runs of the submission of SparkApplications, which render the arguments of spark-submit and the patched driver and executor pods without creating anything.")
+	renderAddress                  = flag.String("render-address", "127.0.0.1", "Address the render endpoint listens on. The endpoint isn't authenticated, so it only listens on the loopback interface by default. An empty address listens on all interfaces.")
+	renderPort                     = flag.Int("render-port", 8091, "Port the render endpoint listens on.")
+	uiExposure                     = flag.String("ui-exposure", "Ingress", "How the Spark UI is exposed when ingress-url-format is set, either Ingress or HTTPRoute. Applications can override it in spec.sparkUIOptions.exposure.")
+	uiGateway                      = flag.String("ui-gateway", "", "The namespace/name of the Gateway that Spark UI HTTPRoutes are attached to.")
+	tracingEndpoint                = flag.String("tracing-endpoint", "", "Base URL of an OpenTelemetry collector accepting OTLP/HTTP, e.g., http://otel-collector:4318, to export traces of the lifecycle of applications to. Tracing is disabled if unset.")
+	tracingServiceName             = flag.String("tracing-service-name", "spark-operator", "Service name reported in the exported traces.")
+	submissionWorkers              = flag.Int("submission-workers", 0, "Number of dedicated workers submitting SparkApplications, independently of controller-threads. Submissions run on the controller workers if 0.")
+	submissionTimeoutSeconds       = flag.Int("submission-timeout-seconds", 300, "Maximum time in seconds spark-submit may run before it is killed. 0 disables the timeout.")
+	submissionBackend              = flag.String("submission-backend", "SparkSubmit", "How drivers are created, either SparkSubmit to run spark-submit, Native to create the driver pod directly, or Job to run spark-submit in a Job in the namespace of the application. Applications can override it in spec.submissionBackend.")
+	enableNotifications            = flag.Bool("enable-notifications", false, "Whether to send CloudEvents for lifecycle transitions of applications to the configured notification sinks.")
+	notificationSinksConfigMap     = flag.String("notification-sinks-configmap", "spark-notification-sinks", "Name of the ConfigMaps defining the notification sinks applications can refer to, which are looked up in the namespace of each application and in the namespace given by notification-sinks-namespace.")
+	notificationSinksNamespace     = flag.String("notification-sinks-namespace", "", "Namespace of the ConfigMap defining the notification sinks of the operator, which applications of all namespaces can refer to. The operator defines no sinks if unset.")
 	enableLeaderElection           = flag.Bool("leader-election", false, "Enable Spark operator leader election.")
 	leaderElectionLockNamespace    = flag.String("leader-election-lock-namespace", "spark-operator", "Namespace in which to create the ConfigMap for leader election.")
 	leaderElectionLockName         = flag.String("leader-election-lock-name", "spark-operator-lock", "Name of the ConfigMap for leader election.")
@@ -73,15 +104,27 @@ var (
 	metricsPort                    = flag.String("metrics-port", "10254", "Port for the metrics endpoint.")
 	metricsEndpoint                = flag.String("metrics-endpoint", "/metrics", "Metrics endpoint.")
 	metricsPrefix                  = flag.String("metrics-prefix", "", "Prefix for the metrics.")
+	failureRulesConfigMap          = flag.String("failure-classification-rules-configmap", "", "The namespace/name of a ConfigMap with custom rules for classifying application failures.")
+	driverPendingTimeoutSeconds    = flag.Int64("driver-pending-timeout-seconds", 0, "Default maximum time in seconds a driver pod may stay pending before the application fails, for applications that don't set spec.driver.pendingTimeoutSeconds. 0 disables the timeout.")
+	executorPendingTimeoutSeconds  = flag.Int64("executor-pending-timeout-seconds", 0, "Default maximum time in seconds after the driver starts an application may go without any running executor before it fails, for applications that don't set spec.executor.pendingTimeoutSeconds. 0 disables the timeout.")
 	metricsLabels                  util.ArrayFlags
+	sparkHomes                     util.ArrayFlags
 	metricsJobStartLatencyBuckets  util.HistogramBuckets = util.DefaultJobStartLatencyBuckets
+	metricsStateDurationBuckets    util.HistogramBuckets = util.DefaultStateDurationBuckets
 )
 
 func main() {
 	flag.Var(&metricsLabels, "metrics-labels", "Labels for the metrics")
+	flag.Var(&sparkHomes, "spark-home",
+		"A Spark installation given as <versions>=<path> to submit applications whose spec.sparkVersion matches versions with, "+
+			"where versions is a version such as 3.1 or 3.1.2, an inclusive range of versions such as 3.2-3.4, or * for any version. "+
+			"It can be repeated, and the first matching installation is used. Applications are submitted with SPARK_HOME if unset")
 	flag.Var(&metricsJobStartLatencyBuckets, "metrics-job-start-latency-buckets",
 		"Comma-separated boundary values (in seconds) for the job start latency histogram bucket; "+
 			"it accepts any numerical values that can be parsed into a 64-bit floating point")
+	flag.Var(&metricsStateDurationBuckets, "metrics-state-duration-buckets",
+		"Comma-separated boundary values (in seconds) for the histogram of the time applications spend in each state; "+
+			"it accepts any numerical values that can be parsed into a 64-bit floating point")
 	flag.Parse()
 
 	// Create the client config. Use kubeConfig if given, otherwise assume in-cluster.
@@ -152,10 +195,34 @@ func main() {
 	if err != nil {
 		glog.Fatal(err)
 	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		glog.Fatal(err)
+	}
+
+	switch v1beta2.SparkUIExposure(*uiExposure) {
+	case v1beta2.IngressExposure:
+	case v1beta2.HTTPRouteExposure:
+		if *uiGateway == "" {
+			glog.Fatal("-ui-gateway must be set if -ui-exposure is HTTPRoute")
+		}
+	default:
+		glog.Fatalf("invalid -ui-exposure %q, must be %s or %s", *uiExposure, v1beta2.IngressExposure, v1beta2.HTTPRouteExposure)
+	}
+
+	if *enableUIProxy {
+		if baseURL, err := url.Parse(*uiProxyBaseURL); err != nil || !baseURL.IsAbs() {
+			glog.Fatalf("-ui-proxy-base-url must be set to the absolute external URL of the UI proxy if it is enabled, got %q", *uiProxyBaseURL)
+		}
+	}
 
 	if err = util.InitializeIngressCapabilities(kubeClient); err != nil {
 		glog.Fatalf("Error retrieving Kubernetes cluster capabilities: %s", err.Error())
 	}
+	// HTTPRoutes are detected even without a Gateway so that routes created before a restart can be deleted.
+	if err = util.InitializeHTTPRouteCapabilities(kubeClient); err != nil {
+		glog.Fatalf("Error retrieving Kubernetes cluster capabilities: %s", err.Error())
+	}
 
 	var batchSchedulerMgr *batchscheduler.SchedulerManager
 	if *enableBatchScheduler {
@@ -177,20 +244,107 @@ func main() {
 			MetricsPrefix:                 *metricsPrefix,
 			MetricsLabels:                 metricsLabels,
 			MetricsJobStartLatencyBuckets: metricsJobStartLatencyBuckets,
+			MetricsStateDurationBuckets:   metricsStateDurationBuckets,
 		}
 
 		glog.Info("Enabling metrics collecting and exporting to Prometheus")
 		util.InitializeMetrics(metricConfig)
 	}
 
+	parsedSparkHomes, err := sparkapplication.ParseSparkHomes(sparkHomes)
+	if err != nil {
+		glog.Fatal(err)
+	}
+
+	var podTemplateDirectory string
+	if *enablePodTemplateMutation {
+		podTemplateDirectory = *podTemplateDir
+	}
+
+	parsedUnmutatedPodPolicy, err := sparkapplication.ParseUnmutatedPodPolicy(*unmutatedPodPolicy)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	// Pods are never mutated if neither the webhook nor pod templates are enabled.
+	if !*enableWebhook && !*enablePodTemplateMutation {
+		parsedUnmutatedPodPolicy = sparkapplication.UnmutatedPodPolicyIgnore
+	}
+
+	var tracer *tracing.Tracer
+	if *tracingEndpoint != "" {
+		if tracer, err = tracing.New(*tracingEndpoint, *tracingServiceName); err != nil {
+			glog.Fatal(err)
+		}
+	}
+
+	var notifier *notification.Notifier
+	if *enableNotifications {
+		notifier = notification.New(kubeClient, *notificationSinksConfigMap, *notificationSinksNamespace)
+		if err = notifier.Start(); err != nil {
+			glog.Fatal(err)
+		}
+	}
+
+	dynamicAllocationCharge, err := resourceusage.ParseDynamicAllocationCharge(*dynamicAllocationExecutors)
+	if err != nil {
+		glog.Fatal(err)
+	}
+
+	// SparkQuotas select namespaces by their labels, so namespaces are watched cluster-wide.
+	var namespaceInformerFactory informers.SharedInformerFactory
+	var sparkQuotaEnforcer *resourceusage.SparkQuotaEnforcer
+	var sparkQuotaController *sparkquota.Controller
+	if *enableSparkQuotas {
+		namespaceInformerFactory = informers.NewSharedInformerFactory(kubeClient, time.Duration(*resyncInterval)*time.Second)
+		sparkQuotaEnforcer = resourceusage.NewSparkQuotaEnforcer(crInformerFactory, namespaceInformerFactory, dynamicAllocationCharge)
+		sparkQuotaController = sparkquota.NewController(crClient, crInformerFactory, namespaceInformerFactory, sparkQuotaEnforcer)
+	}
+
 	applicationController := sparkapplication.NewController(
-		crClient, kubeClient, crInformerFactory, podInformerFactory, metricConfig, *namespace, *ingressURLFormat, batchSchedulerMgr, *enableUIService)
+		crClient, kubeClient, dynamicClient, crInformerFactory, podInformerFactory, metricConfig, *namespace, sparkapplication.Options{
+			IngressURLFormat:              *ingressURLFormat,
+			BatchSchedulerMgr:             batchSchedulerMgr,
+			EnableUIService:               *enableUIService,
+			FailureRulesConfigMap:         *failureRulesConfigMap,
+			DriverPendingTimeoutSeconds:   *driverPendingTimeoutSeconds,
+			ExecutorPendingTimeoutSeconds: *executorPendingTimeoutSeconds,
+			EnableUIProxy:                 *enableUIProxy,
+			UIProxyBaseURL:                *uiProxyBaseURL,
+			UIExposure:                    *uiExposure,
+			UIGateway:                     *uiGateway,
+			Tracer:                        tracer,
+			Notifier:                      notifier,
+			SubmissionBackend:             *submissionBackend,
+			SubmissionWorkers:             *submissionWorkers,
+			SubmissionTimeout:             time.Duration(*submissionTimeoutSeconds) * time.Second,
+			SparkHomes:                    parsedSparkHomes,
+			PodTemplateDir:                podTemplateDirectory,
+			UnmutatedPodPolicy:            parsedUnmutatedPodPolicy,
+			SparkQuotaEnforcer:            sparkQuotaEnforcer,
+		})
 	scheduledApplicationController := scheduledsparkapplication.NewController(
-		crClient, kubeClient, apiExtensionsClient, crInformerFactory, clock.RealClock{})
+		crClient, kubeClient, apiExtensionsClient, crInformerFactory, clock.RealClock{}, notifier)
+
+	var uiProxy *uiproxy.Proxy
+	if *enableUIProxy {
+		var namespaces []string
+		if *uiProxyNamespaces != "" {
+			namespaces = strings.Split(*uiProxyNamespaces, ",")
+		}
+		uiProxy = uiproxy.New(crInformerFactory, podInformerFactory, *uiProxyPort, namespaces)
+	}
+
+	var renderServer *render.Server
+	if *enableRenderEndpoint {
+		renderServer = render.New(kubeClient, *renderAddress, *renderPort)
+	}
 
 	// Start the informer factory that in turn starts the informer.
 	go crInformerFactory.Start(stopCh)
 	go podInformerFactory.Start(stopCh)
+	if *enableSparkQuotas {
+		go namespaceInformerFactory.Start(stopCh)
+	}
 
 	var hook *webhook.WebHook
 	if *enableWebhook {
@@ -198,9 +352,8 @@ func main() {
 		if *enableResourceQuotaEnforcement {
 			coreV1InformerFactory = buildCoreV1InformerFactory(kubeClient)
 		}
-		var err error
 		// Don't deregister webhook on exit if leader election enabled (i.e. multiple webhooks running)
-		hook, err = webhook.New(kubeClient, crInformerFactory, *namespace, !*enableLeaderElection, *enableResourceQuotaEnforcement, coreV1InformerFactory, webhookTimeout)
+		hook, err = webhook.New(kubeClient, crInformerFactory, *namespace, !*enableLeaderElection, *enableResourceQuotaEnforcement, dynamicAllocationCharge, coreV1InformerFactory, sparkQuotaEnforcer, webhookTimeout)
 		if err != nil {
 			glog.Fatal(err)
 		}
@@ -216,11 +369,22 @@ func main() {
 		glog.Fatal("Webhook must be enabled to use resource quota enforcement.")
 	}
 
+	if *enableUIProxy {
+		uiProxy.Start()
+	}
+	if *enableRenderEndpoint {
+		renderServer.Start()
+	}
+
 	if *enableLeaderElection {
 		glog.Info("Waiting to be elected leader before starting application controller goroutines")
 		<-startCh
 	}
 
+	if *enableWebhook {
+		hook.StartCertRotation(stopCh)
+	}
+
 	glog.Info("Starting application controller goroutines")
 
 	if err = applicationController.Start(*controllerThreads, stopCh); err != nil {
@@ -229,6 +393,11 @@ func main() {
 	if err = scheduledApplicationController.Start(*controllerThreads, stopCh); err != nil {
 		glog.Fatal(err)
 	}
+	if *enableSparkQuotas {
+		if err = sparkQuotaController.Start(1, stopCh); err != nil {
+			glog.Fatal(err)
+		}
+	}
 
 	select {
 	case <-signalCh:
@@ -239,6 +408,21 @@ func main() {
 	glog.Info("Shutting down the Spark Operator")
 	applicationController.Stop()
 	scheduledApplicationController.Stop()
+	if *enableSparkQuotas {
+		sparkQuotaController.Stop()
+	}
+	tracer.Stop()
+	notifier.Stop()
+	if *enableUIProxy {
+		if err := uiProxy.Stop(); err != nil {
+			glog.Error(err)
+		}
+	}
+	if *enableRenderEndpoint {
+		if err := renderServer.Stop(); err != nil {
+			glog.Error(err)
+		}
+	}
 	if *enableWebhook {
 		if err := hook.Stop(); err != nil {
 			glog.Fatal(err)
@@ -46,6 +46,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		&SparkApplicationList{},
 		&ScheduledSparkApplication{},
 		&ScheduledSparkApplicationList{},
+		&SparkQuota{},
+		&SparkQuotaList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
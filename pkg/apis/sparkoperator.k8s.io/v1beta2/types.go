@@ -19,6 +19,7 @@ package v1beta2
 import (
 	apiv1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -125,6 +126,10 @@ type ScheduledSparkApplicationSpec struct {
 	// +optional
 	// Defaults to 1.
 	FailedRunHistoryLimit *int32 `json:"failedRunHistoryLimit,omitempty"`
+	// Notifications configures where notifications of transitions of the schedule state are sent.
+	// Notifications for the runs of the application are configured in the template.
+	// +optional
+	Notifications *NotificationSpec `json:"notifications,omitempty"`
 }
 
 type ScheduleState string
@@ -185,7 +190,7 @@ type SparkApplicationSpec struct {
 	// SparkVersion is the version of Spark the application uses.
 	SparkVersion string `json:"sparkVersion"`
 	// Mode is the deployment mode of the Spark application.
-	// +kubebuilder:validation:Enum={cluster,client}
+	// +kubebuilder:validation:Enum={cluster,client,in-cluster-client}
 	Mode DeployMode `json:"mode,omitempty"`
 	// ProxyUser specifies the user to impersonate when submitting the application.
 	// It maps to the command-line flag "--proxy-user" in spark-submit.
@@ -284,20 +289,64 @@ type SparkApplicationSpec struct {
 	// scheduler backend since Spark 3.0.
 	// +optional
 	DynamicAllocation *DynamicAllocation `json:"dynamicAllocation,omitempty"`
+	// Notifications configures where notifications of lifecycle transitions of the application are sent.
+	// +optional
+	Notifications *NotificationSpec `json:"notifications,omitempty"`
+	// SubmissionBackend overrides how the driver of the application is created. Defaults to the
+	// operator-wide setting of the flag -submission-backend.
+	// +optional
+	// +kubebuilder:validation:Enum={SparkSubmit,Native,Job}
+	SubmissionBackend *SubmissionBackend `json:"submissionBackend,omitempty"`
+}
+
+// SubmissionBackend tells how the driver of an application is created.
+type SubmissionBackend string
+
+// Different ways the driver of an application can be created.
+const (
+	// SparkSubmitBackend runs spark-submit to create the driver.
+	SparkSubmitBackend SubmissionBackend = "SparkSubmit"
+	// NativeBackend creates the driver pod, its ConfigMap and its service directly from the operator.
+	NativeBackend SubmissionBackend = "Native"
+	// JobBackend runs spark-submit in a Job in the namespace of the application.
+	JobBackend SubmissionBackend = "Job"
+)
+
+// NotificationSpec configures the sinks notifications of lifecycle transitions are sent to.
+type NotificationSpec struct {
+	// Sinks are references to the sinks the notifications are sent to.
+	// +optional
+	Sinks []NotificationSinkReference `json:"sinks,omitempty"`
+}
+
+// NotificationSinkReference refers by name to a notification sink defined in the notification sinks
+// ConfigMap of the namespace of the application or of the operator. A sink of the namespace takes
+// precedence over a sink of the operator with the same name.
+type NotificationSinkReference struct {
+	// Name is the name of the sink.
+	Name string `json:"name"`
+	// States limits the notifications to transitions into the given states, e.g., FAILED, among the
+	// states the sink accepts. Notifications are sent for every state the sink accepts if empty.
+	// +optional
+	States []string `json:"states,omitempty"`
 }
 
 // BatchSchedulerConfiguration used to configure how to batch scheduling Spark Application
 type BatchSchedulerConfiguration struct {
-	// Queue stands for the resource queue which the application belongs to, it's being used in Volcano batch scheduler.
+	// Queue stands for the resource queue which the application belongs to, it's being used in Volcano, YuniKorn and Kueue batch schedulers.
 	// +optional
 	Queue *string `json:"queue,omitempty"`
 	// PriorityClassName stands for the name of k8s PriorityClass resource, it's being used in Volcano batch scheduler.
 	// +optional
 	PriorityClassName *string `json:"priorityClassName,omitempty"`
 	// Resources stands for the resource list custom request for. Usually it is used to define the lower-bound limit.
-	// If specified, volcano scheduler will consider it as the resources requested.
+	// If specified, volcano and coscheduling schedulers will consider it as the resources requested.
 	// +optional
 	Resources apiv1.ResourceList `json:"resources,omitempty"`
+	// ScheduleTimeoutSeconds stands for how long the pods of the application wait for their PodGroup to be
+	// scheduled, it's being used in the coscheduling batch scheduler.
+	// +optional
+	ScheduleTimeoutSeconds *int32 `json:"scheduleTimeoutSeconds,omitempty"`
 }
 
 // SparkUIConfiguration is for driver UI specific configuration parameters.
@@ -323,8 +372,25 @@ type SparkUIConfiguration struct {
 	// TlsHosts is useful If we need to declare SSL certificates to the ingress object
 	// +optional
 	IngressTLS []networkingv1.IngressTLS `json:"ingressTLS,omitempty"`
+	// Exposure overrides how the UI is exposed outside the cluster if an ingress URL format is set
+	// for the operator. Defaults to the operator-wide setting of the flag -ui-exposure.
+	// +optional
+	// +kubebuilder:validation:Enum={Ingress,HTTPRoute}
+	Exposure *SparkUIExposure `json:"exposure,omitempty"`
 }
 
+// SparkUIExposure tells how the Spark UI is exposed outside the cluster.
+type SparkUIExposure string
+
+// Different ways the Spark UI can be exposed.
+const (
+	// IngressExposure exposes the UI through an Ingress.
+	IngressExposure SparkUIExposure = "Ingress"
+	// HTTPRouteExposure exposes the UI through a Gateway API HTTPRoute attached to the Gateway
+	// set by the flag -ui-gateway.
+	HTTPRouteExposure SparkUIExposure = "HTTPRoute"
+)
+
 // ApplicationStateType represents the type of the current state of an application.
 type ApplicationStateType string
 
@@ -347,8 +413,42 @@ const (
 type ApplicationState struct {
 	State        ApplicationStateType `json:"state"`
 	ErrorMessage string               `json:"errorMessage,omitempty"`
+	// LastTransitionTime is the time the application last changed its state.
+	// +optional
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
 }
 
+// FailureReason classifies why an application failed, so that failures caused by the platform
+// can be told apart from failures caused by the application itself.
+type FailureReason string
+
+// Different failure reasons an application may have. Custom classification rules may produce
+// reasons other than the ones listed here.
+const (
+	// ImagePullFailure means the container image of the driver could not be pulled.
+	ImagePullFailure FailureReason = "ImagePullError"
+	// UnschedulableFailure means the driver pod could not be scheduled onto any node.
+	UnschedulableFailure FailureReason = "Unschedulable"
+	// DriverOOMKilledFailure means the driver container was killed for running out of memory.
+	DriverOOMKilledFailure FailureReason = "DriverOOMKilled"
+	// ExecutorOOMKilledFailure means executor containers were killed for running out of memory.
+	ExecutorOOMKilledFailure FailureReason = "ExecutorOOMKilled"
+	// EvictedFailure means the driver pod was evicted from its node.
+	EvictedFailure FailureReason = "Evicted"
+	// SubmissionFailure means spark-submit failed to submit the application.
+	SubmissionFailure FailureReason = "SubmissionError"
+	// UserCodeFailure means the driver exited with a non-zero exit code.
+	UserCodeFailure FailureReason = "UserCodeError"
+	// TimeoutFailure means the application was terminated after exceeding a deadline.
+	TimeoutFailure FailureReason = "Timeout"
+	// UnmutatedPodFailure means a driver or executor pod was created without the customizations of the application.
+	UnmutatedPodFailure FailureReason = "UnmutatedPod"
+	// SparkQuotaExceededFailure means the application can never run within the SparkQuotas of its namespace.
+	SparkQuotaExceededFailure FailureReason = "SparkQuotaExceeded"
+	// UnknownFailure means the failure could not be classified.
+	UnknownFailure FailureReason = "Unknown"
+)
+
 // DriverState tells the current state of a spark driver.
 type DriverState string
 
@@ -389,16 +489,43 @@ type SparkApplicationStatus struct {
 	DriverInfo DriverInfo `json:"driverInfo"`
 	// AppState tells the overall application state.
 	AppState ApplicationState `json:"applicationState,omitempty"`
+	// FailureReason classifies the cause of the failure if the application failed.
+	FailureReason FailureReason `json:"failureReason,omitempty"`
 	// ExecutorState records the state of executors by executor Pod names.
 	ExecutorState map[string]ExecutorState `json:"executorState,omitempty"`
+	// PendingExecutors aggregates the reasons why executor pods are pending.
+	// +optional
+	PendingExecutors []PendingExecutorReason `json:"pendingExecutors,omitempty"`
 	// ExecutionAttempts is the total number of attempts to run a submitted application to completion.
 	// Incremented upon each attempted run of the application and reset upon invalidation.
 	ExecutionAttempts int32 `json:"executionAttempts,omitempty"`
 	// SubmissionAttempts is the total number of attempts to submit an application to run.
 	// Incremented upon each attempted submission of the application and reset upon invalidation and rerun.
 	SubmissionAttempts int32 `json:"submissionAttempts,omitempty"`
+	// SubmissionOutputConfigMap is the name of the ConfigMap holding the output of spark-submit for the
+	// latest submission attempts.
+	// +optional
+	SubmissionOutputConfigMap string `json:"submissionOutputConfigMap,omitempty"`
+	// Conditions are the latest observations of the application, such as whether its pods were mutated.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+// Types of the conditions of an application.
+const (
+	// PodsMutatedCondition tells whether the driver and executor pods of the application carry the
+	// customizations of the application applied by the webhook or pod templates.
+	PodsMutatedCondition = "PodsMutated"
+	// SparkQuotaAdmittedCondition tells whether the application fits into the SparkQuotas of its namespace, or
+	// waits for other applications to complete before it is submitted.
+	SparkQuotaAdmittedCondition = "SparkQuotaAdmitted"
+	// BatchSchedulerAdmittedCondition tells whether the batch scheduler of the application, e.g. Kueue, admitted
+	// it, or the application waits to be admitted before it is submitted.
+	BatchSchedulerAdmittedCondition = "BatchSchedulerAdmitted"
+)
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // SparkApplicationList carries a list of SparkApplication objects.
@@ -408,6 +535,69 @@ type SparkApplicationList struct {
 	Items           []SparkApplication `json:"items,omitempty"`
 }
 
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +k8s:defaulter-gen=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster,shortName=sparkquota,singular=sparkquota
+
+// SparkQuota limits the SparkApplications of all namespaces it selects together, e.g., of the namespaces of a team.
+type SparkQuota struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              SparkQuotaSpec   `json:"spec"`
+	Status            SparkQuotaStatus `json:"status,omitempty"`
+}
+
+// SparkQuotaSpec describes the limits of a SparkQuota. Limits that are not set are not enforced.
+type SparkQuotaSpec struct {
+	// NamespaceSelector selects the namespaces whose applications are limited by the quota by their labels.
+	// An empty selector selects all namespaces.
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector"`
+	// MaxApplications is the maximum number of applications that run concurrently.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxApplications *int32 `json:"maxApplications,omitempty"`
+	// Cores is the maximum number of cores requested by the drivers and executors of the running applications.
+	// +optional
+	Cores *resource.Quantity `json:"cores,omitempty"`
+	// Memory is the maximum amount of memory, including the memory overhead, requested by the drivers and
+	// executors of the running applications.
+	// +optional
+	Memory *resource.Quantity `json:"memory,omitempty"`
+	// MaxExecutorsPerApplication is the maximum number of executors of a single application. For applications
+	// with dynamic allocation enabled, it limits .spec.dynamicAllocation.maxExecutors, which must then be set.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxExecutorsPerApplication *int32 `json:"maxExecutorsPerApplication,omitempty"`
+}
+
+// SparkQuotaStatus describes the current usage of a SparkQuota.
+type SparkQuotaStatus struct {
+	// Namespaces are the namespaces selected by the quota.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Applications is the number of running applications.
+	Applications int32 `json:"applications"`
+	// Cores is the number of cores requested by the running applications.
+	Cores resource.Quantity `json:"cores"`
+	// Memory is the amount of memory requested by the running applications.
+	Memory resource.Quantity `json:"memory"`
+	// LastUpdateTime is the time the usage was last computed.
+	// +optional
+	LastUpdateTime metav1.Time `json:"lastUpdateTime,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// SparkQuotaList carries a list of SparkQuota objects.
+type SparkQuotaList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SparkQuota `json:"items,omitempty"`
+}
+
 // Dependencies specifies all possible types of dependencies of a Spark application.
 type Dependencies struct {
 	// Jars is a list of JAR files the Spark application depends on.
@@ -534,10 +724,9 @@ type SparkPodSpec struct {
 // DriverSpec is specification of the driver.
 type DriverSpec struct {
 	SparkPodSpec `json:",inline"`
-	// PodName is the name of the driver pod that the user creates. This is used for the
-	// in-cluster client mode in which the user creates a client pod where the driver of
-	// the user application runs. It's an error to set this field if Mode is not
-	// in-cluster-client.
+	// PodName is the name of the driver pod, which defaults to <application name>-driver. In
+	// in-cluster-client mode, the driver pod runs spark-submit in client mode, so this is also
+	// the pod the driver of the user application runs in.
 	// +optional
 	// +kubebuilder:validation:Pattern=[a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*
 	PodName *string `json:"podName,omitempty"`
@@ -563,6 +752,13 @@ type DriverSpec struct {
 	// Ports settings for the pods, following the Kubernetes specifications.
 	// +optional
 	Ports []Port `json:"ports,omitempty"`
+	// PendingTimeoutSeconds is the maximum time in seconds the driver pod may stay pending, e.g.,
+	// because it cannot be scheduled or its image cannot be pulled. The driver pod is deleted and
+	// the application fails once the timeout is exceeded. Defaults to the operator-wide default
+	// set by the flag -driver-pending-timeout-seconds. A value of 0 disables the timeout.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	PendingTimeoutSeconds *int64 `json:"pendingTimeoutSeconds,omitempty"`
 }
 
 // ExecutorSpec is specification of the executor.
@@ -587,6 +783,14 @@ type ExecutorSpec struct {
 	// Ports settings for the pods, following the Kubernetes specifications.
 	// +optional
 	Ports []Port `json:"ports,omitempty"`
+	// PendingTimeoutSeconds is the maximum time in seconds after the driver starts running the
+	// application may go without any executor becoming running, e.g., because the executor pods
+	// cannot be scheduled. The application fails once the timeout is exceeded. Defaults to the
+	// operator-wide default set by the flag -executor-pending-timeout-seconds. A value of 0
+	// disables the timeout.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	PendingTimeoutSeconds *int64 `json:"pendingTimeoutSeconds,omitempty"`
 }
 
 // NamePath is a pair of a name and a path to which the named objects should be mounted to.
@@ -619,7 +823,22 @@ type DriverInfo struct {
 	// Ingress Details if an ingress for the UI was created.
 	WebUIIngressName    string `json:"webUIIngressName,omitempty"`
 	WebUIIngressAddress string `json:"webUIIngressAddress,omitempty"`
-	PodName             string `json:"podName,omitempty"`
+	// WebUIHTTPRouteName is the name of the Gateway API HTTPRoute if one was created for the UI.
+	// WebUIIngressAddress is set to its URL.
+	WebUIHTTPRouteName string `json:"webUIHTTPRouteName,omitempty"`
+	PodName            string `json:"podName,omitempty"`
+}
+
+// PendingExecutorReason tells why a number of executor pods are pending, taken from the waiting
+// state of their containers or their scheduling condition.
+type PendingExecutorReason struct {
+	// Reason is the waiting reason of the executor container or the reason of the scheduling condition.
+	Reason string `json:"reason"`
+	// Message is the message that comes with the reason, e.g., the message of the scheduler.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Count is the number of executor pods pending for this reason.
+	Count int32 `json:"count"`
 }
 
 // SecretInfo captures information of a secret.
@@ -0,0 +1,275 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package coscheduling
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	schedulerinterface "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/batchscheduler/interface"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/webhook/resourceusage"
+)
+
+const (
+	PodGroupName = "podgroups.scheduling.x-k8s.io"
+
+	// PodGroupLabel is the label the coscheduling plugin finds the PodGroup of a pod by.
+	PodGroupLabel = "scheduling.x-k8s.io/pod-group"
+
+	// DefaultSchedulerName is the name the scheduler of scheduler-plugins is deployed with by default. Pods are
+	// scheduled by it unless the driver or executors are configured with another scheduler.
+	DefaultSchedulerName = "scheduler-plugins-scheduler"
+)
+
+var podGroupResource = schema.GroupVersionResource{Group: "scheduling.x-k8s.io", Version: "v1alpha1", Resource: "podgroups"}
+
+// The following types are the subset of the scheduler-plugins v1alpha1 API used by the operator.
+
+type podGroup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              podGroupSpec `json:"spec,omitempty"`
+}
+
+type podGroupSpec struct {
+	MinMember              int32                `json:"minMember,omitempty"`
+	MinResources           *corev1.ResourceList `json:"minResources,omitempty"`
+	ScheduleTimeoutSeconds *int32               `json:"scheduleTimeoutSeconds,omitempty"`
+}
+
+type CoschedulingBatchScheduler struct {
+	dynamicClient dynamic.Interface
+}
+
+func GetPluginName() string {
+	return "coscheduling"
+}
+
+func (c *CoschedulingBatchScheduler) Name() string {
+	return GetPluginName()
+}
+
+func (c *CoschedulingBatchScheduler) ShouldSchedule(app *v1beta2.SparkApplication) bool {
+	//NOTE: There is no additional requirement for coscheduling
+	return true
+}
+
+// SchedulerName keeps the scheduler the pods are configured with, as the coscheduling plugin runs in the
+// scheduler of scheduler-plugins, which may be deployed with another name. It defaults to DefaultSchedulerName.
+func (c *CoschedulingBatchScheduler) SchedulerName(schedulerName string) string {
+	if schedulerName == "" {
+		return DefaultSchedulerName
+	}
+	return schedulerName
+}
+
+func (c *CoschedulingBatchScheduler) DoBatchSchedulingOnSubmission(app *v1beta2.SparkApplication) error {
+	if app.Spec.Executor.Labels == nil {
+		app.Spec.Executor.Labels = make(map[string]string)
+	}
+
+	if app.Spec.Driver.Labels == nil {
+		app.Spec.Driver.Labels = make(map[string]string)
+	}
+
+	switch app.Spec.Mode {
+	case v1beta2.ClientMode:
+		return c.syncPodGroupInClientMode(app)
+	case v1beta2.ClusterMode, v1beta2.InClusterClientMode:
+		//In in-cluster client mode, the driver runs in a pod created by the operator as in cluster mode.
+		return c.syncPodGroupInClusterMode(app)
+	default:
+		return fmt.Errorf("unsupported deploy mode %q. Abandon schedule pods via coscheduling", app.Spec.Mode)
+	}
+}
+
+func (c *CoschedulingBatchScheduler) syncPodGroupInClientMode(app *v1beta2.SparkApplication) error {
+	// We only care about the executor pods in client mode
+	if _, ok := app.Spec.Executor.Labels[PodGroupLabel]; !ok {
+		totalResource, err := getExecutorsRequestResource(app)
+		if err != nil {
+			return err
+		}
+
+		if app.Spec.BatchSchedulerOptions != nil && len(app.Spec.BatchSchedulerOptions.Resources) > 0 {
+			totalResource = app.Spec.BatchSchedulerOptions.Resources
+		}
+		if err := c.syncPodGroup(app, 1, totalResource); err != nil {
+			return err
+		}
+		app.Spec.Executor.Labels[PodGroupLabel] = getAppPodGroupName(app)
+	}
+	return nil
+}
+
+func (c *CoschedulingBatchScheduler) syncPodGroupInClusterMode(app *v1beta2.SparkApplication) error {
+	//We need both mark Driver and Executor when submitting
+	//NOTE: In cluster mode, the minMember of the PodGroup is set to 1 as the executors are only created once the
+	//driver is running, while minResources makes sure that there is room for all of them.
+	if _, ok := app.Spec.Driver.Labels[PodGroupLabel]; !ok {
+		//Both driver and executor resource will be considered.
+		executorResource, err := getExecutorsRequestResource(app)
+		if err != nil {
+			return err
+		}
+		driverResource, err := resourceusage.DriverPodResources(app.Spec)
+		if err != nil {
+			return fmt.Errorf("failed to compute the resources of the driver: %v", err)
+		}
+		totalResource := sumResourceList([]corev1.ResourceList{executorResource, driverResource})
+
+		if app.Spec.BatchSchedulerOptions != nil && len(app.Spec.BatchSchedulerOptions.Resources) > 0 {
+			totalResource = app.Spec.BatchSchedulerOptions.Resources
+		}
+		if err := c.syncPodGroup(app, 1, totalResource); err != nil {
+			return err
+		}
+		app.Spec.Executor.Labels[PodGroupLabel] = getAppPodGroupName(app)
+		app.Spec.Driver.Labels[PodGroupLabel] = getAppPodGroupName(app)
+	}
+	return nil
+}
+
+func getAppPodGroupName(app *v1beta2.SparkApplication) string {
+	return fmt.Sprintf("spark-%s-pg", app.Name)
+}
+
+func (c *CoschedulingBatchScheduler) syncPodGroup(app *v1beta2.SparkApplication, size int32, minResource corev1.ResourceList) error {
+	podGroups := c.dynamicClient.Resource(podGroupResource).Namespace(app.Namespace)
+	obj, err := podGroups.Get(context.TODO(), getAppPodGroupName(app), metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		err = c.createPodGroup(app, size, minResource)
+	} else if minMember, _, _ := unstructured.NestedInt64(obj.Object, "spec", "minMember"); minMember != int64(size) {
+		//Only minMember is updated so that the fields of the PodGroup unknown to the operator are kept.
+		if err = unstructured.SetNestedField(obj.Object, int64(size), "spec", "minMember"); err == nil {
+			_, err = podGroups.Update(context.TODO(), obj, metav1.UpdateOptions{})
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to sync PodGroup with error: %s. Abandon schedule pods via coscheduling", err)
+	}
+	return nil
+}
+
+func (c *CoschedulingBatchScheduler) createPodGroup(app *v1beta2.SparkApplication, size int32, minResource corev1.ResourceList) error {
+	pg := podGroup{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: podGroupResource.GroupVersion().String(),
+			Kind:       "PodGroup",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: app.Namespace,
+			Name:      getAppPodGroupName(app),
+			Labels:    map[string]string{config.SparkAppNameLabel: app.Name},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(app, v1beta2.SchemeGroupVersion.WithKind("SparkApplication")),
+			},
+		},
+		Spec: podGroupSpec{
+			MinMember:    size,
+			MinResources: &minResource,
+		},
+	}
+
+	//Update pod group schedule timeout if it's specified in Spark Application
+	if app.Spec.BatchSchedulerOptions != nil && app.Spec.BatchSchedulerOptions.ScheduleTimeoutSeconds != nil {
+		pg.Spec.ScheduleTimeoutSeconds = app.Spec.BatchSchedulerOptions.ScheduleTimeoutSeconds
+	}
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&pg)
+	if err != nil {
+		return err
+	}
+	glog.V(2).Infof("Creating PodGroup %s/%s", pg.Namespace, pg.Name)
+	_, err = c.dynamicClient.Resource(podGroupResource).Namespace(app.Namespace).Create(context.TODO(), &unstructured.Unstructured{Object: obj}, metav1.CreateOptions{})
+	return err
+}
+
+func (c *CoschedulingBatchScheduler) CleanupOnCompletion(app *v1beta2.SparkApplication) error {
+	err := c.dynamicClient.Resource(podGroupResource).Namespace(app.Namespace).Delete(context.TODO(), getAppPodGroupName(app), metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func New(config *rest.Config) (schedulerinterface.BatchScheduler, error) {
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize dynamic client with error %v", err)
+	}
+	extClient, err := apiextensionsclient.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize k8s extension client with error %v", err)
+	}
+
+	if _, err := extClient.ApiextensionsV1().CustomResourceDefinitions().Get(
+		context.TODO(),
+		PodGroupName,
+		metav1.GetOptions{},
+	); err != nil {
+		return nil, fmt.Errorf("podGroup CRD is required to exists in current cluster error: %s", err)
+	}
+	return &CoschedulingBatchScheduler{
+		dynamicClient: dynamicClient,
+	}, nil
+}
+
+// getExecutorsRequestResource returns the resources requested by the initial executors of the given application.
+func getExecutorsRequestResource(app *v1beta2.SparkApplication) (corev1.ResourceList, error) {
+	resources, err := resourceusage.ExecutorPodResources(app.Spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute the resources of the executors: %v", err)
+	}
+	executors := int64(resourceusage.InitialExecutors(app.Spec))
+	for name, quantity := range resources {
+		resources[name] = *resource.NewMilliQuantity(quantity.MilliValue()*executors, quantity.Format)
+	}
+	return resources, nil
+}
+
+func sumResourceList(list []corev1.ResourceList) corev1.ResourceList {
+	totalResource := corev1.ResourceList{}
+	for _, l := range list {
+		for name, quantity := range l {
+			if value, ok := totalResource[name]; !ok {
+				totalResource[name] = quantity.DeepCopy()
+			} else {
+				value.Add(quantity)
+				totalResource[name] = value
+			}
+		}
+	}
+	return totalResource
+}
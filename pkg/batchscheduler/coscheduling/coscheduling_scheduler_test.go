@@ -0,0 +1,191 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package coscheduling
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+)
+
+func getPodGroup(t *testing.T, c *CoschedulingBatchScheduler, app *v1beta2.SparkApplication) *podGroup {
+	obj, err := c.dynamicClient.Resource(podGroupResource).Namespace(app.Namespace).Get(context.TODO(), getAppPodGroupName(app), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pg := &podGroup{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, pg); err != nil {
+		t.Fatal(err)
+	}
+	return pg
+}
+
+func TestDoBatchSchedulingOnSubmission(t *testing.T) {
+	oneCore := int32(1)
+	halfCoreStr := "500m"
+	oneGB := "1g"
+	overhead := "512m"
+	instances := int32(3)
+	timeout := int32(60)
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type: v1beta2.ScalaApplicationType,
+			BatchSchedulerOptions: &v1beta2.BatchSchedulerConfiguration{
+				ScheduleTimeoutSeconds: &timeout,
+			},
+			Driver: v1beta2.DriverSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					Cores:          &oneCore,
+					Memory:         &oneGB,
+					MemoryOverhead: &overhead,
+				},
+			},
+			Executor: v1beta2.ExecutorSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					Cores:          &oneCore,
+					Memory:         &oneGB,
+					MemoryOverhead: &overhead,
+				},
+				CoreRequest: &halfCoreStr,
+				Instances:   &instances,
+			},
+		},
+	}
+
+	testcases := []struct {
+		name                string
+		mode                v1beta2.DeployMode
+		expectedCPU         string
+		expectedMemory      string
+		expectedDriverLabel bool
+	}{
+		{
+			name:                "cluster mode",
+			mode:                v1beta2.ClusterMode,
+			expectedCPU:         "2500m",
+			expectedMemory:      "6Gi",
+			expectedDriverLabel: true,
+		},
+		{
+			name:                "client mode",
+			mode:                v1beta2.ClientMode,
+			expectedCPU:         "1500m",
+			expectedMemory:      "4608Mi",
+			expectedDriverLabel: false,
+		},
+		{
+			name:                "in-cluster client mode",
+			mode:                v1beta2.InClusterClientMode,
+			expectedCPU:         "2500m",
+			expectedMemory:      "6Gi",
+			expectedDriverLabel: true,
+		},
+	}
+
+	for _, testcase := range testcases {
+		c := &CoschedulingBatchScheduler{dynamicClient: dynamicfake.NewSimpleDynamicClient(scheme.Scheme)}
+		app := app.DeepCopy()
+		app.Spec.Mode = testcase.mode
+		if err := c.DoBatchSchedulingOnSubmission(app); err != nil {
+			t.Fatalf("%s: %v", testcase.name, err)
+		}
+
+		pg := getPodGroup(t, c, app)
+		assert.Equal(t, "spark-foo-pg", pg.Name, testcase.name)
+		assert.Equal(t, int32(1), pg.Spec.MinMember, testcase.name)
+		assert.Equal(t, int32(60), *pg.Spec.ScheduleTimeoutSeconds, testcase.name)
+		minResources := *pg.Spec.MinResources
+		cpu, memory := minResources[corev1.ResourceCPU], minResources[corev1.ResourceMemory]
+		assert.True(t, resource.MustParse(testcase.expectedCPU).Equal(cpu), "%s: unexpected cpu %s", testcase.name, cpu.String())
+		assert.True(t, resource.MustParse(testcase.expectedMemory).Equal(memory), "%s: unexpected memory %s", testcase.name, memory.String())
+
+		assert.Equal(t, "spark-foo-pg", app.Spec.Executor.Labels[PodGroupLabel], testcase.name)
+		_, ok := app.Spec.Driver.Labels[PodGroupLabel]
+		assert.Equal(t, testcase.expectedDriverLabel, ok, testcase.name)
+
+		// PodGroups are deleted on completion.
+		assert.NoError(t, c.CleanupOnCompletion(app), testcase.name)
+		_, err := c.dynamicClient.Resource(podGroupResource).Namespace(app.Namespace).Get(context.TODO(), getAppPodGroupName(app), metav1.GetOptions{})
+		assert.True(t, errors.IsNotFound(err), testcase.name)
+		assert.NoError(t, c.CleanupOnCompletion(app), testcase.name)
+	}
+}
+
+func TestDoBatchSchedulingOnSubmissionWithUnsupportedMode(t *testing.T) {
+	c := &CoschedulingBatchScheduler{dynamicClient: dynamicfake.NewSimpleDynamicClient(scheme.Scheme)}
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type: v1beta2.ScalaApplicationType,
+			Mode: "unknown",
+		},
+	}
+	assert.Error(t, c.DoBatchSchedulingOnSubmission(app))
+	_, err := c.dynamicClient.Resource(podGroupResource).Namespace(app.Namespace).Get(context.TODO(), getAppPodGroupName(app), metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+}
+
+func TestDoBatchSchedulingOnSubmissionWithResources(t *testing.T) {
+	c := &CoschedulingBatchScheduler{dynamicClient: dynamicfake.NewSimpleDynamicClient(scheme.Scheme)}
+	instances := int32(3)
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type: v1beta2.ScalaApplicationType,
+			Mode: v1beta2.ClusterMode,
+			BatchSchedulerOptions: &v1beta2.BatchSchedulerConfiguration{
+				Resources: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("8"),
+					corev1.ResourceMemory: resource.MustParse("16Gi"),
+				},
+			},
+			Executor: v1beta2.ExecutorSpec{
+				Instances: &instances,
+			},
+		},
+	}
+	if err := c.DoBatchSchedulingOnSubmission(app); err != nil {
+		t.Fatal(err)
+	}
+
+	pg := getPodGroup(t, c, app)
+	assert.Equal(t, app.Spec.BatchSchedulerOptions.Resources, *pg.Spec.MinResources)
+
+	// The PodGroup of an application submitted again is reused.
+	resubmitted := app.DeepCopy()
+	resubmitted.Spec.BatchSchedulerOptions.Resources = nil
+	assert.NoError(t, c.DoBatchSchedulingOnSubmission(resubmitted))
+	pg = getPodGroup(t, c, app)
+	assert.Equal(t, app.Spec.BatchSchedulerOptions.Resources, *pg.Spec.MinResources)
+}
+
+func TestSchedulerName(t *testing.T) {
+	c := &CoschedulingBatchScheduler{}
+	assert.Equal(t, DefaultSchedulerName, c.SchedulerName(""))
+	assert.Equal(t, "my-scheduler", c.SchedulerName("my-scheduler"))
+}
@@ -26,4 +26,27 @@ type BatchScheduler interface {
 	ShouldSchedule(app *v1beta2.SparkApplication) bool
 	DoBatchSchedulingOnSubmission(app *v1beta2.SparkApplication) error
 	CleanupOnCompletion(app *v1beta2.SparkApplication) error
+
+	// SchedulerName returns the scheduler the pods of the applications the batch scheduler schedules are
+	// scheduled by, given the one the driver or executors are configured with, which is empty if none is.
+	SchedulerName(schedulerName string) string
+}
+
+// PreemptingBatchScheduler is implemented by batch schedulers that may preempt applications they admitted.
+type PreemptingBatchScheduler interface {
+	BatchScheduler
+
+	// IsPreempted tells if the given submitted application was preempted, and why, in which case it must be
+	// stopped and submitted again once it is admitted again.
+	IsPreempted(app *v1beta2.SparkApplication) (bool, string, error)
+}
+
+// PendingAdmissionError is returned by DoBatchSchedulingOnSubmission if the application must not be submitted
+// until the batch scheduler admits it.
+type PendingAdmissionError struct {
+	Reason string
+}
+
+func (e *PendingAdmissionError) Error() string {
+	return e.Reason
 }
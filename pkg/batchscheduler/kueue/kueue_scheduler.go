@@ -0,0 +1,407 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kueue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	schedulerinterface "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/batchscheduler/interface"
+	batchschedulerutil "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/batchscheduler/util"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/webhook/resourceusage"
+)
+
+const (
+	WorkloadName = "workloads.kueue.x-k8s.io"
+
+	// defaultQueueName is the LocalQueue Kueue defaults jobs without a queue to.
+	defaultQueueName = "default"
+
+	driverPodSetName   = "driver"
+	executorPodSetName = "executor"
+
+	// Conditions of Workloads, see https://kueue.sigs.k8s.io/docs/concepts/workload/.
+	workloadQuotaReserved = "QuotaReserved"
+	workloadAdmitted      = "Admitted"
+	workloadEvicted       = "Evicted"
+	workloadFinished      = "Finished"
+
+	priorityClassSource = "scheduling.k8s.io/priorityclass"
+)
+
+var (
+	workloadResource       = schema.GroupVersionResource{Group: "kueue.x-k8s.io", Version: "v1beta1", Resource: "workloads"}
+	resourceFlavorResource = schema.GroupVersionResource{Group: "kueue.x-k8s.io", Version: "v1beta1", Resource: "resourceflavors"}
+)
+
+// The following types are the subset of the Kueue v1beta1 API used by the operator.
+
+type workload struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              workloadSpec   `json:"spec"`
+	Status            workloadStatus `json:"status,omitempty"`
+}
+
+type workloadSpec struct {
+	PodSets             []podSet `json:"podSets"`
+	QueueName           string   `json:"queueName,omitempty"`
+	PriorityClassName   string   `json:"priorityClassName,omitempty"`
+	Priority            *int32   `json:"priority,omitempty"`
+	PriorityClassSource string   `json:"priorityClassSource,omitempty"`
+}
+
+type podSet struct {
+	Name     string                 `json:"name"`
+	Template corev1.PodTemplateSpec `json:"template"`
+	Count    int32                  `json:"count"`
+}
+
+type workloadStatus struct {
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	Admission  *admission         `json:"admission,omitempty"`
+}
+
+type admission struct {
+	ClusterQueue      string             `json:"clusterQueue"`
+	PodSetAssignments []podSetAssignment `json:"podSetAssignments"`
+}
+
+type podSetAssignment struct {
+	Name    string                         `json:"name"`
+	Flavors map[corev1.ResourceName]string `json:"flavors,omitempty"`
+}
+
+type resourceFlavor struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              resourceFlavorSpec `json:"spec,omitempty"`
+}
+
+type resourceFlavorSpec struct {
+	NodeLabels  map[string]string   `json:"nodeLabels,omitempty"`
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+}
+
+type KueueBatchScheduler struct {
+	dynamicClient dynamic.Interface
+	kubeClient    kubernetes.Interface
+}
+
+func GetPluginName() string {
+	return "kueue"
+}
+
+func (k *KueueBatchScheduler) Name() string {
+	return GetPluginName()
+}
+
+func (k *KueueBatchScheduler) ShouldSchedule(app *v1beta2.SparkApplication) bool {
+	//NOTE: There is no additional requirement for kueue
+	return true
+}
+
+// SchedulerName keeps the scheduler of the pods, as Kueue only admits applications.
+func (k *KueueBatchScheduler) SchedulerName(schedulerName string) string {
+	return schedulerName
+}
+
+// DoBatchSchedulingOnSubmission creates the Workload of the application, and returns a PendingAdmissionError
+// until Kueue admits it. The node selectors and tolerations of the flavors assigned to the admitted Workload
+// are then recorded on the driver and executors, whose pods the webhook adds them to.
+func (k *KueueBatchScheduler) DoBatchSchedulingOnSubmission(app *v1beta2.SparkApplication) error {
+	wl, err := k.getWorkload(app)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		if err := k.createWorkload(app); err != nil {
+			return fmt.Errorf("failed to create Workload with error: %s. Abandon queueing the application via kueue", err)
+		}
+		return &schedulerinterface.PendingAdmissionError{
+			Reason: fmt.Sprintf("Workload %s/%s is waiting to be admitted by Kueue", app.Namespace, getAppWorkloadName(app)),
+		}
+	}
+
+	if !wl.DeletionTimestamp.IsZero() {
+		return &schedulerinterface.PendingAdmissionError{
+			Reason: fmt.Sprintf("the previous Workload %s/%s is being deleted", wl.Namespace, wl.Name),
+		}
+	}
+	// A Workload of a previous run, or one evicted before the application was submitted, is replaced.
+	if meta.IsStatusConditionTrue(wl.Status.Conditions, workloadFinished) || meta.IsStatusConditionTrue(wl.Status.Conditions, workloadEvicted) {
+		if err := k.deleteWorkload(app); err != nil {
+			return err
+		}
+		return &schedulerinterface.PendingAdmissionError{
+			Reason: fmt.Sprintf("the previous Workload %s/%s is being deleted", wl.Namespace, wl.Name),
+		}
+	}
+	if !meta.IsStatusConditionTrue(wl.Status.Conditions, workloadAdmitted) || wl.Status.Admission == nil {
+		reason := fmt.Sprintf("Workload %s/%s is waiting to be admitted by Kueue", wl.Namespace, wl.Name)
+		if condition := meta.FindStatusCondition(wl.Status.Conditions, workloadQuotaReserved); condition != nil && condition.Message != "" {
+			reason = fmt.Sprintf("%s: %s", reason, condition.Message)
+		}
+		return &schedulerinterface.PendingAdmissionError{Reason: reason}
+	}
+
+	for _, assignment := range wl.Status.Admission.PodSetAssignments {
+		var podSpec *v1beta2.SparkPodSpec
+		switch assignment.Name {
+		case driverPodSetName:
+			podSpec = &app.Spec.Driver.SparkPodSpec
+		case executorPodSetName:
+			podSpec = &app.Spec.Executor.SparkPodSpec
+		default:
+			continue
+		}
+		if err := k.applyFlavors(podSpec, assignment); err != nil {
+			return err
+		}
+	}
+	glog.V(2).Infof("Workload %s/%s of SparkApplication %s/%s is admitted by ClusterQueue %s", wl.Namespace, wl.Name, app.Namespace, app.Name, wl.Status.Admission.ClusterQueue)
+	return nil
+}
+
+// IsPreempted tells if the Workload of the given application was evicted, e.g., by a Workload of higher priority.
+func (k *KueueBatchScheduler) IsPreempted(app *v1beta2.SparkApplication) (bool, string, error) {
+	wl, err := k.getWorkload(app)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, "", nil
+		}
+		return false, "", err
+	}
+	condition := meta.FindStatusCondition(wl.Status.Conditions, workloadEvicted)
+	if condition == nil || condition.Status != metav1.ConditionTrue {
+		return false, "", nil
+	}
+	return true, fmt.Sprintf("Workload %s/%s was evicted by Kueue: %s", wl.Namespace, wl.Name, condition.Message), nil
+}
+
+func (k *KueueBatchScheduler) CleanupOnCompletion(app *v1beta2.SparkApplication) error {
+	return k.deleteWorkload(app)
+}
+
+func New(config *rest.Config) (schedulerinterface.BatchScheduler, error) {
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize dynamic client with error %v", err)
+	}
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize k8s client with error %v", err)
+	}
+	extClient, err := apiextensionsclient.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize k8s extension client with error %v", err)
+	}
+
+	if _, err := extClient.ApiextensionsV1().CustomResourceDefinitions().Get(
+		context.TODO(),
+		WorkloadName,
+		metav1.GetOptions{},
+	); err != nil {
+		return nil, fmt.Errorf("workload CRD is required to exists in current cluster error: %s", err)
+	}
+	return &KueueBatchScheduler{
+		dynamicClient: dynamicClient,
+		kubeClient:    kubeClient,
+	}, nil
+}
+
+func getAppWorkloadName(app *v1beta2.SparkApplication) string {
+	return fmt.Sprintf("spark-%s-workload", app.Name)
+}
+
+func (k *KueueBatchScheduler) getWorkload(app *v1beta2.SparkApplication) (*workload, error) {
+	obj, err := k.dynamicClient.Resource(workloadResource).Namespace(app.Namespace).Get(context.TODO(), getAppWorkloadName(app), metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	wl := &workload{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, wl); err != nil {
+		return nil, fmt.Errorf("failed to parse Workload %s/%s: %v", obj.GetNamespace(), obj.GetName(), err)
+	}
+	return wl, nil
+}
+
+func (k *KueueBatchScheduler) createWorkload(app *v1beta2.SparkApplication) error {
+	wl := workload{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: workloadResource.GroupVersion().String(),
+			Kind:       "Workload",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: app.Namespace,
+			Name:      getAppWorkloadName(app),
+			Labels:    map[string]string{config.SparkAppNameLabel: app.Name},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(app, v1beta2.SchemeGroupVersion.WithKind("SparkApplication")),
+			},
+		},
+		Spec: workloadSpec{
+			QueueName: defaultQueueName,
+		},
+	}
+
+	// In client mode, the driver doesn't run in a pod created by the operator.
+	if app.Spec.Mode != v1beta2.ClientMode {
+		requests, err := resourceusage.DriverPodResources(app.Spec)
+		if err != nil {
+			return fmt.Errorf("failed to compute the resources of the driver: %v", err)
+		}
+		driver := newPodSet(app, driverPodSetName, 1, app.Spec.Driver.SparkPodSpec, requests, config.SparkDriverContainerName)
+		wl.Spec.PodSets = append(wl.Spec.PodSets, driver)
+	}
+	requests, err := resourceusage.ExecutorPodResources(app.Spec)
+	if err != nil {
+		return fmt.Errorf("failed to compute the resources of the executors: %v", err)
+	}
+	executors := int32(resourceusage.InitialExecutors(app.Spec))
+	executor := newPodSet(app, executorPodSetName, executors, app.Spec.Executor.SparkPodSpec, requests, config.SparkExecutorContainerName)
+	wl.Spec.PodSets = append(wl.Spec.PodSets, executor)
+
+	if app.Spec.BatchSchedulerOptions != nil {
+		//Update workload queue if it's specified in Spark Application
+		if app.Spec.BatchSchedulerOptions.Queue != nil {
+			wl.Spec.QueueName = *app.Spec.BatchSchedulerOptions.Queue
+		}
+		//Update workload priority if a priorityClassName is specified in Spark Application
+		if app.Spec.BatchSchedulerOptions.PriorityClassName != nil {
+			priorityClass, err := k.kubeClient.SchedulingV1().PriorityClasses().Get(context.TODO(), *app.Spec.BatchSchedulerOptions.PriorityClassName, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			wl.Spec.PriorityClassName = priorityClass.Name
+			wl.Spec.Priority = &priorityClass.Value
+			wl.Spec.PriorityClassSource = priorityClassSource
+		}
+	}
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&wl)
+	if err != nil {
+		return err
+	}
+	// The status is owned by Kueue.
+	delete(obj, "status")
+	glog.V(2).Infof("Creating Workload %s/%s in LocalQueue %s", wl.Namespace, wl.Name, wl.Spec.QueueName)
+	_, err = k.dynamicClient.Resource(workloadResource).Namespace(app.Namespace).Create(context.TODO(), &unstructured.Unstructured{Object: obj}, metav1.CreateOptions{})
+	return err
+}
+
+func (k *KueueBatchScheduler) deleteWorkload(app *v1beta2.SparkApplication) error {
+	err := k.dynamicClient.Resource(workloadResource).Namespace(app.Namespace).Delete(context.TODO(), getAppWorkloadName(app), metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// applyFlavors records the node labels and tolerations of the flavors of the given assignment on the pods of
+// the given pod spec, which the webhook adds them to.
+func (k *KueueBatchScheduler) applyFlavors(podSpec *v1beta2.SparkPodSpec, assignment podSetAssignment) error {
+	var nodeSelector map[string]string
+	var tolerations []corev1.Toleration
+	applied := make(map[string]bool)
+	for _, name := range assignment.Flavors {
+		if applied[name] {
+			continue
+		}
+		applied[name] = true
+
+		obj, err := k.dynamicClient.Resource(resourceFlavorResource).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get ResourceFlavor %s: %v", name, err)
+		}
+		flavor := &resourceFlavor{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, flavor); err != nil {
+			return fmt.Errorf("failed to parse ResourceFlavor %s: %v", name, err)
+		}
+		nodeSelector = batchschedulerutil.MergeMaps(nodeSelector, flavor.Spec.NodeLabels)
+		tolerations = append(tolerations, flavor.Spec.Tolerations...)
+	}
+
+	if podSpec.Annotations == nil {
+		podSpec.Annotations = make(map[string]string)
+	}
+	delete(podSpec.Annotations, config.NodeSelectorAnnotation)
+	delete(podSpec.Annotations, config.TolerationsAnnotation)
+	if len(nodeSelector) > 0 {
+		value, err := json.Marshal(nodeSelector)
+		if err != nil {
+			return err
+		}
+		podSpec.Annotations[config.NodeSelectorAnnotation] = string(value)
+	}
+	if len(tolerations) > 0 {
+		value, err := json.Marshal(tolerations)
+		if err != nil {
+			return err
+		}
+		podSpec.Annotations[config.TolerationsAnnotation] = string(value)
+	}
+	return nil
+}
+
+// newPodSet returns the pod set of the given number of pods with the given spec and requests of the given
+// application.
+func newPodSet(
+	app *v1beta2.SparkApplication,
+	name string,
+	count int32,
+	spec v1beta2.SparkPodSpec,
+	requests corev1.ResourceList,
+	containerName string) podSet {
+	container := corev1.Container{
+		Name:      containerName,
+		Resources: corev1.ResourceRequirements{Requests: requests},
+	}
+	if spec.Image != nil {
+		container.Image = *spec.Image
+	} else if app.Spec.Image != nil {
+		container.Image = *app.Spec.Image
+	}
+	return podSet{
+		Name:  name,
+		Count: count,
+		Template: corev1.PodTemplateSpec{
+			Spec: corev1.PodSpec{
+				Containers:   []corev1.Container{container},
+				NodeSelector: batchschedulerutil.PodNodeSelector(app, spec),
+				Tolerations:  spec.Tolerations,
+				Affinity:     spec.Affinity,
+			},
+		},
+	}
+}
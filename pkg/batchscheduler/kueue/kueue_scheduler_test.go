@@ -0,0 +1,243 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kueue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubeclientfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	schedulerinterface "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/batchscheduler/interface"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+)
+
+// updateWorkloadStatus sets the status of the Workload of the given application as Kueue would.
+func updateWorkloadStatus(t *testing.T, k *KueueBatchScheduler, app *v1beta2.SparkApplication, status workloadStatus) {
+	wl, err := k.getWorkload(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wl.Status = status
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(wl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = k.dynamicClient.Resource(workloadResource).Namespace(app.Namespace).Update(context.TODO(), &unstructured.Unstructured{Object: obj}, metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDoBatchSchedulingOnSubmission(t *testing.T) {
+	flavor, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&resourceFlavor{
+		TypeMeta:   metav1.TypeMeta{APIVersion: resourceFlavorResource.GroupVersion().String(), Kind: "ResourceFlavor"},
+		ObjectMeta: metav1.ObjectMeta{Name: "spot"},
+		Spec: resourceFlavorSpec{
+			NodeLabels:  map[string]string{"instance-type": "spot"},
+			Tolerations: []corev1.Toleration{{Key: "spot", Operator: corev1.TolerationOpExists}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &KueueBatchScheduler{
+		dynamicClient: dynamicfake.NewSimpleDynamicClient(scheme.Scheme, &unstructured.Unstructured{Object: flavor}),
+		kubeClient: kubeclientfake.NewSimpleClientset(&schedulingv1.PriorityClass{
+			ObjectMeta: metav1.ObjectMeta{Name: "high"},
+			Value:      1000,
+		}),
+	}
+	oneCore := int32(1)
+	halfCoreStr := "500m"
+	oneGB := "1g"
+	overhead := "512m"
+	instances := int32(3)
+	queue := "spark"
+	priorityClassName := "high"
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type:         v1beta2.ScalaApplicationType,
+			Mode:         v1beta2.ClusterMode,
+			NodeSelector: map[string]string{"pool": "spark"},
+			BatchSchedulerOptions: &v1beta2.BatchSchedulerConfiguration{
+				Queue:             &queue,
+				PriorityClassName: &priorityClassName,
+			},
+			Driver: v1beta2.DriverSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					Cores:          &oneCore,
+					Memory:         &oneGB,
+					MemoryOverhead: &overhead,
+				},
+			},
+			Executor: v1beta2.ExecutorSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					Cores:          &oneCore,
+					Memory:         &oneGB,
+					MemoryOverhead: &overhead,
+				},
+				CoreRequest: &halfCoreStr,
+				Instances:   &instances,
+			},
+		},
+	}
+
+	// The Workload is created and the application waits for it to be admitted.
+	err = k.DoBatchSchedulingOnSubmission(app.DeepCopy())
+	assert.IsType(t, &schedulerinterface.PendingAdmissionError{}, err)
+	wl, err := k.getWorkload(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "spark-foo-workload", wl.Name)
+	assert.Equal(t, "spark", wl.Spec.QueueName)
+	assert.Equal(t, "high", wl.Spec.PriorityClassName)
+	assert.Equal(t, int32(1000), *wl.Spec.Priority)
+	if assert.Len(t, wl.Spec.PodSets, 2) {
+		driver := wl.Spec.PodSets[0]
+		assert.Equal(t, driverPodSetName, driver.Name)
+		assert.Equal(t, int32(1), driver.Count)
+		requests := driver.Template.Spec.Containers[0].Resources.Requests
+		assert.True(t, resource.MustParse("1").Equal(requests[corev1.ResourceCPU]))
+		assert.True(t, resource.MustParse("1536Mi").Equal(requests[corev1.ResourceMemory]))
+		assert.Equal(t, map[string]string{"pool": "spark"}, driver.Template.Spec.NodeSelector)
+
+		executor := wl.Spec.PodSets[1]
+		assert.Equal(t, executorPodSetName, executor.Name)
+		assert.Equal(t, int32(3), executor.Count)
+		requests = executor.Template.Spec.Containers[0].Resources.Requests
+		assert.True(t, resource.MustParse("500m").Equal(requests[corev1.ResourceCPU]))
+		assert.True(t, resource.MustParse("1536Mi").Equal(requests[corev1.ResourceMemory]))
+	}
+
+	// The reason the Workload isn't admitted yet is reported.
+	updateWorkloadStatus(t, k, app, workloadStatus{
+		Conditions: []metav1.Condition{{Type: workloadQuotaReserved, Status: metav1.ConditionFalse, Reason: "Pending", Message: "insufficient quota"}},
+	})
+	err = k.DoBatchSchedulingOnSubmission(app.DeepCopy())
+	assert.EqualError(t, err, "Workload default/spark-foo-workload is waiting to be admitted by Kueue: insufficient quota")
+
+	// The flavors of the admitted Workload are recorded on the pods.
+	updateWorkloadStatus(t, k, app, workloadStatus{
+		Conditions: []metav1.Condition{{Type: workloadAdmitted, Status: metav1.ConditionTrue, Reason: "Admitted"}},
+		Admission: &admission{
+			ClusterQueue: "cluster-queue",
+			PodSetAssignments: []podSetAssignment{
+				{Name: driverPodSetName, Flavors: map[corev1.ResourceName]string{corev1.ResourceCPU: "spot", corev1.ResourceMemory: "spot"}},
+				{Name: executorPodSetName, Flavors: map[corev1.ResourceName]string{corev1.ResourceCPU: "spot"}},
+			},
+		},
+	})
+	admitted := app.DeepCopy()
+	assert.NoError(t, k.DoBatchSchedulingOnSubmission(admitted))
+	for _, pod := range []v1beta2.SparkPodSpec{admitted.Spec.Driver.SparkPodSpec, admitted.Spec.Executor.SparkPodSpec} {
+		assert.Equal(t, `{"instance-type":"spot"}`, pod.Annotations[config.NodeSelectorAnnotation])
+		assert.Equal(t, `[{"key":"spot","operator":"Exists"}]`, pod.Annotations[config.TolerationsAnnotation])
+	}
+	assert.Empty(t, admitted.Spec.Driver.NodeSelector)
+	assert.Empty(t, admitted.Spec.Driver.Tolerations)
+
+	// Workloads are deleted on completion.
+	assert.NoError(t, k.CleanupOnCompletion(app))
+	_, err = k.getWorkload(app)
+	assert.True(t, errors.IsNotFound(err))
+	assert.NoError(t, k.CleanupOnCompletion(app))
+}
+
+func TestDoBatchSchedulingOnSubmissionInClientMode(t *testing.T) {
+	k := &KueueBatchScheduler{
+		dynamicClient: dynamicfake.NewSimpleDynamicClient(scheme.Scheme),
+		kubeClient:    kubeclientfake.NewSimpleClientset(),
+	}
+	instances := int32(2)
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type: v1beta2.ScalaApplicationType,
+			Mode: v1beta2.ClientMode,
+			Executor: v1beta2.ExecutorSpec{
+				Instances: &instances,
+			},
+		},
+	}
+
+	err := k.DoBatchSchedulingOnSubmission(app)
+	assert.IsType(t, &schedulerinterface.PendingAdmissionError{}, err)
+	wl, err := k.getWorkload(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, defaultQueueName, wl.Spec.QueueName)
+	assert.Nil(t, wl.Spec.Priority)
+	if assert.Len(t, wl.Spec.PodSets, 1) {
+		assert.Equal(t, executorPodSetName, wl.Spec.PodSets[0].Name)
+	}
+}
+
+func TestIsPreempted(t *testing.T) {
+	k := &KueueBatchScheduler{
+		dynamicClient: dynamicfake.NewSimpleDynamicClient(scheme.Scheme),
+		kubeClient:    kubeclientfake.NewSimpleClientset(),
+	}
+	instances := int32(2)
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type: v1beta2.ScalaApplicationType,
+			Mode: v1beta2.ClusterMode,
+			Executor: v1beta2.ExecutorSpec{
+				Instances: &instances,
+			},
+		},
+	}
+
+	preempted, _, err := k.IsPreempted(app)
+	assert.NoError(t, err)
+	assert.False(t, preempted)
+
+	assert.IsType(t, &schedulerinterface.PendingAdmissionError{}, k.DoBatchSchedulingOnSubmission(app.DeepCopy()))
+	preempted, _, err = k.IsPreempted(app)
+	assert.NoError(t, err)
+	assert.False(t, preempted)
+
+	updateWorkloadStatus(t, k, app, workloadStatus{
+		Conditions: []metav1.Condition{{Type: workloadEvicted, Status: metav1.ConditionTrue, Reason: "Preempted", Message: "Preempted to accommodate a higher priority Workload"}},
+	})
+	preempted, reason, err := k.IsPreempted(app)
+	assert.NoError(t, err)
+	assert.True(t, preempted)
+	assert.Equal(t, "Workload default/spark-foo-workload was evicted by Kueue: Preempted to accommodate a higher priority Workload", reason)
+
+	// An evicted Workload is replaced when the application is submitted again.
+	err = k.DoBatchSchedulingOnSubmission(app.DeepCopy())
+	assert.EqualError(t, err, "the previous Workload default/spark-foo-workload is being deleted")
+	_, err = k.getWorkload(app)
+	assert.True(t, errors.IsNotFound(err))
+}
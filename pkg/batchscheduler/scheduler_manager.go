@@ -22,14 +22,20 @@ import (
 
 	"k8s.io/client-go/rest"
 
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/batchscheduler/coscheduling"
 	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/batchscheduler/interface"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/batchscheduler/kueue"
 	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/batchscheduler/volcano"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/batchscheduler/yunikorn"
 )
 
 type schedulerInitializeFunc func(config *rest.Config) (schedulerinterface.BatchScheduler, error)
 
 var schedulerContainers = map[string]schedulerInitializeFunc{
-	volcano.GetPluginName(): volcano.New,
+	coscheduling.GetPluginName(): coscheduling.New,
+	kueue.GetPluginName():        kueue.New,
+	volcano.GetPluginName():      volcano.New,
+	yunikorn.GetPluginName():     yunikorn.New,
 }
 
 func GetRegisteredNames() []string {
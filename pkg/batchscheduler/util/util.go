@@ -0,0 +1,43 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package util contains utility code shared by the batch schedulers.
+package util
+
+import (
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+)
+
+// MergeMaps returns the union of the given maps, where the values of the second one win.
+func MergeMaps(m1, m2 map[string]string) map[string]string {
+	if len(m1) == 0 && len(m2) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(m1)+len(m2))
+	for key, value := range m1 {
+		merged[key] = value
+	}
+	for key, value := range m2 {
+		merged[key] = value
+	}
+	return merged
+}
+
+// PodNodeSelector returns the node selector of the pods with the given spec of the given application, where the
+// node selector of the spec wins over the one of the application.
+func PodNodeSelector(app *v1beta2.SparkApplication, spec v1beta2.SparkPodSpec) map[string]string {
+	return MergeMaps(app.Spec.NodeSelector, spec.NodeSelector)
+}
@@ -56,6 +56,10 @@ func (v *VolcanoBatchScheduler) ShouldSchedule(app *v1beta2.SparkApplication) bo
 	return true
 }
 
+func (v *VolcanoBatchScheduler) SchedulerName(schedulerName string) string {
+	return GetPluginName()
+}
+
 func (v *VolcanoBatchScheduler) DoBatchSchedulingOnSubmission(app *v1beta2.SparkApplication) error {
 	if app.Spec.Executor.Annotations == nil {
 		app.Spec.Executor.Annotations = make(map[string]string)
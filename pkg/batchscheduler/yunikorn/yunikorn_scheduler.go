@@ -0,0 +1,161 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package yunikorn
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	schedulerinterface "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/batchscheduler/interface"
+	batchschedulerutil "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/batchscheduler/util"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/webhook/resourceusage"
+)
+
+const (
+	// ApplicationIDLabel is the label YuniKorn groups pods into applications by.
+	ApplicationIDLabel = "applicationId"
+	// QueueLabel is the label YuniKorn reads the queue of an application from.
+	QueueLabel = "queue"
+	// TaskGroupNameAnnotation is the annotation naming the task group a pod belongs to.
+	TaskGroupNameAnnotation = "yunikorn.apache.org/task-group-name"
+	// TaskGroupsAnnotation is the annotation defining the task groups of an application, which YuniKorn reserves
+	// resources for before scheduling any of its pods.
+	TaskGroupsAnnotation = "yunikorn.apache.org/task-groups"
+
+	driverTaskGroupName   = "spark-driver"
+	executorTaskGroupName = "spark-executor"
+)
+
+// taskGroup is a group of identical pods of an application that YuniKorn gang schedules, as documented in
+// https://yunikorn.apache.org/docs/user_guide/gang_scheduling.
+type taskGroup struct {
+	Name         string              `json:"name"`
+	MinMember    int32               `json:"minMember"`
+	MinResource  corev1.ResourceList `json:"minResource"`
+	NodeSelector map[string]string   `json:"nodeSelector,omitempty"`
+	Tolerations  []corev1.Toleration `json:"tolerations,omitempty"`
+	Affinity     *corev1.Affinity    `json:"affinity,omitempty"`
+}
+
+type YuniKornBatchScheduler struct{}
+
+func GetPluginName() string {
+	return "yunikorn"
+}
+
+func (y *YuniKornBatchScheduler) Name() string {
+	return GetPluginName()
+}
+
+func (y *YuniKornBatchScheduler) ShouldSchedule(app *v1beta2.SparkApplication) bool {
+	//NOTE: There is no additional requirement for yunikorn scheduler
+	return true
+}
+
+func (y *YuniKornBatchScheduler) SchedulerName(schedulerName string) string {
+	return GetPluginName()
+}
+
+func (y *YuniKornBatchScheduler) DoBatchSchedulingOnSubmission(app *v1beta2.SparkApplication) error {
+	driverResources, err := resourceusage.DriverPodResources(app.Spec)
+	if err != nil {
+		return fmt.Errorf("failed to compute the resources of the driver: %v", err)
+	}
+	executorResources, err := resourceusage.ExecutorPodResources(app.Spec)
+	if err != nil {
+		return fmt.Errorf("failed to compute the resources of the executors: %v", err)
+	}
+	driverTaskGroup := newTaskGroup(app, driverTaskGroupName, 1, app.Spec.Driver.SparkPodSpec, driverResources)
+	executors := int32(resourceusage.InitialExecutors(app.Spec))
+	executorTaskGroup := newTaskGroup(app, executorTaskGroupName, executors, app.Spec.Executor.SparkPodSpec, executorResources)
+
+	schedulerName := GetPluginName()
+	app.Spec.Driver.SchedulerName = &schedulerName
+	app.Spec.Executor.SchedulerName = &schedulerName
+
+	// Every submission is a new YuniKorn application, unless the user chose its ID.
+	applicationID := app.Spec.Driver.Labels[ApplicationIDLabel]
+	if applicationID == "" {
+		applicationID = fmt.Sprintf("spark-%s", strings.ReplaceAll(uuid.New().String(), "-", ""))
+	}
+	labels := map[string]string{ApplicationIDLabel: applicationID}
+	if app.Spec.BatchSchedulerOptions != nil && app.Spec.BatchSchedulerOptions.Queue != nil {
+		labels[QueueLabel] = *app.Spec.BatchSchedulerOptions.Queue
+	}
+	app.Spec.Driver.Labels = batchschedulerutil.MergeMaps(app.Spec.Driver.Labels, labels)
+	app.Spec.Executor.Labels = batchschedulerutil.MergeMaps(app.Spec.Executor.Labels, labels)
+
+	// The task groups are defined on the first pod of the application, which is the driver in cluster mode
+	// and an executor in client mode, where the driver doesn't run in a pod created by the operator.
+	if app.Spec.Mode == v1beta2.ClientMode {
+		taskGroups, err := json.Marshal([]taskGroup{executorTaskGroup})
+		if err != nil {
+			return fmt.Errorf("failed to marshal the YuniKorn task groups: %v", err)
+		}
+		app.Spec.Executor.Annotations = batchschedulerutil.MergeMaps(app.Spec.Executor.Annotations, map[string]string{
+			TaskGroupNameAnnotation: executorTaskGroupName,
+			TaskGroupsAnnotation:    string(taskGroups),
+		})
+		return nil
+	}
+
+	taskGroups, err := json.Marshal([]taskGroup{driverTaskGroup, executorTaskGroup})
+	if err != nil {
+		return fmt.Errorf("failed to marshal the YuniKorn task groups: %v", err)
+	}
+	app.Spec.Driver.Annotations = batchschedulerutil.MergeMaps(app.Spec.Driver.Annotations, map[string]string{
+		TaskGroupNameAnnotation: driverTaskGroupName,
+		TaskGroupsAnnotation:    string(taskGroups),
+	})
+	app.Spec.Executor.Annotations = batchschedulerutil.MergeMaps(app.Spec.Executor.Annotations, map[string]string{
+		TaskGroupNameAnnotation: executorTaskGroupName,
+	})
+	return nil
+}
+
+func (y *YuniKornBatchScheduler) CleanupOnCompletion(app *v1beta2.SparkApplication) error {
+	//NOTE: YuniKorn releases the resources of an application once all of its pods have completed
+	return nil
+}
+
+func New(config *rest.Config) (schedulerinterface.BatchScheduler, error) {
+	return &YuniKornBatchScheduler{}, nil
+}
+
+// newTaskGroup returns the task group of the given number of pods with the given spec and resources of the given
+// application.
+func newTaskGroup(
+	app *v1beta2.SparkApplication,
+	name string,
+	minMember int32,
+	spec v1beta2.SparkPodSpec,
+	minResource corev1.ResourceList) taskGroup {
+	return taskGroup{
+		Name:         name,
+		MinMember:    minMember,
+		MinResource:  minResource,
+		NodeSelector: batchschedulerutil.PodNodeSelector(app, spec),
+		Tolerations:  spec.Tolerations,
+		Affinity:     spec.Affinity,
+	}
+}
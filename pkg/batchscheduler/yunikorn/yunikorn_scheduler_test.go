@@ -0,0 +1,242 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package yunikorn
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+)
+
+func TestDoBatchSchedulingOnSubmission(t *testing.T) {
+
+	oneCore := int32(1)
+	twoCores := int32(2)
+	halfCoreStr := "500m"
+	oneGB := "1g"
+	overhead := "512m"
+	instances := int32(3)
+	minExecutors := int32(4)
+	queue := "root.spark"
+
+	toleration := v1.Toleration{Key: "spark", Operator: v1.TolerationOpExists}
+
+	newApp := func(mode v1beta2.DeployMode) v1beta2.SparkApplication {
+		return v1beta2.SparkApplication{
+			Spec: v1beta2.SparkApplicationSpec{
+				Type:         v1beta2.ScalaApplicationType,
+				Mode:         mode,
+				NodeSelector: map[string]string{"pool": "spark"},
+				Driver: v1beta2.DriverSpec{
+					SparkPodSpec: v1beta2.SparkPodSpec{
+						Cores:          &oneCore,
+						Memory:         &oneGB,
+						MemoryOverhead: &overhead,
+						Labels:         map[string]string{"version": "3.1.1"},
+					},
+				},
+				Executor: v1beta2.ExecutorSpec{
+					SparkPodSpec: v1beta2.SparkPodSpec{
+						Cores:          &twoCores,
+						Memory:         &oneGB,
+						MemoryOverhead: &overhead,
+						NodeSelector:   map[string]string{"disk": "ssd"},
+						Tolerations:    []v1.Toleration{toleration},
+					},
+					CoreRequest: &halfCoreStr,
+					Instances:   &instances,
+				},
+			},
+		}
+	}
+
+	clusterMode := newApp(v1beta2.ClusterMode)
+	clusterMode.Spec.BatchSchedulerOptions = &v1beta2.BatchSchedulerConfiguration{Queue: &queue}
+	dynamicAllocation := newApp(v1beta2.ClusterMode)
+	dynamicAllocation.Spec.DynamicAllocation = &v1beta2.DynamicAllocation{Enabled: true, MinExecutors: &minExecutors}
+	clientMode := newApp(v1beta2.ClientMode)
+
+	testcases := []struct {
+		Name              string
+		app               v1beta2.SparkApplication
+		queue             string
+		taskGroups        []taskGroup
+		podWithTaskGroups string
+	}{
+		{
+			Name:  "Validate cluster mode",
+			app:   clusterMode,
+			queue: queue,
+			taskGroups: []taskGroup{
+				{
+					Name:         driverTaskGroupName,
+					MinMember:    1,
+					MinResource:  v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("1536Mi")},
+					NodeSelector: map[string]string{"pool": "spark"},
+				},
+				{
+					Name:         executorTaskGroupName,
+					MinMember:    3,
+					MinResource:  v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m"), v1.ResourceMemory: resource.MustParse("1536Mi")},
+					NodeSelector: map[string]string{"pool": "spark", "disk": "ssd"},
+					Tolerations:  []v1.Toleration{toleration},
+				},
+			},
+			podWithTaskGroups: driverTaskGroupName,
+		},
+		{
+			Name: "Validate dynamic allocation",
+			app:  dynamicAllocation,
+			taskGroups: []taskGroup{
+				{
+					Name:         driverTaskGroupName,
+					MinMember:    1,
+					MinResource:  v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("1536Mi")},
+					NodeSelector: map[string]string{"pool": "spark"},
+				},
+				{
+					Name:         executorTaskGroupName,
+					MinMember:    4,
+					MinResource:  v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m"), v1.ResourceMemory: resource.MustParse("1536Mi")},
+					NodeSelector: map[string]string{"pool": "spark", "disk": "ssd"},
+					Tolerations:  []v1.Toleration{toleration},
+				},
+			},
+			podWithTaskGroups: driverTaskGroupName,
+		},
+		{
+			Name: "Validate client mode",
+			app:  clientMode,
+			taskGroups: []taskGroup{
+				{
+					Name:         executorTaskGroupName,
+					MinMember:    3,
+					MinResource:  v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m"), v1.ResourceMemory: resource.MustParse("1536Mi")},
+					NodeSelector: map[string]string{"pool": "spark", "disk": "ssd"},
+					Tolerations:  []v1.Toleration{toleration},
+				},
+			},
+			podWithTaskGroups: executorTaskGroupName,
+		},
+	}
+
+	scheduler := &YuniKornBatchScheduler{}
+	for _, testcase := range testcases {
+		t.Run(testcase.Name, func(t *testing.T) {
+			app := testcase.app.DeepCopy()
+			if err := scheduler.DoBatchSchedulingOnSubmission(app); err != nil {
+				t.Fatalf("failed to schedule the application: %v", err)
+			}
+
+			for _, pod := range []v1beta2.SparkPodSpec{app.Spec.Driver.SparkPodSpec, app.Spec.Executor.SparkPodSpec} {
+				if pod.SchedulerName == nil || *pod.SchedulerName != GetPluginName() {
+					t.Errorf("expecting pods to be scheduled by %s, while get %v", GetPluginName(), pod.SchedulerName)
+				}
+				if queue := pod.Labels[QueueLabel]; queue != testcase.queue {
+					t.Errorf("expecting pods to have queue %q, while get %q", testcase.queue, queue)
+				}
+			}
+			if app.Spec.Driver.Labels["version"] != "3.1.1" {
+				t.Errorf("expecting the labels of the driver to be kept, while get %v", app.Spec.Driver.Labels)
+			}
+
+			applicationID := app.Spec.Driver.Labels[ApplicationIDLabel]
+			if !strings.HasPrefix(applicationID, "spark-") {
+				t.Errorf("expecting driver pod to have a generated application ID, while get %q", applicationID)
+			}
+			if id := app.Spec.Executor.Labels[ApplicationIDLabel]; id != applicationID {
+				t.Errorf("expecting executor pods to have application ID %q, while get %q", applicationID, id)
+			}
+
+			if name := app.Spec.Executor.Annotations[TaskGroupNameAnnotation]; name != executorTaskGroupName {
+				t.Errorf("expecting executor pods to be in task group %s, while get %q", executorTaskGroupName, name)
+			}
+			annotations := app.Spec.Driver.Annotations
+			if testcase.podWithTaskGroups == executorTaskGroupName {
+				annotations = app.Spec.Executor.Annotations
+				if _, ok := app.Spec.Driver.Annotations[TaskGroupNameAnnotation]; ok {
+					t.Errorf("expecting driver pod to be in no task group in client mode")
+				}
+			} else if name := annotations[TaskGroupNameAnnotation]; name != driverTaskGroupName {
+				t.Errorf("expecting driver pod to be in task group %s, while get %q", driverTaskGroupName, name)
+			}
+
+			var taskGroups []taskGroup
+			if err := json.Unmarshal([]byte(annotations[TaskGroupsAnnotation]), &taskGroups); err != nil {
+				t.Fatalf("failed to unmarshal the task groups %q: %v", annotations[TaskGroupsAnnotation], err)
+			}
+			if len(taskGroups) != len(testcase.taskGroups) {
+				t.Fatalf("expecting %d task groups, while get %d", len(testcase.taskGroups), len(taskGroups))
+			}
+			for i, expected := range testcase.taskGroups {
+				actual := taskGroups[i]
+				if actual.Name != expected.Name || actual.MinMember != expected.MinMember {
+					t.Errorf("expecting task group %s with %d members, while get %s with %d members",
+						expected.Name, expected.MinMember, actual.Name, actual.MinMember)
+				}
+				for name, quantity := range expected.MinResource {
+					if value, ok := actual.MinResource[name]; !ok || quantity.Cmp(value) != 0 {
+						t.Errorf("expecting task group %s to have resource %s with value %s, while get %s",
+							expected.Name, name, quantity.String(), value.String())
+					}
+				}
+				if len(actual.NodeSelector) != len(expected.NodeSelector) {
+					t.Errorf("expecting task group %s to have node selector %v, while get %v",
+						expected.Name, expected.NodeSelector, actual.NodeSelector)
+				}
+				for key, value := range expected.NodeSelector {
+					if actual.NodeSelector[key] != value {
+						t.Errorf("expecting task group %s to have node selector %v, while get %v",
+							expected.Name, expected.NodeSelector, actual.NodeSelector)
+					}
+				}
+				if len(actual.Tolerations) != len(expected.Tolerations) {
+					t.Errorf("expecting task group %s to have tolerations %v, while get %v",
+						expected.Name, expected.Tolerations, actual.Tolerations)
+				}
+			}
+		})
+	}
+}
+
+func TestDoBatchSchedulingOnSubmissionKeepsApplicationID(t *testing.T) {
+	app := &v1beta2.SparkApplication{
+		Spec: v1beta2.SparkApplicationSpec{
+			Mode: v1beta2.ClusterMode,
+			Driver: v1beta2.DriverSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					Labels: map[string]string{ApplicationIDLabel: "my-app"},
+				},
+			},
+		},
+	}
+
+	scheduler := &YuniKornBatchScheduler{}
+	if err := scheduler.DoBatchSchedulingOnSubmission(app); err != nil {
+		t.Fatalf("failed to schedule the application: %v", err)
+	}
+	for _, labels := range []map[string]string{app.Spec.Driver.Labels, app.Spec.Executor.Labels} {
+		if id := labels[ApplicationIDLabel]; id != "my-app" {
+			t.Errorf("expecting pods to have application ID my-app, while get %q", id)
+		}
+	}
+}
@@ -30,6 +30,7 @@ type SparkoperatorV1beta2Interface interface {
 	RESTClient() rest.Interface
 	ScheduledSparkApplicationsGetter
 	SparkApplicationsGetter
+	SparkQuotasGetter
 }
 
 // SparkoperatorV1beta2Client is used to interact with features provided by the sparkoperator.k8s.io group.
@@ -45,6 +46,10 @@ func (c *SparkoperatorV1beta2Client) SparkApplications(namespace string) SparkAp
 	return newSparkApplications(c, namespace)
 }
 
+func (c *SparkoperatorV1beta2Client) SparkQuotas() SparkQuotaInterface {
+	return newSparkQuotas(c)
+}
+
 // NewForConfig creates a new SparkoperatorV1beta2Client for the given config.
 func NewForConfig(c *rest.Config) (*SparkoperatorV1beta2Client, error) {
 	config := *c
@@ -66,6 +66,8 @@ func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Sparkoperator().V1beta2().ScheduledSparkApplications().Informer()}, nil
 	case v1beta2.SchemeGroupVersion.WithResource("sparkapplications"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Sparkoperator().V1beta2().SparkApplications().Informer()}, nil
+	case v1beta2.SchemeGroupVersion.WithResource("sparkquotas"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Sparkoperator().V1beta2().SparkQuotas().Informer()}, nil
 
 	}
 
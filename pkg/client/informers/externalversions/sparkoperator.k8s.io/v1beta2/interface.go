@@ -30,6 +30,8 @@ type Interface interface {
 	ScheduledSparkApplications() ScheduledSparkApplicationInformer
 	// SparkApplications returns a SparkApplicationInformer.
 	SparkApplications() SparkApplicationInformer
+	// SparkQuotas returns a SparkQuotaInformer.
+	SparkQuotas() SparkQuotaInformer
 }
 
 type version struct {
@@ -52,3 +54,8 @@ func (v *version) ScheduledSparkApplications() ScheduledSparkApplicationInformer
 func (v *version) SparkApplications() SparkApplicationInformer {
 	return &sparkApplicationInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
 }
+
+// SparkQuotas returns a SparkQuotaInformer.
+func (v *version) SparkQuotas() SparkQuotaInformer {
+	return &sparkQuotaInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
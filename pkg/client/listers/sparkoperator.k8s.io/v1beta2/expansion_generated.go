@@ -35,3 +35,7 @@ type SparkApplicationListerExpansion interface{}
 // SparkApplicationNamespaceListerExpansion allows custom methods to be added to
 // SparkApplicationNamespaceLister.
 type SparkApplicationNamespaceListerExpansion interface{}
+
+// SparkQuotaListerExpansion allows custom methods to be added to
+// SparkQuotaLister.
+type SparkQuotaListerExpansion interface{}
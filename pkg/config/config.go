@@ -56,3 +56,8 @@ func GetExecutorEnvVarConfOptions(app *v1beta2.SparkApplication) []string {
 func GetPrometheusConfigMapName(app *v1beta2.SparkApplication) string {
 	return fmt.Sprintf("%s-%s", app.Name, PrometheusConfigMapNameSuffix)
 }
+
+// GetSubmissionOutputConfigMapName returns the name of the ConfigMap holding the output of spark-submit.
+func GetSubmissionOutputConfigMapName(app *v1beta2.SparkApplication) string {
+	return fmt.Sprintf("%s-%s", app.Name, SubmissionOutputConfigMapNameSuffix)
+}
@@ -54,6 +54,21 @@ const (
 	SparkExecutorRole = "executor"
 	// SubmissionIDLabel is the label that records the submission ID of the current run of an application.
 	SubmissionIDLabel = LabelAnnotationPrefix + "submission-id"
+	// TraceIDAnnotation is the annotation that records the ID of the trace of an application.
+	TraceIDAnnotation = LabelAnnotationPrefix + "trace-id"
+	// PodTemplateMutationAnnotation is the annotation on Spark pods created from pod templates the controller
+	// rendered the customizations of the application into, which the webhook doesn't mutate again if they carry
+	// all of them.
+	PodTemplateMutationAnnotation = LabelAnnotationPrefix + "pod-template-mutation"
+	// SchedulerNameAnnotation is the annotation on Spark pods that records the scheduler the batch scheduler of
+	// the application has them scheduled by.
+	SchedulerNameAnnotation = LabelAnnotationPrefix + "scheduler-name"
+	// NodeSelectorAnnotation is the annotation on Spark pods that records, as JSON, the node selector the batch
+	// scheduler of the application adds to them.
+	NodeSelectorAnnotation = LabelAnnotationPrefix + "node-selector"
+	// TolerationsAnnotation is the annotation on Spark pods that records, as JSON, the tolerations the batch
+	// scheduler of the application adds to them.
+	TolerationsAnnotation = LabelAnnotationPrefix + "tolerations"
 )
 
 const (
@@ -114,6 +129,16 @@ const (
 	SparkExecutorVolumesPrefix = "spark.kubernetes.executor.volumes."
 	// SparkDriverPodNameKey is the Spark configuration key for driver pod name.
 	SparkDriverPodNameKey = "spark.kubernetes.driver.pod.name"
+	// SparkDriverPodTemplateFileKey is the Spark configuration key for the pod template file of the driver.
+	SparkDriverPodTemplateFileKey = "spark.kubernetes.driver.podTemplateFile"
+	// SparkExecutorPodTemplateFileKey is the Spark configuration key for the pod template file of the executors.
+	SparkExecutorPodTemplateFileKey = "spark.kubernetes.executor.podTemplateFile"
+	// SparkDriverPodTemplateContainerNameKey is the Spark configuration key for the name of the container of the
+	// driver in its pod template.
+	SparkDriverPodTemplateContainerNameKey = "spark.kubernetes.driver.podTemplateContainerName"
+	// SparkExecutorPodTemplateContainerNameKey is the Spark configuration key for the name of the container of
+	// the executors in their pod template.
+	SparkExecutorPodTemplateContainerNameKey = "spark.kubernetes.executor.podTemplateContainerName"
 	// SparkDriverServiceAccountName is the Spark configuration key for specifying name of the Kubernetes service
 	// account used by the driver pod.
 	SparkDriverServiceAccountName = "spark.kubernetes.authenticate.driver.serviceAccountName"
@@ -195,6 +220,17 @@ const (
 	PrometheusConfigMapMountPath = "/etc/metrics/conf"
 )
 
+const (
+	// SubmissionOutputConfigMapNameSuffix is the name suffix of the ConfigMap holding the output of spark-submit.
+	SubmissionOutputConfigMapNameSuffix = "submission-output"
+	// SubmissionOutputStdoutKeyFormat is the format of the key of the standard output of a submission attempt
+	// in the submission output ConfigMap.
+	SubmissionOutputStdoutKeyFormat = "attempt-%d.stdout"
+	// SubmissionOutputStderrKeyFormat is the format of the key of the standard error of a submission attempt
+	// in the submission output ConfigMap.
+	SubmissionOutputStderrKeyFormat = "attempt-%d.stderr"
+)
+
 // DefaultMetricsProperties is the default content of metrics.properties.
 const DefaultMetricsProperties = `
 *.sink.jmx.class=org.apache.spark.metrics.sink.JmxSink
@@ -44,6 +44,7 @@ import (
 	crdinformers "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/informers/externalversions"
 	crdlisters "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/listers/sparkoperator.k8s.io/v1beta2"
 	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/notification"
 )
 
 var (
@@ -59,6 +60,7 @@ type Controller struct {
 	ssaLister        crdlisters.ScheduledSparkApplicationLister
 	saLister         crdlisters.SparkApplicationLister
 	clock            clock.Clock
+	notifier         *notification.Notifier
 }
 
 func NewController(
@@ -66,7 +68,8 @@ func NewController(
 	kubeClient kubernetes.Interface,
 	extensionsClient apiextensionsclient.Interface,
 	informerFactory crdinformers.SharedInformerFactory,
-	clock clock.Clock) *Controller {
+	clock clock.Clock,
+	notifier *notification.Notifier) *Controller {
 	crdscheme.AddToScheme(scheme.Scheme)
 
 	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(),
@@ -78,6 +81,7 @@ func NewController(
 		extensionsClient: extensionsClient,
 		queue:            queue,
 		clock:            clock,
+		notifier:         notifier,
 	}
 
 	informer := informerFactory.Sparkoperator().V1beta2().ScheduledSparkApplications()
@@ -203,7 +207,11 @@ func (c *Controller) syncScheduledSparkApplication(key string) error {
 		}
 	}
 
-	return c.updateScheduledSparkApplicationStatus(app, status)
+	if err := c.updateScheduledSparkApplicationStatus(app, status); err != nil {
+		return err
+	}
+	c.notifyStateTransition(app, status)
+	return nil
 }
 
 func (c *Controller) onAdd(obj interface{}) {
@@ -385,6 +393,21 @@ func (c *Controller) updateScheduledSparkApplicationStatus(
 	})
 }
 
+// notifyStateTransition sends a notification if the schedule state of the application changed to
+// the sinks its spec refers to.
+func (c *Controller) notifyStateTransition(
+	app *v1beta2.ScheduledSparkApplication,
+	newStatus *v1beta2.ScheduledSparkApplicationStatus) {
+	if c.notifier == nil || app.Status.ScheduleState == newStatus.ScheduleState {
+		return
+	}
+	var sinks []v1beta2.NotificationSinkReference
+	if app.Spec.Notifications != nil {
+		sinks = app.Spec.Notifications.Sinks
+	}
+	c.notifier.Notify(notification.NewScheduledSparkApplicationEvent(app, app.Status.ScheduleState, newStatus), sinks)
+}
+
 func (c *Controller) listSparkApplications(app *v1beta2.ScheduledSparkApplication) (sparkApps, error) {
 	set := labels.Set{config.ScheduledSparkAppNameLabel: app.Name}
 	apps, err := c.saLister.SparkApplications(app.Namespace).List(set.AsSelector())
@@ -521,7 +521,7 @@ func newFakeController() (*Controller, *clock.FakeClock) {
 	apiExtensionsClient := apiextensionsfake.NewSimpleClientset()
 	informerFactory := crdinformers.NewSharedInformerFactory(crdClient, 1*time.Second)
 	clk := clock.NewFakeClock(time.Now())
-	controller := NewController(crdClient, kubeClient, apiExtensionsClient, informerFactory, clk)
+	controller := NewController(crdClient, kubeClient, apiExtensionsClient, informerFactory, clk, nil)
 	ssaInformer := informerFactory.Sparkoperator().V1beta2().ScheduledSparkApplications().Informer()
 	saInformer := informerFactory.Sparkoperator().V1beta2().SparkApplications().Informer()
 	crdClient.PrependReactor("create", "scheduledsparkapplications",
@@ -0,0 +1,139 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	schedulerinterface "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/batchscheduler/interface"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+)
+
+const (
+	// batchSchedulerRetryInterval is how often an application waiting for its batch scheduler to admit it is
+	// checked again.
+	batchSchedulerRetryInterval = 10 * time.Second
+	// batchSchedulerPendingAdmissionReason is the reason of the BatchSchedulerAdmitted condition of waiting
+	// applications.
+	batchSchedulerPendingAdmissionReason = "PendingAdmission"
+	// sparkApplicationPreemptedReason is the reason of the event recorded when the batch scheduler of an
+	// application preempts it.
+	sparkApplicationPreemptedReason = "SparkApplicationPreempted"
+)
+
+// batchSchedulerManager gets the batch schedulers applications are scheduled with by name.
+type batchSchedulerManager interface {
+	GetScheduler(schedulerName string) (schedulerinterface.BatchScheduler, error)
+}
+
+// waitForBatchSchedulerAdmission keeps the given application from being submitted until its batch scheduler
+// admits it, and syncs it again later.
+func (c *Controller) waitForBatchSchedulerAdmission(app *v1beta2.SparkApplication, pending *schedulerinterface.PendingAdmissionError) {
+	key := createMetaNamespaceKey(app.Namespace, app.Name)
+	glog.V(2).Infof("SparkApplication %s waits for its batch scheduler to admit it: %s", key, pending.Reason)
+	if !waitingForBatchScheduler(app) {
+		c.recorder.Eventf(app, apiv1.EventTypeNormal, batchSchedulerPendingAdmissionReason, "SparkApplication %s waits for %s to admit it", app.Name, *app.Spec.BatchScheduler)
+	}
+	meta.SetStatusCondition(&app.Status.Conditions, metav1.Condition{
+		Type:    v1beta2.BatchSchedulerAdmittedCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  batchSchedulerPendingAdmissionReason,
+		Message: pending.Reason,
+	})
+	// The application doesn't take room in its SparkQuotas while it is queued by its batch scheduler.
+	c.sparkQuotaEnforcer.Release(app.Namespace, app.Name)
+	c.queue.AddAfter(key, batchSchedulerRetryInterval)
+}
+
+// setPodSchedulerNames records the scheduler the given batch scheduler has the driver and executors of the given
+// application scheduled by on their pods, whose scheduler the webhook sets to it.
+func setPodSchedulerNames(app *v1beta2.SparkApplication, scheduler schedulerinterface.BatchScheduler) {
+	for _, podSpec := range []*v1beta2.SparkPodSpec{&app.Spec.Driver.SparkPodSpec, &app.Spec.Executor.SparkPodSpec} {
+		var schedulerName string
+		if podSpec.SchedulerName != nil {
+			schedulerName = *podSpec.SchedulerName
+		}
+		schedulerName = scheduler.SchedulerName(schedulerName)
+		if schedulerName == "" {
+			continue
+		}
+		if podSpec.Annotations == nil {
+			podSpec.Annotations = make(map[string]string)
+		}
+		podSpec.Annotations[config.SchedulerNameAnnotation] = schedulerName
+	}
+}
+
+// waitingForBatchScheduler tells if the given application waits for its batch scheduler to admit it.
+func waitingForBatchScheduler(app *v1beta2.SparkApplication) bool {
+	return meta.IsStatusConditionFalse(app.Status.Conditions, v1beta2.BatchSchedulerAdmittedCondition)
+}
+
+// waitingForAdmission tells if the given application waits for room in its SparkQuotas or for its batch scheduler
+// to admit it, so that the events about it being added or rerun have already been recorded.
+func waitingForAdmission(app *v1beta2.SparkApplication) bool {
+	return waitingForSparkQuota(app) || waitingForBatchScheduler(app)
+}
+
+// stopIfPreempted stops the given submitted application if its batch scheduler preempted it, and moves it to
+// PendingRerunState so that it is queued again. It returns true if the application was preempted.
+func (c *Controller) stopIfPreempted(app *v1beta2.SparkApplication) (bool, error) {
+	needScheduling, scheduler := c.shouldDoBatchScheduling(app)
+	if !needScheduling {
+		return false, nil
+	}
+	preemptingScheduler, ok := scheduler.(schedulerinterface.PreemptingBatchScheduler)
+	if !ok {
+		return false, nil
+	}
+	preempted, reason, err := preemptingScheduler.IsPreempted(app)
+	if err != nil {
+		// Keep tracking the application, it is checked again on its next sync.
+		glog.Errorf("failed to check whether SparkApplication %s/%s was preempted: %v", app.Namespace, app.Name, err)
+		return false, nil
+	}
+	if !preempted {
+		return false, nil
+	}
+
+	glog.Infof("Stopping SparkApplication %s/%s preempted by %s: %s", app.Namespace, app.Name, scheduler.Name(), reason)
+	c.recorder.Eventf(app, apiv1.EventTypeWarning, sparkApplicationPreemptedReason, "SparkApplication %s was preempted: %s", app.Name, reason)
+	if err := c.deleteSparkResources(app); err != nil {
+		return false, err
+	}
+	if err := scheduler.CleanupOnCompletion(app); err != nil {
+		return false, err
+	}
+	app.Status.AppState.State = v1beta2.PendingRerunState
+	return true, nil
+}
+
+// releaseBatchScheduling releases what the batch scheduler of the given application reserved for its last run,
+// before it is run again.
+func (c *Controller) releaseBatchScheduling(app *v1beta2.SparkApplication) {
+	if needScheduling, scheduler := c.shouldDoBatchScheduling(app); needScheduling {
+		if err := scheduler.CleanupOnCompletion(app); err != nil {
+			glog.Errorf("failed to clean up batch scheduling of SparkApplication %s/%s: %v", app.Namespace, app.Name, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/batchscheduler/coscheduling"
+	schedulerinterface "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/batchscheduler/interface"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+)
+
+// fakeBatchScheduler is a batch scheduler that records the applications it cleaned up after.
+type fakeBatchScheduler struct {
+	cleanedUp []string
+}
+
+func (s *fakeBatchScheduler) Name() string {
+	return "fake"
+}
+
+func (s *fakeBatchScheduler) ShouldSchedule(app *v1beta2.SparkApplication) bool {
+	return true
+}
+
+func (s *fakeBatchScheduler) DoBatchSchedulingOnSubmission(app *v1beta2.SparkApplication) error {
+	return nil
+}
+
+func (s *fakeBatchScheduler) CleanupOnCompletion(app *v1beta2.SparkApplication) error {
+	s.cleanedUp = append(s.cleanedUp, app.Name)
+	return nil
+}
+
+func (s *fakeBatchScheduler) SchedulerName(schedulerName string) string {
+	return schedulerName
+}
+
+// GetScheduler makes the fake batch scheduler the manager of itself.
+func (s *fakeBatchScheduler) GetScheduler(schedulerName string) (schedulerinterface.BatchScheduler, error) {
+	return s, nil
+}
+
+func TestWaitForBatchSchedulerAdmission(t *testing.T) {
+	scheduler := "kueue"
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec:       v1beta2.SparkApplicationSpec{BatchScheduler: &scheduler},
+	}
+	ctrl, recorder := newFakeController(app)
+	assert.False(t, waitingForAdmission(app))
+
+	ctrl.waitForBatchSchedulerAdmission(app, &schedulerinterface.PendingAdmissionError{Reason: "Workload default/spark-foo-workload is waiting to be admitted by Kueue"})
+	assert.True(t, waitingForBatchScheduler(app))
+	assert.True(t, waitingForAdmission(app))
+	condition := meta.FindStatusCondition(app.Status.Conditions, v1beta2.BatchSchedulerAdmittedCondition)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, batchSchedulerPendingAdmissionReason, condition.Reason)
+		assert.Equal(t, "Workload default/spark-foo-workload is waiting to be admitted by Kueue", condition.Message)
+	}
+	event := <-recorder.Events
+	assert.True(t, strings.Contains(event, batchSchedulerPendingAdmissionReason))
+
+	// The event is only recorded when the application starts waiting.
+	ctrl.waitForBatchSchedulerAdmission(app, &schedulerinterface.PendingAdmissionError{Reason: "still waiting"})
+	assert.Empty(t, recorder.Events)
+	assert.Equal(t, "still waiting", meta.FindStatusCondition(app.Status.Conditions, v1beta2.BatchSchedulerAdmittedCondition).Message)
+}
+
+func TestSetPodSchedulerNames(t *testing.T) {
+	schedulerName := "my-scheduler"
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Driver: v1beta2.DriverSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{SchedulerName: &schedulerName},
+			},
+		},
+	}
+
+	setPodSchedulerNames(app, &coscheduling.CoschedulingBatchScheduler{})
+	assert.Equal(t, schedulerName, app.Spec.Driver.Annotations[config.SchedulerNameAnnotation])
+	assert.Equal(t, coscheduling.DefaultSchedulerName, app.Spec.Executor.Annotations[config.SchedulerNameAnnotation])
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
@@ -28,14 +29,18 @@ import (
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/informers"
+	batchinformers "k8s.io/client-go/informers/batch/v1"
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
 	v1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
@@ -50,7 +55,11 @@ import (
 	crdinformers "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/informers/externalversions"
 	crdlisters "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/listers/sparkoperator.k8s.io/v1beta2"
 	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/notification"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/tracing"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/uiproxy"
 	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/util"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/webhook/resourceusage"
 )
 
 const (
@@ -69,6 +78,7 @@ var (
 type Controller struct {
 	crdClient         crdclientset.Interface
 	kubeClient        clientset.Interface
+	dynamicClient     dynamic.Interface
 	queue             workqueue.RateLimitingInterface
 	cacheSynced       cache.InformerSynced
 	recorder          record.EventRecorder
@@ -76,21 +86,99 @@ type Controller struct {
 	applicationLister crdlisters.SparkApplicationLister
 	podLister         v1.PodLister
 	ingressURLFormat  string
-	batchSchedulerMgr *batchscheduler.SchedulerManager
+	batchSchedulerMgr batchSchedulerManager
 	enableUIService   bool
+	failureClassifier *failureClassifier
+	// driverPendingTimeoutSeconds is the default for applications that don't set spec.driver.pendingTimeoutSeconds.
+	driverPendingTimeoutSeconds int64
+	// executorPendingTimeoutSeconds is the default for applications that don't set spec.executor.pendingTimeoutSeconds.
+	executorPendingTimeoutSeconds int64
+	executorEventThrottle         *eventThrottle
+	// enableUIProxy tells if the UIs are served by the operator's reverse proxy under uiProxyBaseURL.
+	enableUIProxy  bool
+	uiProxyBaseURL string
+	// uiExposure is the default for applications that don't set spec.sparkUIOptions.exposure.
+	uiExposure v1beta2.SparkUIExposure
+	// uiGateway is the namespace/name of the Gateway HTTPRoutes for the UIs are attached to.
+	uiGateway string
+	// tracer exports spans of the lifecycle of applications if tracing is enabled, otherwise it is nil.
+	tracer *tracing.Tracer
+	// notifier sends notifications of state transitions if notifications are enabled, otherwise it is nil.
+	notifier *notification.Notifier
+	// submissionBackend is the default for applications that don't set spec.submissionBackend.
+	submissionBackend v1beta2.SubmissionBackend
+	// submissionExecutor runs submissions on dedicated workers, or is nil if they run on the controller workers.
+	submissionExecutor *submissionExecutor
+	// submissionTimeout is how long spark-submit may run before it is killed, or 0 for no timeout.
+	submissionTimeout time.Duration
+	// submissionJobs tracks the submissions running in Jobs, which are watched by jobInformer.
+	submissionJobs *submissionJobTracker
+	jobInformer    cache.SharedIndexInformer
+	jobLister      batchlisters.JobLister
+	// sparkHomes are the Spark installations applications are submitted with depending on their Spark version.
+	sparkHomes SparkHomes
+	// podTemplateDir is the directory the pod templates of applications submitted with spark-submit are written
+	// to, or empty if pods are only mutated by the webhook. Applications submitted otherwise get their pod
+	// templates mounted from ConfigMaps when it is set.
+	podTemplateDir string
+	// podMutationVerifier verifies that pods carry the customizations of their application, or is nil if
+	// pods are not verified.
+	podMutationVerifier *podMutationVerifier
+	// sparkQuotaEnforcer holds applications back from submission while they don't fit into the SparkQuotas
+	// selecting their namespaces, or is nil if SparkQuotas are not enforced.
+	sparkQuotaEnforcer      *resourceusage.SparkQuotaEnforcer
+	sparkQuotaEventThrottle *eventThrottle
+}
+
+// Options configures the Controller.
+type Options struct {
+	IngressURLFormat  string
+	BatchSchedulerMgr *batchscheduler.SchedulerManager
+	EnableUIService   bool
+	// FailureRulesConfigMap is the namespace/name of a ConfigMap with custom rules for classifying failures.
+	FailureRulesConfigMap string
+	// DriverPendingTimeoutSeconds is the default for applications that don't set
+	// spec.driver.pendingTimeoutSeconds, or 0 for no timeout.
+	DriverPendingTimeoutSeconds int64
+	// ExecutorPendingTimeoutSeconds is the default for applications that don't set
+	// spec.executor.pendingTimeoutSeconds, or 0 for no timeout.
+	ExecutorPendingTimeoutSeconds int64
+	// EnableUIProxy tells if the UIs are served by the operator's reverse proxy under UIProxyBaseURL.
+	EnableUIProxy  bool
+	UIProxyBaseURL string
+	// UIExposure is the default for applications that don't set spec.sparkUIOptions.exposure.
+	UIExposure string
+	// UIGateway is the namespace/name of the Gateway HTTPRoutes for the UIs are attached to.
+	UIGateway string
+	// Tracer exports spans of the lifecycle of applications, or is nil if tracing is disabled.
+	Tracer *tracing.Tracer
+	// Notifier sends notifications of state transitions, or is nil if notifications are disabled.
+	Notifier *notification.Notifier
+	// SubmissionBackend is the default for applications that don't set spec.submissionBackend.
+	SubmissionBackend string
+	// SubmissionWorkers is the number of dedicated submission workers, or 0 to submit on the controller workers.
+	SubmissionWorkers int
+	// SubmissionTimeout is how long spark-submit may run before it is killed, or 0 for no timeout.
+	SubmissionTimeout time.Duration
+	SparkHomes        SparkHomes
+	// PodTemplateDir is the directory pod templates are written to, or empty if pods are only mutated by the
+	// webhook.
+	PodTemplateDir     string
+	UnmutatedPodPolicy UnmutatedPodPolicy
+	// SparkQuotaEnforcer holds applications back from submission, or is nil if SparkQuotas are not enforced.
+	SparkQuotaEnforcer *resourceusage.SparkQuotaEnforcer
 }
 
 // NewController creates a new Controller.
 func NewController(
 	crdClient crdclientset.Interface,
 	kubeClient clientset.Interface,
+	dynamicClient dynamic.Interface,
 	crdInformerFactory crdinformers.SharedInformerFactory,
 	podInformerFactory informers.SharedInformerFactory,
 	metricsConfig *util.MetricConfig,
 	namespace string,
-	ingressURLFormat string,
-	batchSchedulerMgr *batchscheduler.SchedulerManager,
-	enableUIService bool) *Controller {
+	options Options) *Controller {
 	crdscheme.AddToScheme(scheme.Scheme)
 
 	eventBroadcaster := record.NewBroadcaster()
@@ -100,35 +188,54 @@ func NewController(
 	})
 	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, apiv1.EventSource{Component: "spark-operator"})
 
-	return newSparkApplicationController(crdClient, kubeClient, crdInformerFactory, podInformerFactory, recorder, metricsConfig, ingressURLFormat, batchSchedulerMgr, enableUIService)
+	return newSparkApplicationController(crdClient, kubeClient, dynamicClient, crdInformerFactory, podInformerFactory, recorder, metricsConfig, namespace, options)
 }
 
 func newSparkApplicationController(
 	crdClient crdclientset.Interface,
 	kubeClient clientset.Interface,
+	dynamicClient dynamic.Interface,
 	crdInformerFactory crdinformers.SharedInformerFactory,
 	podInformerFactory informers.SharedInformerFactory,
 	eventRecorder record.EventRecorder,
 	metricsConfig *util.MetricConfig,
-	ingressURLFormat string,
-	batchSchedulerMgr *batchscheduler.SchedulerManager,
-	enableUIService bool) *Controller {
+	namespace string,
+	options Options) *Controller {
 	queue := workqueue.NewNamedRateLimitingQueue(&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(queueTokenRefillRate), queueTokenBucketSize)},
 		"spark-application-controller")
 
 	controller := &Controller{
-		crdClient:         crdClient,
-		kubeClient:        kubeClient,
-		recorder:          eventRecorder,
-		queue:             queue,
-		ingressURLFormat:  ingressURLFormat,
-		batchSchedulerMgr: batchSchedulerMgr,
-		enableUIService:   enableUIService,
-	}
-
-	if metricsConfig != nil {
-		controller.metrics = newSparkAppMetrics(metricsConfig)
-		controller.metrics.registerMetrics()
+		crdClient:                     crdClient,
+		kubeClient:                    kubeClient,
+		dynamicClient:                 dynamicClient,
+		recorder:                      eventRecorder,
+		queue:                         queue,
+		ingressURLFormat:              options.IngressURLFormat,
+		enableUIService:               options.EnableUIService,
+		failureClassifier:             newFailureClassifier(kubeClient, options.FailureRulesConfigMap),
+		driverPendingTimeoutSeconds:   options.DriverPendingTimeoutSeconds,
+		executorPendingTimeoutSeconds: options.ExecutorPendingTimeoutSeconds,
+		executorEventThrottle:         newEventThrottle(executorPendingEventInterval),
+		enableUIProxy:                 options.EnableUIProxy,
+		uiProxyBaseURL:                options.UIProxyBaseURL,
+		uiExposure:                    v1beta2.SparkUIExposure(options.UIExposure),
+		uiGateway:                     options.UIGateway,
+		tracer:                        options.Tracer,
+		notifier:                      options.Notifier,
+		submissionBackend:             v1beta2.SubmissionBackend(options.SubmissionBackend),
+		submissionTimeout:             options.SubmissionTimeout,
+		submissionJobs:                newSubmissionJobTracker(),
+		sparkHomes:                    options.SparkHomes,
+		podTemplateDir:                options.PodTemplateDir,
+		podMutationVerifier:           newPodMutationVerifier(options.UnmutatedPodPolicy),
+		sparkQuotaEnforcer:            options.SparkQuotaEnforcer,
+		sparkQuotaEventThrottle:       newEventThrottle(sparkQuotaEventInterval),
+	}
+	if options.BatchSchedulerMgr != nil {
+		controller.batchSchedulerMgr = options.BatchSchedulerMgr
+	}
+	if options.SubmissionWorkers > 0 {
+		controller.submissionExecutor = newSubmissionExecutor(options.SubmissionWorkers, func(key string) { controller.queue.Add(key) }, metricsConfig)
 	}
 
 	crdInformer := crdInformerFactory.Sparkoperator().V1beta2().SparkApplications()
@@ -139,6 +246,11 @@ func newSparkApplicationController(
 	})
 	controller.applicationLister = crdInformer.Lister()
 
+	if metricsConfig != nil {
+		controller.metrics = newSparkAppMetrics(metricsConfig, controller.applicationLister)
+		controller.metrics.registerMetrics()
+	}
+
 	podsInformer := podInformerFactory.Core().V1().Pods()
 	sparkPodEventHandler := newSparkPodEventHandler(controller.queue.AddRateLimited, controller.applicationLister)
 	podsInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -148,8 +260,22 @@ func newSparkApplicationController(
 	})
 	controller.podLister = podsInformer.Lister()
 
+	// Only submission Jobs are watched, which are labeled with the name of their application.
+	controller.jobInformer = batchinformers.NewFilteredJobInformer(kubeClient, namespace, 0,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		func(options *metav1.ListOptions) {
+			options.LabelSelector = fmt.Sprintf("%s=true,%s", config.LaunchedBySparkOperatorLabel, config.SparkAppNameLabel)
+		})
+	controller.jobInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    controller.onSubmissionJobChanged,
+		UpdateFunc: func(_, newObj interface{}) { controller.onSubmissionJobChanged(newObj) },
+		DeleteFunc: controller.onSubmissionJobChanged,
+	})
+	controller.jobLister = batchlisters.NewJobLister(controller.jobInformer.GetIndexer())
+
 	controller.cacheSynced = func() bool {
-		return crdInformer.Informer().HasSynced() && podsInformer.Informer().HasSynced()
+		return crdInformer.Informer().HasSynced() && podsInformer.Informer().HasSynced() &&
+			controller.jobInformer.HasSynced()
 	}
 
 	return controller
@@ -157,10 +283,17 @@ func newSparkApplicationController(
 
 // Start starts the Controller by registering a watcher for SparkApplication objects.
 func (c *Controller) Start(workers int, stopCh <-chan struct{}) error {
+	go c.jobInformer.Run(stopCh)
 	// Wait for all involved caches to be synced, before processing items from the queue is started.
 	if !cache.WaitForCacheSync(stopCh, c.cacheSynced) {
 		return fmt.Errorf("timed out waiting for cache to sync")
 	}
+	if err := c.sparkQuotaEnforcer.WaitForCacheSync(stopCh); err != nil {
+		return err
+	}
+	if err := c.failureClassifier.start(stopCh); err != nil {
+		return err
+	}
 
 	glog.Info("Starting the workers of the SparkApplication controller")
 	for i := 0; i < workers; i++ {
@@ -168,6 +301,7 @@ func (c *Controller) Start(workers int, stopCh <-chan struct{}) error {
 		// the worker after one second.
 		go wait.Until(c.runWorker, time.Second, stopCh)
 	}
+	c.submissionExecutor.start(stopCh)
 
 	return nil
 }
@@ -176,6 +310,7 @@ func (c *Controller) Start(workers int, stopCh <-chan struct{}) error {
 func (c *Controller) Stop() {
 	glog.Info("Stopping the SparkApplication controller")
 	c.queue.ShutDown()
+	c.submissionExecutor.stop()
 }
 
 // Callback function called when a new SparkApplication object gets created.
@@ -201,6 +336,8 @@ func (c *Controller) onUpdate(oldObj, newObj interface{}) {
 		// Force-set the application status to Invalidating which handles clean-up and application re-run.
 		if _, err := c.updateApplicationStatusWithRetries(newApp, func(status *v1beta2.SparkApplicationStatus) {
 			status.AppState.State = v1beta2.InvalidatingState
+			now := metav1.Now()
+			status.AppState.LastTransitionTime = &now
 		}); err != nil {
 			c.recorder.Eventf(
 				newApp,
@@ -325,6 +462,7 @@ func (c *Controller) getAndUpdateDriverState(app *v1beta2.SparkApplication) erro
 	if driverPod == nil {
 		app.Status.AppState.ErrorMessage = "driver pod not found"
 		app.Status.AppState.State = v1beta2.FailingState
+		app.Status.FailureReason = c.failureClassifier.classifyMissingDriver(app, app.Status.DriverInfo.PodName)
 		app.Status.TerminationTime = metav1.Now()
 		return nil
 	}
@@ -332,6 +470,23 @@ func (c *Controller) getAndUpdateDriverState(app *v1beta2.SparkApplication) erro
 	app.Status.SparkApplicationID = getSparkApplicationID(driverPod)
 	driverState := podStatusToDriverState(driverPod.Status)
 
+	if driverState == v1beta2.DriverPendingState {
+		timeLeft, hasTimeout := c.getDriverPendingTimeLeft(app, driverPod)
+		if hasTimeout && timeLeft <= 0 {
+			if err := c.deleteTimedOutDriver(app, driverPod); err != nil {
+				return err
+			}
+			c.recordDriverEvent(app, v1beta2.DriverFailedState, driverPod.Name)
+			app.Status.AppState.State = v1beta2.FailingState
+			return nil
+		}
+		if hasTimeout {
+			// A driver that stays pending doesn't necessarily cause any update that syncs the application
+			// again, so it is synced again once the timeout is exceeded.
+			c.queue.AddAfter(createMetaNamespaceKey(app.Namespace, app.Name), timeLeft)
+		}
+	}
+
 	if hasDriverTerminated(driverState) {
 		if app.Status.TerminationTime.IsZero() {
 			app.Status.TerminationTime = metav1.Now()
@@ -345,6 +500,9 @@ func (c *Controller) getAndUpdateDriverState(app *v1beta2.SparkApplication) erro
 			} else {
 				app.Status.AppState.ErrorMessage = "driver container status missing"
 			}
+			if app.Status.FailureReason == "" {
+				app.Status.FailureReason = c.failureClassifier.classifyDriverFailure(driverPod)
+			}
 		}
 	}
 
@@ -358,6 +516,38 @@ func (c *Controller) getAndUpdateDriverState(app *v1beta2.SparkApplication) erro
 	return nil
 }
 
+// getDriverPendingTimeLeft returns how much longer the given pending driver pod may stay pending before it
+// exceeds the pending timeout of the application. It returns false if the application has no pending timeout.
+func (c *Controller) getDriverPendingTimeLeft(app *v1beta2.SparkApplication, driverPod *apiv1.Pod) (time.Duration, bool) {
+	timeoutSeconds := c.driverPendingTimeoutSeconds
+	if app.Spec.Driver.PendingTimeoutSeconds != nil {
+		timeoutSeconds = *app.Spec.Driver.PendingTimeoutSeconds
+	}
+	if timeoutSeconds <= 0 || driverPod.CreationTimestamp.IsZero() {
+		return 0, false
+	}
+	return time.Until(driverPod.CreationTimestamp.Add(time.Duration(timeoutSeconds) * time.Second)), true
+}
+
+// deleteTimedOutDriver deletes a driver pod that has been pending for too long and records why it
+// was pending in the status of the application.
+func (c *Controller) deleteTimedOutDriver(app *v1beta2.SparkApplication, driverPod *apiv1.Pod) error {
+	glog.Infof("Driver pod %s/%s of SparkApplication %s has exceeded its pending timeout, deleting it",
+		driverPod.Namespace, driverPod.Name, app.Name)
+	err := c.kubeClient.CoreV1().Pods(driverPod.Namespace).Delete(context.TODO(), driverPod.Name, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete driver pod %s/%s pending for too long: %v", driverPod.Namespace, driverPod.Name, err)
+	}
+
+	app.Status.AppState.ErrorMessage = fmt.Sprintf("driver pod exceeded its pending timeout: %s", getDriverPendingMessage(driverPod.Status))
+	app.Status.FailureReason = classifyDriverPodStatus(driverPod.Status)
+	if app.Status.FailureReason == v1beta2.UnknownFailure {
+		app.Status.FailureReason = v1beta2.TimeoutFailure
+	}
+	app.Status.TerminationTime = metav1.Now()
+	return nil
+}
+
 // getAndUpdateExecutorState lists the executor pods of the application
 // and updates the executor state based on the current phase of the pods.
 func (c *Controller) getAndUpdateExecutorState(app *v1beta2.SparkApplication) error {
@@ -395,6 +585,9 @@ func (c *Controller) getAndUpdateExecutorState(app *v1beta2.SparkApplication) er
 		}
 	}
 
+	classifyExecutorFailures(app, pods)
+	c.updatePendingExecutors(app, pods)
+
 	// ApplicationID label can be different on driver/executors. Prefer executor ApplicationID if set.
 	// Refer https://issues.apache.org/jira/projects/SPARK/issues/SPARK-25922 for details.
 	if executorApplicationID != "" {
@@ -438,15 +631,37 @@ func (c *Controller) getAndUpdateAppState(app *v1beta2.SparkApplication) error {
 	if err := c.getAndUpdateExecutorState(app); err != nil {
 		return err
 	}
+	if terminated, err := c.verifyPodMutation(app); err != nil || terminated {
+		return err
+	}
+	timeLeft, hasTimeout, err := c.getExecutorPendingTimeLeft(app)
+	if err != nil {
+		return err
+	}
+	if hasTimeout && timeLeft <= 0 {
+		return c.failOnExecutorPendingTimeout(app)
+	}
+	if hasTimeout {
+		// Executors that stay pending don't necessarily cause any update that syncs the application again,
+		// so it is synced again once the timeout is exceeded.
+		c.queue.AddAfter(createMetaNamespaceKey(app.Namespace, app.Name), timeLeft)
+	}
 	return nil
 }
 
 func (c *Controller) handleSparkApplicationDeletion(app *v1beta2.SparkApplication) {
 	c.metrics.exportMetricsOnDelete(app)
+	c.executorEventThrottle.forget(createMetaNamespaceKey(app.Namespace, app.Name))
+	c.submissionExecutor.forget(createMetaNamespaceKey(app.Namespace, app.Name))
+	c.submissionJobs.forget(createMetaNamespaceKey(app.Namespace, app.Name))
+	c.podMutationVerifier.forget(createMetaNamespaceKey(app.Namespace, app.Name))
+	c.sparkQuotaEventThrottle.forget(createMetaNamespaceKey(app.Namespace, app.Name))
+	c.sparkQuotaEnforcer.Release(app.Namespace, app.Name)
 	// SparkApplication deletion requested, lets delete driver pod.
 	if err := c.deleteSparkResources(app); err != nil {
 		glog.Errorf("failed to delete resources associated with deleted SparkApplication %s/%s: %v", app.Namespace, app.Name, err)
 	}
+	c.traceDeletion(app)
 }
 
 // ShouldRetry determines if SparkApplication in a given state should be retried.
@@ -477,41 +692,41 @@ func shouldRetry(app *v1beta2.SparkApplication) bool {
 }
 
 // State Machine for SparkApplication:
-//+--------------------------------------------------------------------------------------------------------------------+
-//|        +---------------------------------------------------------------------------------------------+             |
-//|        |       +----------+                                                                          |             |
-//|        |       |          |                                                                          |             |
-//|        |       |          |                                                                          |             |
-//|        |       |Submission|                                                                          |             |
-//|        |  +---->  Failed  +----+------------------------------------------------------------------+  |             |
-//|        |  |    |          |    |                                                                  |  |             |
-//|        |  |    |          |    |                                                                  |  |             |
-//|        |  |    +----^-----+    |  +-----------------------------------------+                     |  |             |
-//|        |  |         |          |  |                                         |                     |  |             |
-//|        |  |         |          |  |                                         |                     |  |             |
-//|      +-+--+----+    |    +-----v--+-+          +----------+           +-----v-----+          +----v--v--+          |
-//|      |         |    |    |          |          |          |           |           |          |          |          |
-//|      |         |    |    |          |          |          |           |           |          |          |          |
-//|      |   New   +---------> Submitted+----------> Running  +----------->  Failing  +---------->  Failed  |          |
-//|      |         |    |    |          |          |          |           |           |          |          |          |
-//|      |         |    |    |          |          |          |           |           |          |          |          |
-//|      |         |    |    |          |          |          |           |           |          |          |          |
-//|      +---------+    |    +----^-----+          +-----+----+           +-----+-----+          +----------+          |
-//|                     |         |                      |                      |                                      |
-//|                     |         |                      |                      |                                      |
-//|    +------------+   |         |             +-------------------------------+                                      |
-//|    |            |   |   +-----+-----+       |        |                +-----------+          +----------+          |
-//|    |            |   |   |  Pending  |       |        |                |           |          |          |          |
-//|    |            |   +---+   Rerun   <-------+        +---------------->Succeeding +---------->Completed |          |
-//|    |Invalidating|       |           <-------+                         |           |          |          |          |
-//|    |            +------->           |       |                         |           |          |          |          |
-//|    |            |       |           |       |                         |           |          |          |          |
-//|    |            |       +-----------+       |                         +-----+-----+          +----------+          |
-//|    +------------+                           |                               |                                      |
-//|                                             |                               |                                      |
-//|                                             +-------------------------------+                                      |
-//|                                                                                                                    |
-//+--------------------------------------------------------------------------------------------------------------------+
+// +--------------------------------------------------------------------------------------------------------------------+
+// |        +---------------------------------------------------------------------------------------------+             |
+// |        |       +----------+                                                                          |             |
+// |        |       |          |                                                                          |             |
+// |        |       |          |                                                                          |             |
+// |        |       |Submission|                                                                          |             |
+// |        |  +---->  Failed  +----+------------------------------------------------------------------+  |             |
+// |        |  |    |          |    |                                                                  |  |             |
+// |        |  |    |          |    |                                                                  |  |             |
+// |        |  |    +----^-----+    |  +-----------------------------------------+                     |  |             |
+// |        |  |         |          |  |                                         |                     |  |             |
+// |        |  |         |          |  |                                         |                     |  |             |
+// |      +-+--+----+    |    +-----v--+-+          +----------+           +-----v-----+          +----v--v--+          |
+// |      |         |    |    |          |          |          |           |           |          |          |          |
+// |      |         |    |    |          |          |          |           |           |          |          |          |
+// |      |   New   +---------> Submitted+----------> Running  +----------->  Failing  +---------->  Failed  |          |
+// |      |         |    |    |          |          |          |           |           |          |          |          |
+// |      |         |    |    |          |          |          |           |           |          |          |          |
+// |      |         |    |    |          |          |          |           |           |          |          |          |
+// |      +---------+    |    +----^-----+          +-----+----+           +-----+-----+          +----------+          |
+// |                     |         |                      |                      |                                      |
+// |                     |         |                      |                      |                                      |
+// |    +------------+   |         |             +-------------------------------+                                      |
+// |    |            |   |   +-----+-----+       |        |                +-----------+          +----------+          |
+// |    |            |   |   |  Pending  |       |        |                |           |          |          |          |
+// |    |            |   +---+   Rerun   <-------+        +---------------->Succeeding +---------->Completed |          |
+// |    |Invalidating|       |           <-------+                         |           |          |          |          |
+// |    |            +------->           |       |                         |           |          |          |          |
+// |    |            |       |           |       |                         |           |          |          |          |
+// |    |            |       +-----------+       |                         +-----+-----+          +----------+          |
+// |    +------------+                           |                               |                                      |
+// |                                             |                               |                                      |
+// |                                             +-------------------------------+                                      |
+// |                                                                                                                    |
+// +--------------------------------------------------------------------------------------------------------------------+
 func (c *Controller) syncSparkApplication(key string) error {
 	namespace, name, err := cache.SplitMetaNamespaceKey(key)
 	if err != nil {
@@ -529,6 +744,21 @@ func (c *Controller) syncSparkApplication(key string) error {
 		c.handleSparkApplicationDeletion(app)
 		return nil
 	}
+	if job := c.submissionExecutor.takeResult(key); job != nil {
+		return c.handleSubmissionResult(app, job)
+	}
+	if c.submissionExecutor.isPending(key) {
+		glog.V(2).Infof("SparkApplication %s/%s is waiting for its submission to complete", app.Namespace, app.Name)
+		return nil
+	}
+	if job := c.submissionJobs.get(key); job != nil {
+		return c.syncSubmissionJob(app, job)
+	}
+	if app.Status.AppState.State == v1beta2.NewState {
+		if app, err = c.ensureTraceID(app); err != nil {
+			return err
+		}
+	}
 
 	appCopy := app.DeepCopy()
 	// Apply the default values to the copy. Note that the default values applied
@@ -538,8 +768,13 @@ func (c *Controller) syncSparkApplication(key string) error {
 	// Take action based on application state.
 	switch appCopy.Status.AppState.State {
 	case v1beta2.NewState:
-		c.recordSparkApplicationEvent(appCopy)
-		if err := c.validateSparkApplication(appCopy); err != nil {
+		if !waitingForAdmission(appCopy) {
+			c.recordSparkApplicationEvent(appCopy)
+		}
+		validationStart := time.Now()
+		err := c.validateSparkApplication(appCopy)
+		c.recordSpan(appCopy, validationSpanName, validationStart, err)
+		if err != nil {
 			appCopy.Status.AppState.State = v1beta2.FailedState
 			appCopy.Status.AppState.ErrorMessage = err.Error()
 		} else {
@@ -555,6 +790,7 @@ func (c *Controller) syncSparkApplication(key string) error {
 					appCopy.Namespace, appCopy.Name, err)
 				return err
 			}
+			c.releaseBatchScheduling(appCopy)
 			appCopy.Status.AppState.State = v1beta2.PendingRerunState
 		}
 	case v1beta2.FailingState:
@@ -567,6 +803,7 @@ func (c *Controller) syncSparkApplication(key string) error {
 					appCopy.Namespace, appCopy.Name, err)
 				return err
 			}
+			c.releaseBatchScheduling(appCopy)
 			appCopy.Status.AppState.State = v1beta2.PendingRerunState
 		}
 	case v1beta2.FailedSubmissionState:
@@ -584,20 +821,29 @@ func (c *Controller) syncSparkApplication(key string) error {
 				appCopy.Namespace, appCopy.Name, err)
 			return err
 		}
+		c.releaseBatchScheduling(appCopy)
 		c.clearStatus(&appCopy.Status)
 		appCopy.Status.AppState.State = v1beta2.PendingRerunState
 	case v1beta2.PendingRerunState:
 		glog.V(2).Infof("SparkApplication %s/%s is pending rerun", appCopy.Namespace, appCopy.Name)
 		if c.validateSparkResourceDeletion(appCopy) {
 			glog.V(2).Infof("Resources for SparkApplication %s/%s successfully deleted", appCopy.Namespace, appCopy.Name)
-			c.recordSparkApplicationEvent(appCopy)
+			if !waitingForAdmission(appCopy) {
+				c.recordSparkApplicationEvent(appCopy)
+			}
 			c.clearStatus(&appCopy.Status)
 			appCopy = c.submitSparkApplication(appCopy)
 		}
 	case v1beta2.SubmittedState, v1beta2.RunningState, v1beta2.UnknownState:
-		if err := c.getAndUpdateAppState(appCopy); err != nil {
+		preempted, err := c.stopIfPreempted(appCopy)
+		if err != nil {
 			return err
 		}
+		if !preempted {
+			if err := c.getAndUpdateAppState(appCopy); err != nil {
+				return err
+			}
+		}
 	case v1beta2.CompletedState, v1beta2.FailedState:
 		if c.hasApplicationExpired(app) {
 			glog.Infof("Garbage collecting expired SparkApplication %s/%s", app.Namespace, app.Name)
@@ -618,6 +864,7 @@ func (c *Controller) syncSparkApplication(key string) error {
 			glog.Errorf("failed to update SparkApplication %s/%s: %v", app.Namespace, app.Name, err)
 			return err
 		}
+		c.podMutationVerifier.recorded(key)
 
 		if state := appCopy.Status.AppState.State; state == v1beta2.CompletedState ||
 			state == v1beta2.FailedState {
@@ -649,6 +896,10 @@ func isNextRetryDue(retryInterval *int64, attemptsDone int32, lastEventTime meta
 
 // submitSparkApplication creates a new submission for the given SparkApplication and submits it using spark-submit.
 func (c *Controller) submitSparkApplication(app *v1beta2.SparkApplication) *v1beta2.SparkApplication {
+	if !c.admitBySparkQuotas(app) {
+		return app
+	}
+
 	if app.PrometheusMonitoringEnabled() {
 		if err := configPrometheusMonitoring(app, c.kubeClient); err != nil {
 			glog.Error(err)
@@ -657,11 +908,18 @@ func (c *Controller) submitSparkApplication(app *v1beta2.SparkApplication) *v1be
 
 	// Use batch scheduler to perform scheduling task before submitting (before build command arguments).
 	if needScheduling, scheduler := c.shouldDoBatchScheduling(app); needScheduling {
+		schedulingStart := time.Now()
 		err := scheduler.DoBatchSchedulingOnSubmission(app)
+		c.recordSpan(app, batchSchedulingSpanName, schedulingStart, err)
+		if pending, ok := err.(*schedulerinterface.PendingAdmissionError); ok {
+			c.waitForBatchSchedulerAdmission(app, pending)
+			return app
+		}
 		if err != nil {
 			glog.Errorf("failed to process batch scheduler BeforeSubmitSparkApplication with error %v", err)
 			return app
 		}
+		setPodSchedulerNames(app, scheduler)
 	}
 
 	if c.enableUIService {
@@ -672,8 +930,8 @@ func (c *Controller) submitSparkApplication(app *v1beta2.SparkApplication) *v1be
 			app.Status.DriverInfo.WebUIServiceName = service.serviceName
 			app.Status.DriverInfo.WebUIPort = service.servicePort
 			app.Status.DriverInfo.WebUIAddress = fmt.Sprintf("%s:%d", service.serviceIP, app.Status.DriverInfo.WebUIPort)
-			// Create UI Ingress if ingress-format is set.
-			if c.ingressURLFormat != "" {
+			// Create UI Ingress or HTTPRoute if ingress-format is set, unless the UI is served by the operator's proxy.
+			if c.ingressURLFormat != "" && !c.enableUIProxy {
 				// We are going to want to use an ingress url.
 				ingressURL, err := getSparkUIingressURL(c.ingressURLFormat, app.GetName(), app.GetNamespace())
 				if err != nil {
@@ -687,44 +945,107 @@ func (c *Controller) submitSparkApplication(app *v1beta2.SparkApplication) *v1be
 						app.Spec.SparkConf["spark.ui.proxyBase"] = ingressURL.Path
 						app.Spec.SparkConf["spark.ui.proxyRedirectUri"] = "/"
 					}
-					ingress, err := createSparkUIIngress(app, *service, ingressURL, c.kubeClient)
-					if err != nil {
-						glog.Errorf("failed to create UI Ingress for SparkApplication %s/%s: %v", app.Namespace, app.Name, err)
+					if getUIExposure(app, c.uiExposure) == v1beta2.HTTPRouteExposure {
+						route, err := createSparkUIHTTPRoute(app, *service, ingressURL, c.uiGateway, c.dynamicClient)
+						if err != nil {
+							glog.Errorf("failed to create UI HTTPRoute for SparkApplication %s/%s: %v", app.Namespace, app.Name, err)
+						} else {
+							app.Status.DriverInfo.WebUIIngressAddress = route.routeURL.String()
+							app.Status.DriverInfo.WebUIHTTPRouteName = route.routeName
+						}
 					} else {
-						app.Status.DriverInfo.WebUIIngressAddress = ingress.ingressURL.String()
-						app.Status.DriverInfo.WebUIIngressName = ingress.ingressName
+						ingress, err := createSparkUIIngress(app, *service, ingressURL, c.kubeClient)
+						if err != nil {
+							glog.Errorf("failed to create UI Ingress for SparkApplication %s/%s: %v", app.Namespace, app.Name, err)
+						} else {
+							app.Status.DriverInfo.WebUIIngressAddress = ingress.ingressURL.String()
+							app.Status.DriverInfo.WebUIIngressName = ingress.ingressName
+						}
 					}
 				}
 			}
 		}
 	}
 
+	if c.enableUIProxy {
+		// The proxy serves the UI under a path prefix, which the UI needs to know to generate links.
+		proxyPath := uiproxy.AppPath(app.Namespace, app.Name)
+		if app.Spec.SparkConf == nil {
+			app.Spec.SparkConf = make(map[string]string)
+		}
+		app.Spec.SparkConf["spark.ui.proxyBase"] = strings.TrimSuffix(proxyPath, "/")
+		app.Spec.SparkConf["spark.ui.proxyRedirectUri"] = "/"
+		app.Status.DriverInfo.WebUIAddress = strings.TrimSuffix(c.uiProxyBaseURL, "/") + proxyPath
+	}
+
+	c.addTraceContext(app)
+
 	driverPodName := getDriverPodName(app)
 	submissionID := uuid.New().String()
 	submissionCmdArgs, err := buildSubmissionCommandArgs(app, driverPodName, submissionID)
 	if err != nil {
-		app.Status = v1beta2.SparkApplicationStatus{
-			AppState: v1beta2.ApplicationState{
-				State:        v1beta2.FailedSubmissionState,
-				ErrorMessage: err.Error(),
-			},
-			SubmissionAttempts:        app.Status.SubmissionAttempts + 1,
-			LastSubmissionAttemptTime: metav1.Now(),
-		}
+		setFailedSubmission(&app.Status, v1beta2.SubmissionFailure, err)
 		return app
 	}
-	// Try submitting the application by running spark-submit.
-	submitted, err := runSparkSubmit(newSubmission(submissionCmdArgs, app))
+	if app.Spec.Mode != v1beta2.InClusterClientMode && getSubmissionBackend(app, c.submissionBackend) == v1beta2.JobBackend {
+		// Keep the status of the application unchanged until its submission Job finishes, at which point the
+		// application is synced again.
+		if err := c.startSubmissionJob(app, driverPodName, submissionID, submissionCmdArgs); err != nil {
+			return c.completeSubmission(app, driverPodName, submissionID, false, err)
+		}
+		return nil
+	}
+	// Try submitting the application by running spark-submit or creating the driver natively.
+	run := func() (bool, error) {
+		submissionStart := time.Now()
+		submitted, err := c.submit(app, submissionCmdArgs)
+		c.recordSpan(app, sparkSubmitSpanName, submissionStart, err)
+		return submitted, err
+	}
+	if c.submissionExecutor != nil {
+		// Leave the submission to the submission workers and keep the status of the application unchanged
+		// until the submission completes, at which point the application is synced again.
+		c.submissionExecutor.submit(&submissionJob{
+			appSubmission: newAppSubmission(app, driverPodName, submissionID),
+			key:           createMetaNamespaceKey(app.Namespace, app.Name),
+			run:           run,
+		})
+		return nil
+	}
+	submitted, err := run()
+	return c.completeSubmission(app, driverPodName, submissionID, submitted, err)
+}
+
+// handleSubmissionResult updates the status of the application from the result of a submission run by the
+// submission workers. The result is dropped if the application changed in the meantime.
+func (c *Controller) handleSubmissionResult(app *v1beta2.SparkApplication, job *submissionJob) error {
+	if !job.isFor(app) {
+		glog.Warningf("dropping the result of an outdated submission of SparkApplication %s/%s", app.Namespace, app.Name)
+		c.enqueue(app)
+		return nil
+	}
+	newApp := c.completeSubmission(job.app, job.driverPodName, job.submissionID, job.submitted, job.err)
+	if err := c.updateStatusAndExportMetrics(app, newApp); err != nil {
+		glog.Errorf("failed to update SparkApplication %s/%s: %v", app.Namespace, app.Name, err)
+		return err
+	}
+	return nil
+}
+
+// completeSubmission updates the status of the application from the result of its submission.
+func (c *Controller) completeSubmission(app *v1beta2.SparkApplication, driverPodName string, submissionID string, submitted bool, err error) *v1beta2.SparkApplication {
 	if err != nil {
-		app.Status = v1beta2.SparkApplicationStatus{
-			AppState: v1beta2.ApplicationState{
-				State:        v1beta2.FailedSubmissionState,
-				ErrorMessage: err.Error(),
-			},
-			SubmissionAttempts:        app.Status.SubmissionAttempts + 1,
-			LastSubmissionAttemptTime: metav1.Now(),
+		failureReason := c.failureClassifier.classifySubmissionFailure(err)
+		if isSubmissionTimeout(err) {
+			failureReason = v1beta2.TimeoutFailure
+		}
+		setFailedSubmission(&app.Status, failureReason, err)
+		if _, ok := err.(*permanentSubmissionError); ok {
+			// Submitting the application again would fail the same way.
+			app.Status.AppState.State = v1beta2.FailedState
 		}
 		c.recordSparkApplicationEvent(app)
+		c.sparkQuotaEnforcer.Release(app.Namespace, app.Name)
 		glog.Errorf("failed to run spark-submit for SparkApplication %s/%s: %v", app.Namespace, app.Name, err)
 		return app
 	}
@@ -736,23 +1057,73 @@ func (c *Controller) submitSparkApplication(app *v1beta2.SparkApplication) *v1be
 	}
 
 	glog.Infof("SparkApplication %s/%s has been submitted", app.Namespace, app.Name)
-	app.Status = v1beta2.SparkApplicationStatus{
-		SubmissionID: submissionID,
-		AppState: v1beta2.ApplicationState{
-			State: v1beta2.SubmittedState,
-		},
-		DriverInfo: v1beta2.DriverInfo{
-			PodName: driverPodName,
-		},
-		SubmissionAttempts:        app.Status.SubmissionAttempts + 1,
-		ExecutionAttempts:         app.Status.ExecutionAttempts + 1,
-		LastSubmissionAttemptTime: metav1.Now(),
-	}
+	// The rest of the status, e.g., the information about the UI service, ingress or proxy set up above, the
+	// conditions and the time the application entered its current state, is kept.
+	app.Status.SubmissionID = submissionID
+	app.Status.AppState.State = v1beta2.SubmittedState
+	app.Status.AppState.ErrorMessage = ""
+	app.Status.FailureReason = ""
+	app.Status.DriverInfo.PodName = driverPodName
+	app.Status.SubmissionAttempts++
+	app.Status.ExecutionAttempts++
+	app.Status.LastSubmissionAttemptTime = metav1.Now()
+	app.Status.TerminationTime = metav1.Time{}
 	c.recordSparkApplicationEvent(app)
 
 	return app
 }
 
+// permanentSubmissionError is a submission failure that submitting the application again doesn't fix, e.g., because
+// no Spark installation is available for its version, which fails the application without retrying it.
+type permanentSubmissionError struct {
+	err error
+}
+
+func (e *permanentSubmissionError) Error() string {
+	return e.err.Error()
+}
+
+// setFailedSubmission moves the given status to FailedSubmissionState after a failed submission attempt, keeping
+// the rest of the status, e.g., its conditions and the time the application entered its current state.
+func setFailedSubmission(status *v1beta2.SparkApplicationStatus, failureReason v1beta2.FailureReason, err error) {
+	status.SubmissionID = ""
+	status.AppState.State = v1beta2.FailedSubmissionState
+	status.AppState.ErrorMessage = err.Error()
+	status.FailureReason = failureReason
+	status.SubmissionAttempts++
+	status.LastSubmissionAttemptTime = metav1.Now()
+}
+
+// submit creates the driver of the application with the submission backend selected for it.
+func (c *Controller) submit(app *v1beta2.SparkApplication, submissionCmdArgs []string) (bool, error) {
+	submission := newSubmission(submissionCmdArgs, app)
+	// spark-submit can't run the driver of an application in in-cluster client mode in a pod of its own.
+	if app.Spec.Mode == v1beta2.InClusterClientMode || getSubmissionBackend(app, c.submissionBackend) == v1beta2.NativeBackend {
+		if c.podTemplateDir != "" {
+			if err := setNativePodTemplates(app, submission, c.kubeClient); err != nil {
+				return false, fmt.Errorf("failed to build the pod templates of SparkApplication %s/%s: %v", app.Namespace, app.Name, err)
+			}
+		}
+		return runNativeSubmission(c.kubeClient, submission)
+	}
+	sparkHome, err := c.sparkHomes.resolve(app.Spec.SparkVersion)
+	if err != nil {
+		return false, &permanentSubmissionError{fmt.Errorf("failed to submit SparkApplication %s/%s: %v", app.Namespace, app.Name, err)}
+	}
+	submission.sparkHome = sparkHome
+	if c.podTemplateDir != "" {
+		templateArgs, templateFiles, err := writePodTemplates(app, c.podTemplateDir, c.kubeClient)
+		if err != nil {
+			return false, fmt.Errorf("failed to write the pod templates of SparkApplication %s/%s: %v", app.Namespace, app.Name, err)
+		}
+		defer removePodTemplates(templateFiles)
+		submission.args = append(templateArgs, submission.args...)
+	}
+	submitted, err := runSparkSubmit(submission, c.submissionTimeout)
+	c.recordSubmissionOutput(app, submission)
+	return submitted, err
+}
+
 func (c *Controller) shouldDoBatchScheduling(app *v1beta2.SparkApplication) (bool, schedulerinterface.BatchScheduler) {
 	if c.batchSchedulerMgr == nil || app.Spec.BatchScheduler == nil || *app.Spec.BatchScheduler == "" {
 		return false, nil
@@ -805,6 +1176,11 @@ func (c *Controller) updateApplicationStatusWithRetries(
 
 // updateStatusAndExportMetrics updates the status of the SparkApplication and export the metrics.
 func (c *Controller) updateStatusAndExportMetrics(oldApp, newApp *v1beta2.SparkApplication) error {
+	if newApp.Status.AppState.State != oldApp.Status.AppState.State {
+		now := metav1.Now()
+		newApp.Status.AppState.LastTransitionTime = &now
+	}
+
 	// Skip update if nothing changed.
 	if equality.Semantic.DeepEqual(oldApp.Status, newApp.Status) {
 		return nil
@@ -831,10 +1207,25 @@ func (c *Controller) updateStatusAndExportMetrics(oldApp, newApp *v1beta2.SparkA
 	if c.metrics != nil {
 		c.metrics.exportMetrics(oldApp, updatedApp)
 	}
+	c.traceStateTransition(oldApp, updatedApp)
+	c.notifyStateTransition(oldApp, updatedApp)
 
 	return nil
 }
 
+// notifyStateTransition sends a notification if the state of the application changed to the sinks
+// its spec refers to.
+func (c *Controller) notifyStateTransition(oldApp, newApp *v1beta2.SparkApplication) {
+	if c.notifier == nil || oldApp.Status.AppState.State == newApp.Status.AppState.State {
+		return
+	}
+	var sinks []v1beta2.NotificationSinkReference
+	if newApp.Spec.Notifications != nil {
+		sinks = newApp.Spec.Notifications.Sinks
+	}
+	c.notifier.Notify(notification.NewSparkApplicationEvent(oldApp, newApp), sinks)
+}
+
 func (c *Controller) getSparkApplication(namespace string, name string) (*v1beta2.SparkApplication, error) {
 	app, err := c.applicationLister.SparkApplications(namespace).Get(name)
 	if err != nil {
@@ -846,8 +1237,16 @@ func (c *Controller) getSparkApplication(namespace string, name string) (*v1beta
 	return app, nil
 }
 
-// Delete the driver pod and optional UI resources (Service/Ingress) created for the application.
-func (c *Controller) deleteSparkResources(app *v1beta2.SparkApplication) error {
+// Delete the driver pod and optional UI resources (Service/Ingress/HTTPRoute) created for the application.
+func (c *Controller) deleteSparkResources(app *v1beta2.SparkApplication) (err error) {
+	defer func(start time.Time) {
+		// Resources of applications that completed or failed are cleaned up after the span covering the
+		// whole application ended.
+		if !hasApplicationSpanEnded(app) {
+			c.recordSpan(app, cleanupSpanName, start, err)
+		}
+	}(time.Now())
+
 	driverPodName := app.Status.DriverInfo.PodName
 	// Derive the driver pod name in case the driver pod name was not recorded in the status,
 	// which could happen if the status update right after submission failed.
@@ -856,7 +1255,7 @@ func (c *Controller) deleteSparkResources(app *v1beta2.SparkApplication) error {
 	}
 
 	glog.V(2).Infof("Deleting pod %s in namespace %s", driverPodName, app.Namespace)
-	err := c.kubeClient.CoreV1().Pods(app.Namespace).Delete(context.TODO(), driverPodName, metav1.DeleteOptions{})
+	err = c.kubeClient.CoreV1().Pods(app.Namespace).Delete(context.TODO(), driverPodName, metav1.DeleteOptions{})
 	if err != nil && !errors.IsNotFound(err) {
 		return err
 	}
@@ -888,6 +1287,14 @@ func (c *Controller) deleteSparkResources(app *v1beta2.SparkApplication) error {
 		}
 	}
 
+	sparkUIHTTPRouteName := app.Status.DriverInfo.WebUIHTTPRouteName
+	if sparkUIHTTPRouteName != "" {
+		err := deleteSparkUIHTTPRoute(app.Namespace, sparkUIHTTPRouteName, c.dynamicClient)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -902,7 +1309,7 @@ func (c *Controller) validateSparkApplication(app *v1beta2.SparkApplication) err
 	return nil
 }
 
-// Validate that any Spark resources (driver/Service/Ingress) created for the application have been deleted.
+// Validate that any Spark resources (driver/Service/Ingress/HTTPRoute) created for the application have been deleted.
 func (c *Controller) validateSparkResourceDeletion(app *v1beta2.SparkApplication) bool {
 	driverPodName := app.Status.DriverInfo.PodName
 	// Derive the driver pod name in case the driver pod name was not recorded in the status,
@@ -931,6 +1338,14 @@ func (c *Controller) validateSparkResourceDeletion(app *v1beta2.SparkApplication
 		}
 	}
 
+	sparkUIHTTPRouteName := app.Status.DriverInfo.WebUIHTTPRouteName
+	if sparkUIHTTPRouteName != "" {
+		_, err := getSparkUIHTTPRoute(app.Namespace, sparkUIHTTPRouteName, c.dynamicClient)
+		if err == nil || !errors.IsNotFound(err) {
+			return false
+		}
+	}
+
 	return true
 }
 
@@ -1031,14 +1446,22 @@ func (c *Controller) clearStatus(status *v1beta2.SparkApplicationStatus) {
 		status.LastSubmissionAttemptTime = metav1.Time{}
 		status.TerminationTime = metav1.Time{}
 		status.AppState.ErrorMessage = ""
+		status.FailureReason = ""
 		status.ExecutorState = nil
+		status.PendingExecutors = nil
 	} else if status.AppState.State == v1beta2.PendingRerunState {
+		// The pods of the previous run don't matter anymore.
+		if meta.FindStatusCondition(status.Conditions, v1beta2.PodsMutatedCondition) != nil {
+			meta.RemoveStatusCondition(&status.Conditions, v1beta2.PodsMutatedCondition)
+		}
 		status.SparkApplicationID = ""
 		status.SubmissionAttempts = 0
 		status.LastSubmissionAttemptTime = metav1.Time{}
 		status.DriverInfo = v1beta2.DriverInfo{}
 		status.AppState.ErrorMessage = ""
+		status.FailureReason = ""
 		status.ExecutorState = nil
+		status.PendingExecutors = nil
 	}
 }
 
@@ -1070,3 +1493,7 @@ func (c *Controller) cleanUpOnTermination(oldApp, newApp *v1beta2.SparkApplicati
 func int64ptr(n int64) *int64 {
 	return &n
 }
+
+func int32ptr(n int32) *int32 {
+	return &n
+}
@@ -31,6 +31,7 @@ import (
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/informers"
 	kubeclientfake "k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -67,8 +68,9 @@ func newFakeController(app *v1beta2.SparkApplication, pods ...*apiv1.Pod) (*Cont
 	}, metav1.CreateOptions{})
 
 	podInformerFactory := informers.NewSharedInformerFactory(kubeClient, 0*time.Second)
-	controller := newSparkApplicationController(crdClient, kubeClient, informerFactory, podInformerFactory, recorder,
-		&util.MetricConfig{}, "", nil, true)
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(scheme.Scheme)
+	controller := newSparkApplicationController(crdClient, kubeClient, dynamicClient, informerFactory, podInformerFactory, recorder,
+		&util.MetricConfig{}, apiv1.NamespaceAll, Options{EnableUIService: true})
 
 	informer := informerFactory.Sparkoperator().V1beta2().SparkApplications().Informer()
 	if app != nil {
@@ -282,7 +284,8 @@ func TestSyncSparkApplication_SubmissionFailed(t *testing.T) {
 	assert.Equal(t, int32(1), updatedApp.Status.SubmissionAttempts)
 	assert.Equal(t, float64(1), fetchCounterValue(ctrl.metrics.sparkAppCount, map[string]string{}))
 	assert.Equal(t, float64(0), fetchCounterValue(ctrl.metrics.sparkAppSubmitCount, map[string]string{}))
-	assert.Equal(t, float64(1), fetchCounterValue(ctrl.metrics.sparkAppFailedSubmissionCount, map[string]string{}))
+	assert.Equal(t, float64(1), fetchCounterValue(ctrl.metrics.sparkAppFailedSubmissionCount, map[string]string{failureReasonMetricLabel: string(v1beta2.SubmissionFailure)}))
+	assert.Equal(t, v1beta2.SubmissionFailure, updatedApp.Status.FailureReason)
 
 	event := <-recorder.Events
 	assert.True(t, strings.Contains(event, "SparkApplicationAdded"))
@@ -325,6 +328,78 @@ func TestSyncSparkApplication_SubmissionFailed(t *testing.T) {
 	assert.Equal(t, int32(2), updatedApp.Status.SubmissionAttempts)
 }
 
+func TestSyncSparkApplication_SubmissionStateDuration(t *testing.T) {
+	os.Setenv(sparkHomeEnvVar, "/spark")
+	os.Setenv(kubernetesServiceHostEnvVar, "localhost")
+	os.Setenv(kubernetesServicePortEnvVar, "443")
+
+	failedAt := metav1.NewTime(time.Now().Add(-90 * time.Second))
+	condition := metav1.Condition{Type: v1beta2.PodsMutatedCondition, Status: metav1.ConditionTrue, Reason: "CustomizationsApplied"}
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+		},
+		Spec: v1beta2.SparkApplicationSpec{
+			RestartPolicy: v1beta2.RestartPolicy{
+				Type:                             v1beta2.OnFailure,
+				OnSubmissionFailureRetries:       int32ptr(3),
+				OnSubmissionFailureRetryInterval: int64ptr(1),
+			},
+		},
+		Status: v1beta2.SparkApplicationStatus{
+			AppState: v1beta2.ApplicationState{
+				State:              v1beta2.FailedSubmissionState,
+				LastTransitionTime: &failedAt,
+			},
+			Conditions:                []metav1.Condition{condition},
+			SubmissionAttempts:        1,
+			LastSubmissionAttemptTime: metav1.NewTime(failedAt.Add(-time.Minute)),
+		},
+	}
+	sync := func(app *v1beta2.SparkApplication, helper string) (*Controller, *v1beta2.SparkApplication) {
+		ctrl, _ := newFakeController(app)
+		if _, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Create(context.TODO(), app, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		execCommand = func(command string, args ...string) *exec.Cmd {
+			cs := []string{"-test.run=" + helper, "--", command}
+			cs = append(cs, args...)
+			cmd := exec.Command(os.Args[0], cs...)
+			cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
+			return cmd
+		}
+		assert.NoError(t, ctrl.syncSparkApplication("default/foo"))
+		updatedApp, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ctrl, updatedApp
+	}
+
+	// A failed retry keeps the time the application entered FailedSubmissionState and its conditions.
+	_, updatedApp := sync(app, "TestHelperProcessFailure")
+	assert.Equal(t, v1beta2.FailedSubmissionState, updatedApp.Status.AppState.State)
+	assert.Equal(t, int32(2), updatedApp.Status.SubmissionAttempts)
+	assert.Equal(t, []metav1.Condition{condition}, updatedApp.Status.Conditions)
+	if assert.NotNil(t, updatedApp.Status.AppState.LastTransitionTime) {
+		assert.True(t, updatedApp.Status.AppState.LastTransitionTime.Equal(&failedAt))
+	}
+
+	updatedApp.Status.LastSubmissionAttemptTime = metav1.NewTime(time.Now().Add(-time.Minute))
+	ctrl, updatedApp := sync(updatedApp, "TestHelperProcessSuccess")
+	assert.Equal(t, v1beta2.SubmittedState, updatedApp.Status.AppState.State)
+	assert.Equal(t, []metav1.Condition{condition}, updatedApp.Status.Conditions)
+	if assert.NotNil(t, updatedApp.Status.AppState.LastTransitionTime) {
+		assert.True(t, updatedApp.Status.AppState.LastTransitionTime.After(failedAt.Time))
+	}
+
+	// The time the application spent in FailedSubmissionState is measured from when it entered it.
+	histogram := fetchHistogram(ctrl.metrics.sparkAppStateDuration, map[string]string{stateMetricLabel: string(v1beta2.FailedSubmissionState)})
+	assert.Equal(t, uint64(1), histogram.GetSampleCount())
+	assert.InDelta(t, 90, histogram.GetSampleSum(), 5)
+}
+
 func TestValidateDetectsNodeSelectorSuccessNoSelector(t *testing.T) {
 	ctrl, _ := newFakeController(nil)
 
@@ -932,6 +1007,7 @@ func TestSyncSparkApplication_ExecutingState(t *testing.T) {
 		driverPod               *apiv1.Pod
 		executorPod             *apiv1.Pod
 		expectedAppState        v1beta2.ApplicationStateType
+		expectedFailureReason   v1beta2.FailureReason
 		expectedExecutorState   map[string]v1beta2.ExecutorState
 		expectedAppMetrics      metrics
 		expectedExecutorMetrics executorMetrics
@@ -971,6 +1047,7 @@ func TestSyncSparkApplication_ExecutingState(t *testing.T) {
 			oldAppStatus:          v1beta2.SubmittedState,
 			oldExecutorStatus:     map[string]v1beta2.ExecutorState{"exec-1": v1beta2.ExecutorRunningState},
 			expectedAppState:      v1beta2.FailingState,
+			expectedFailureReason: v1beta2.UnknownFailure,
 			expectedExecutorState: map[string]v1beta2.ExecutorState{"exec-1": v1beta2.ExecutorFailedState},
 			expectedAppMetrics: metrics{
 				failedMetricCount: 1,
@@ -1182,6 +1259,7 @@ func TestSyncSparkApplication_ExecutingState(t *testing.T) {
 				},
 			},
 			expectedAppState:      v1beta2.FailingState,
+			expectedFailureReason: v1beta2.DriverOOMKilledFailure,
 			expectedExecutorState: map[string]v1beta2.ExecutorState{"exec-1": v1beta2.ExecutorCompletedState},
 			expectedAppMetrics: metrics{
 				failedMetricCount: 1,
@@ -1245,6 +1323,7 @@ func TestSyncSparkApplication_ExecutingState(t *testing.T) {
 				},
 			},
 			expectedAppState:      v1beta2.FailingState,
+			expectedFailureReason: v1beta2.DriverOOMKilledFailure,
 			expectedExecutorState: map[string]v1beta2.ExecutorState{"exec-1": v1beta2.ExecutorFailedState},
 			expectedAppMetrics: metrics{
 				failedMetricCount: 1,
@@ -1480,6 +1559,7 @@ func TestSyncSparkApplication_ExecutingState(t *testing.T) {
 		updatedApp, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
 		assert.Equal(t, test.expectedAppState, updatedApp.Status.AppState.State)
 		assert.Equal(t, test.expectedExecutorState, updatedApp.Status.ExecutorState)
+		assert.Equal(t, test.expectedFailureReason, updatedApp.Status.FailureReason)
 
 		// Validate error message if the driver pod failed.
 		if test.driverPod != nil && test.driverPod.Status.Phase == apiv1.PodFailed {
@@ -1497,7 +1577,7 @@ func TestSyncSparkApplication_ExecutingState(t *testing.T) {
 		assert.Equal(t, test.expectedAppMetrics.runningMetricCount, ctrl.metrics.sparkAppRunningCount.Value(map[string]string{}))
 		assert.Equal(t, test.expectedAppMetrics.successMetricCount, fetchCounterValue(ctrl.metrics.sparkAppSuccessCount, map[string]string{}))
 		assert.Equal(t, test.expectedAppMetrics.submitMetricCount, fetchCounterValue(ctrl.metrics.sparkAppSubmitCount, map[string]string{}))
-		assert.Equal(t, test.expectedAppMetrics.failedMetricCount, fetchCounterValue(ctrl.metrics.sparkAppFailureCount, map[string]string{}))
+		assert.Equal(t, test.expectedAppMetrics.failedMetricCount, fetchCounterValue(ctrl.metrics.sparkAppFailureCount, map[string]string{failureReasonMetricLabel: string(test.expectedFailureReason)}))
 
 		// Verify executor metrics.
 		assert.Equal(t, test.expectedExecutorMetrics.runningMetricCount, ctrl.metrics.sparkAppExecutorRunningCount.Value(map[string]string{}))
@@ -1557,6 +1637,201 @@ func TestSyncSparkApplication_ApplicationExpired(t *testing.T) {
 	assert.True(t, errors.IsNotFound(err))
 }
 
+func TestSyncSparkApplication_DriverPendingTimeout(t *testing.T) {
+	os.Setenv(kubernetesServiceHostEnvVar, "localhost")
+	os.Setenv(kubernetesServicePortEnvVar, "443")
+
+	appName := "foo"
+	driverPodName := appName + "-driver"
+
+	newApp := func(pendingTimeoutSeconds *int64) *v1beta2.SparkApplication {
+		return &v1beta2.SparkApplication{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      appName,
+				Namespace: "test",
+			},
+			Spec: v1beta2.SparkApplicationSpec{
+				RestartPolicy: v1beta2.RestartPolicy{
+					Type: v1beta2.Never,
+				},
+				Driver: v1beta2.DriverSpec{
+					PendingTimeoutSeconds: pendingTimeoutSeconds,
+				},
+			},
+			Status: v1beta2.SparkApplicationStatus{
+				AppState: v1beta2.ApplicationState{
+					State: v1beta2.SubmittedState,
+				},
+				DriverInfo: v1beta2.DriverInfo{
+					PodName: driverPodName,
+				},
+			},
+		}
+	}
+	driverPod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              driverPodName,
+			Namespace:         "test",
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-10 * time.Minute)),
+			Labels: map[string]string{
+				config.SparkRoleLabel:    config.SparkDriverRole,
+				config.SparkAppNameLabel: appName,
+			},
+		},
+		Status: apiv1.PodStatus{
+			Phase: apiv1.PodPending,
+			ContainerStatuses: []apiv1.ContainerStatus{
+				{
+					Name: config.SparkDriverContainerName,
+					State: apiv1.ContainerState{
+						Waiting: &apiv1.ContainerStateWaiting{
+							Reason:  "ImagePullBackOff",
+							Message: "Back-off pulling image \"spark:missing\"",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	type testcase struct {
+		name                  string
+		pendingTimeoutSeconds *int64
+		defaultTimeoutSeconds int64
+		expectedState         v1beta2.ApplicationStateType
+	}
+	testcases := []testcase{
+		{
+			name:                  "no timeout",
+			pendingTimeoutSeconds: nil,
+			expectedState:         v1beta2.SubmittedState,
+		},
+		{
+			name:                  "timeout not exceeded",
+			pendingTimeoutSeconds: int64ptr(3600),
+			expectedState:         v1beta2.SubmittedState,
+		},
+		{
+			name:                  "timeout exceeded",
+			pendingTimeoutSeconds: int64ptr(60),
+			expectedState:         v1beta2.FailingState,
+		},
+		{
+			name:                  "operator default timeout exceeded",
+			defaultTimeoutSeconds: 60,
+			expectedState:         v1beta2.FailingState,
+		},
+		{
+			name:                  "operator default timeout disabled by application",
+			pendingTimeoutSeconds: int64ptr(0),
+			defaultTimeoutSeconds: 60,
+			expectedState:         v1beta2.SubmittedState,
+		},
+	}
+
+	for _, test := range testcases {
+		app := newApp(test.pendingTimeoutSeconds)
+		ctrl, _ := newFakeController(app, driverPod)
+		ctrl.driverPendingTimeoutSeconds = test.defaultTimeoutSeconds
+		_, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Create(context.TODO(), app, metav1.CreateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Nil(t, ctrl.syncSparkApplication(fmt.Sprintf("%s/%s", app.Namespace, app.Name)), test.name)
+
+		updatedApp, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, test.expectedState, updatedApp.Status.AppState.State, test.name)
+		if test.expectedState == v1beta2.FailingState {
+			assert.Equal(t, v1beta2.ImagePullFailure, updatedApp.Status.FailureReason, test.name)
+			assert.Contains(t, updatedApp.Status.AppState.ErrorMessage, "ImagePullBackOff", test.name)
+		}
+	}
+}
+
+func TestSyncSparkApplication_DriverPendingTimeoutRequeue(t *testing.T) {
+	os.Setenv(kubernetesServiceHostEnvVar, "localhost")
+	os.Setenv(kubernetesServicePortEnvVar, "443")
+
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "test",
+		},
+		Spec: v1beta2.SparkApplicationSpec{
+			RestartPolicy: v1beta2.RestartPolicy{
+				Type: v1beta2.Never,
+			},
+			Driver: v1beta2.DriverSpec{
+				PendingTimeoutSeconds: int64ptr(60),
+			},
+		},
+		Status: v1beta2.SparkApplicationStatus{
+			AppState: v1beta2.ApplicationState{
+				State: v1beta2.SubmittedState,
+			},
+			DriverInfo: v1beta2.DriverInfo{
+				PodName: "foo-driver",
+			},
+		},
+	}
+	// The driver pod stays unschedulable without any further update, and its timeout is exceeded in a second.
+	driverPod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "foo-driver",
+			Namespace:         "test",
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-59 * time.Second)),
+			Labels: map[string]string{
+				config.SparkRoleLabel:    config.SparkDriverRole,
+				config.SparkAppNameLabel: "foo",
+			},
+		},
+		Status: apiv1.PodStatus{
+			Phase: apiv1.PodPending,
+			Conditions: []apiv1.PodCondition{
+				{
+					Type:   apiv1.PodScheduled,
+					Status: apiv1.ConditionFalse,
+					Reason: apiv1.PodReasonUnschedulable,
+				},
+			},
+		},
+	}
+	ctrl, _ := newFakeController(app, driverPod)
+	_, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Create(context.TODO(), app, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, ctrl.syncSparkApplication("test/foo"))
+	updatedApp, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, v1beta2.SubmittedState, updatedApp.Status.AppState.State)
+
+	processNextItemWithTimeout(t, ctrl, 10*time.Second)
+	updatedApp, err = ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, v1beta2.FailingState, updatedApp.Status.AppState.State)
+	assert.Equal(t, v1beta2.UnschedulableFailure, updatedApp.Status.FailureReason)
+}
+
+// processNextItemWithTimeout processes the next item added to the queue of the controller, and fails the test
+// if no item is added within the given timeout.
+func processNextItemWithTimeout(t *testing.T, ctrl *Controller, timeout time.Duration) {
+	processed := make(chan struct{})
+	go func() {
+		ctrl.processNextItem()
+		close(processed)
+	}()
+	select {
+	case <-processed:
+	case <-time.After(timeout):
+		ctrl.queue.ShutDown()
+		t.Fatal("timed out waiting for the application to be requeued")
+	}
+}
+
 func TestIsNextRetryDue(t *testing.T) {
 	// Failure cases.
 	assert.False(t, isNextRetryDue(nil, 3, metav1.Time{Time: metav1.Now().Add(-100 * time.Second)}))
@@ -1619,10 +1894,111 @@ func TestIngressWithSubpathAffectsSparkConfiguration(t *testing.T) {
 	}
 }
 
-func stringptr(s string) *string {
-	return &s
+func TestUIProxyReplacesIngress(t *testing.T) {
+	os.Setenv(sparkHomeEnvVar, "/spark")
+	os.Setenv(kubernetesServiceHostEnvVar, "localhost")
+	os.Setenv(kubernetesServicePortEnvVar, "443")
+
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "test",
+		},
+		Spec: v1beta2.SparkApplicationSpec{
+			RestartPolicy: v1beta2.RestartPolicy{
+				Type: v1beta2.Never,
+			},
+		},
+	}
+
+	ctrl, _ := newFakeController(app)
+	ctrl.ingressURLFormat = "example.com/{{$appNamespace}}/{{$appName}}"
+	ctrl.enableUIProxy = true
+	ctrl.uiProxyBaseURL = "https://spark.example.com/"
+	_, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Create(context.TODO(), app, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		cs := []string{"-test.run=TestHelperProcessSuccess", "--", command}
+		cs = append(cs, args...)
+		cmd := exec.Command(os.Args[0], cs...)
+		cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
+		return cmd
+	}
+
+	err = ctrl.syncSparkApplication(fmt.Sprintf("%s/%s", app.Namespace, app.Name))
+	assert.Nil(t, err)
+	updatedApp, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, v1beta2.SubmittedState, updatedApp.Status.AppState.State)
+	assert.Equal(t, "https://spark.example.com/test/foo/", updatedApp.Status.DriverInfo.WebUIAddress)
+	assert.Equal(t, "", updatedApp.Status.DriverInfo.WebUIIngressName)
+
+	ingresses, err := ctrl.kubeClient.NetworkingV1().Ingresses(app.Namespace).List(context.TODO(), metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(ingresses.Items))
 }
 
-func int32ptr(n int32) *int32 {
-	return &n
+func TestHTTPRouteExposure(t *testing.T) {
+	os.Setenv(sparkHomeEnvVar, "/spark")
+	os.Setenv(kubernetesServiceHostEnvVar, "localhost")
+	os.Setenv(kubernetesServicePortEnvVar, "443")
+
+	exposure := v1beta2.HTTPRouteExposure
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "test",
+		},
+		Spec: v1beta2.SparkApplicationSpec{
+			RestartPolicy: v1beta2.RestartPolicy{
+				Type: v1beta2.Never,
+			},
+			SparkUIOptions: &v1beta2.SparkUIConfiguration{
+				Exposure: &exposure,
+			},
+		},
+	}
+
+	ctrl, _ := newFakeController(app)
+	setHTTPRouteCapabilities(t, util.Capabilities{"gateway.networking.k8s.io/v1beta1": true})
+	ctrl.ingressURLFormat = "example.com/{{$appNamespace}}/{{$appName}}"
+	ctrl.uiGateway = "gateways/spark"
+	_, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Create(context.TODO(), app, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		cs := []string{"-test.run=TestHelperProcessSuccess", "--", command}
+		cs = append(cs, args...)
+		cmd := exec.Command(os.Args[0], cs...)
+		cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
+		return cmd
+	}
+
+	err = ctrl.syncSparkApplication(fmt.Sprintf("%s/%s", app.Namespace, app.Name))
+	assert.Nil(t, err)
+	updatedApp, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "foo-ui-httproute", updatedApp.Status.DriverInfo.WebUIHTTPRouteName)
+	assert.Equal(t, "", updatedApp.Status.DriverInfo.WebUIIngressName)
+	assert.Equal(t, "http://example.com/test/foo", updatedApp.Status.DriverInfo.WebUIIngressAddress)
+
+	route, err := getSparkUIHTTPRoute(app.Namespace, "foo-ui-httproute", ctrl.dynamicClient)
+	assert.Nil(t, err)
+	assert.NotNil(t, route)
+	ingresses, err := ctrl.kubeClient.NetworkingV1().Ingresses(app.Namespace).List(context.TODO(), metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(ingresses.Items))
+
+	assert.Nil(t, ctrl.deleteSparkResources(updatedApp))
+	_, err = getSparkUIHTTPRoute(app.Namespace, "foo-ui-httproute", ctrl.dynamicClient)
+	assert.True(t, errors.IsNotFound(err))
+}
+
+func stringptr(s string) *string {
+	return &s
 }
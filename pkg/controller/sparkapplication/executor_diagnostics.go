@@ -0,0 +1,220 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/util"
+)
+
+// executorPendingEventInterval is the minimum interval between two events about pending executors
+// of the same application.
+const executorPendingEventInterval = 5 * time.Minute
+
+// eventThrottle limits how often an event is recorded for the same key.
+type eventThrottle struct {
+	mutex    sync.Mutex
+	interval time.Duration
+	last     map[string]time.Time
+}
+
+func newEventThrottle(interval time.Duration) *eventThrottle {
+	return &eventThrottle{interval: interval, last: make(map[string]time.Time)}
+}
+
+// allow tells if an event may be recorded for the given key now, and if so records that it was.
+func (t *eventThrottle) allow(key string, now time.Time) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if last, ok := t.last[key]; ok && now.Sub(last) < t.interval {
+		return false
+	}
+	t.last[key] = now
+	return true
+}
+
+func (t *eventThrottle) forget(key string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.last, key)
+}
+
+// getPendingExecutorReasons aggregates why the given executor pods are pending. The waiting reason
+// of the executor container takes precedence over the scheduling condition of the pod.
+func getPendingExecutorReasons(pods []*apiv1.Pod) []v1beta2.PendingExecutorReason {
+	type reasonKey struct{ reason, message string }
+	counts := make(map[reasonKey]int32)
+	for _, pod := range pods {
+		if !util.IsExecutorPod(pod) || pod.Status.Phase != apiv1.PodPending {
+			continue
+		}
+		if key, ok := getExecutorWaitingReason(pod.Status); ok {
+			counts[reasonKey{key.Reason, key.Message}]++
+			continue
+		}
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == apiv1.PodScheduled && condition.Status == apiv1.ConditionFalse {
+				counts[reasonKey{condition.Reason, condition.Message}]++
+				break
+			}
+		}
+	}
+
+	var reasons []v1beta2.PendingExecutorReason
+	for key, count := range counts {
+		reasons = append(reasons, v1beta2.PendingExecutorReason{Reason: key.reason, Message: key.message, Count: count})
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if reasons[i].Count != reasons[j].Count {
+			return reasons[i].Count > reasons[j].Count
+		}
+		if reasons[i].Reason != reasons[j].Reason {
+			return reasons[i].Reason < reasons[j].Reason
+		}
+		return reasons[i].Message < reasons[j].Message
+	})
+	return reasons
+}
+
+func getExecutorWaitingReason(podStatus apiv1.PodStatus) (*apiv1.ContainerStateWaiting, bool) {
+	for _, c := range podStatus.ContainerStatuses {
+		if c.Name != config.Spark3DefaultExecutorContainerName && c.Name != config.SparkExecutorContainerName {
+			continue
+		}
+		// ContainerCreating is the normal state of a container being started, not a problem.
+		if c.State.Waiting != nil && c.State.Waiting.Reason != "" && c.State.Waiting.Reason != "ContainerCreating" {
+			return c.State.Waiting, true
+		}
+	}
+	return nil, false
+}
+
+func formatPendingExecutorReasons(reasons []v1beta2.PendingExecutorReason) string {
+	var parts []string
+	for _, r := range reasons {
+		if r.Message != "" {
+			parts = append(parts, fmt.Sprintf("%d executor(s) %s: %s", r.Count, r.Reason, r.Message))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d executor(s) %s", r.Count, r.Reason))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// updatePendingExecutors records the aggregated reasons of pending executor pods in the status of
+// the application, and in a throttled event.
+func (c *Controller) updatePendingExecutors(app *v1beta2.SparkApplication, pods []*apiv1.Pod) {
+	app.Status.PendingExecutors = getPendingExecutorReasons(pods)
+	if len(app.Status.PendingExecutors) == 0 {
+		return
+	}
+	if c.executorEventThrottle.allow(createMetaNamespaceKey(app.Namespace, app.Name), time.Now()) {
+		c.recorder.Eventf(app, apiv1.EventTypeWarning, "SparkExecutorsPending", "Executors of SparkApplication %s are pending: %s",
+			app.Name, formatPendingExecutorReasons(app.Status.PendingExecutors))
+	}
+}
+
+// hasAnyExecutorRun tells if any executor of the current run of the application was ever running.
+func hasAnyExecutorRun(app *v1beta2.SparkApplication) bool {
+	for _, state := range app.Status.ExecutorState {
+		if state == v1beta2.ExecutorRunningState || state == v1beta2.ExecutorCompletedState {
+			return true
+		}
+	}
+	return false
+}
+
+// getDriverStartTime returns when the driver container started running.
+func getDriverStartTime(driverPod *apiv1.Pod) *metav1.Time {
+	for _, c := range driverPod.Status.ContainerStatuses {
+		if c.Name == config.SparkDriverContainerName && c.State.Running != nil {
+			return &c.State.Running.StartedAt
+		}
+	}
+	return driverPod.Status.StartTime
+}
+
+// getExecutorPendingTimeLeft returns how much longer the running application may go without any running
+// executor before it exceeds the executor pending timeout since the driver started. It returns false if the
+// application has no executor pending timeout, or it doesn't apply because an executor has already run.
+func (c *Controller) getExecutorPendingTimeLeft(app *v1beta2.SparkApplication) (time.Duration, bool, error) {
+	timeoutSeconds := c.executorPendingTimeoutSeconds
+	if app.Spec.Executor.PendingTimeoutSeconds != nil {
+		timeoutSeconds = *app.Spec.Executor.PendingTimeoutSeconds
+	}
+	if timeoutSeconds <= 0 || app.Status.AppState.State != v1beta2.RunningState || hasAnyExecutorRun(app) {
+		return 0, false, nil
+	}
+
+	driverPod, err := c.getDriverPod(app)
+	if err != nil || driverPod == nil {
+		return 0, false, err
+	}
+	startTime := getDriverStartTime(driverPod)
+	if startTime == nil || startTime.IsZero() {
+		return 0, false, nil
+	}
+	return time.Until(startTime.Add(time.Duration(timeoutSeconds) * time.Second)), true, nil
+}
+
+// failOnExecutorPendingTimeout deletes the driver pod of an application whose executors never started
+// running, which also deletes the executor pods, and fails the application.
+func (c *Controller) failOnExecutorPendingTimeout(app *v1beta2.SparkApplication) error {
+	driverPodName := app.Status.DriverInfo.PodName
+	glog.Infof("No executor of SparkApplication %s/%s has started running within its pending timeout, deleting driver pod %s",
+		app.Namespace, app.Name, driverPodName)
+	err := c.kubeClient.CoreV1().Pods(app.Namespace).Delete(context.TODO(), driverPodName, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete driver pod %s/%s: %v", app.Namespace, driverPodName, err)
+	}
+
+	message := "no executor became running within the executor pending timeout"
+	if len(app.Status.PendingExecutors) > 0 {
+		message = fmt.Sprintf("%s: %s", message, formatPendingExecutorReasons(app.Status.PendingExecutors))
+	}
+	app.Status.AppState.ErrorMessage = message
+	app.Status.AppState.State = v1beta2.FailingState
+	app.Status.FailureReason = classifyPendingExecutors(app.Status.PendingExecutors)
+	app.Status.TerminationTime = metav1.Now()
+	c.recordDriverEvent(app, v1beta2.DriverFailedState, driverPodName)
+	return nil
+}
+
+func classifyPendingExecutors(reasons []v1beta2.PendingExecutorReason) v1beta2.FailureReason {
+	for _, r := range reasons {
+		if r.Reason == apiv1.PodReasonUnschedulable {
+			return v1beta2.UnschedulableFailure
+		}
+		if imagePullWaitingReasons[r.Reason] {
+			return v1beta2.ImagePullFailure
+		}
+	}
+	return v1beta2.TimeoutFailure
+}
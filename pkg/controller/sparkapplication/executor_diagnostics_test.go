@@ -0,0 +1,273 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+)
+
+const unschedulableMessage = "0/3 nodes are available: 3 Insufficient cpu."
+
+func newPendingExecutorPod(name string, status apiv1.PodStatus) *apiv1.Pod {
+	status.Phase = apiv1.PodPending
+	return &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "test",
+			Labels: map[string]string{
+				config.SparkRoleLabel:    config.SparkExecutorRole,
+				config.SparkAppNameLabel: "foo",
+			},
+		},
+		Status: status,
+	}
+}
+
+func unschedulableStatus() apiv1.PodStatus {
+	return apiv1.PodStatus{
+		Conditions: []apiv1.PodCondition{
+			{
+				Type:    apiv1.PodScheduled,
+				Status:  apiv1.ConditionFalse,
+				Reason:  apiv1.PodReasonUnschedulable,
+				Message: unschedulableMessage,
+			},
+		},
+	}
+}
+
+func TestGetPendingExecutorReasons(t *testing.T) {
+	imagePull := apiv1.PodStatus{
+		ContainerStatuses: []apiv1.ContainerStatus{
+			{
+				Name:  config.Spark3DefaultExecutorContainerName,
+				State: apiv1.ContainerState{Waiting: &apiv1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+			},
+		},
+	}
+	creating := apiv1.PodStatus{
+		ContainerStatuses: []apiv1.ContainerStatus{
+			{
+				Name:  config.Spark3DefaultExecutorContainerName,
+				State: apiv1.ContainerState{Waiting: &apiv1.ContainerStateWaiting{Reason: "ContainerCreating"}},
+			},
+		},
+	}
+	running := newPendingExecutorPod("exec-5", apiv1.PodStatus{})
+	running.Status.Phase = apiv1.PodRunning
+
+	reasons := getPendingExecutorReasons([]*apiv1.Pod{
+		newPendingExecutorPod("exec-1", unschedulableStatus()),
+		newPendingExecutorPod("exec-2", imagePull),
+		newPendingExecutorPod("exec-3", unschedulableStatus()),
+		newPendingExecutorPod("exec-4", creating),
+		running,
+	})
+	assert.Equal(t, []v1beta2.PendingExecutorReason{
+		{Reason: apiv1.PodReasonUnschedulable, Message: unschedulableMessage, Count: 2},
+		{Reason: "ImagePullBackOff", Count: 1},
+	}, reasons)
+	assert.Equal(t, v1beta2.UnschedulableFailure, classifyPendingExecutors(reasons))
+	assert.Equal(t, v1beta2.TimeoutFailure, classifyPendingExecutors(nil))
+}
+
+func TestEventThrottle(t *testing.T) {
+	throttle := newEventThrottle(time.Minute)
+	now := time.Now()
+	assert.True(t, throttle.allow("test/foo", now))
+	assert.False(t, throttle.allow("test/foo", now.Add(30*time.Second)))
+	assert.True(t, throttle.allow("test/bar", now.Add(30*time.Second)))
+	assert.True(t, throttle.allow("test/foo", now.Add(2*time.Minute)))
+	throttle.forget("test/bar")
+	assert.True(t, throttle.allow("test/bar", now.Add(time.Minute)))
+}
+
+func TestSyncSparkApplication_ExecutorPendingTimeout(t *testing.T) {
+	appName := "foo"
+	driverPodName := appName + "-driver"
+
+	newApp := func(executorState map[string]v1beta2.ExecutorState) *v1beta2.SparkApplication {
+		return &v1beta2.SparkApplication{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      appName,
+				Namespace: "test",
+			},
+			Spec: v1beta2.SparkApplicationSpec{
+				RestartPolicy: v1beta2.RestartPolicy{
+					Type: v1beta2.Never,
+				},
+				Executor: v1beta2.ExecutorSpec{
+					PendingTimeoutSeconds: int64ptr(60),
+				},
+			},
+			Status: v1beta2.SparkApplicationStatus{
+				AppState: v1beta2.ApplicationState{
+					State: v1beta2.RunningState,
+				},
+				DriverInfo: v1beta2.DriverInfo{
+					PodName: driverPodName,
+				},
+				ExecutorState: executorState,
+			},
+		}
+	}
+	driverPod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      driverPodName,
+			Namespace: "test",
+			Labels: map[string]string{
+				config.SparkRoleLabel:    config.SparkDriverRole,
+				config.SparkAppNameLabel: appName,
+			},
+		},
+		Status: apiv1.PodStatus{
+			Phase: apiv1.PodRunning,
+			ContainerStatuses: []apiv1.ContainerStatus{
+				{
+					Name: config.SparkDriverContainerName,
+					State: apiv1.ContainerState{
+						Running: &apiv1.ContainerStateRunning{StartedAt: metav1.NewTime(time.Now().Add(-10 * time.Minute))},
+					},
+				},
+			},
+		},
+	}
+	executorPod := newPendingExecutorPod("exec-1", unschedulableStatus())
+
+	type testcase struct {
+		name          string
+		executorState map[string]v1beta2.ExecutorState
+		expectedState v1beta2.ApplicationStateType
+	}
+	testcases := []testcase{
+		{
+			name:          "no executor ever running",
+			expectedState: v1beta2.FailingState,
+		},
+		{
+			name:          "executor was running before",
+			executorState: map[string]v1beta2.ExecutorState{"exec-0": v1beta2.ExecutorCompletedState},
+			expectedState: v1beta2.RunningState,
+		},
+	}
+
+	for _, test := range testcases {
+		app := newApp(test.executorState)
+		ctrl, recorder := newFakeController(app, driverPod, executorPod)
+		_, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Create(context.TODO(), app, metav1.CreateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Nil(t, ctrl.syncSparkApplication(fmt.Sprintf("%s/%s", app.Namespace, app.Name)), test.name)
+
+		updatedApp, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, test.expectedState, updatedApp.Status.AppState.State, test.name)
+		assert.Equal(t, []v1beta2.PendingExecutorReason{
+			{Reason: apiv1.PodReasonUnschedulable, Message: unschedulableMessage, Count: 1},
+		}, updatedApp.Status.PendingExecutors, test.name)
+		if test.expectedState == v1beta2.FailingState {
+			assert.Equal(t, v1beta2.UnschedulableFailure, updatedApp.Status.FailureReason, test.name)
+			assert.Contains(t, updatedApp.Status.AppState.ErrorMessage, unschedulableMessage, test.name)
+		}
+
+		var pendingEvents int
+		for len(recorder.Events) > 0 {
+			event := <-recorder.Events
+			if strings.Contains(event, "SparkExecutorsPending") {
+				pendingEvents++
+			}
+		}
+		assert.Equal(t, 1, pendingEvents, test.name)
+	}
+}
+
+func TestSyncSparkApplication_ExecutorPendingTimeoutRequeue(t *testing.T) {
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "test",
+		},
+		Spec: v1beta2.SparkApplicationSpec{
+			RestartPolicy: v1beta2.RestartPolicy{
+				Type: v1beta2.Never,
+			},
+			Executor: v1beta2.ExecutorSpec{
+				PendingTimeoutSeconds: int64ptr(60),
+			},
+		},
+		Status: v1beta2.SparkApplicationStatus{
+			AppState: v1beta2.ApplicationState{
+				State: v1beta2.RunningState,
+			},
+			DriverInfo: v1beta2.DriverInfo{
+				PodName: "foo-driver",
+			},
+		},
+	}
+	// The driver runs without any executor pod and without any further update, and the executor pending
+	// timeout is exceeded in a second.
+	driverPod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo-driver",
+			Namespace: "test",
+			Labels: map[string]string{
+				config.SparkRoleLabel:    config.SparkDriverRole,
+				config.SparkAppNameLabel: "foo",
+			},
+		},
+		Status: apiv1.PodStatus{
+			Phase: apiv1.PodRunning,
+			ContainerStatuses: []apiv1.ContainerStatus{
+				{
+					Name: config.SparkDriverContainerName,
+					State: apiv1.ContainerState{
+						Running: &apiv1.ContainerStateRunning{StartedAt: metav1.NewTime(time.Now().Add(-59 * time.Second))},
+					},
+				},
+			},
+		},
+	}
+	ctrl, _ := newFakeController(app, driverPod)
+	_, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Create(context.TODO(), app, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, ctrl.syncSparkApplication("test/foo"))
+	updatedApp, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, v1beta2.RunningState, updatedApp.Status.AppState.State)
+
+	processNextItemWithTimeout(t, ctrl, 10*time.Second)
+	updatedApp, err = ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, v1beta2.FailingState, updatedApp.Status.AppState.State)
+	assert.Equal(t, v1beta2.TimeoutFailure, updatedApp.Status.FailureReason)
+}
@@ -0,0 +1,325 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	v1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+)
+
+const (
+	// failureRulesConfigMapKey is the key in the rules ConfigMap holding the list of custom rules.
+	failureRulesConfigMapKey = "rules.yaml"
+	// defaultFailureLogTailLines is the default number of driver log lines custom rules are matched against.
+	defaultFailureLogTailLines int64 = 50
+
+	oomKilledReason        = "OOMKilled"
+	evictedReason          = "Evicted"
+	deadlineExceededReason = "DeadlineExceeded"
+	failedSchedulingReason = "FailedScheduling"
+)
+
+// failureRuleSource tells which piece of failure information a custom rule is matched against.
+type failureRuleSource string
+
+const (
+	// terminationMessageSource matches against the termination message of the driver container.
+	terminationMessageSource failureRuleSource = "terminationMessage"
+	// logTailSource matches against the last lines of the driver container log.
+	logTailSource failureRuleSource = "logTail"
+	// submissionErrorSource matches against the error output of spark-submit.
+	submissionErrorSource failureRuleSource = "submissionError"
+)
+
+var imagePullWaitingReasons = map[string]bool{
+	"ErrImagePull":      true,
+	"ImagePullBackOff":  true,
+	"InvalidImageName":  true,
+	"ErrImageNeverPull": true,
+}
+
+// failureRule is a custom classification rule that maps a regular expression over some failure
+// information to a failure reason.
+type failureRule struct {
+	// Reason is the failure reason reported if the rule matches.
+	Reason string `json:"reason"`
+	// Source is the failure information to match. Defaults to terminationMessage.
+	Source failureRuleSource `json:"source,omitempty"`
+	// Pattern is the regular expression to match.
+	Pattern string `json:"pattern"`
+
+	regex *regexp.Regexp
+}
+
+// failureClassifier derives a v1beta2.FailureReason for failed applications from the status of
+// their pods, the events recorded for them, and the error of spark-submit.
+type failureClassifier struct {
+	kubeClient clientset.Interface
+	// rulesConfigMap is the namespace/name of an optional ConfigMap with custom rules.
+	rulesConfigMap string
+	// rulesInformer watches the rules ConfigMap, or is nil if there is none.
+	rulesInformer cache.SharedIndexInformer
+	rulesLister   v1.ConfigMapLister
+	logTailLines  int64
+}
+
+func newFailureClassifier(kubeClient clientset.Interface, rulesConfigMap string) *failureClassifier {
+	classifier := &failureClassifier{
+		kubeClient:     kubeClient,
+		rulesConfigMap: rulesConfigMap,
+		logTailLines:   defaultFailureLogTailLines,
+	}
+	if rulesConfigMap == "" {
+		return classifier
+	}
+	namespace, name, err := cache.SplitMetaNamespaceKey(rulesConfigMap)
+	if err != nil {
+		glog.Errorf("invalid failure classification rules ConfigMap %s: %v", rulesConfigMap, err)
+		return classifier
+	}
+	// Only the rules ConfigMap is watched, so rule changes take effect without restarting the operator
+	// and without reading the ConfigMap every time a failure is classified.
+	classifier.rulesInformer = coreinformers.NewFilteredConfigMapInformer(kubeClient, namespace, 0, cache.Indexers{},
+		func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		})
+	classifier.rulesLister = v1.NewConfigMapLister(classifier.rulesInformer.GetIndexer())
+	return classifier
+}
+
+// start starts watching the rules ConfigMap and waits until it is synced.
+func (f *failureClassifier) start(stopCh <-chan struct{}) error {
+	if f.rulesInformer == nil {
+		return nil
+	}
+	go f.rulesInformer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, f.rulesInformer.HasSynced) {
+		return fmt.Errorf("timed out waiting for the failure classification rules cache to sync")
+	}
+	return nil
+}
+
+// loadRules reads the custom rules from the cached rules ConfigMap.
+func (f *failureClassifier) loadRules() ([]failureRule, error) {
+	if f.rulesLister == nil {
+		return nil, nil
+	}
+	namespace, name, err := cache.SplitMetaNamespaceKey(f.rulesConfigMap)
+	if err != nil {
+		return nil, err
+	}
+	cm, err := f.rulesLister.ConfigMaps(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return parseFailureRules(cm.Data[failureRulesConfigMapKey])
+}
+
+func parseFailureRules(data string) ([]failureRule, error) {
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+	var rules []failureRule
+	decoder := yaml.NewYAMLOrJSONDecoder(strings.NewReader(data), len(data))
+	if err := decoder.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("failed to parse failure classification rules: %v", err)
+	}
+	for i := range rules {
+		if rules[i].Reason == "" {
+			return nil, fmt.Errorf("failure classification rule %d has no reason", i)
+		}
+		if rules[i].Source == "" {
+			rules[i].Source = terminationMessageSource
+		}
+		regex, err := regexp.Compile(rules[i].Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern in failure classification rule %d: %v", i, err)
+		}
+		rules[i].regex = regex
+	}
+	return rules, nil
+}
+
+// matchRules returns the reason of the first rule whose source text matches. The texts are
+// fetched lazily since getting the log tail requires a call to the API server.
+func matchRules(rules []failureRule, texts map[failureRuleSource]func() string) v1beta2.FailureReason {
+	cached := make(map[failureRuleSource]string)
+	for _, rule := range rules {
+		getText, ok := texts[rule.Source]
+		if !ok {
+			continue
+		}
+		text, fetched := cached[rule.Source]
+		if !fetched {
+			text = getText()
+			cached[rule.Source] = text
+		}
+		if text != "" && rule.regex.MatchString(text) {
+			return v1beta2.FailureReason(rule.Reason)
+		}
+	}
+	return ""
+}
+
+func (f *failureClassifier) rules() []failureRule {
+	rules, err := f.loadRules()
+	if err != nil {
+		glog.Errorf("failed to load failure classification rules from %s: %v", f.rulesConfigMap, err)
+		return nil
+	}
+	return rules
+}
+
+// classifySubmissionFailure classifies a failed submission from the error of spark-submit.
+func (f *failureClassifier) classifySubmissionFailure(submissionErr error) v1beta2.FailureReason {
+	if reason := matchRules(f.rules(), map[failureRuleSource]func() string{
+		submissionErrorSource: func() string { return submissionErr.Error() },
+	}); reason != "" {
+		return reason
+	}
+	return v1beta2.SubmissionFailure
+}
+
+// classifyDriverFailure classifies the failure of the given driver pod.
+func (f *failureClassifier) classifyDriverFailure(driverPod *apiv1.Pod) v1beta2.FailureReason {
+	terminated := getDriverContainerTerminatedState(driverPod.Status)
+	if reason := matchRules(f.rules(), map[failureRuleSource]func() string{
+		terminationMessageSource: func() string {
+			if terminated == nil {
+				return driverPod.Status.Message
+			}
+			return terminated.Message
+		},
+		logTailSource: func() string { return f.getDriverLogTail(driverPod) },
+	}); reason != "" {
+		return reason
+	}
+	return classifyDriverPodStatus(driverPod.Status)
+}
+
+// classifyMissingDriver classifies the failure of an application whose driver pod is gone by
+// looking at the events recorded for the driver pod.
+func (f *failureClassifier) classifyMissingDriver(app *v1beta2.SparkApplication, driverPodName string) v1beta2.FailureReason {
+	events, err := f.kubeClient.CoreV1().Events(app.Namespace).List(context.TODO(), metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("involvedObject.kind=Pod,involvedObject.name=%s", driverPodName),
+	})
+	if err != nil {
+		glog.Errorf("failed to list events of driver pod %s/%s: %v", app.Namespace, driverPodName, err)
+		return v1beta2.UnknownFailure
+	}
+
+	reason := v1beta2.UnknownFailure
+	for _, event := range events.Items {
+		if event.InvolvedObject.Name != driverPodName {
+			continue
+		}
+		switch {
+		case event.Reason == evictedReason:
+			// Eviction explains why the pod is gone, so it takes precedence over anything else.
+			return v1beta2.EvictedFailure
+		case event.Reason == failedSchedulingReason:
+			reason = v1beta2.UnschedulableFailure
+		case strings.Contains(event.Message, "ImagePullBackOff") || strings.Contains(event.Message, "ErrImagePull"):
+			reason = v1beta2.ImagePullFailure
+		}
+	}
+	return reason
+}
+
+// classifyExecutorFailures refines the failure reason of a failing application with the state
+// of its executor pods. A driver that failed after executors were OOM-killed most likely failed
+// because of that.
+func classifyExecutorFailures(app *v1beta2.SparkApplication, executorPods []*apiv1.Pod) {
+	if app.Status.AppState.State != v1beta2.FailingState {
+		return
+	}
+	if app.Status.FailureReason != v1beta2.UserCodeFailure && app.Status.FailureReason != v1beta2.UnknownFailure {
+		return
+	}
+	for _, pod := range executorPods {
+		if state := getExecutorContainerTerminatedState(pod.Status); state != nil && state.Reason == oomKilledReason {
+			app.Status.FailureReason = v1beta2.ExecutorOOMKilledFailure
+			return
+		}
+	}
+}
+
+// classifyDriverPodStatus applies the built-in classification to the status of a driver pod.
+func classifyDriverPodStatus(podStatus apiv1.PodStatus) v1beta2.FailureReason {
+	switch podStatus.Reason {
+	case evictedReason:
+		return v1beta2.EvictedFailure
+	case deadlineExceededReason:
+		return v1beta2.TimeoutFailure
+	}
+
+	for _, c := range podStatus.ContainerStatuses {
+		if c.Name != config.SparkDriverContainerName {
+			continue
+		}
+		if c.State.Waiting != nil && imagePullWaitingReasons[c.State.Waiting.Reason] {
+			return v1beta2.ImagePullFailure
+		}
+	}
+
+	for _, condition := range podStatus.Conditions {
+		if condition.Type == apiv1.PodScheduled && condition.Status == apiv1.ConditionFalse &&
+			condition.Reason == apiv1.PodReasonUnschedulable {
+			return v1beta2.UnschedulableFailure
+		}
+	}
+
+	if state := getDriverContainerTerminatedState(podStatus); state != nil {
+		if state.Reason == oomKilledReason {
+			return v1beta2.DriverOOMKilledFailure
+		}
+		if state.ExitCode != 0 {
+			return v1beta2.UserCodeFailure
+		}
+	}
+
+	return v1beta2.UnknownFailure
+}
+
+func (f *failureClassifier) getDriverLogTail(driverPod *apiv1.Pod) string {
+	tailLines := f.logTailLines
+	request := f.kubeClient.CoreV1().Pods(driverPod.Namespace).GetLogs(driverPod.Name, &apiv1.PodLogOptions{
+		Container: config.SparkDriverContainerName,
+		TailLines: &tailLines,
+	})
+	logs, err := request.Do(context.TODO()).Raw()
+	if err != nil {
+		glog.Errorf("failed to get logs of driver pod %s/%s: %v", driverPod.Namespace, driverPod.Name, err)
+		return ""
+	}
+	return string(logs)
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeclientfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+)
+
+func TestClassifyDriverPodStatus(t *testing.T) {
+	type testcase struct {
+		name     string
+		status   apiv1.PodStatus
+		expected v1beta2.FailureReason
+	}
+
+	terminated := func(exitCode int32, reason string) apiv1.PodStatus {
+		return apiv1.PodStatus{
+			Phase: apiv1.PodFailed,
+			ContainerStatuses: []apiv1.ContainerStatus{
+				{
+					Name: config.SparkDriverContainerName,
+					State: apiv1.ContainerState{
+						Terminated: &apiv1.ContainerStateTerminated{ExitCode: exitCode, Reason: reason},
+					},
+				},
+			},
+		}
+	}
+
+	testcases := []testcase{
+		{
+			name:     "evicted",
+			status:   apiv1.PodStatus{Phase: apiv1.PodFailed, Reason: "Evicted"},
+			expected: v1beta2.EvictedFailure,
+		},
+		{
+			name:     "deadline exceeded",
+			status:   apiv1.PodStatus{Phase: apiv1.PodFailed, Reason: "DeadlineExceeded"},
+			expected: v1beta2.TimeoutFailure,
+		},
+		{
+			name: "image pull back-off",
+			status: apiv1.PodStatus{
+				Phase: apiv1.PodPending,
+				ContainerStatuses: []apiv1.ContainerStatus{
+					{
+						Name:  config.SparkDriverContainerName,
+						State: apiv1.ContainerState{Waiting: &apiv1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+					},
+				},
+			},
+			expected: v1beta2.ImagePullFailure,
+		},
+		{
+			name: "unschedulable",
+			status: apiv1.PodStatus{
+				Phase: apiv1.PodPending,
+				Conditions: []apiv1.PodCondition{
+					{
+						Type:   apiv1.PodScheduled,
+						Status: apiv1.ConditionFalse,
+						Reason: apiv1.PodReasonUnschedulable,
+					},
+				},
+			},
+			expected: v1beta2.UnschedulableFailure,
+		},
+		{
+			name:     "OOM-killed",
+			status:   terminated(137, "OOMKilled"),
+			expected: v1beta2.DriverOOMKilledFailure,
+		},
+		{
+			name:     "non-zero exit code",
+			status:   terminated(1, "Error"),
+			expected: v1beta2.UserCodeFailure,
+		},
+		{
+			name:     "no information",
+			status:   apiv1.PodStatus{Phase: apiv1.PodFailed},
+			expected: v1beta2.UnknownFailure,
+		},
+	}
+
+	for _, test := range testcases {
+		assert.Equal(t, test.expected, classifyDriverPodStatus(test.status), test.name)
+	}
+}
+
+func TestClassifyDriverFailureWithCustomRules(t *testing.T) {
+	rules := `
+- reason: StorageThrottled
+  source: logTail
+  pattern: "SlowDown"
+- reason: MissingTable
+  pattern: "Table or view not found"
+`
+	kubeClient := kubeclientfake.NewSimpleClientset(&apiv1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "failure-rules", Namespace: "spark-operator"},
+		Data:       map[string]string{failureRulesConfigMapKey: rules},
+	})
+	classifier := newFailureClassifier(kubeClient, "spark-operator/failure-rules")
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	assert.Nil(t, classifier.start(stopCh))
+
+	driverPod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo-driver", Namespace: "default"},
+		Status: apiv1.PodStatus{
+			Phase: apiv1.PodFailed,
+			ContainerStatuses: []apiv1.ContainerStatus{
+				{
+					Name: config.SparkDriverContainerName,
+					State: apiv1.ContainerState{
+						Terminated: &apiv1.ContainerStateTerminated{
+							ExitCode: 1,
+							Message:  "AnalysisException: Table or view not found: db.events",
+						},
+					},
+				},
+			},
+		},
+	}
+	assert.Equal(t, v1beta2.FailureReason("MissingTable"), classifier.classifyDriverFailure(driverPod))
+
+	// Without a matching rule the built-in classification applies.
+	driverPod.Status.ContainerStatuses[0].State.Terminated.Message = "something else"
+	assert.Equal(t, v1beta2.UserCodeFailure, classifier.classifyDriverFailure(driverPod))
+
+	assert.Equal(t, v1beta2.SubmissionFailure, classifier.classifySubmissionFailure(fmt.Errorf("exit status 1")))
+}
+
+func TestParseFailureRules(t *testing.T) {
+	rules, err := parseFailureRules(`[{"reason": "Quota", "source": "submissionError", "pattern": "exceeded quota"}]`)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rules))
+	assert.Equal(t, submissionErrorSource, rules[0].Source)
+	assert.Equal(t, v1beta2.FailureReason("Quota"), matchRules(rules, map[failureRuleSource]func() string{
+		submissionErrorSource: func() string { return "pods is forbidden: exceeded quota: compute" },
+	}))
+
+	_, err = parseFailureRules(`[{"reason": "Bad", "pattern": "("}]`)
+	assert.NotNil(t, err)
+	_, err = parseFailureRules(`[{"pattern": "foo"}]`)
+	assert.NotNil(t, err)
+}
+
+func TestClassifyMissingDriver(t *testing.T) {
+	app := &v1beta2.SparkApplication{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+	kubeClient := kubeclientfake.NewSimpleClientset(&apiv1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "foo-driver.1", Namespace: "default"},
+		InvolvedObject: apiv1.ObjectReference{Kind: "Pod", Name: "foo-driver", Namespace: "default"},
+		Reason:         "Evicted",
+		Message:        "The node was low on resource: memory.",
+	})
+	classifier := newFailureClassifier(kubeClient, "")
+	assert.Equal(t, v1beta2.EvictedFailure, classifier.classifyMissingDriver(app, "foo-driver"))
+	assert.Equal(t, v1beta2.UnknownFailure, classifier.classifyMissingDriver(app, "bar-driver"))
+}
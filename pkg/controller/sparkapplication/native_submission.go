@@ -0,0 +1,772 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/golang/glog"
+	"github.com/google/uuid"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientset "k8s.io/client-go/kubernetes"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+)
+
+// The native submission backend creates the driver pod, the ConfigMap holding the Spark properties
+// of the driver and the headless driver service the same way spark-submit does in cluster mode
+// (see KubernetesClientApplication and KubernetesDriverBuilder of Spark 3.1), without forking a JVM.
+// It works from the spark-submit arguments built by buildSubmissionCommandArgs so that both backends
+// submit applications with exactly the same configuration.
+//
+// It also creates the driver of applications in in-cluster client mode, which spark-submit can't do.
+// The driver pod is the same as in cluster mode, as the Spark image runs spark-submit in client mode
+// in the driver pod anyway, but Spark is told the application runs in client mode.
+
+const (
+	nativeDriverRPCPortName        = "driver-rpc-port"
+	nativeBlockManagerPortName     = "blockmanager"
+	nativeUIPortName               = "spark-ui"
+	nativeDefaultDriverPort        = 7078
+	nativeDefaultBlockManagerPort  = 7079
+	nativeDefaultUIPort            = 4040
+	nativeSparkConfVolumeName      = "spark-conf-volume-driver"
+	nativeSparkPropertiesFileName  = "spark.properties"
+	nativeDefaultLocalDirVolume    = config.SparkLocalDirVolumePrefix + "1"
+	nativeDriverBindAddressEnvVar  = "SPARK_DRIVER_BIND_ADDRESS"
+	nativeLocalDirsEnvVar          = "SPARK_LOCAL_DIRS"
+	nativePySparkPythonEnvVar      = "PYSPARK_PYTHON"
+	nativePySparkDriverEnvVar      = "PYSPARK_DRIVER_PYTHON"
+	nativePythonRunnerClass        = "org.apache.spark.deploy.PythonRunner"
+	nativeRRunnerClass             = "org.apache.spark.deploy.RRunner"
+	nativeNoPrimaryResource        = "spark-internal"
+	nativeClientModeTokenFileKey   = "spark.kubernetes.authenticate.oauthTokenFile"
+	nativeClientModeCACertFileKey  = "spark.kubernetes.authenticate.caCertFile"
+	nativeServiceAccountTokenFile  = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	nativeServiceAccountCACertFile = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	nativeMinMemoryOverheadMiB     = 384
+	nativeJVMMemoryOverheadFactor  = 0.1
+	nativeNonJVMMemoryOverhead     = 0.4
+	maxKubernetesServiceNameLen    = 63
+)
+
+// sparkSubmitOptionConfs maps the spark-submit options used by buildSubmissionCommandArgs to the
+// Spark properties spark-submit sets from them.
+var sparkSubmitOptionConfs = map[string]string{
+	"--jars":             "spark.jars",
+	"--files":            "spark.files",
+	"--py-files":         "spark.submit.pyFiles",
+	"--packages":         "spark.jars.packages",
+	"--exclude-packages": "spark.jars.excludes",
+	"--repositories":     "spark.jars.repositories",
+}
+
+// sparkSubmitArgs are the parsed arguments of spark-submit.
+type sparkSubmitArgs struct {
+	mainClass       string
+	master          string
+	deployMode      string
+	proxyUser       string
+	conf            map[string]string
+	primaryResource string
+	appArgs         []string
+}
+
+func parseSparkSubmitArgs(args []string) (*sparkSubmitArgs, error) {
+	parsed := &sparkSubmitArgs{conf: make(map[string]string)}
+	// Options given on the command line take precedence over the same properties set with --conf.
+	optionConfs := make(map[string]string)
+	i := 0
+	for ; i < len(args) && strings.HasPrefix(args[i], "--"); i += 2 {
+		if i+1 >= len(args) {
+			return nil, fmt.Errorf("missing value of spark-submit option %s", args[i])
+		}
+		option, value := args[i], args[i+1]
+		switch option {
+		case "--class":
+			parsed.mainClass = value
+		case "--master":
+			parsed.master = value
+		case "--deploy-mode":
+			parsed.deployMode = value
+		case "--proxy-user":
+			parsed.proxyUser = value
+		case "--conf":
+			kv := strings.SplitN(value, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("invalid Spark property %q", value)
+			}
+			parsed.conf[kv[0]] = kv[1]
+		default:
+			key, ok := sparkSubmitOptionConfs[option]
+			if !ok {
+				return nil, fmt.Errorf("unsupported spark-submit option %s", option)
+			}
+			optionConfs[key] = value
+		}
+	}
+	for key, value := range optionConfs {
+		parsed.conf[key] = value
+	}
+	if i < len(args) {
+		parsed.primaryResource = args[i]
+		parsed.appArgs = args[i+1:]
+	}
+	return parsed, nil
+}
+
+func (a *sparkSubmitArgs) isPython() bool {
+	return strings.HasSuffix(a.primaryResource, ".py")
+}
+
+func (a *sparkSubmitArgs) isR() bool {
+	return strings.HasSuffix(a.primaryResource, ".R") || strings.HasSuffix(a.primaryResource, ".r")
+}
+
+func (a *sparkSubmitArgs) get(key, defaultValue string) string {
+	if value, ok := a.conf[key]; ok {
+		return value
+	}
+	return defaultValue
+}
+
+// withPrefix returns the properties whose key starts with the given prefix, keyed by the rest of the key.
+func (a *sparkSubmitArgs) withPrefix(prefix string) map[string]string {
+	result := make(map[string]string)
+	for key, value := range a.conf {
+		if strings.HasPrefix(key, prefix) {
+			result[strings.TrimPrefix(key, prefix)] = value
+		}
+	}
+	return result
+}
+
+// nativeIDs are the identifiers spark-submit generates randomly for every submission.
+type nativeIDs struct {
+	// appID is the Spark application ID, which is also the value of the spark-app-selector label.
+	appID string
+	// uniqueID is a 16-character hex ID used in the names of the resources created for the driver.
+	uniqueID string
+	// configMapID is the hex ID in the name of the ConfigMap holding the Spark properties.
+	configMapID string
+	// localDirID is the UUID in the path of the default local directory.
+	localDirID string
+}
+
+func newNativeIDs() nativeIDs {
+	return nativeIDs{
+		appID:       "spark-" + strings.Replace(uuid.New().String(), "-", "", -1),
+		uniqueID:    randomHexID(),
+		configMapID: randomHexID(),
+		localDirID:  uuid.New().String(),
+	}
+}
+
+func randomHexID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		glog.Errorf("failed to generate a random ID: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// nativeDriver holds the objects created for the driver of an application.
+type nativeDriver struct {
+	pod       *apiv1.Pod
+	configMap *apiv1.ConfigMap
+	service   *apiv1.Service
+}
+
+var (
+	invalidResourceNameChars = regexp.MustCompile(`[^a-z0-9\-]`)
+	repeatedDashes           = regexp.MustCompile(`-+`)
+	sparkMemoryPattern       = regexp.MustCompile(`^([0-9]+)([a-z]*)$`)
+	// sparkMemoryUnits are the units of Spark memory settings in MiB.
+	sparkMemoryUnits = map[string]float64{
+		"b": 1.0 / (1 << 20), "k": 1.0 / (1 << 10), "kb": 1.0 / (1 << 10), "": 1, "m": 1, "mb": 1,
+		"g": 1 << 10, "gb": 1 << 10, "t": 1 << 20, "tb": 1 << 20, "p": 1 << 30, "pb": 1 << 30,
+	}
+)
+
+func getNativeResourceNamePrefix(appName string, uniqueID string) string {
+	prefix := strings.ToLower(strings.TrimSpace(fmt.Sprintf("%s-%s", appName, uniqueID)))
+	prefix = invalidResourceNameChars.ReplaceAllString(prefix, "-")
+	return repeatedDashes.ReplaceAllString(prefix, "-")
+}
+
+// checkNoLocalDependencies fails the submission if any dependency is a file local to the operator,
+// which spark-submit would upload to spark.kubernetes.file.upload.path.
+func checkNoLocalDependencies(args *sparkSubmitArgs) error {
+	deps := []string{args.primaryResource}
+	for _, key := range []string{"spark.jars", "spark.files", "spark.submit.pyFiles"} {
+		if value := args.conf[key]; value != "" {
+			deps = append(deps, strings.Split(value, ",")...)
+		}
+	}
+	for _, dep := range deps {
+		if dep == "" {
+			continue
+		}
+		u, err := url.Parse(dep)
+		if err != nil {
+			return fmt.Errorf("invalid dependency %s: %v", dep, err)
+		}
+		if u.Scheme == "" || u.Scheme == "file" {
+			return fmt.Errorf("the native submission backend does not upload local dependencies, use a local:// or remote URI for %s", dep)
+		}
+	}
+	return nil
+}
+
+// parseSparkMemoryMiB parses a Spark memory setting, which is in MiB if it has no unit.
+func parseSparkMemoryMiB(value string) (int64, error) {
+	matches := sparkMemoryPattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(value)))
+	if matches == nil {
+		return 0, fmt.Errorf("invalid memory setting %q", value)
+	}
+	unit, ok := sparkMemoryUnits[matches[2]]
+	if !ok {
+		return 0, fmt.Errorf("invalid memory setting %q", value)
+	}
+	amount, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(float64(amount) * unit), nil
+}
+
+func getDriverResources(args *sparkSubmitArgs, nonJVM bool) (apiv1.ResourceRequirements, string, error) {
+	memoryMiB, err := parseSparkMemoryMiB(args.get("spark.driver.memory", "1g"))
+	if err != nil {
+		return apiv1.ResourceRequirements{}, "", err
+	}
+	overheadFactor := nativeJVMMemoryOverheadFactor
+	if nonJVM {
+		overheadFactor = nativeNonJVMMemoryOverhead
+	}
+	if value, ok := args.conf[config.SparkMemoryOverheadFactor]; ok {
+		if overheadFactor, err = strconv.ParseFloat(value, 64); err != nil {
+			return apiv1.ResourceRequirements{}, "", fmt.Errorf("invalid %s %q: %v", config.SparkMemoryOverheadFactor, value, err)
+		}
+	}
+	overheadMiB := int64(math.Max(float64(int64(overheadFactor*float64(memoryMiB))), nativeMinMemoryOverheadMiB))
+	if value, ok := args.conf["spark.driver.memoryOverhead"]; ok {
+		if overheadMiB, err = parseSparkMemoryMiB(value); err != nil {
+			return apiv1.ResourceRequirements{}, "", err
+		}
+	}
+	memory, err := resource.ParseQuantity(fmt.Sprintf("%dMi", memoryMiB+overheadMiB))
+	if err != nil {
+		return apiv1.ResourceRequirements{}, "", err
+	}
+	cpu, err := resource.ParseQuantity(args.get(config.SparkDriverCoreRequestKey, args.get("spark.driver.cores", "1")))
+	if err != nil {
+		return apiv1.ResourceRequirements{}, "", fmt.Errorf("invalid driver cores: %v", err)
+	}
+	resources := apiv1.ResourceRequirements{
+		Requests: apiv1.ResourceList{apiv1.ResourceCPU: cpu, apiv1.ResourceMemory: memory},
+		Limits:   apiv1.ResourceList{apiv1.ResourceMemory: memory},
+	}
+	if value, ok := args.conf[config.SparkDriverCoreLimitKey]; ok {
+		limit, err := resource.ParseQuantity(value)
+		if err != nil {
+			return apiv1.ResourceRequirements{}, "", fmt.Errorf("invalid driver core limit: %v", err)
+		}
+		resources.Limits[apiv1.ResourceCPU] = limit
+	}
+	return resources, strconv.FormatFloat(overheadFactor, 'f', -1, 64), nil
+}
+
+func getPortConf(args *sparkSubmitArgs, key string, defaultPort int32) (int32, error) {
+	value, ok := args.conf[key]
+	if !ok {
+		return defaultPort, nil
+	}
+	port, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %v", key, value, err)
+	}
+	return int32(port), nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// buildNativeDriver builds the objects spark-submit creates for the driver of an application.
+func buildNativeDriver(namespace string, args *sparkSubmitArgs, ids nativeIDs) (*nativeDriver, error) {
+	inClusterClient := args.deployMode == string(v1beta2.InClusterClientMode)
+	if args.deployMode != string(v1beta2.ClusterMode) && !inClusterClient {
+		return nil, fmt.Errorf("the native submission backend only supports the cluster and in-cluster-client deploy modes")
+	}
+	if err := checkNoLocalDependencies(args); err != nil {
+		return nil, err
+	}
+	if _, ok := args.conf[config.SparkDriverPodTemplateFileKey]; ok {
+		return nil, fmt.Errorf("the native submission backend does not support %s", config.SparkDriverPodTemplateFileKey)
+	}
+	podName := args.conf[config.SparkDriverPodNameKey]
+	if podName == "" {
+		return nil, fmt.Errorf("%s is not set", config.SparkDriverPodNameKey)
+	}
+	image := args.get(config.SparkDriverContainerImageKey, args.conf[config.SparkContainerImageKey])
+	if image == "" {
+		return nil, fmt.Errorf("no container image is set for the driver")
+	}
+
+	nonJVM := args.isPython() || args.isR()
+	resources, overheadFactor, err := getDriverResources(args, nonJVM)
+	if err != nil {
+		return nil, err
+	}
+	driverPort, err := getPortConf(args, "spark.driver.port", nativeDefaultDriverPort)
+	if err != nil {
+		return nil, err
+	}
+	blockManagerPort, err := getPortConf(args, "spark.driver.blockManager.port", nativeDefaultBlockManagerPort)
+	if err != nil {
+		return nil, err
+	}
+	uiPort, err := getPortConf(args, "spark.ui.port", nativeDefaultUIPort)
+	if err != nil {
+		return nil, err
+	}
+
+	resourceNamePrefix := getNativeResourceNamePrefix(args.get(config.SparkAppNameKey, podName), ids.uniqueID)
+	serviceName := resourceNamePrefix + "-driver-svc"
+	if len(serviceName) > maxKubernetesServiceNameLen {
+		serviceName = fmt.Sprintf("spark-%s-driver-svc", ids.uniqueID)
+	}
+	configMapName := fmt.Sprintf("spark-drv-%s-conf-map", ids.configMapID)
+
+	labels := args.withPrefix(config.SparkDriverLabelKeyPrefix)
+	labels[config.SparkApplicationSelectorLabel] = ids.appID
+	labels[config.SparkRoleLabel] = config.SparkDriverRole
+
+	// The Spark properties passed to the driver through the properties file.
+	sparkConf := make(map[string]string)
+	for key, value := range args.conf {
+		sparkConf[key] = value
+	}
+	sparkConf["spark.master"] = args.master
+	sparkConf["spark.submit.deployMode"] = string(v1beta2.ClusterMode)
+	sparkConf["spark.app.id"] = ids.appID
+	sparkConf["spark.kubernetes.submitInDriver"] = "true"
+	sparkConf["spark.kubernetes.executor.podNamePrefix"] = resourceNamePrefix
+	sparkConf["spark.kubernetes.memoryOverheadFactor"] = overheadFactor
+	sparkConf["spark.driver.host"] = fmt.Sprintf("%s.%s.svc", serviceName, namespace)
+	sparkConf["spark.driver.port"] = strconv.Itoa(int(driverPort))
+	sparkConf["spark.driver.blockManager.port"] = strconv.Itoa(int(blockManagerPort))
+	if inClusterClient {
+		// The driver pod runs spark-submit in client mode, in which Spark doesn't use the service account
+		// token mounted into the pod unless told to.
+		sparkConf["spark.submit.deployMode"] = string(v1beta2.ClientMode)
+		delete(sparkConf, "spark.kubernetes.submitInDriver")
+		if _, ok := sparkConf[nativeClientModeTokenFileKey]; !ok {
+			sparkConf[nativeClientModeTokenFileKey] = nativeServiceAccountTokenFile
+		}
+		if _, ok := sparkConf[nativeClientModeCACertFileKey]; !ok {
+			sparkConf[nativeClientModeCACertFileKey] = nativeServiceAccountCACertFile
+		}
+	}
+	mainClass := args.mainClass
+	switch {
+	case args.isPython():
+		sparkConf["spark.kubernetes.resource.type"] = "python"
+		mainClass = nativePythonRunnerClass
+	case args.isR():
+		sparkConf["spark.kubernetes.resource.type"] = "r"
+		mainClass = nativeRRunnerClass
+	default:
+		sparkConf["spark.kubernetes.resource.type"] = "java"
+	}
+
+	var env []apiv1.EnvVar
+	driverEnv := args.withPrefix(config.SparkDriverEnvVarConfigKeyPrefix)
+	for _, name := range sortedKeys(driverEnv) {
+		env = append(env, apiv1.EnvVar{Name: name, Value: driverEnv[name]})
+	}
+	env = append(env, apiv1.EnvVar{
+		Name: nativeDriverBindAddressEnvVar,
+		ValueFrom: &apiv1.EnvVarSource{
+			FieldRef: &apiv1.ObjectFieldSelector{APIVersion: "v1", FieldPath: "status.podIP"},
+		},
+	})
+	if args.isPython() {
+		if value, ok := args.conf["spark.pyspark.python"]; ok {
+			env = append(env, apiv1.EnvVar{Name: nativePySparkPythonEnvVar, Value: value})
+		}
+		if value, ok := args.conf["spark.pyspark.driver.python"]; ok {
+			env = append(env, apiv1.EnvVar{Name: nativePySparkDriverEnvVar, Value: value})
+		}
+	}
+
+	volumes, volumeMounts, localDirs, err := getNativeDriverVolumes(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(localDirs) == 0 {
+		localDir := fmt.Sprintf("/var/data/spark-%s", ids.localDirID)
+		volumes = append(volumes, apiv1.Volume{
+			Name:         nativeDefaultLocalDirVolume,
+			VolumeSource: apiv1.VolumeSource{EmptyDir: &apiv1.EmptyDirVolumeSource{}},
+		})
+		volumeMounts = append(volumeMounts, apiv1.VolumeMount{Name: nativeDefaultLocalDirVolume, MountPath: localDir})
+		localDirs = append(localDirs, localDir)
+	}
+	env = append(env, apiv1.EnvVar{Name: nativeLocalDirsEnvVar, Value: strings.Join(localDirs, ",")})
+
+	secrets := args.withPrefix(config.SparkDriverSecretKeyPrefix)
+	for _, name := range sortedKeys(secrets) {
+		volumeName := name + "-volume"
+		volumes = append(volumes, apiv1.Volume{
+			Name:         volumeName,
+			VolumeSource: apiv1.VolumeSource{Secret: &apiv1.SecretVolumeSource{SecretName: name}},
+		})
+		volumeMounts = append(volumeMounts, apiv1.VolumeMount{Name: volumeName, MountPath: secrets[name]})
+	}
+	secretKeyRefs := args.withPrefix(config.SparkDriverSecretKeyRefKeyPrefix)
+	for _, name := range sortedKeys(secretKeyRefs) {
+		ref := strings.SplitN(secretKeyRefs[name], ":", 2)
+		if len(ref) != 2 {
+			return nil, fmt.Errorf("invalid secret key reference %q for environment variable %s", secretKeyRefs[name], name)
+		}
+		env = append(env, apiv1.EnvVar{
+			Name: name,
+			ValueFrom: &apiv1.EnvVarSource{
+				SecretKeyRef: &apiv1.SecretKeySelector{
+					LocalObjectReference: apiv1.LocalObjectReference{Name: ref[0]},
+					Key:                  ref[1],
+				},
+			},
+		})
+	}
+
+	volumes = append(volumes, apiv1.Volume{
+		Name: nativeSparkConfVolumeName,
+		VolumeSource: apiv1.VolumeSource{
+			ConfigMap: &apiv1.ConfigMapVolumeSource{
+				LocalObjectReference: apiv1.LocalObjectReference{Name: configMapName},
+				Items: []apiv1.KeyToPath{{
+					Key:  nativeSparkPropertiesFileName,
+					Path: nativeSparkPropertiesFileName,
+					Mode: int32ptr(420),
+				}},
+			},
+		},
+	})
+	volumeMounts = append(volumeMounts, apiv1.VolumeMount{Name: nativeSparkConfVolumeName, MountPath: config.DefaultSparkConfDir})
+	env = append(env, apiv1.EnvVar{Name: config.SparkConfDirEnvVar, Value: config.DefaultSparkConfDir})
+
+	containerArgs := []string{"driver"}
+	if args.proxyUser != "" {
+		containerArgs = append(containerArgs, "--proxy-user", args.proxyUser)
+	}
+	containerArgs = append(containerArgs, "--properties-file", config.DefaultSparkConfDir+"/"+nativeSparkPropertiesFileName)
+	containerArgs = append(containerArgs, "--class", mainClass)
+	if args.primaryResource != "" {
+		containerArgs = append(containerArgs, args.primaryResource)
+	} else {
+		containerArgs = append(containerArgs, nativeNoPrimaryResource)
+	}
+	containerArgs = append(containerArgs, args.appArgs...)
+
+	var imagePullSecrets []apiv1.LocalObjectReference
+	if value := args.conf[config.SparkImagePullSecretKey]; value != "" {
+		for _, name := range strings.Split(value, ",") {
+			imagePullSecrets = append(imagePullSecrets, apiv1.LocalObjectReference{Name: strings.TrimSpace(name)})
+		}
+	}
+	nodeSelector := args.withPrefix(config.SparkNodeSelectorKeyPrefix)
+	if len(nodeSelector) == 0 {
+		nodeSelector = nil
+	}
+	annotations := args.withPrefix(config.SparkDriverAnnotationKeyPrefix)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+
+	pod := &apiv1.Pod{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        podName,
+			Namespace:   namespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: apiv1.PodSpec{
+			Containers: []apiv1.Container{{
+				Name:            config.SparkDriverContainerName,
+				Image:           image,
+				ImagePullPolicy: apiv1.PullPolicy(args.get(config.SparkContainerImagePullPolicyKey, string(apiv1.PullIfNotPresent))),
+				Args:            containerArgs,
+				Env:             env,
+				Ports: []apiv1.ContainerPort{
+					{Name: nativeDriverRPCPortName, ContainerPort: driverPort, Protocol: apiv1.ProtocolTCP},
+					{Name: nativeBlockManagerPortName, ContainerPort: blockManagerPort, Protocol: apiv1.ProtocolTCP},
+					{Name: nativeUIPortName, ContainerPort: uiPort, Protocol: apiv1.ProtocolTCP},
+				},
+				Resources:    resources,
+				VolumeMounts: volumeMounts,
+			}},
+			Volumes:            volumes,
+			RestartPolicy:      apiv1.RestartPolicyNever,
+			ServiceAccountName: args.conf[config.SparkDriverServiceAccountName],
+			ImagePullSecrets:   imagePullSecrets,
+			NodeSelector:       nodeSelector,
+		},
+	}
+
+	serviceSelector := make(map[string]string)
+	for key, value := range labels {
+		serviceSelector[key] = value
+	}
+	serviceAnnotations := args.withPrefix(config.SparkDriverServiceAnnotationKeyPrefix)
+	if len(serviceAnnotations) == 0 {
+		serviceAnnotations = nil
+	}
+	service := &apiv1.Service{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        serviceName,
+			Namespace:   namespace,
+			Annotations: serviceAnnotations,
+		},
+		Spec: apiv1.ServiceSpec{
+			ClusterIP: apiv1.ClusterIPNone,
+			Selector:  serviceSelector,
+			Ports: []apiv1.ServicePort{
+				{Name: nativeDriverRPCPortName, Port: driverPort, TargetPort: intstr.FromInt(int(driverPort))},
+				{Name: nativeBlockManagerPortName, Port: blockManagerPort, TargetPort: intstr.FromInt(int(blockManagerPort))},
+				{Name: nativeUIPortName, Port: uiPort, TargetPort: intstr.FromInt(int(uiPort))},
+			},
+		},
+	}
+
+	configMap := &apiv1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      configMapName,
+			Namespace: namespace,
+		},
+		Data: map[string]string{nativeSparkPropertiesFileName: formatJavaProperties(sparkConf, configMapName)},
+	}
+
+	return &nativeDriver{pod: pod, configMap: configMap, service: service}, nil
+}
+
+// getNativeDriverVolumes returns the volumes set with spark.kubernetes.driver.volumes.* and the
+// mount paths of the local directory volumes among them.
+func getNativeDriverVolumes(args *sparkSubmitArgs) ([]apiv1.Volume, []apiv1.VolumeMount, []string, error) {
+	type volumeConf struct {
+		volumeType string
+		mount      apiv1.VolumeMount
+		options    map[string]string
+	}
+	confs := make(map[string]*volumeConf)
+	for key, value := range args.withPrefix(config.SparkDriverVolumesPrefix) {
+		// Keys are <type>.<name>.mount.<property> or <type>.<name>.options.<option>.
+		parts := strings.SplitN(key, ".", 4)
+		if len(parts) != 4 {
+			return nil, nil, nil, fmt.Errorf("invalid volume property %s%s", config.SparkDriverVolumesPrefix, key)
+		}
+		volumeType, name, kind, property := parts[0], parts[1], parts[2], parts[3]
+		conf, ok := confs[name]
+		if !ok {
+			conf = &volumeConf{volumeType: volumeType, mount: apiv1.VolumeMount{Name: name}, options: make(map[string]string)}
+			confs[name] = conf
+		}
+		switch {
+		case kind == "mount" && property == "path":
+			conf.mount.MountPath = value
+		case kind == "mount" && property == "subPath":
+			conf.mount.SubPath = value
+		case kind == "mount" && property == "readOnly":
+			conf.mount.ReadOnly = value == "true"
+		case kind == "options":
+			conf.options[property] = value
+		default:
+			return nil, nil, nil, fmt.Errorf("invalid volume property %s%s", config.SparkDriverVolumesPrefix, key)
+		}
+	}
+
+	var names []string
+	for name := range confs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var volumes []apiv1.Volume
+	var volumeMounts []apiv1.VolumeMount
+	var localDirs []string
+	for _, name := range names {
+		conf := confs[name]
+		volume := apiv1.Volume{Name: name}
+		switch conf.volumeType {
+		case "hostPath":
+			volume.HostPath = &apiv1.HostPathVolumeSource{Path: conf.options["path"]}
+			if hostPathType, ok := conf.options["type"]; ok {
+				t := apiv1.HostPathType(hostPathType)
+				volume.HostPath.Type = &t
+			}
+		case "emptyDir":
+			volume.EmptyDir = &apiv1.EmptyDirVolumeSource{Medium: apiv1.StorageMedium(conf.options["medium"])}
+			if sizeLimit, ok := conf.options["sizeLimit"]; ok {
+				quantity, err := resource.ParseQuantity(sizeLimit)
+				if err != nil {
+					return nil, nil, nil, fmt.Errorf("invalid size limit of volume %s: %v", name, err)
+				}
+				volume.EmptyDir.SizeLimit = &quantity
+			}
+		case "persistentVolumeClaim":
+			volume.PersistentVolumeClaim = &apiv1.PersistentVolumeClaimVolumeSource{
+				ClaimName: conf.options["claimName"],
+				ReadOnly:  conf.mount.ReadOnly,
+			}
+		default:
+			return nil, nil, nil, fmt.Errorf("unsupported type %s of volume %s", conf.volumeType, name)
+		}
+		volumes = append(volumes, volume)
+		volumeMounts = append(volumeMounts, conf.mount)
+		if strings.HasPrefix(name, config.SparkLocalDirVolumePrefix) {
+			localDirs = append(localDirs, conf.mount.MountPath)
+		}
+	}
+	return volumes, volumeMounts, localDirs, nil
+}
+
+// formatJavaProperties formats the given properties in the format of java.util.Properties, which
+// is how Spark reads the properties file.
+func formatJavaProperties(properties map[string]string, configMapName string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "#Java properties built from Kubernetes config map with name: %s\n", configMapName)
+	for _, key := range sortedKeys(properties) {
+		b.WriteString(escapeJavaProperty(key, true))
+		b.WriteString("=")
+		b.WriteString(escapeJavaProperty(properties[key], false))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func escapeJavaProperty(s string, isKey bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch r {
+		case ' ':
+			if i == 0 || isKey {
+				b.WriteString(`\`)
+			}
+			b.WriteRune(r)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\\', '=', ':', '#', '!':
+			b.WriteString(`\`)
+			b.WriteRune(r)
+		default:
+			if r < 0x20 || r > 0x7e {
+				// Characters outside of ISO 8859-1 are written as UTF-16 escapes.
+				for _, c := range utf16.Encode([]rune{r}) {
+					fmt.Fprintf(&b, `\u%04X`, c)
+				}
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String()
+}
+
+// runNativeSubmission creates the driver of an application without running spark-submit. Like
+// spark-submit, it creates the driver pod first, and then the ConfigMap and the service owned by
+// the driver pod, deleting the driver pod if they can't be created.
+func runNativeSubmission(kubeClient clientset.Interface, submission *submission) (bool, error) {
+	args, err := parseSparkSubmitArgs(submission.args)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse the submission arguments of SparkApplication %s/%s: %v", submission.namespace, submission.name, err)
+	}
+	driver, err := buildNativeDriver(submission.namespace, args, newNativeIDs())
+	if err != nil {
+		return false, fmt.Errorf("failed to build the driver of SparkApplication %s/%s: %v", submission.namespace, submission.name, err)
+	}
+	if submission.patchDriverPod != nil {
+		if driver.pod, err = submission.patchDriverPod(driver.pod); err != nil {
+			return false, fmt.Errorf("failed to build the driver of SparkApplication %s/%s: %v", submission.namespace, submission.name, err)
+		}
+	}
+	if submission.executorPodTemplate != nil {
+		driver.configMap.Data[executorPodTemplateRole.fileName()] = string(submission.executorPodTemplate)
+		mountPodTemplates(&driver.pod.Spec, config.SparkDriverContainerName, driver.configMap.Name, []podTemplateRole{executorPodTemplateRole})
+	}
+
+	pod, err := kubeClient.CoreV1().Pods(submission.namespace).Create(context.TODO(), driver.pod, metav1.CreateOptions{})
+	if err != nil {
+		if errors.IsAlreadyExists(err) {
+			glog.Warningf("trying to resubmit an already submitted SparkApplication %s/%s", submission.namespace, submission.name)
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to create the driver pod of SparkApplication %s/%s: %v", submission.namespace, submission.name, err)
+	}
+
+	controller := true
+	ownerReference := metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Name:       pod.Name,
+		UID:        pod.UID,
+		Controller: &controller,
+	}
+	driver.configMap.OwnerReferences = []metav1.OwnerReference{ownerReference}
+	driver.service.OwnerReferences = []metav1.OwnerReference{ownerReference}
+	if _, err = kubeClient.CoreV1().ConfigMaps(submission.namespace).Create(context.TODO(), driver.configMap, metav1.CreateOptions{}); err == nil {
+		_, err = kubeClient.CoreV1().Services(submission.namespace).Create(context.TODO(), driver.service, metav1.CreateOptions{})
+	}
+	if err != nil {
+		if deleteErr := kubeClient.CoreV1().Pods(submission.namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{}); deleteErr != nil {
+			glog.Errorf("failed to delete the driver pod %s/%s: %v", submission.namespace, pod.Name, deleteErr)
+		}
+		return false, fmt.Errorf("failed to create the resources of the driver of SparkApplication %s/%s: %v", submission.namespace, submission.name, err)
+	}
+	glog.V(2).Infof("Created the driver pod %s/%s natively", submission.namespace, pod.Name)
+	return true, nil
+}
@@ -0,0 +1,521 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	kubeclientfake "k8s.io/client-go/kubernetes/fake"
+	kubetesting "k8s.io/client-go/testing"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+)
+
+// The golden files in testdata/native are the driver pod, ConfigMap and service spark-submit 3.1.1
+// creates for the applications below, with the randomly generated IDs replaced by those in testIDs.
+var testIDs = nativeIDs{
+	appID:       "spark-0123456789abcdef0123456789abcdef",
+	uniqueID:    "7d1b5e79c5d6e1a8",
+	configMapID: "3f0e2a9b17c4d5e6",
+	localDirID:  "11111111-2222-3333-4444-555555555555",
+}
+
+func setSubmissionEnv() {
+	os.Setenv(kubernetesServiceHostEnvVar, "localhost")
+	os.Setenv(kubernetesServicePortEnvVar, "443")
+}
+
+func buildNativeTestDriver(t *testing.T, app *v1beta2.SparkApplication) *nativeDriver {
+	setSubmissionEnv()
+	submissionArgs, err := buildSubmissionCommandArgs(app, getDriverPodName(app), "test-submission-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, err := parseSparkSubmitArgs(submissionArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver, err := buildNativeDriver(app.Namespace, args, testIDs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return driver
+}
+
+func assertMatchesGolden(t *testing.T, goldenFile string, obj runtime.Object) {
+	golden, err := ioutil.ReadFile(filepath.Join("testdata", "native", goldenFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := yaml.ToJSON(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.JSONEq(t, string(expected), string(actual), "generated object differs from %s", goldenFile)
+}
+
+func TestNativeDriverParity(t *testing.T) {
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "spark-pi",
+			Namespace: "default",
+			Labels:    map[string]string{"team": "analytics"},
+		},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type:                v1beta2.ScalaApplicationType,
+			Mode:                v1beta2.ClusterMode,
+			Image:               stringptr("gcr.io/spark-operator/spark:v3.1.1"),
+			ImagePullPolicy:     stringptr("Always"),
+			ImagePullSecrets:    []string{"registry-secret"},
+			MainClass:           stringptr("org.apache.spark.examples.SparkPi"),
+			MainApplicationFile: stringptr("local:///opt/spark/examples/jars/spark-examples_2.12-3.1.1.jar"),
+			Arguments:           []string{"1000"},
+			SparkVersion:        "3.1.1",
+			SparkConf:           map[string]string{"spark.eventLog.enabled": "false"},
+			NodeSelector:        map[string]string{"disktype": "ssd"},
+			Deps: v1beta2.Dependencies{
+				Jars: []string{"https://repo1.maven.org/maven2/org/example/example.jar"},
+			},
+			Driver: v1beta2.DriverSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					Cores:          int32ptr(1),
+					CoreLimit:      stringptr("1200m"),
+					Memory:         stringptr("512m"),
+					ServiceAccount: stringptr("spark"),
+					Annotations:    map[string]string{"owner": "analytics"},
+					EnvVars:        map[string]string{"LOG_LEVEL": "INFO"},
+					EnvSecretKeyRefs: map[string]v1beta2.NameKey{
+						"DB_PASSWORD": {Name: "db", Key: "password"},
+					},
+					Secrets: []v1beta2.SecretInfo{
+						{Name: "gcp-key", Path: "/mnt/secrets", Type: v1beta2.GenericType},
+					},
+				},
+				ServiceAnnotations: map[string]string{"prometheus.io/scrape": "true"},
+			},
+			Executor: v1beta2.ExecutorSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					Cores:  int32ptr(1),
+					Memory: stringptr("512m"),
+				},
+				Instances: int32ptr(2),
+			},
+		},
+	}
+	driver := buildNativeTestDriver(t, app)
+
+	assertMatchesGolden(t, "spark-pi-driver-pod.yaml", driver.pod)
+	assertMatchesGolden(t, "spark-pi-driver-svc.yaml", driver.service)
+	assertMatchesGolden(t, "spark-pi-conf-map.yaml", driver.configMap)
+}
+
+func TestNativeDriverParityPython(t *testing.T) {
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pyspark-pi",
+			Namespace: "default",
+		},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type:                v1beta2.PythonApplicationType,
+			PythonVersion:       stringptr("3"),
+			Mode:                v1beta2.ClusterMode,
+			Image:               stringptr("gcr.io/spark-operator/spark:v3.1.1"),
+			ImagePullPolicy:     stringptr("Always"),
+			MainApplicationFile: stringptr("local:///opt/spark/examples/src/main/python/pi.py"),
+			Arguments:           []string{"1000"},
+			SparkVersion:        "3.1.1",
+			SparkConf:           map[string]string{"spark.pyspark.python": "python3"},
+			Driver: v1beta2.DriverSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					Cores:          int32ptr(1),
+					Memory:         stringptr("1g"),
+					ServiceAccount: stringptr("spark"),
+				},
+			},
+			Executor: v1beta2.ExecutorSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					Cores:  int32ptr(1),
+					Memory: stringptr("512m"),
+				},
+				Instances: int32ptr(2),
+			},
+		},
+	}
+
+	driver := buildNativeTestDriver(t, app)
+
+	assertMatchesGolden(t, "pyspark-pi-driver-pod.yaml", driver.pod)
+	assertMatchesGolden(t, "pyspark-pi-conf-map.yaml", driver.configMap)
+}
+
+func TestNativeDriverLocalDirVolumes(t *testing.T) {
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "spark-pi", Namespace: "default"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type:                v1beta2.ScalaApplicationType,
+			Mode:                v1beta2.ClusterMode,
+			Image:               stringptr("gcr.io/spark-operator/spark:v3.1.1"),
+			MainClass:           stringptr("org.apache.spark.examples.SparkPi"),
+			MainApplicationFile: stringptr("local:///opt/spark/examples/jars/spark-examples_2.12-3.1.1.jar"),
+			Volumes: []apiv1.Volume{
+				{Name: "spark-local-dir-scratch", VolumeSource: apiv1.VolumeSource{HostPath: &apiv1.HostPathVolumeSource{Path: "/mnt/disks/ssd0"}}},
+			},
+			Driver: v1beta2.DriverSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					VolumeMounts: []apiv1.VolumeMount{{Name: "spark-local-dir-scratch", MountPath: "/tmp/spark-local"}},
+				},
+			},
+		},
+	}
+
+	driver := buildNativeTestDriver(t, app)
+
+	container := driver.pod.Spec.Containers[0]
+	assert.Contains(t, container.Env, apiv1.EnvVar{Name: nativeLocalDirsEnvVar, Value: "/tmp/spark-local"})
+	assert.Contains(t, container.VolumeMounts, apiv1.VolumeMount{Name: "spark-local-dir-scratch", MountPath: "/tmp/spark-local"})
+	assert.Contains(t, driver.pod.Spec.Volumes, apiv1.Volume{
+		Name:         "spark-local-dir-scratch",
+		VolumeSource: apiv1.VolumeSource{HostPath: &apiv1.HostPathVolumeSource{Path: "/mnt/disks/ssd0"}},
+	})
+	for _, volume := range driver.pod.Spec.Volumes {
+		assert.NotEqual(t, nativeDefaultLocalDirVolume, volume.Name)
+	}
+}
+
+func TestNativeDriverLongServiceName(t *testing.T) {
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "a-spark-application-with-a-name-that-is-much-too-long-for-a-service", Namespace: "default"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type:                v1beta2.ScalaApplicationType,
+			Mode:                v1beta2.ClusterMode,
+			Image:               stringptr("gcr.io/spark-operator/spark:v3.1.1"),
+			MainClass:           stringptr("org.apache.spark.examples.SparkPi"),
+			MainApplicationFile: stringptr("local:///opt/spark/examples/jars/spark-examples_2.12-3.1.1.jar"),
+		},
+	}
+
+	driver := buildNativeTestDriver(t, app)
+
+	assert.Equal(t, "spark-7d1b5e79c5d6e1a8-driver-svc", driver.service.Name)
+}
+
+func TestNativeDriverInClusterClientMode(t *testing.T) {
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "spark-pi", Namespace: "default"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type:                v1beta2.ScalaApplicationType,
+			Mode:                v1beta2.ClusterMode,
+			Image:               stringptr("gcr.io/spark-operator/spark:v3.1.1"),
+			MainClass:           stringptr("org.apache.spark.examples.SparkPi"),
+			MainApplicationFile: stringptr("local:///opt/spark/examples/jars/spark-examples_2.12-3.1.1.jar"),
+		},
+	}
+	clusterDriver := buildNativeTestDriver(t, app.DeepCopy())
+	app.Spec.Mode = v1beta2.InClusterClientMode
+	driver := buildNativeTestDriver(t, app)
+
+	// The driver pod runs spark-submit in client mode in either mode.
+	assert.Equal(t, clusterDriver.pod, driver.pod)
+	assert.Equal(t, clusterDriver.service, driver.service)
+	properties := driver.configMap.Data[nativeSparkPropertiesFileName]
+	assert.Contains(t, properties, "spark.submit.deployMode=client\n")
+	assert.NotContains(t, properties, "spark.kubernetes.submitInDriver")
+	assert.Contains(t, properties, "spark.kubernetes.authenticate.oauthTokenFile=/var/run/secrets/kubernetes.io/serviceaccount/token\n")
+	assert.Contains(t, properties, "spark.kubernetes.authenticate.caCertFile=/var/run/secrets/kubernetes.io/serviceaccount/ca.crt\n")
+	assert.Contains(t, properties, "spark.driver.host=spark-pi-7d1b5e79c5d6e1a8-driver-svc.default.svc\n")
+}
+
+func TestBuildNativeDriverErrors(t *testing.T) {
+	setSubmissionEnv()
+	testcases := []struct {
+		name   string
+		mutate func(app *v1beta2.SparkApplication)
+	}{
+		{
+			name:   "client mode",
+			mutate: func(app *v1beta2.SparkApplication) { app.Spec.Mode = v1beta2.ClientMode },
+		},
+		{
+			name: "local application file",
+			mutate: func(app *v1beta2.SparkApplication) {
+				app.Spec.MainApplicationFile = stringptr("/opt/spark/examples/jars/spark-examples_2.12-3.1.1.jar")
+			},
+		},
+		{
+			name:   "local dependency",
+			mutate: func(app *v1beta2.SparkApplication) { app.Spec.Deps.Files = []string{"file:///tmp/data.csv"} },
+		},
+		{
+			name: "pod template file",
+			mutate: func(app *v1beta2.SparkApplication) {
+				app.Spec.SparkConf["spark.kubernetes.driver.podTemplateFile"] = "/opt/spark/templates/driver.yaml"
+			},
+		},
+		{
+			name:   "no image",
+			mutate: func(app *v1beta2.SparkApplication) { app.Spec.Image = nil },
+		},
+		{
+			name:   "invalid memory",
+			mutate: func(app *v1beta2.SparkApplication) { app.Spec.Driver.Memory = stringptr("lots") },
+		},
+	}
+	for _, test := range testcases {
+		app := &v1beta2.SparkApplication{
+			ObjectMeta: metav1.ObjectMeta{Name: "spark-pi", Namespace: "default"},
+			Spec: v1beta2.SparkApplicationSpec{
+				Type:                v1beta2.ScalaApplicationType,
+				Mode:                v1beta2.ClusterMode,
+				Image:               stringptr("gcr.io/spark-operator/spark:v3.1.1"),
+				MainClass:           stringptr("org.apache.spark.examples.SparkPi"),
+				MainApplicationFile: stringptr("local:///opt/spark/examples/jars/spark-examples_2.12-3.1.1.jar"),
+				SparkConf:           map[string]string{},
+			},
+		}
+		test.mutate(app)
+		submissionArgs, err := buildSubmissionCommandArgs(app, getDriverPodName(app), "test-submission-id")
+		assert.NoError(t, err, test.name)
+		args, err := parseSparkSubmitArgs(submissionArgs)
+		assert.NoError(t, err, test.name)
+		_, err = buildNativeDriver(app.Namespace, args, testIDs)
+		assert.Error(t, err, test.name)
+	}
+}
+
+func TestParseSparkSubmitArgs(t *testing.T) {
+	args, err := parseSparkSubmitArgs([]string{
+		"--class", "org.example.Main",
+		"--master", "k8s://https://localhost:443",
+		"--deploy-mode", "cluster",
+		"--proxy-user", "alice",
+		"--conf", "spark.jars=a.jar",
+		"--jars", "local:///b.jar",
+		"--conf", "spark.driver.extraJavaOptions=-Dkey=value",
+		"local:///app.jar", "--input", "data",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "org.example.Main", args.mainClass)
+	assert.Equal(t, "k8s://https://localhost:443", args.master)
+	assert.Equal(t, "cluster", args.deployMode)
+	assert.Equal(t, "alice", args.proxyUser)
+	assert.Equal(t, "local:///b.jar", args.conf["spark.jars"])
+	assert.Equal(t, "-Dkey=value", args.conf["spark.driver.extraJavaOptions"])
+	assert.Equal(t, "local:///app.jar", args.primaryResource)
+	assert.Equal(t, []string{"--input", "data"}, args.appArgs)
+
+	_, err = parseSparkSubmitArgs([]string{"--supervise", "true"})
+	assert.Error(t, err)
+	_, err = parseSparkSubmitArgs([]string{"--conf"})
+	assert.Error(t, err)
+}
+
+func TestParseSparkMemoryMiB(t *testing.T) {
+	testcases := map[string]int64{
+		"512m":   512,
+		"1g":     1024,
+		"2048":   2048,
+		"1T":     1 << 20,
+		"4096kb": 4,
+	}
+	for value, expected := range testcases {
+		memory, err := parseSparkMemoryMiB(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, expected, memory, value)
+	}
+	_, err := parseSparkMemoryMiB("1.5g")
+	assert.Error(t, err)
+}
+
+func TestFormatJavaProperties(t *testing.T) {
+	properties := map[string]string{
+		"spark.master":                  "k8s://https://localhost:443",
+		"spark.driver.extraJavaOptions": " -Dkey=value #1",
+		"spark.app.name":                "café",
+	}
+	expected := "#Java properties built from Kubernetes config map with name: conf\n" +
+		"spark.app.name=caf\\u00E9\n" +
+		"spark.driver.extraJavaOptions=\\ -Dkey\\=value \\#1\n" +
+		"spark.master=k8s\\://https\\://localhost\\:443\n"
+	assert.Equal(t, expected, formatJavaProperties(properties, "conf"))
+}
+
+func TestRunNativeSubmission(t *testing.T) {
+	setSubmissionEnv()
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "spark-pi", Namespace: "default"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type:                v1beta2.ScalaApplicationType,
+			Mode:                v1beta2.ClusterMode,
+			Image:               stringptr("gcr.io/spark-operator/spark:v3.1.1"),
+			MainClass:           stringptr("org.apache.spark.examples.SparkPi"),
+			MainApplicationFile: stringptr("local:///opt/spark/examples/jars/spark-examples_2.12-3.1.1.jar"),
+		},
+	}
+	submissionArgs, err := buildSubmissionCommandArgs(app, getDriverPodName(app), "test-submission-id")
+	assert.NoError(t, err)
+
+	kubeClient := kubeclientfake.NewSimpleClientset()
+	submitted, err := runNativeSubmission(kubeClient, newSubmission(submissionArgs, app))
+	assert.NoError(t, err)
+	assert.True(t, submitted)
+
+	pod, err := kubeClient.CoreV1().Pods(app.Namespace).Get(context.TODO(), getDriverPodName(app), metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "true", pod.Labels[config.LaunchedBySparkOperatorLabel])
+	assert.Equal(t, "test-submission-id", pod.Labels[config.SubmissionIDLabel])
+	configMaps, err := kubeClient.CoreV1().ConfigMaps(app.Namespace).List(context.TODO(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, configMaps.Items, 1)
+	assert.Equal(t, pod.Name, configMaps.Items[0].OwnerReferences[0].Name)
+	services, err := kubeClient.CoreV1().Services(app.Namespace).List(context.TODO(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, services.Items, 1)
+	assert.Equal(t, "Pod", services.Items[0].OwnerReferences[0].Kind)
+
+	// Resubmitting while the driver pod exists is not an error, like with spark-submit.
+	submitted, err = runNativeSubmission(kubeClient, newSubmission(submissionArgs, app))
+	assert.NoError(t, err)
+	assert.False(t, submitted)
+}
+
+func TestRunNativeSubmissionCleansUpOnFailure(t *testing.T) {
+	setSubmissionEnv()
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "spark-pi", Namespace: "default"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type:                v1beta2.ScalaApplicationType,
+			Mode:                v1beta2.ClusterMode,
+			Image:               stringptr("gcr.io/spark-operator/spark:v3.1.1"),
+			MainClass:           stringptr("org.apache.spark.examples.SparkPi"),
+			MainApplicationFile: stringptr("local:///opt/spark/examples/jars/spark-examples_2.12-3.1.1.jar"),
+		},
+	}
+	submissionArgs, err := buildSubmissionCommandArgs(app, getDriverPodName(app), "test-submission-id")
+	assert.NoError(t, err)
+
+	kubeClient := kubeclientfake.NewSimpleClientset()
+	kubeClient.PrependReactor("create", "services", func(action kubetesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("services are forbidden")
+	})
+	submitted, err := runNativeSubmission(kubeClient, newSubmission(submissionArgs, app))
+	assert.Error(t, err)
+	assert.False(t, submitted)
+
+	_, err = kubeClient.CoreV1().Pods(app.Namespace).Get(context.TODO(), getDriverPodName(app), metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+}
+
+func TestSubmitSparkApplication_InClusterClientMode(t *testing.T) {
+	setSubmissionEnv()
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "spark-pi", Namespace: "default"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type:                v1beta2.ScalaApplicationType,
+			Mode:                v1beta2.InClusterClientMode,
+			Image:               stringptr("gcr.io/spark-operator/spark:v3.1.1"),
+			MainClass:           stringptr("org.apache.spark.examples.SparkPi"),
+			MainApplicationFile: stringptr("local:///opt/spark/examples/jars/spark-examples_2.12-3.1.1.jar"),
+		},
+	}
+	ctrl, _ := newFakeController(app)
+
+	// spark-submit is not run even though it is the submission backend.
+	ranSparkSubmit := false
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		ranSparkSubmit = true
+		return exec.Command("false")
+	}
+
+	app = ctrl.submitSparkApplication(app)
+	assert.Equal(t, v1beta2.SubmittedState, app.Status.AppState.State)
+	assert.False(t, ranSparkSubmit)
+	pod, err := ctrl.kubeClient.CoreV1().Pods(app.Namespace).Get(context.TODO(), "spark-pi-driver", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, config.SparkDriverRole, pod.Labels[config.SparkRoleLabel])
+	assert.Equal(t, app.Status.SubmissionID, pod.Labels[config.SubmissionIDLabel])
+}
+
+func TestSubmitSparkApplication_NativePodTemplates(t *testing.T) {
+	setSubmissionEnv()
+	backend := v1beta2.NativeBackend
+	toleration := apiv1.Toleration{Key: "dedicated", Operator: apiv1.TolerationOpEqual, Value: "spark", Effect: apiv1.TaintEffectNoSchedule}
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "spark-pi", Namespace: "default", UID: "app-uid"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type:                v1beta2.ScalaApplicationType,
+			Mode:                v1beta2.ClusterMode,
+			SubmissionBackend:   &backend,
+			Image:               stringptr("gcr.io/spark-operator/spark:v3.1.1"),
+			MainClass:           stringptr("org.apache.spark.examples.SparkPi"),
+			MainApplicationFile: stringptr("local:///opt/spark/examples/jars/spark-examples_2.12-3.1.1.jar"),
+			Driver: v1beta2.DriverSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{Tolerations: []apiv1.Toleration{toleration}},
+			},
+			Executor: v1beta2.ExecutorSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{Tolerations: []apiv1.Toleration{toleration}},
+			},
+		},
+	}
+	ctrl, _ := newFakeController(app)
+	ctrl.podTemplateDir = os.TempDir()
+
+	app = ctrl.submitSparkApplication(app)
+	assert.Equal(t, v1beta2.SubmittedState, app.Status.AppState.State)
+
+	// The driver pod is patched like the webhook would.
+	pod, err := ctrl.kubeClient.CoreV1().Pods(app.Namespace).Get(context.TODO(), "spark-pi-driver", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []apiv1.Toleration{toleration}, pod.Spec.Tolerations)
+	assert.Equal(t, "true", pod.Annotations[config.PodTemplateMutationAnnotation])
+
+	// The executor pod template is mounted into the driver pod, which reads it from its properties.
+	configMaps, err := ctrl.kubeClient.CoreV1().ConfigMaps(app.Namespace).List(context.TODO(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	var configMap apiv1.ConfigMap
+	for _, item := range configMaps.Items {
+		if _, ok := item.Data[nativeSparkPropertiesFileName]; ok {
+			configMap = item
+		}
+	}
+	data, err := yaml.ToJSON([]byte(configMap.Data[executorPodTemplateRole.fileName()]))
+	assert.NoError(t, err)
+	template := &apiv1.Pod{}
+	assert.NoError(t, json.Unmarshal(data, template))
+	assert.Equal(t, []apiv1.Toleration{toleration}, template.Spec.Tolerations)
+	assert.Contains(t, configMap.Data[nativeSparkPropertiesFileName],
+		config.SparkExecutorPodTemplateFileKey+"="+podTemplateMountPath+"/"+executorPodTemplateRole.fileName())
+	assert.Contains(t, pod.Spec.Containers[0].VolumeMounts,
+		apiv1.VolumeMount{Name: podTemplateVolumeName, MountPath: podTemplateMountPath, ReadOnly: true})
+}
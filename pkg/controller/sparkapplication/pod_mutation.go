@@ -0,0 +1,253 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/cache"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/util"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/webhook"
+)
+
+// UnmutatedPodPolicy tells how the controller reacts to driver and executor pods that don't carry the
+// customizations of their application, e.g., because the webhook was unavailable when they were created.
+type UnmutatedPodPolicy string
+
+// Different ways the controller can react to unmutated pods.
+const (
+	// UnmutatedPodPolicyIgnore doesn't verify pods.
+	UnmutatedPodPolicyIgnore UnmutatedPodPolicy = "Ignore"
+	// UnmutatedPodPolicyWarn records a Warning event and the PodsMutated condition of the application.
+	UnmutatedPodPolicyWarn UnmutatedPodPolicy = "Warn"
+	// UnmutatedPodPolicyFail also fails the application, which is then retried according to its restart policy.
+	UnmutatedPodPolicyFail UnmutatedPodPolicy = "Fail"
+	// UnmutatedPodPolicyResubmit also reruns the application, failing it once it has run maxUnmutatedPodExecutionAttempts times.
+	UnmutatedPodPolicyResubmit UnmutatedPodPolicy = "Resubmit"
+)
+
+const (
+	// maxUnmutatedPodExecutionAttempts is how many times an application with unmutated pods is run with the
+	// Resubmit policy before it fails.
+	maxUnmutatedPodExecutionAttempts = 3
+	// verifiedPodsCacheSize is the maximum number of pods remembered as verified.
+	verifiedPodsCacheSize = 10000
+	// verifiedPodsTTL is how long a pod is remembered as verified.
+	verifiedPodsTTL = 24 * time.Hour
+	// podsMutatedReason is the reason of the PodsMutated condition of applications with unmutated pods.
+	podsMutatedReason = "MissingCustomizations"
+	// podsCustomizedReason is the reason of the PodsMutated condition of applications whose pods all carry their
+	// customizations.
+	podsCustomizedReason = "CustomizationsApplied"
+)
+
+// ParseUnmutatedPodPolicy parses the policy for unmutated pods given on the command line.
+func ParseUnmutatedPodPolicy(policy string) (UnmutatedPodPolicy, error) {
+	switch p := UnmutatedPodPolicy(policy); p {
+	case UnmutatedPodPolicyIgnore, UnmutatedPodPolicyWarn, UnmutatedPodPolicyFail, UnmutatedPodPolicyResubmit:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown unmutated pod policy %q, expected one of Ignore, Warn, Fail or Resubmit", policy)
+}
+
+// podMutationVerifier verifies that driver and executor pods carry the customizations of their application
+// the webhook or pod templates apply. Every pod is only verified once, i.e., until the result of its
+// verification is recorded in the status of its application.
+type podMutationVerifier struct {
+	policy       UnmutatedPodPolicy
+	verifiedPods *cache.LRUExpireCache
+
+	mutex sync.Mutex
+	// unrecordedPods are the pods verified by the current sync of each application, keyed by the key of the
+	// application, which are remembered as verified once the status of the application is updated.
+	unrecordedPods map[string][]types.UID
+}
+
+func newPodMutationVerifier(policy UnmutatedPodPolicy) *podMutationVerifier {
+	if policy == "" || policy == UnmutatedPodPolicyIgnore {
+		return nil
+	}
+	return &podMutationVerifier{
+		policy:         policy,
+		verifiedPods:   cache.NewLRUExpireCache(verifiedPodsCacheSize),
+		unrecordedPods: make(map[string][]types.UID),
+	}
+}
+
+// setUnrecorded sets the pods verified by the current sync of the application with the given key.
+func (v *podMutationVerifier) setUnrecorded(key string, uids []types.UID) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if len(uids) == 0 {
+		delete(v.unrecordedPods, key)
+		return
+	}
+	v.unrecordedPods[key] = uids
+}
+
+// recorded remembers the pods verified by the current sync of the application with the given key as verified,
+// once the result of their verification is recorded in the status of the application.
+func (v *podMutationVerifier) recorded(key string) {
+	if v == nil {
+		return
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	for _, uid := range v.unrecordedPods[key] {
+		v.verifiedPods.Add(uid, struct{}{}, verifiedPodsTTL)
+	}
+	delete(v.unrecordedPods, key)
+}
+
+// forget forgets the pods verified by the current sync of the deleted application with the given key.
+func (v *podMutationVerifier) forget(key string) {
+	if v == nil {
+		return
+	}
+	v.setUnrecorded(key, nil)
+}
+
+// verifyPodMutation verifies the driver and executor pods of the given application that haven't been verified
+// yet. For every pod missing customizations of the application, it records a Warning event, and sets the
+// PodsMutated condition of the application to False. It then fails or reruns the application according to the
+// policy, and returns true if it did. The condition is set to True once pods are verified to carry them.
+func (c *Controller) verifyPodMutation(app *v1beta2.SparkApplication) (bool, error) {
+	if c.podMutationVerifier == nil {
+		return false, nil
+	}
+
+	var pods []*apiv1.Pod
+	driverPod, err := c.getDriverPod(app)
+	if err != nil {
+		return false, err
+	}
+	if driverPod != nil {
+		pods = append(pods, driverPod)
+	}
+	executorPods, err := c.getExecutorPods(app)
+	if err != nil {
+		return false, err
+	}
+	pods = append(pods, executorPods...)
+
+	// The pods are only remembered as verified once the status of the application is updated, so they are
+	// verified again if the update fails.
+	var messages []string
+	var verified []types.UID
+	for _, pod := range pods {
+		if _, ok := c.podMutationVerifier.verifiedPods.Get(pod.UID); ok {
+			continue
+		}
+		message, err := c.verifyPod(app, pod)
+		if err != nil {
+			glog.Errorf("failed to verify the mutation of pod %s/%s: %v", pod.Namespace, pod.Name, err)
+			continue
+		}
+		verified = append(verified, pod.UID)
+		if message != "" {
+			messages = append(messages, message)
+		}
+	}
+	c.podMutationVerifier.setUnrecorded(createMetaNamespaceKey(app.Namespace, app.Name), verified)
+	if len(messages) == 0 {
+		// Pods of the current run found unmutated before keep the condition False.
+		if len(verified) > 0 && !meta.IsStatusConditionFalse(app.Status.Conditions, v1beta2.PodsMutatedCondition) {
+			meta.SetStatusCondition(&app.Status.Conditions, metav1.Condition{
+				Type:    v1beta2.PodsMutatedCondition,
+				Status:  metav1.ConditionTrue,
+				Reason:  podsCustomizedReason,
+				Message: "the driver and executor pods carry the customizations of the application",
+			})
+		}
+		return false, nil
+	}
+
+	message := strings.Join(messages, "; ")
+	meta.SetStatusCondition(&app.Status.Conditions, metav1.Condition{
+		Type:    v1beta2.PodsMutatedCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  podsMutatedReason,
+		Message: message,
+	})
+
+	// Pods of applications that already terminated don't matter anymore.
+	state := app.Status.AppState.State
+	if state != v1beta2.SubmittedState && state != v1beta2.RunningState && state != v1beta2.UnknownState {
+		return false, nil
+	}
+	switch c.podMutationVerifier.policy {
+	case UnmutatedPodPolicyResubmit:
+		if app.Status.ExecutionAttempts < maxUnmutatedPodExecutionAttempts {
+			glog.Infof("Rerunning SparkApplication %s/%s with unmutated pods", app.Namespace, app.Name)
+			if err := c.deleteSparkResources(app); err != nil {
+				return false, err
+			}
+			c.releaseBatchScheduling(app)
+			app.Status.AppState.State = v1beta2.PendingRerunState
+			return true, nil
+		}
+		fallthrough
+	case UnmutatedPodPolicyFail:
+		glog.Infof("Failing SparkApplication %s/%s with unmutated pods", app.Namespace, app.Name)
+		if err := c.deleteSparkResources(app); err != nil {
+			return false, err
+		}
+		app.Status.AppState.State = v1beta2.FailingState
+		app.Status.AppState.ErrorMessage = message
+		app.Status.FailureReason = v1beta2.UnmutatedPodFailure
+		app.Status.TerminationTime = metav1.Now()
+		return true, nil
+	}
+	return false, nil
+}
+
+// verifyPod verifies the given pod, and returns a message telling what it is missing, or an empty message if
+// it carries the customizations of the application.
+func (c *Controller) verifyPod(app *v1beta2.SparkApplication, pod *apiv1.Pod) (string, error) {
+	missing, err := webhook.MissingPatches(pod, app, c.kubeClient)
+	if err != nil {
+		return "", err
+	}
+	if len(missing) == 0 {
+		return "", nil
+	}
+
+	role := config.SparkExecutorRole
+	if util.IsDriverPod(pod) {
+		role = config.SparkDriverRole
+	}
+	message := fmt.Sprintf("%s pod %s is missing %s", role, pod.Name, strings.Join(missing, ", "))
+	glog.Warningf("SparkApplication %s/%s: %s", app.Namespace, app.Name, message)
+	c.recorder.Eventf(
+		app,
+		apiv1.EventTypeWarning,
+		"SparkPodNotMutated",
+		"%s pod %s was created without the customizations %s of the application, most likely because the webhook was unavailable",
+		strings.Title(role), pod.Name, strings.Join(missing, ", "))
+	return message, nil
+}
@@ -0,0 +1,279 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	kubetesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	crdclientfake "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/clientset/versioned/fake"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/webhook"
+)
+
+func newPodMutationTestPods(app *v1beta2.SparkApplication) (*apiv1.Pod, *apiv1.Pod) {
+	newPod := func(name string, role string, container string) *apiv1.Pod {
+		return &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: app.Namespace,
+				UID:       types.UID("uid-" + name),
+				Labels: map[string]string{
+					config.SparkRoleLabel:               role,
+					config.SparkAppNameLabel:            app.Name,
+					config.SubmissionIDLabel:            app.Status.SubmissionID,
+					config.LaunchedBySparkOperatorLabel: "true",
+				},
+			},
+			Spec: apiv1.PodSpec{
+				Containers: []apiv1.Container{{
+					Name: container,
+					Env:  []apiv1.EnvVar{{Name: config.SparkConfDirEnvVar, Value: config.DefaultSparkConfDir}},
+				}},
+			},
+			Status: apiv1.PodStatus{Phase: apiv1.PodRunning},
+		}
+	}
+	driver := newPod("foo-driver", config.SparkDriverRole, config.SparkDriverContainerName)
+	// The driver pod is mutated.
+	driver.OwnerReferences = []metav1.OwnerReference{*getOwnerReference(app)}
+	executor := newPod("foo-exec-1", config.SparkExecutorRole, config.Spark3DefaultExecutorContainerName)
+	return driver, executor
+}
+
+func TestParseUnmutatedPodPolicy(t *testing.T) {
+	policy, err := ParseUnmutatedPodPolicy("Resubmit")
+	assert.NoError(t, err)
+	assert.Equal(t, UnmutatedPodPolicyResubmit, policy)
+	_, err = ParseUnmutatedPodPolicy("Retry")
+	assert.Error(t, err)
+	assert.Nil(t, newPodMutationVerifier(UnmutatedPodPolicyIgnore))
+}
+
+func TestVerifyPodMutationWarn(t *testing.T) {
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", UID: "foo-uid"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Executor: v1beta2.ExecutorSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					Tolerations: []apiv1.Toleration{
+						{Key: "dedicated", Operator: apiv1.TolerationOpEqual, Value: "spark", Effect: apiv1.TaintEffectNoSchedule},
+					},
+				},
+			},
+		},
+		Status: v1beta2.SparkApplicationStatus{
+			AppState:          v1beta2.ApplicationState{State: v1beta2.RunningState},
+			DriverInfo:        v1beta2.DriverInfo{PodName: "foo-driver"},
+			SubmissionID:      "submission-1",
+			ExecutionAttempts: 1,
+		},
+	}
+	driver, executor := newPodMutationTestPods(app)
+	ctrl, recorder := newFakeController(app, driver, executor)
+	ctrl.podMutationVerifier = newPodMutationVerifier(UnmutatedPodPolicyWarn)
+
+	terminated, err := ctrl.verifyPodMutation(app)
+	assert.NoError(t, err)
+	assert.False(t, terminated)
+	assert.Equal(t, v1beta2.RunningState, app.Status.AppState.State)
+	condition := meta.FindStatusCondition(app.Status.Conditions, v1beta2.PodsMutatedCondition)
+	assert.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	assert.Equal(t, "executor pod foo-exec-1 is missing /spec/tolerations", condition.Message)
+	assert.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "SparkPodNotMutated")
+
+	// Pods are verified again until the result is recorded in the status of the application.
+	app.Status.Conditions = nil
+	terminated, err = ctrl.verifyPodMutation(app)
+	assert.NoError(t, err)
+	assert.False(t, terminated)
+	assert.NotNil(t, meta.FindStatusCondition(app.Status.Conditions, v1beta2.PodsMutatedCondition))
+	assert.Contains(t, <-recorder.Events, "SparkPodNotMutated")
+
+	// Pods are only verified once the result is recorded.
+	ctrl.podMutationVerifier.recorded("default/foo")
+	app.Status.Conditions = nil
+	terminated, err = ctrl.verifyPodMutation(app)
+	assert.NoError(t, err)
+	assert.False(t, terminated)
+	assert.Empty(t, app.Status.Conditions)
+	assert.Len(t, recorder.Events, 0)
+
+	// Mutated pods are fine.
+	mutated, err := webhook.PatchSparkPod(executor, app, ctrl.kubeClient)
+	assert.NoError(t, err)
+	mutated.UID = "mutated"
+	ctrl, recorder = newFakeController(app, driver, mutated)
+	ctrl.podMutationVerifier = newPodMutationVerifier(UnmutatedPodPolicyWarn)
+	terminated, err = ctrl.verifyPodMutation(app)
+	assert.NoError(t, err)
+	assert.False(t, terminated)
+	condition = meta.FindStatusCondition(app.Status.Conditions, v1beta2.PodsMutatedCondition)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, metav1.ConditionTrue, condition.Status)
+		assert.Equal(t, podsCustomizedReason, condition.Reason)
+	}
+	assert.Len(t, recorder.Events, 0)
+
+	// Pods found unmutated before keep the condition False.
+	meta.SetStatusCondition(&app.Status.Conditions, metav1.Condition{Type: v1beta2.PodsMutatedCondition, Status: metav1.ConditionFalse, Reason: podsMutatedReason})
+	ctrl, _ = newFakeController(app, driver, mutated)
+	ctrl.podMutationVerifier = newPodMutationVerifier(UnmutatedPodPolicyWarn)
+	_, err = ctrl.verifyPodMutation(app)
+	assert.NoError(t, err)
+	assert.True(t, meta.IsStatusConditionFalse(app.Status.Conditions, v1beta2.PodsMutatedCondition))
+}
+
+func TestVerifyPodMutationFail(t *testing.T) {
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", UID: "foo-uid"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Executor: v1beta2.ExecutorSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					Tolerations: []apiv1.Toleration{
+						{Key: "dedicated", Operator: apiv1.TolerationOpEqual, Value: "spark", Effect: apiv1.TaintEffectNoSchedule},
+					},
+				},
+			},
+		},
+		Status: v1beta2.SparkApplicationStatus{
+			AppState:          v1beta2.ApplicationState{State: v1beta2.RunningState},
+			DriverInfo:        v1beta2.DriverInfo{PodName: "foo-driver"},
+			SubmissionID:      "submission-1",
+			ExecutionAttempts: 1,
+		},
+	}
+	driver, executor := newPodMutationTestPods(app)
+	ctrl, _ := newFakeController(app, driver, executor)
+	ctrl.podMutationVerifier = newPodMutationVerifier(UnmutatedPodPolicyFail)
+	ctrl.kubeClient.CoreV1().Pods(app.Namespace).Create(context.TODO(), driver, metav1.CreateOptions{})
+
+	terminated, err := ctrl.verifyPodMutation(app)
+	assert.NoError(t, err)
+	assert.True(t, terminated)
+	assert.Equal(t, v1beta2.FailingState, app.Status.AppState.State)
+	assert.Equal(t, v1beta2.UnmutatedPodFailure, app.Status.FailureReason)
+	assert.Contains(t, app.Status.AppState.ErrorMessage, "foo-exec-1")
+	_, err = ctrl.kubeClient.CoreV1().Pods(app.Namespace).Get(context.TODO(), driver.Name, metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+}
+
+func TestVerifyPodMutationResubmit(t *testing.T) {
+	batchScheduler := "fake"
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", UID: "foo-uid"},
+		Spec: v1beta2.SparkApplicationSpec{
+			BatchScheduler: &batchScheduler,
+			Executor: v1beta2.ExecutorSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					Tolerations: []apiv1.Toleration{
+						{Key: "dedicated", Operator: apiv1.TolerationOpEqual, Value: "spark", Effect: apiv1.TaintEffectNoSchedule},
+					},
+				},
+			},
+		},
+		Status: v1beta2.SparkApplicationStatus{
+			AppState:          v1beta2.ApplicationState{State: v1beta2.RunningState},
+			DriverInfo:        v1beta2.DriverInfo{PodName: "foo-driver"},
+			SubmissionID:      "submission-1",
+			ExecutionAttempts: 1,
+		},
+	}
+	driver, executor := newPodMutationTestPods(app)
+	ctrl, _ := newFakeController(app, driver, executor)
+	ctrl.podMutationVerifier = newPodMutationVerifier(UnmutatedPodPolicyResubmit)
+	scheduler := &fakeBatchScheduler{}
+	ctrl.batchSchedulerMgr = scheduler
+
+	terminated, err := ctrl.verifyPodMutation(app)
+	assert.NoError(t, err)
+	assert.True(t, terminated)
+	assert.Equal(t, v1beta2.PendingRerunState, app.Status.AppState.State)
+	// What the batch scheduler reserved for the run is released before the application is run again.
+	assert.Equal(t, []string{"foo"}, scheduler.cleanedUp)
+
+	// The application fails once it has run too many times.
+	app.Status.AppState.State = v1beta2.RunningState
+	app.Status.ExecutionAttempts = maxUnmutatedPodExecutionAttempts
+	ctrl, _ = newFakeController(app, driver, executor)
+	ctrl.podMutationVerifier = newPodMutationVerifier(UnmutatedPodPolicyResubmit)
+	terminated, err = ctrl.verifyPodMutation(app)
+	assert.NoError(t, err)
+	assert.True(t, terminated)
+	assert.Equal(t, v1beta2.FailingState, app.Status.AppState.State)
+}
+
+func TestVerifyPodMutationStatusUpdateFailure(t *testing.T) {
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", UID: "foo-uid"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Executor: v1beta2.ExecutorSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					Tolerations: []apiv1.Toleration{
+						{Key: "dedicated", Operator: apiv1.TolerationOpEqual, Value: "spark", Effect: apiv1.TaintEffectNoSchedule},
+					},
+				},
+			},
+		},
+		Status: v1beta2.SparkApplicationStatus{
+			AppState:          v1beta2.ApplicationState{State: v1beta2.RunningState},
+			DriverInfo:        v1beta2.DriverInfo{PodName: "foo-driver"},
+			SubmissionID:      "submission-1",
+			ExecutionAttempts: 1,
+		},
+	}
+	driver, executor := newPodMutationTestPods(app)
+	ctrl, _ := newFakeController(app, driver, executor)
+	ctrl.recorder = record.NewFakeRecorder(100)
+	ctrl.podMutationVerifier = newPodMutationVerifier(UnmutatedPodPolicyWarn)
+	updateErr := fmt.Errorf("conflict")
+	ctrl.crdClient.(*crdclientfake.Clientset).PrependReactor("update", "sparkapplications",
+		func(action kubetesting.Action) (bool, runtime.Object, error) {
+			return updateErr != nil, nil, updateErr
+		})
+	ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Create(context.TODO(), app, metav1.CreateOptions{})
+
+	// The pods are verified again since their result was not recorded.
+	assert.Error(t, ctrl.syncSparkApplication("default/foo"))
+	assert.Error(t, ctrl.syncSparkApplication("default/foo"))
+	assert.Len(t, ctrl.podMutationVerifier.unrecordedPods["default/foo"], 2)
+	_, verified := ctrl.podMutationVerifier.verifiedPods.Get(executor.UID)
+	assert.False(t, verified)
+
+	updateErr = nil
+	assert.NoError(t, ctrl.syncSparkApplication("default/foo"))
+	updated, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.NotNil(t, meta.FindStatusCondition(updated.Status.Conditions, v1beta2.PodsMutatedCondition))
+	assert.Empty(t, ctrl.podMutationVerifier.unrecordedPods)
+	_, verified = ctrl.podMutationVerifier.verifiedPods.Get(executor.UID)
+	assert.True(t, verified)
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/webhook"
+)
+
+// podTemplateRole describes how the pod template of the driver or the executors is passed to spark-submit.
+type podTemplateRole struct {
+	role             string
+	containerName    string
+	fileKey          string
+	containerNameKey string
+}
+
+var (
+	driverPodTemplateRole = podTemplateRole{
+		role:             config.SparkDriverRole,
+		containerName:    config.SparkDriverContainerName,
+		fileKey:          config.SparkDriverPodTemplateFileKey,
+		containerNameKey: config.SparkDriverPodTemplateContainerNameKey,
+	}
+	executorPodTemplateRole = podTemplateRole{
+		role:             config.SparkExecutorRole,
+		containerName:    config.Spark3DefaultExecutorContainerName,
+		fileKey:          config.SparkExecutorPodTemplateFileKey,
+		containerNameKey: config.SparkExecutorPodTemplateContainerNameKey,
+	}
+	podTemplateRoles = []podTemplateRole{driverPodTemplateRole, executorPodTemplateRole}
+)
+
+const (
+	// podTemplateMountPath is where the pod templates are mounted into the pods reading them, i.e., the pods of
+	// submission Jobs and the driver pods created by the native submission backend.
+	podTemplateMountPath  = "/opt/spark/pod-template"
+	podTemplateVolumeName = "spark-pod-template"
+)
+
+// fileName is the name of the file the template is mounted as under podTemplateMountPath.
+func (r podTemplateRole) fileName() string {
+	return r.role + "-pod-template.yaml"
+}
+
+// args returns the spark-submit arguments passing the template file at the given path to Spark.
+func (r podTemplateRole) args(path string) []string {
+	return []string{
+		"--conf", fmt.Sprintf("%s=%s", r.fileKey, path),
+		"--conf", fmt.Sprintf("%s=%s", r.containerNameKey, r.containerName),
+	}
+}
+
+// buildPodTemplate builds the pod template of the driver or the executors of the given application, which
+// holds the customizations the webhook would otherwise patch the pods with. Spark creates the pods from the
+// template, keeping what the template sets unless Spark sets it itself, e.g., the image and resources of the
+// Spark container. The client is only used to read the Spark ConfigMap.
+func buildPodTemplate(app *v1beta2.SparkApplication, role podTemplateRole, kubeClient clientset.Interface) (*apiv1.Pod, error) {
+	pod := &apiv1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Pod",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{config.SparkRoleLabel: role.role},
+		},
+		Spec: apiv1.PodSpec{
+			Containers: []apiv1.Container{{Name: role.containerName}},
+		},
+	}
+	template, err := webhook.PatchSparkPod(pod, app, kubeClient)
+	if err != nil {
+		return nil, err
+	}
+	// Spark sets the role label itself.
+	delete(template.Labels, config.SparkRoleLabel)
+	if len(template.Labels) == 0 {
+		template.Labels = nil
+	}
+	if template.Annotations == nil {
+		template.Annotations = make(map[string]string)
+	}
+	template.Annotations[config.PodTemplateMutationAnnotation] = "true"
+	return template, nil
+}
+
+// renderPodTemplates renders the pod templates of the driver and the executors of the given application as
+// YAML, keyed by their role. The template of a role whose template file is set by the application is not
+// rendered, and the pods of that role are left to the webhook.
+func renderPodTemplates(app *v1beta2.SparkApplication, kubeClient clientset.Interface) (map[podTemplateRole][]byte, error) {
+	templates := make(map[podTemplateRole][]byte)
+	for _, role := range podTemplateRoles {
+		if _, ok := app.Spec.SparkConf[role.fileKey]; ok {
+			glog.V(2).Infof("SparkApplication %s/%s sets %s, not rendering its %s pod template", app.Namespace, app.Name, role.fileKey, role.role)
+			continue
+		}
+		template, err := buildPodTemplate(app, role, kubeClient)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build the %s pod template: %v", role.role, err)
+		}
+		data, err := yaml.Marshal(template)
+		if err != nil {
+			return nil, err
+		}
+		templates[role] = data
+	}
+	return templates, nil
+}
+
+// writePodTemplates writes the pod templates of the driver and the executors of the given application to
+// files in the given directory, and returns the spark-submit arguments passing them to Spark along with the
+// paths of the files. spark-submit reads both templates, so the files can be removed once it completes.
+func writePodTemplates(app *v1beta2.SparkApplication, dir string, kubeClient clientset.Interface) ([]string, []string, error) {
+	templates, err := renderPodTemplates(app, kubeClient)
+	if err != nil {
+		return nil, nil, err
+	}
+	var args, files []string
+	for _, role := range podTemplateRoles {
+		data, ok := templates[role]
+		if !ok {
+			continue
+		}
+		file, err := ioutil.TempFile(dir, fmt.Sprintf("%s-%s-%s-*.yaml", app.Namespace, app.Name, role.role))
+		if err != nil {
+			removePodTemplates(files)
+			return nil, nil, err
+		}
+		files = append(files, file.Name())
+		_, err = file.Write(data)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			removePodTemplates(files)
+			return nil, nil, err
+		}
+		args = append(args, role.args(file.Name())...)
+	}
+	return args, files, nil
+}
+
+// mountPodTemplates mounts the pod templates held by the given ConfigMap under podTemplateMountPath into the
+// container with the given name.
+func mountPodTemplates(podSpec *apiv1.PodSpec, containerName string, configMapName string, roles []podTemplateRole) {
+	var items []apiv1.KeyToPath
+	for _, role := range roles {
+		items = append(items, apiv1.KeyToPath{Key: role.fileName(), Path: role.fileName()})
+	}
+	podSpec.Volumes = append(podSpec.Volumes, apiv1.Volume{
+		Name: podTemplateVolumeName,
+		VolumeSource: apiv1.VolumeSource{
+			ConfigMap: &apiv1.ConfigMapVolumeSource{
+				LocalObjectReference: apiv1.LocalObjectReference{Name: configMapName},
+				Items:                items,
+			},
+		},
+	})
+	for i := range podSpec.Containers {
+		if podSpec.Containers[i].Name == containerName {
+			podSpec.Containers[i].VolumeMounts = append(podSpec.Containers[i].VolumeMounts,
+				apiv1.VolumeMount{Name: podTemplateVolumeName, MountPath: podTemplateMountPath, ReadOnly: true})
+		}
+	}
+}
+
+// setNativePodTemplates makes the native submission of the given application create its driver pod with the
+// customizations the webhook would otherwise patch it with, and its executors from a pod template mounted into
+// the driver pod, which reads it as spark-submit would.
+func setNativePodTemplates(app *v1beta2.SparkApplication, submission *submission, kubeClient clientset.Interface) error {
+	templates, err := renderPodTemplates(app, kubeClient)
+	if err != nil {
+		return err
+	}
+	if _, ok := templates[driverPodTemplateRole]; ok {
+		submission.patchDriverPod = func(pod *apiv1.Pod) (*apiv1.Pod, error) {
+			patched, err := webhook.PatchSparkPod(pod, app, kubeClient)
+			if err != nil {
+				return nil, fmt.Errorf("failed to patch the driver pod: %v", err)
+			}
+			if patched.Annotations == nil {
+				patched.Annotations = make(map[string]string)
+			}
+			patched.Annotations[config.PodTemplateMutationAnnotation] = "true"
+			return patched, nil
+		}
+	}
+	if data, ok := templates[executorPodTemplateRole]; ok {
+		submission.executorPodTemplate = data
+		path := podTemplateMountPath + "/" + executorPodTemplateRole.fileName()
+		submission.args = append(executorPodTemplateRole.args(path), submission.args...)
+	}
+	return nil
+}
+
+func removePodTemplates(files []string) {
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			glog.Errorf("failed to remove pod template %s: %v", file, err)
+		}
+	}
+}
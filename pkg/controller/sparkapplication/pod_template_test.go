@@ -0,0 +1,393 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeclientfake "k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/yaml"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	crdclientfake "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/clientset/versioned/fake"
+	crdinformers "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/informers/externalversions"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/webhook"
+)
+
+// newSparkPod returns a pod of the given role as Spark creates it without a pod template.
+func newSparkPod(role podTemplateRole) *apiv1.Pod {
+	return &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "spark-pi-" + role.role,
+			Namespace: "default",
+			Labels: map[string]string{
+				config.SparkRoleLabel:               role.role,
+				config.SparkAppNameLabel:            "spark-pi",
+				config.LaunchedBySparkOperatorLabel: "true",
+			},
+		},
+		Spec: apiv1.PodSpec{
+			Containers: []apiv1.Container{{Name: role.containerName, Image: "gcr.io/spark-operator/spark:v3.1.1"}},
+		},
+	}
+}
+
+// mergePodTemplate merges the given pod template into a pod Spark would create without it, the way Spark
+// creates pods from templates, i.e., starting from the template and setting what Spark sets itself.
+func mergePodTemplate(template *apiv1.Pod, pod *apiv1.Pod) *apiv1.Pod {
+	merged := template.DeepCopy()
+	merged.TypeMeta = pod.TypeMeta
+	merged.Name = pod.Name
+	merged.Namespace = pod.Namespace
+	if merged.Labels == nil {
+		merged.Labels = make(map[string]string)
+	}
+	for key, value := range pod.Labels {
+		merged.Labels[key] = value
+	}
+	for i := range merged.Spec.Containers {
+		if merged.Spec.Containers[i].Name == pod.Spec.Containers[0].Name {
+			merged.Spec.Containers[i].Image = pod.Spec.Containers[0].Image
+		}
+	}
+	return merged
+}
+
+func TestPodTemplateParity(t *testing.T) {
+	var user int64 = 1000
+	var gracePeriod int64 = 60
+	podSpec := func(role string) v1beta2.SparkPodSpec {
+		return v1beta2.SparkPodSpec{
+			VolumeMounts: []apiv1.VolumeMount{{Name: "data", MountPath: "/mnt/data"}},
+			Env:          []apiv1.EnvVar{{Name: "ROLE", Value: role}},
+			NodeSelector: map[string]string{"disktype": "ssd"},
+			Affinity: &apiv1.Affinity{
+				NodeAffinity: &apiv1.NodeAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: &apiv1.NodeSelector{
+						NodeSelectorTerms: []apiv1.NodeSelectorTerm{{
+							MatchExpressions: []apiv1.NodeSelectorRequirement{
+								{Key: "pool", Operator: apiv1.NodeSelectorOpIn, Values: []string{role}},
+							},
+						}},
+					},
+				},
+			},
+			Tolerations: []apiv1.Toleration{
+				{Key: "dedicated", Operator: apiv1.TolerationOpEqual, Value: "spark", Effect: apiv1.TaintEffectNoSchedule},
+			},
+			SecurityContext:    &apiv1.SecurityContext{RunAsUser: &user},
+			PodSecurityContext: &apiv1.PodSecurityContext{FSGroup: &user},
+			Sidecars: []apiv1.Container{
+				{Name: "log-shipper", Image: "fluent-bit:1.7"},
+			},
+			InitContainers: []apiv1.Container{
+				{Name: "init", Image: "busybox:1.33"},
+			},
+			GPU:                           &v1beta2.GPUSpec{Name: "nvidia.com/gpu", Quantity: 1},
+			SchedulerName:                 stringptr("custom-scheduler"),
+			DNSConfig:                     &apiv1.PodDNSConfig{Nameservers: []string{"8.8.8.8"}},
+			HostAliases:                   []apiv1.HostAlias{{IP: "10.0.0.1", Hostnames: []string{"metastore"}}},
+			ConfigMaps:                    []v1beta2.NamePath{{Name: "extra-conf", Path: "/etc/extra"}},
+			TerminationGracePeriodSeconds: &gracePeriod,
+		}
+	}
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "spark-pi",
+			Namespace: "default",
+			UID:       "app-uid",
+		},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type:            v1beta2.ScalaApplicationType,
+			Image:           stringptr("gcr.io/spark-operator/spark:v3.1.1"),
+			HadoopConfigMap: stringptr("hadoop-conf"),
+			Volumes: []apiv1.Volume{
+				{Name: "data", VolumeSource: apiv1.VolumeSource{EmptyDir: &apiv1.EmptyDirVolumeSource{}}},
+			},
+			Driver: v1beta2.DriverSpec{
+				SparkPodSpec: podSpec(config.SparkDriverRole),
+				Lifecycle: &apiv1.Lifecycle{
+					PreStop: &apiv1.Handler{Exec: &apiv1.ExecAction{Command: []string{"sleep", "5"}}},
+				},
+			},
+			Executor: v1beta2.ExecutorSpec{
+				SparkPodSpec: podSpec(config.SparkExecutorRole),
+			},
+		},
+	}
+	kubeClient := kubeclientfake.NewSimpleClientset()
+	informer := crdinformers.NewSharedInformerFactory(crdclientfake.NewSimpleClientset(), 0).Sparkoperator().V1beta2().SparkApplications()
+	if err := informer.Informer().GetIndexer().Add(app); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, role := range podTemplateRoles {
+		// The pod Spark creates without a template is patched by the webhook.
+		pod, err := json.Marshal(newSparkPod(role))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := webhook.MutatePod(&admissionv1.AdmissionReview{
+			Request: &admissionv1.AdmissionRequest{
+				Namespace: app.Namespace,
+				Object:    runtime.RawExtension{Raw: pod},
+			},
+		}, informer.Lister(), kubeClient)
+		if err != nil {
+			t.Fatal(err)
+		}
+		patch, err := jsonpatch.DecodePatch(response.Patch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pod, err = patch.Apply(pod); err != nil {
+			t.Fatal(err)
+		}
+		admitted := &apiv1.Pod{}
+		if err := json.Unmarshal(pod, admitted); err != nil {
+			t.Fatal(err)
+		}
+
+		template, err := buildPodTemplate(app, role, kubeClient)
+		assert.NoError(t, err)
+		assert.Equal(t, "true", template.Annotations[config.PodTemplateMutationAnnotation])
+		assert.Empty(t, template.Labels[config.SparkRoleLabel])
+		merged := mergePodTemplate(template, newSparkPod(role))
+		delete(merged.Annotations, config.PodTemplateMutationAnnotation)
+		if len(merged.Annotations) == 0 {
+			merged.Annotations = nil
+		}
+
+		assert.Equal(t, admitted.ObjectMeta, merged.ObjectMeta, role.role)
+		assert.Equal(t, admitted.Spec, merged.Spec, role.role)
+
+		// The template is written as YAML and read back by Spark.
+		data, err := yaml.Marshal(template)
+		assert.NoError(t, err)
+		read := &apiv1.Pod{}
+		assert.NoError(t, yaml.Unmarshal(data, read))
+		assert.Equal(t, template, read)
+	}
+}
+
+func TestPodTemplateCustomizations(t *testing.T) {
+	var user int64 = 1000
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "spark-pi", Namespace: "default", UID: "app-uid"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type:  v1beta2.ScalaApplicationType,
+			Image: stringptr("gcr.io/spark-operator/spark:v3.1.1"),
+			Volumes: []apiv1.Volume{
+				{Name: "data", VolumeSource: apiv1.VolumeSource{EmptyDir: &apiv1.EmptyDirVolumeSource{}}},
+			},
+			Driver: v1beta2.DriverSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					VolumeMounts: []apiv1.VolumeMount{{Name: "data", MountPath: "/mnt/data"}},
+					Env:          []apiv1.EnvVar{{Name: "ROLE", Value: config.SparkDriverRole}},
+					NodeSelector: map[string]string{"disktype": "ssd"},
+					Affinity: &apiv1.Affinity{
+						NodeAffinity: &apiv1.NodeAffinity{
+							RequiredDuringSchedulingIgnoredDuringExecution: &apiv1.NodeSelector{
+								NodeSelectorTerms: []apiv1.NodeSelectorTerm{{
+									MatchExpressions: []apiv1.NodeSelectorRequirement{
+										{Key: "pool", Operator: apiv1.NodeSelectorOpIn, Values: []string{config.SparkDriverRole}},
+									},
+								}},
+							},
+						},
+					},
+					Tolerations: []apiv1.Toleration{
+						{Key: "dedicated", Operator: apiv1.TolerationOpEqual, Value: "spark", Effect: apiv1.TaintEffectNoSchedule},
+					},
+					SecurityContext:    &apiv1.SecurityContext{RunAsUser: &user},
+					PodSecurityContext: &apiv1.PodSecurityContext{FSGroup: &user},
+					Sidecars:           []apiv1.Container{{Name: "log-shipper", Image: "fluent-bit:1.7"}},
+					InitContainers:     []apiv1.Container{{Name: "init", Image: "busybox:1.33"}},
+					GPU:                &v1beta2.GPUSpec{Name: "nvidia.com/gpu", Quantity: 1},
+					SchedulerName:      stringptr("custom-scheduler"),
+				},
+				Lifecycle: &apiv1.Lifecycle{
+					PreStop: &apiv1.Handler{Exec: &apiv1.ExecAction{Command: []string{"sleep", "5"}}},
+				},
+			},
+		},
+	}
+	template, err := buildPodTemplate(app, podTemplateRoles[0], kubeclientfake.NewSimpleClientset())
+	assert.NoError(t, err)
+
+	assert.Equal(t, app.Name, template.OwnerReferences[0].Name)
+	assert.Equal(t, app.Spec.Driver.Affinity, template.Spec.Affinity)
+	assert.Equal(t, app.Spec.Driver.Tolerations, template.Spec.Tolerations)
+	assert.Equal(t, app.Spec.Driver.PodSecurityContext, template.Spec.SecurityContext)
+	assert.Equal(t, "custom-scheduler", template.Spec.SchedulerName)
+	assert.Equal(t, "ssd", template.Spec.NodeSelector["disktype"])
+	assert.Len(t, template.Spec.InitContainers, 1)
+	// The Spark container is the first one, and the one Spark is told to use.
+	assert.Equal(t, []string{config.SparkDriverContainerName, "log-shipper"},
+		[]string{template.Spec.Containers[0].Name, template.Spec.Containers[1].Name})
+	container := template.Spec.Containers[0]
+	assert.Equal(t, app.Spec.Driver.SecurityContext, container.SecurityContext)
+	assert.Equal(t, app.Spec.Driver.Lifecycle, container.Lifecycle)
+	assert.Contains(t, container.VolumeMounts, apiv1.VolumeMount{Name: "data", MountPath: "/mnt/data"})
+	assert.Contains(t, container.Env, apiv1.EnvVar{Name: "ROLE", Value: config.SparkDriverRole})
+	assert.Equal(t, resource.MustParse("1"), container.Resources.Limits["nvidia.com/gpu"])
+}
+
+func TestWritePodTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pod-templates")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "spark-pi", Namespace: "default", UID: "app-uid"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type:      v1beta2.ScalaApplicationType,
+			Image:     stringptr("gcr.io/spark-operator/spark:v3.1.1"),
+			SparkConf: map[string]string{config.SparkExecutorPodTemplateFileKey: "/opt/templates/executor.yaml"},
+			Driver: v1beta2.DriverSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					Tolerations: []apiv1.Toleration{
+						{Key: "dedicated", Operator: apiv1.TolerationOpEqual, Value: "spark", Effect: apiv1.TaintEffectNoSchedule},
+					},
+				},
+			},
+			Executor: v1beta2.ExecutorSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					Affinity: &apiv1.Affinity{
+						PodAntiAffinity: &apiv1.PodAntiAffinity{
+							PreferredDuringSchedulingIgnoredDuringExecution: []apiv1.WeightedPodAffinityTerm{{
+								Weight: 100,
+								PodAffinityTerm: apiv1.PodAffinityTerm{
+									LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{config.SparkAppNameLabel: "spark-pi"}},
+									TopologyKey:   "kubernetes.io/hostname",
+								},
+							}},
+						},
+					},
+				},
+			},
+		},
+	}
+	args, files, err := writePodTemplates(app, dir, kubeclientfake.NewSimpleClientset())
+	assert.NoError(t, err)
+	// The executor pod template of the application is kept.
+	assert.Len(t, files, 1)
+	assert.True(t, strings.HasPrefix(files[0], dir+"/default-spark-pi-driver-"))
+	assert.Equal(t, []string{
+		"--conf", config.SparkDriverPodTemplateFileKey + "=" + files[0],
+		"--conf", config.SparkDriverPodTemplateContainerNameKey + "=" + config.SparkDriverContainerName,
+	}, args)
+
+	data, err := ioutil.ReadFile(files[0])
+	assert.NoError(t, err)
+	template := &apiv1.Pod{}
+	assert.NoError(t, yaml.Unmarshal(data, template))
+	assert.Equal(t, "Pod", template.Kind)
+	assert.Equal(t, app.Spec.Driver.Tolerations, template.Spec.Tolerations)
+
+	removePodTemplates(files)
+	_, err = os.Stat(files[0])
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSubmitSparkApplication_PodTemplateMutation(t *testing.T) {
+	setSubmissionEnv()
+	dir, err := ioutil.TempDir("", "pod-templates")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "spark-pi", Namespace: "default", UID: "app-uid"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type:                v1beta2.ScalaApplicationType,
+			Image:               stringptr("gcr.io/spark-operator/spark:v3.1.1"),
+			MainApplicationFile: stringptr("local:///opt/spark/examples/jars/spark-examples.jar"),
+			Driver: v1beta2.DriverSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					Tolerations: []apiv1.Toleration{
+						{Key: "dedicated", Operator: apiv1.TolerationOpEqual, Value: "spark", Effect: apiv1.TaintEffectNoSchedule},
+					},
+				},
+			},
+			Executor: v1beta2.ExecutorSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					Affinity: &apiv1.Affinity{
+						PodAntiAffinity: &apiv1.PodAntiAffinity{
+							PreferredDuringSchedulingIgnoredDuringExecution: []apiv1.WeightedPodAffinityTerm{{
+								Weight: 100,
+								PodAffinityTerm: apiv1.PodAffinityTerm{
+									LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{config.SparkAppNameLabel: "spark-pi"}},
+									TopologyKey:   "kubernetes.io/hostname",
+								},
+							}},
+						},
+					},
+				},
+			},
+		},
+	}
+	ctrl, _ := newFakeController(app)
+	ctrl.podTemplateDir = dir
+
+	var submitArgs []string
+	templates := make(map[string]*apiv1.Pod)
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		submitArgs = args
+		for _, arg := range args {
+			for _, role := range podTemplateRoles {
+				if strings.HasPrefix(arg, role.fileKey+"=") {
+					data, err := ioutil.ReadFile(strings.TrimPrefix(arg, role.fileKey+"="))
+					assert.NoError(t, err)
+					template := &apiv1.Pod{}
+					assert.NoError(t, yaml.Unmarshal(data, template))
+					templates[role.role] = template
+				}
+			}
+		}
+		cs := []string{"-test.run=TestHelperProcessSuccess", "--", command}
+		cs = append(cs, args...)
+		cmd := exec.Command(os.Args[0], cs...)
+		cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
+		return cmd
+	}
+
+	app = ctrl.submitSparkApplication(app)
+	assert.Equal(t, v1beta2.SubmittedState, app.Status.AppState.State)
+	assert.Len(t, templates, 2)
+	assert.Equal(t, app.Spec.Driver.Tolerations, templates[config.SparkDriverRole].Spec.Tolerations)
+	assert.Equal(t, app.Spec.Executor.Affinity, templates[config.SparkExecutorRole].Spec.Affinity)
+	// The main application file stays last.
+	assert.Equal(t, *app.Spec.MainApplicationFile, submitArgs[len(submitArgs)-1])
+
+	// The templates are removed once spark-submit completes.
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
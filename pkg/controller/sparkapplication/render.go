@@ -0,0 +1,136 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/webhook"
+)
+
+// Rendering is the result of a dry run of the submission of a SparkApplication.
+type Rendering struct {
+	// SparkSubmitArgs are the arguments spark-submit is run with.
+	SparkSubmitArgs []string `json:"sparkSubmitArgs"`
+	// DriverPod is a driver pod as patched by the webhook.
+	DriverPod *apiv1.Pod `json:"driverPod"`
+	// ExecutorPod is an executor pod as patched by the webhook.
+	ExecutorPod *apiv1.Pod `json:"executorPod"`
+}
+
+// Render does a dry run of the submission of the given application without creating anything. It builds
+// the arguments of spark-submit, and applies the patches of the webhook to synthetic driver and executor
+// pods carrying the labels, annotations and images spark-submit would set from those arguments. Anything
+// else Spark adds to the pods is not rendered. spark-submit is given the given master URL, or the in-cluster
+// address of the API server the operator uses if it is empty. The client is only used to read the Spark ConfigMap.
+func Render(app *v1beta2.SparkApplication, masterURL string, kubeClient clientset.Interface) (*Rendering, error) {
+	app = app.DeepCopy()
+	v1beta2.SetSparkApplicationDefaults(app)
+
+	if masterURL == "" {
+		var err error
+		if masterURL, err = getMasterURL(); err != nil {
+			return nil, fmt.Errorf("failed to build the arguments of spark-submit: %v", err)
+		}
+	}
+	driverPodName := getDriverPodName(app)
+	args, err := buildSubmissionCommandArgsForMaster(app, masterURL, driverPodName, uuid.New().String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the arguments of spark-submit: %v", err)
+	}
+	parsedArgs, err := parseSparkSubmitArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	driverPod, err := webhook.PatchSparkPod(newSyntheticDriverPod(app, parsedArgs, driverPodName), app, kubeClient)
+	if err != nil {
+		return nil, err
+	}
+	executorPod, err := webhook.PatchSparkPod(newSyntheticExecutorPod(app, parsedArgs), app, kubeClient)
+	if err != nil {
+		return nil, err
+	}
+	return &Rendering{
+		SparkSubmitArgs: args,
+		DriverPod:       driverPod,
+		ExecutorPod:     executorPod,
+	}, nil
+}
+
+func newSyntheticDriverPod(app *v1beta2.SparkApplication, args *sparkSubmitArgs, podName string) *apiv1.Pod {
+	labels := args.withPrefix(config.SparkDriverLabelKeyPrefix)
+	labels[config.SparkRoleLabel] = config.SparkDriverRole
+	return newSyntheticPod(
+		app.Namespace,
+		podName,
+		labels,
+		args.withPrefix(config.SparkDriverAnnotationKeyPrefix),
+		config.SparkDriverContainerName,
+		args.get(config.SparkDriverContainerImageKey, args.conf[config.SparkContainerImageKey]))
+}
+
+func newSyntheticExecutorPod(app *v1beta2.SparkApplication, args *sparkSubmitArgs) *apiv1.Pod {
+	labels := args.withPrefix(config.SparkExecutorLabelKeyPrefix)
+	labels[config.SparkRoleLabel] = config.SparkExecutorRole
+	return newSyntheticPod(
+		app.Namespace,
+		fmt.Sprintf("%s-exec-1", app.Name),
+		labels,
+		args.withPrefix(config.SparkExecutorAnnotationKeyPrefix),
+		config.Spark3DefaultExecutorContainerName,
+		args.get(config.SparkExecutorContainerImageKey, args.conf[config.SparkContainerImageKey]))
+}
+
+func newSyntheticPod(
+	namespace string,
+	name string,
+	labels map[string]string,
+	annotations map[string]string,
+	containerName string,
+	image string) *apiv1.Pod {
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	return &apiv1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Pod",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: apiv1.PodSpec{
+			Containers: []apiv1.Container{
+				{
+					Name:  containerName,
+					Image: image,
+				},
+			},
+		},
+	}
+}
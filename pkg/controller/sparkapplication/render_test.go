@@ -0,0 +1,116 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeclientfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+)
+
+func TestRender(t *testing.T) {
+	os.Setenv(kubernetesServiceHostEnvVar, "localhost")
+	os.Setenv(kubernetesServicePortEnvVar, "443")
+
+	image := "spark:3.1.1"
+	executorImage := "spark-executor:3.1.1"
+	mainFile := "local:///opt/spark/examples/jars/spark-examples.jar"
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+		},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type:                v1beta2.ScalaApplicationType,
+			Image:               &image,
+			MainApplicationFile: &mainFile,
+			Driver: v1beta2.DriverSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					Labels:       map[string]string{"team": "data"},
+					Annotations:  map[string]string{"owner": "alice"},
+					Env:          []apiv1.EnvVar{{Name: "DRIVER_ENV", Value: "1"}},
+					NodeSelector: map[string]string{"pool": "drivers"},
+				},
+			},
+			Executor: v1beta2.ExecutorSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					Image: &executorImage,
+					Env:   []apiv1.EnvVar{{Name: "EXECUTOR_ENV", Value: "2"}},
+				},
+			},
+		},
+	}
+	kubeClient := kubeclientfake.NewSimpleClientset()
+
+	rendering, err := Render(app, "", kubeClient)
+	assert.NoError(t, err)
+	assert.Contains(t, rendering.SparkSubmitArgs, "k8s://https://localhost:443")
+	assert.Contains(t, rendering.SparkSubmitArgs, "spark.kubernetes.driver.pod.name=foo-driver")
+	assert.Equal(t, mainFile, rendering.SparkSubmitArgs[len(rendering.SparkSubmitArgs)-1])
+
+	driverPod := rendering.DriverPod
+	assert.Equal(t, "foo-driver", driverPod.Name)
+	assert.Equal(t, "default", driverPod.Namespace)
+	assert.Equal(t, config.SparkDriverRole, driverPod.Labels[config.SparkRoleLabel])
+	assert.Equal(t, "data", driverPod.Labels["team"])
+	assert.Equal(t, "true", driverPod.Labels[config.LaunchedBySparkOperatorLabel])
+	assert.Equal(t, "alice", driverPod.Annotations["owner"])
+	assert.Len(t, driverPod.OwnerReferences, 1)
+	assert.Equal(t, map[string]string{"pool": "drivers"}, driverPod.Spec.NodeSelector)
+	assert.Equal(t, image, driverPod.Spec.Containers[0].Image)
+	assert.Contains(t, driverPod.Spec.Containers[0].Env, apiv1.EnvVar{Name: "DRIVER_ENV", Value: "1"})
+
+	executorPod := rendering.ExecutorPod
+	assert.Equal(t, "foo-exec-1", executorPod.Name)
+	assert.Equal(t, config.SparkExecutorRole, executorPod.Labels[config.SparkRoleLabel])
+	assert.Empty(t, executorPod.OwnerReferences)
+	assert.Empty(t, executorPod.Spec.NodeSelector)
+	assert.Equal(t, executorImage, executorPod.Spec.Containers[0].Image)
+	assert.Contains(t, executorPod.Spec.Containers[0].Env, apiv1.EnvVar{Name: "EXECUTOR_ENV", Value: "2"})
+
+	// Nothing is created.
+	assert.Empty(t, kubeClient.Actions())
+	// The given application is left unchanged.
+	assert.Equal(t, v1beta2.ScalaApplicationType, app.Spec.Type)
+	assert.Empty(t, app.Spec.Mode)
+}
+
+func TestRenderWithoutMasterURL(t *testing.T) {
+	os.Unsetenv(kubernetesServiceHostEnvVar)
+	defer os.Setenv(kubernetesServiceHostEnvVar, "localhost")
+
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+		},
+	}
+	_, err := Render(app, "", kubeclientfake.NewSimpleClientset())
+	assert.Error(t, err)
+
+	// A given master URL is used instead.
+	rendering, err := Render(app, "k8s://https://10.0.0.1:6443", kubeclientfake.NewSimpleClientset())
+	assert.NoError(t, err)
+	assert.Contains(t, rendering.SparkSubmitArgs, "k8s://https://10.0.0.1:6443")
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// anySparkVersion is the version selector matching all Spark versions.
+const anySparkVersion = "*"
+
+// SparkHomes maps Spark versions to the Spark installations that applications using those versions are
+// submitted with. The first installation whose versions match the spec.sparkVersion of an application is used.
+// Applications are submitted with the installation in SPARK_HOME if no installations are configured.
+type SparkHomes []sparkHome
+
+// sparkHome is a Spark installation and the versions it is used for.
+type sparkHome struct {
+	versions string
+	// min and max are the lowest and highest versions matched, inclusive. A version matches max if max
+	// is a prefix of it, i.e., 3.4 matches 3.4.2. Both are nil for anySparkVersion.
+	min  []int
+	max  []int
+	path string
+}
+
+// ParseSparkHomes parses Spark installations given as <versions>=<path>, where versions is a version,
+// e.g., 3.1 for all 3.1.x versions or 3.1.2 for that version only, an inclusive range of versions such
+// as 3.2-3.4, or * for any version.
+func ParseSparkHomes(specs []string) (SparkHomes, error) {
+	var homes SparkHomes
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid Spark home %q, expected <versions>=<path>", spec)
+		}
+		home := sparkHome{versions: strings.TrimSpace(parts[0]), path: parts[1]}
+		if home.versions != anySparkVersion {
+			bounds := strings.SplitN(home.versions, "-", 2)
+			min, err := parseVersionSelector(bounds[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid versions of Spark home %q: %v", spec, err)
+			}
+			max := min
+			if len(bounds) == 2 {
+				if max, err = parseVersionSelector(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid versions of Spark home %q: %v", spec, err)
+				}
+				if compareVersions(min, max) > 0 {
+					return nil, fmt.Errorf("invalid versions of Spark home %q: %s is higher than %s", spec, bounds[0], bounds[1])
+				}
+			}
+			home.min, home.max = min, max
+		}
+		homes = append(homes, home)
+	}
+	return homes, nil
+}
+
+// resolve returns the path of the installation to submit applications of the given Spark version with.
+// It returns an empty path if no installations are configured.
+func (h SparkHomes) resolve(sparkVersion string) (string, error) {
+	if len(h) == 0 {
+		return "", nil
+	}
+	version := parseSparkVersion(sparkVersion)
+	for _, home := range h {
+		if home.matches(version) {
+			return home.path, nil
+		}
+	}
+	if len(version) == 0 {
+		return "", fmt.Errorf("spec.sparkVersion %q is not a valid Spark version, which is needed to choose a Spark installation", sparkVersion)
+	}
+	return "", fmt.Errorf("no Spark installation is available for Spark version %s, the available versions are %s", sparkVersion, h)
+}
+
+func (h SparkHomes) String() string {
+	versions := make([]string, 0, len(h))
+	for _, home := range h {
+		versions = append(versions, home.versions)
+	}
+	return strings.Join(versions, ", ")
+}
+
+func (h sparkHome) matches(version []int) bool {
+	if h.versions == anySparkVersion {
+		return true
+	}
+	if len(version) == 0 {
+		return false
+	}
+	if compareVersions(version, h.min) < 0 {
+		return false
+	}
+	// Only compare as many components as max has, so that 3.4 matches 3.4.2.
+	if len(version) > len(h.max) {
+		version = version[:len(h.max)]
+	}
+	return compareVersions(version, h.max) <= 0
+}
+
+// parseVersionSelector parses a version of the form major[.minor[.patch]].
+func parseVersionSelector(selector string) ([]int, error) {
+	var version []int
+	for _, component := range strings.Split(strings.TrimSpace(selector), ".") {
+		n, err := strconv.Atoi(component)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%q is not a version", selector)
+		}
+		version = append(version, n)
+	}
+	return version, nil
+}
+
+// parseSparkVersion parses the numeric components of a Spark version, ignoring any suffix such as in
+// 3.3.0-amzn-1. It returns nil if the version doesn't start with a number.
+func parseSparkVersion(sparkVersion string) []int {
+	var version []int
+	for _, component := range strings.Split(strings.TrimSpace(sparkVersion), ".") {
+		digits := 0
+		for digits < len(component) && component[digits] >= '0' && component[digits] <= '9' {
+			digits++
+		}
+		if digits == 0 {
+			break
+		}
+		n, err := strconv.Atoi(component[:digits])
+		if err != nil {
+			break
+		}
+		version = append(version, n)
+		if digits < len(component) {
+			break
+		}
+	}
+	return version
+}
+
+// compareVersions compares two versions component by component, treating missing components as 0.
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+)
+
+func TestParseSparkHomesErrors(t *testing.T) {
+	for _, spec := range []string{"/opt/spark", "3.1=", "x.1=/opt/spark", "3.4-3.2=/opt/spark", "3.1-=/opt/spark"} {
+		_, err := ParseSparkHomes([]string{spec})
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestResolveSparkHome(t *testing.T) {
+	homes, err := ParseSparkHomes([]string{
+		"3.1.1=/opt/spark-3.1.1",
+		"3.1=/opt/spark-3.1",
+		"3.2-3.4=/opt/spark-3.4",
+		"3.5=/opt/spark-3.5",
+	})
+	assert.NoError(t, err)
+
+	testcases := []struct {
+		version string
+		home    string
+	}{
+		{version: "3.1.1", home: "/opt/spark-3.1.1"},
+		{version: "3.1.3", home: "/opt/spark-3.1"},
+		{version: "3.1", home: "/opt/spark-3.1"},
+		{version: "3.2.0", home: "/opt/spark-3.4"},
+		{version: "3.4.2", home: "/opt/spark-3.4"},
+		{version: "3.3.0-amzn-1", home: "/opt/spark-3.4"},
+		{version: "3.5.1", home: "/opt/spark-3.5"},
+	}
+	for _, test := range testcases {
+		home, err := homes.resolve(test.version)
+		assert.NoError(t, err, test.version)
+		assert.Equal(t, test.home, home, test.version)
+	}
+
+	for _, version := range []string{"3", "3.0.3", "3.6.0", "4.0.0", "", "latest"} {
+		_, err := homes.resolve(version)
+		assert.Error(t, err, version)
+	}
+
+	homes, err = ParseSparkHomes([]string{"3.5=/opt/spark-3.5", "*=/opt/spark"})
+	assert.NoError(t, err)
+	home, err := homes.resolve("2.4.8")
+	assert.NoError(t, err)
+	assert.Equal(t, "/opt/spark", home)
+
+	// SPARK_HOME is used if no installations are configured.
+	home, err = SparkHomes(nil).resolve("3.1.1")
+	assert.NoError(t, err)
+	assert.Equal(t, "", home)
+}
+
+func TestSyncSparkApplication_SparkHomes(t *testing.T) {
+	os.Setenv(sparkHomeEnvVar, "/spark")
+	os.Setenv(kubernetesServiceHostEnvVar, "localhost")
+	os.Setenv(kubernetesServicePortEnvVar, "443")
+
+	newApp := func(name string, sparkVersion string) *v1beta2.SparkApplication {
+		return &v1beta2.SparkApplication{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+			},
+			Spec: v1beta2.SparkApplicationSpec{
+				SparkVersion: sparkVersion,
+				RestartPolicy: v1beta2.RestartPolicy{
+					Type: v1beta2.Never,
+				},
+			},
+		}
+	}
+	supported := newApp("supported", "3.5.0")
+	unsupported := newApp("unsupported", "2.4.8")
+	unsupported.Spec.RestartPolicy = v1beta2.RestartPolicy{
+		Type:                       v1beta2.OnFailure,
+		OnSubmissionFailureRetries: int32ptr(3),
+	}
+	ctrl, _ := newFakeController(supported)
+	homes, err := ParseSparkHomes([]string{"3.1=/opt/spark-3.1", "3.5=/opt/spark-3.5"})
+	assert.NoError(t, err)
+	ctrl.sparkHomes = homes
+	for _, app := range []*v1beta2.SparkApplication{supported, unsupported} {
+		if _, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Create(context.TODO(), app, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var commands []string
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		commands = append(commands, command)
+		cs := []string{"-test.run=TestHelperProcessSuccess", "--", command}
+		cs = append(cs, args...)
+		cmd := exec.Command(os.Args[0], cs...)
+		cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
+		return cmd
+	}
+
+	err = ctrl.syncSparkApplication("default/supported")
+	assert.Nil(t, err)
+	updatedApp, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications("default").Get(context.TODO(), "supported", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, v1beta2.SubmittedState, updatedApp.Status.AppState.State)
+	assert.Equal(t, []string{"/opt/spark-3.5/bin/spark-submit"}, commands)
+
+	app := unsupported.DeepCopy()
+	app.Status.AppState.State = v1beta2.NewState
+	app = ctrl.submitSparkApplication(app)
+	// The application fails without being retried, as no installation becomes available for its version.
+	assert.Equal(t, v1beta2.FailedState, app.Status.AppState.State)
+	assert.Equal(t, v1beta2.SubmissionFailure, app.Status.FailureReason)
+	assert.Contains(t, app.Status.AppState.ErrorMessage, "no Spark installation is available for Spark version 2.4.8")
+	assert.Len(t, commands, 1)
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+)
+
+const (
+	// sparkQuotaRetryInterval is how often an application waiting for room in its SparkQuotas is checked again.
+	sparkQuotaRetryInterval = 10 * time.Second
+	// sparkQuotaEventInterval is the minimum interval between two events about an application waiting for
+	// room in its SparkQuotas.
+	sparkQuotaEventInterval = 5 * time.Minute
+	// sparkQuotaExceededReason is the reason of the SparkQuotaAdmitted condition of waiting applications.
+	sparkQuotaExceededReason = "SparkQuotaExceeded"
+	// sparkQuotaAdmittedReason is the reason of the SparkQuotaAdmitted condition of applications that fit into
+	// their SparkQuotas.
+	sparkQuotaAdmittedReason = "WithinSparkQuotas"
+)
+
+// admitBySparkQuotas checks the given application against the SparkQuotas selecting its namespace before it is
+// submitted. It returns false if the application must not be submitted now, in which case it either failed
+// because it can never fit into the quotas, or waits for other applications to complete and is synced again.
+func (c *Controller) admitBySparkQuotas(app *v1beta2.SparkApplication) bool {
+	if c.sparkQuotaEnforcer == nil {
+		return true
+	}
+	key := createMetaNamespaceKey(app.Namespace, app.Name)
+	reason, err := c.sparkQuotaEnforcer.AdmitSparkApplication(*app)
+	if err == nil && reason != "" {
+		glog.Infof("Failing SparkApplication %s that exceeds its SparkQuotas: %s", key, reason)
+		app.Status.AppState.State = v1beta2.FailedState
+		app.Status.AppState.ErrorMessage = reason
+		app.Status.FailureReason = v1beta2.SparkQuotaExceededFailure
+		c.recordSparkApplicationEvent(app)
+		c.sparkQuotaEventThrottle.forget(key)
+		return false
+	}
+	if err == nil {
+		reason, err = c.sparkQuotaEnforcer.AdmitSubmission(*app)
+	}
+	if err != nil {
+		glog.Errorf("failed to check SparkApplication %s against its SparkQuotas: %v", key, err)
+		c.queue.AddAfter(key, sparkQuotaRetryInterval)
+		return false
+	}
+	if reason != "" {
+		glog.V(2).Infof("SparkApplication %s waits for room in its SparkQuotas: %s", key, reason)
+		meta.SetStatusCondition(&app.Status.Conditions, metav1.Condition{
+			Type:    v1beta2.SparkQuotaAdmittedCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  sparkQuotaExceededReason,
+			Message: reason,
+		})
+		if c.sparkQuotaEventThrottle.allow(key, time.Now()) {
+			c.recorder.Event(app, apiv1.EventTypeWarning, sparkQuotaExceededReason, reason)
+		}
+		c.queue.AddAfter(key, sparkQuotaRetryInterval)
+		return false
+	}
+	meta.SetStatusCondition(&app.Status.Conditions, metav1.Condition{
+		Type:    v1beta2.SparkQuotaAdmittedCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  sparkQuotaAdmittedReason,
+		Message: "The application fits into the SparkQuotas of its namespace.",
+	})
+	c.sparkQuotaEventThrottle.forget(key)
+	return true
+}
+
+// waitingForSparkQuota tells if the given application waits for room in its SparkQuotas, so that the events
+// about it being added or rerun have already been recorded.
+func waitingForSparkQuota(app *v1beta2.SparkApplication) bool {
+	return meta.IsStatusConditionFalse(app.Status.Conditions, v1beta2.SparkQuotaAdmittedCondition)
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/webhook/resourceusage"
+)
+
+// newTestSparkQuotaEnforcer returns an enforcer of a SparkQuota with the given spec selecting all namespaces,
+// which sees the given applications in the default namespace.
+func newTestSparkQuotaEnforcer(spec v1beta2.SparkQuotaSpec, apps ...*v1beta2.SparkApplication) *resourceusage.SparkQuotaEnforcer {
+	return resourceusage.NewSparkQuotaEnforcerForObjects(
+		[]*v1beta2.SparkQuota{{ObjectMeta: metav1.ObjectMeta{Name: "quota"}, Spec: spec}},
+		apps,
+		[]*apiv1.Namespace{{ObjectMeta: metav1.ObjectMeta{Name: "default"}}},
+		resourceusage.DynamicAllocationChargeMax)
+}
+
+func TestSyncSparkApplication_SparkQuotaExceeded(t *testing.T) {
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+	}
+	running := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "running", Namespace: "default"},
+		Status:     v1beta2.SparkApplicationStatus{AppState: v1beta2.ApplicationState{State: v1beta2.RunningState}},
+	}
+
+	// The application waits while another application takes the only slot of the quota.
+	ctrl, recorder := newFakeController(app)
+	ctrl.sparkQuotaEnforcer = newTestSparkQuotaEnforcer(v1beta2.SparkQuotaSpec{MaxApplications: int32ptr(1)}, running, app)
+	_, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Create(context.TODO(), app, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, ctrl.syncSparkApplication("default/foo"))
+	updatedApp, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, v1beta2.NewState, updatedApp.Status.AppState.State)
+	condition := meta.FindStatusCondition(updatedApp.Status.Conditions, v1beta2.SparkQuotaAdmittedCondition)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, metav1.ConditionFalse, condition.Status)
+		assert.Equal(t, "SparkApplication default/foo waits for one of the 1 running applications of SparkQuota quota to complete.", condition.Message)
+	}
+	assert.Equal(t, 0, int(updatedApp.Status.SubmissionAttempts))
+
+	event := <-recorder.Events
+	assert.True(t, strings.Contains(event, "SparkApplicationAdded"))
+	event = <-recorder.Events
+	assert.True(t, strings.Contains(event, sparkQuotaExceededReason))
+
+	// Checking the application again while it waits records no further events.
+	assert.True(t, waitingForSparkQuota(updatedApp))
+	waiting := ctrl.submitSparkApplication(updatedApp.DeepCopy())
+	assert.Equal(t, v1beta2.NewState, waiting.Status.AppState.State)
+	assert.Empty(t, recorder.Events)
+
+	// The application is admitted once the quota has room for it.
+	ctrl.sparkQuotaEnforcer = newTestSparkQuotaEnforcer(v1beta2.SparkQuotaSpec{MaxApplications: int32ptr(2)}, running, app)
+	admitted := updatedApp.DeepCopy()
+	assert.True(t, ctrl.admitBySparkQuotas(admitted))
+	assert.False(t, waitingForSparkQuota(admitted))
+	condition = meta.FindStatusCondition(admitted.Status.Conditions, v1beta2.SparkQuotaAdmittedCondition)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, metav1.ConditionTrue, condition.Status)
+		assert.Equal(t, sparkQuotaAdmittedReason, condition.Reason)
+	}
+
+	// An application that can never fit into the quota fails.
+	cores := resource.MustParse("1")
+	ctrl, recorder = newFakeController(app)
+	ctrl.sparkQuotaEnforcer = newTestSparkQuotaEnforcer(v1beta2.SparkQuotaSpec{Cores: &cores}, app)
+	_, err = ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Create(context.TODO(), app, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, ctrl.syncSparkApplication("default/foo"))
+	updatedApp, err = ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, v1beta2.FailedState, updatedApp.Status.AppState.State)
+	assert.Equal(t, v1beta2.SparkQuotaExceededFailure, updatedApp.Status.FailureReason)
+	assert.Equal(t, "SparkApplication default/foo requests too many cores under SparkQuota quota (2.000 cores requested, 1.000 available).", updatedApp.Status.AppState.ErrorMessage)
+
+	event = <-recorder.Events
+	assert.True(t, strings.Contains(event, "SparkApplicationAdded"))
+	event = <-recorder.Events
+	assert.True(t, strings.Contains(event, "SparkApplicationFailed"))
+}
@@ -17,15 +17,25 @@ limitations under the License.
 package sparkapplication
 
 import (
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/labels"
 
 	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	crdlisters "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/listers/sparkoperator.k8s.io/v1beta2"
 	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/util"
 )
 
+const (
+	// failureReasonMetricLabel is the label carrying the failure reason on the failure metrics.
+	failureReasonMetricLabel = "failure_reason"
+	// stateMetricLabel is the label carrying the application state on the per-state metrics.
+	stateMetricLabel = "state"
+)
+
 type sparkAppMetrics struct {
 	labels []string
 	prefix string
@@ -41,19 +51,23 @@ type sparkAppMetrics struct {
 	sparkAppFailureExecutionTime  *prometheus.SummaryVec
 	sparkAppStartLatency          *prometheus.SummaryVec
 	sparkAppStartLatencyHistogram *prometheus.HistogramVec
+	sparkAppStateDuration         *prometheus.HistogramVec
+	sparkAppStateCount            *sparkAppStateCollector
 
 	sparkAppExecutorRunningCount *util.PositiveGauge
 	sparkAppExecutorFailureCount *prometheus.CounterVec
 	sparkAppExecutorSuccessCount *prometheus.CounterVec
 }
 
-func newSparkAppMetrics(metricsConfig *util.MetricConfig) *sparkAppMetrics {
+func newSparkAppMetrics(metricsConfig *util.MetricConfig, appLister crdlisters.SparkApplicationLister) *sparkAppMetrics {
 	prefix := metricsConfig.MetricsPrefix
 	labels := metricsConfig.MetricsLabels
 	validLabels := make([]string, len(labels))
 	for i, label := range labels {
 		validLabels[i] = util.CreateValidMetricNameLabel("", label)
 	}
+	failureLabels := append(append([]string{}, validLabels...), failureReasonMetricLabel)
+	stateLabels := append(append([]string{}, validLabels...), stateMetricLabel)
 
 	sparkAppCount := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -81,14 +95,14 @@ func newSparkAppMetrics(metricsConfig *util.MetricConfig) *sparkAppMetrics {
 			Name: util.CreateValidMetricNameLabel(prefix, "spark_app_failure_count"),
 			Help: "Spark App Failure Count via the Operator",
 		},
-		validLabels,
+		failureLabels,
 	)
 	sparkAppFailedSubmissionCount := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: util.CreateValidMetricNameLabel(prefix, "spark_app_failed_submission_count"),
 			Help: "Spark App Failed Submission Count via the Operator",
 		},
-		validLabels,
+		failureLabels,
 	)
 	sparkAppSuccessExecutionTime := prometheus.NewSummaryVec(
 		prometheus.SummaryOpts{
@@ -102,7 +116,7 @@ func newSparkAppMetrics(metricsConfig *util.MetricConfig) *sparkAppMetrics {
 			Name: util.CreateValidMetricNameLabel(prefix, "spark_app_failure_execution_time_microseconds"),
 			Help: "Spark App Failed Execution Runtime via the Operator",
 		},
-		validLabels,
+		failureLabels,
 	)
 	sparkAppStartLatency := prometheus.NewSummaryVec(
 		prometheus.SummaryOpts{
@@ -119,6 +133,20 @@ func newSparkAppMetrics(metricsConfig *util.MetricConfig) *sparkAppMetrics {
 		},
 		validLabels,
 	)
+	sparkAppStateDuration := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    util.CreateValidMetricNameLabel(prefix, "spark_app_state_duration_seconds"),
+			Help:    "Time Spark Apps spent in a state before moving to another one",
+			Buckets: metricsConfig.MetricsStateDurationBuckets,
+		},
+		stateLabels,
+	)
+	sparkAppStateCount := &sparkAppStateCollector{
+		desc: prometheus.NewDesc(util.CreateValidMetricNameLabel(prefix, "spark_app_state_count"),
+			"Number of Spark Apps currently in each state", stateLabels, nil),
+		labels:    validLabels,
+		appLister: appLister,
+	}
 	sparkAppExecutorSuccessCount := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: util.CreateValidMetricNameLabel(prefix, "spark_app_executor_success_count"),
@@ -151,6 +179,8 @@ func newSparkAppMetrics(metricsConfig *util.MetricConfig) *sparkAppMetrics {
 		sparkAppFailureExecutionTime:  sparkAppFailureExecutionTime,
 		sparkAppStartLatency:          sparkAppStartLatency,
 		sparkAppStartLatencyHistogram: sparkAppStartLatencyHistogram,
+		sparkAppStateDuration:         sparkAppStateDuration,
+		sparkAppStateCount:            sparkAppStateCount,
 		sparkAppExecutorRunningCount:  sparkAppExecutorRunningCount,
 		sparkAppExecutorSuccessCount:  sparkAppExecutorSuccessCount,
 		sparkAppExecutorFailureCount:  sparkAppExecutorFailureCount,
@@ -166,6 +196,8 @@ func (sm *sparkAppMetrics) registerMetrics() {
 	util.RegisterMetric(sm.sparkAppFailureExecutionTime)
 	util.RegisterMetric(sm.sparkAppStartLatency)
 	util.RegisterMetric(sm.sparkAppStartLatencyHistogram)
+	util.RegisterMetric(sm.sparkAppStateDuration)
+	util.RegisterMetric(sm.sparkAppStateCount)
 	util.RegisterMetric(sm.sparkAppExecutorSuccessCount)
 	util.RegisterMetric(sm.sparkAppExecutorFailureCount)
 	sm.sparkAppRunningCount.Register()
@@ -188,10 +220,13 @@ func (sm *sparkAppMetrics) exportMetricsOnDelete(oldApp *v1beta2.SparkApplicatio
 
 func (sm *sparkAppMetrics) exportMetrics(oldApp, newApp *v1beta2.SparkApplication) {
 	metricLabels := fetchMetricLabels(newApp, sm.labels)
+	failureLabels := fetchFailureMetricLabels(newApp, metricLabels)
 
 	oldState := oldApp.Status.AppState.State
 	newState := newApp.Status.AppState.State
 	if newState != oldState {
+		sm.exportStateDurationMetrics(oldApp, newApp, metricLabels)
+
 		if oldState == v1beta2.NewState {
 			if m, err := sm.sparkAppCount.GetMetricWith(metricLabels); err != nil {
 				glog.Errorf("Error while exporting metrics: %v", err)
@@ -228,20 +263,20 @@ func (sm *sparkAppMetrics) exportMetrics(oldApp, newApp *v1beta2.SparkApplicatio
 		case v1beta2.FailingState:
 			if !newApp.Status.LastSubmissionAttemptTime.Time.IsZero() && !newApp.Status.TerminationTime.Time.IsZero() {
 				d := newApp.Status.TerminationTime.Time.Sub(newApp.Status.LastSubmissionAttemptTime.Time)
-				if m, err := sm.sparkAppFailureExecutionTime.GetMetricWith(metricLabels); err != nil {
+				if m, err := sm.sparkAppFailureExecutionTime.GetMetricWith(failureLabels); err != nil {
 					glog.Errorf("Error while exporting metrics: %v", err)
 				} else {
 					m.Observe(float64(d / time.Microsecond))
 				}
 			}
 			sm.sparkAppRunningCount.Dec(metricLabels)
-			if m, err := sm.sparkAppFailureCount.GetMetricWith(metricLabels); err != nil {
+			if m, err := sm.sparkAppFailureCount.GetMetricWith(failureLabels); err != nil {
 				glog.Errorf("Error while exporting metrics: %v", err)
 			} else {
 				m.Inc()
 			}
 		case v1beta2.FailedSubmissionState:
-			if m, err := sm.sparkAppFailedSubmissionCount.GetMetricWith(metricLabels); err != nil {
+			if m, err := sm.sparkAppFailedSubmissionCount.GetMetricWith(failureLabels); err != nil {
 				glog.Errorf("Error while exporting metrics: %v", err)
 			} else {
 				m.Inc()
@@ -314,6 +349,80 @@ func (sm *sparkAppMetrics) exportJobStartLatencyMetrics(app *v1beta2.SparkApplic
 	}
 }
 
+// exportStateDurationMetrics records how long the application stayed in its previous state. The time
+// the application entered a state is not known for applications that changed state before the
+// operator started recording it, in which case nothing is recorded.
+func (sm *sparkAppMetrics) exportStateDurationMetrics(oldApp, newApp *v1beta2.SparkApplication, metricLabels map[string]string) {
+	var enteredAt, leftAt time.Time
+	if oldApp.Status.AppState.LastTransitionTime != nil {
+		enteredAt = oldApp.Status.AppState.LastTransitionTime.Time
+	} else if oldApp.Status.AppState.State == v1beta2.NewState {
+		enteredAt = oldApp.CreationTimestamp.Time
+	}
+	if newApp.Status.AppState.LastTransitionTime != nil {
+		leftAt = newApp.Status.AppState.LastTransitionTime.Time
+	}
+	if enteredAt.IsZero() || leftAt.IsZero() || leftAt.Before(enteredAt) {
+		return
+	}
+
+	stateLabels := make(map[string]string, len(metricLabels)+1)
+	for key, value := range metricLabels {
+		stateLabels[key] = value
+	}
+	stateLabels[stateMetricLabel] = stateMetricLabelValue(oldApp.Status.AppState.State)
+	if m, err := sm.sparkAppStateDuration.GetMetricWith(stateLabels); err != nil {
+		glog.Errorf("Error while exporting metrics: %v", err)
+	} else {
+		m.Observe(leftAt.Sub(enteredAt).Seconds())
+	}
+}
+
+func stateMetricLabelValue(state v1beta2.ApplicationStateType) string {
+	if state == v1beta2.NewState {
+		return "NEW"
+	}
+	return string(state)
+}
+
+// sparkAppStateCollector reports the number of applications currently in each state. Unlike the
+// other gauges, it is computed from the informer cache at collection time, so it also accounts for
+// applications that haven't changed state since the operator started.
+type sparkAppStateCollector struct {
+	desc      *prometheus.Desc
+	labels    []string
+	appLister crdlisters.SparkApplicationLister
+}
+
+func (c *sparkAppStateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *sparkAppStateCollector) Collect(ch chan<- prometheus.Metric) {
+	if c.appLister == nil {
+		return
+	}
+	apps, err := c.appLister.List(labels.Everything())
+	if err != nil {
+		glog.Errorf("Error while collecting metrics: %v", err)
+		return
+	}
+
+	counts := make(map[string]float64)
+	for _, app := range apps {
+		metricLabels := fetchMetricLabels(app, c.labels)
+		values := make([]string, 0, len(c.labels)+1)
+		for _, label := range c.labels {
+			values = append(values, metricLabels[label])
+		}
+		values = append(values, stateMetricLabelValue(app.Status.AppState.State))
+		counts[strings.Join(values, "\x00")]++
+	}
+	for key, count := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, count, strings.Split(key, "\x00")...)
+	}
+}
+
 func fetchMetricLabels(app *v1beta2.SparkApplication, labels []string) map[string]string {
 	// Convert app labels into ones that can be used as metric labels.
 	validLabels := make(map[string]string)
@@ -334,3 +443,16 @@ func fetchMetricLabels(app *v1beta2.SparkApplication, labels []string) map[strin
 	}
 	return metricLabels
 }
+
+// fetchFailureMetricLabels adds the failure reason of the application to the given metric labels.
+func fetchFailureMetricLabels(app *v1beta2.SparkApplication, metricLabels map[string]string) map[string]string {
+	failureLabels := make(map[string]string, len(metricLabels)+1)
+	for key, value := range metricLabels {
+		failureLabels[key] = value
+	}
+	failureLabels[failureReasonMetricLabel] = string(app.Status.FailureReason)
+	if app.Status.FailureReason == "" {
+		failureLabels[failureReasonMetricLabel] = string(v1beta2.UnknownFailure)
+	}
+	return failureLabels
+}
@@ -21,8 +21,16 @@ import (
 	"net/http"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	prometheus_model "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	crdlisters "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/listers/sparkoperator.k8s.io/v1beta2"
 )
 
 func TestSparkAppMetrics(t *testing.T) {
@@ -33,8 +41,9 @@ func TestSparkAppMetrics(t *testing.T) {
 		MetricsLabels:                 []string{"app-id", "namespace"},
 		MetricsJobStartLatencyBuckets: []float64{30, 60, 90, 120},
 	}
-	metrics := newSparkAppMetrics(metricsConfig)
+	metrics := newSparkAppMetrics(metricsConfig, nil)
 	app1 := map[string]string{"app_id": "test1", "namespace": "default"}
+	failedApp1 := map[string]string{"app_id": "test1", "namespace": "default", "failure_reason": "UserCodeError"}
 
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -44,10 +53,10 @@ func TestSparkAppMetrics(t *testing.T) {
 			metrics.sparkAppSubmitCount.With(app1).Inc()
 			metrics.sparkAppRunningCount.Inc(app1)
 			metrics.sparkAppSuccessCount.With(app1).Inc()
-			metrics.sparkAppFailureCount.With(app1).Inc()
-			metrics.sparkAppFailedSubmissionCount.With(app1).Inc()
+			metrics.sparkAppFailureCount.With(failedApp1).Inc()
+			metrics.sparkAppFailedSubmissionCount.With(failedApp1).Inc()
 			metrics.sparkAppSuccessExecutionTime.With(app1).Observe(float64(100 * i))
-			metrics.sparkAppFailureExecutionTime.With(app1).Observe(float64(500 * i))
+			metrics.sparkAppFailureExecutionTime.With(failedApp1).Observe(float64(500 * i))
 			metrics.sparkAppStartLatency.With(app1).Observe(float64(10 * i))
 			metrics.sparkAppStartLatencyHistogram.With(app1).Observe(float64(10 * i))
 			metrics.sparkAppExecutorRunningCount.Inc(app1)
@@ -66,9 +75,78 @@ func TestSparkAppMetrics(t *testing.T) {
 	assert.Equal(t, float64(10), fetchCounterValue(metrics.sparkAppSubmitCount, app1))
 	assert.Equal(t, float64(5), metrics.sparkAppRunningCount.Value(app1))
 	assert.Equal(t, float64(10), fetchCounterValue(metrics.sparkAppSuccessCount, app1))
-	assert.Equal(t, float64(10), fetchCounterValue(metrics.sparkAppFailureCount, app1))
-	assert.Equal(t, float64(10), fetchCounterValue(metrics.sparkAppFailedSubmissionCount, app1))
+	assert.Equal(t, float64(10), fetchCounterValue(metrics.sparkAppFailureCount, failedApp1))
+	assert.Equal(t, float64(10), fetchCounterValue(metrics.sparkAppFailedSubmissionCount, failedApp1))
 	assert.Equal(t, float64(5), metrics.sparkAppExecutorRunningCount.Value(app1))
 	assert.Equal(t, float64(10), fetchCounterValue(metrics.sparkAppExecutorFailureCount, app1))
 	assert.Equal(t, float64(10), fetchCounterValue(metrics.sparkAppExecutorSuccessCount, app1))
 }
+
+func TestSparkAppStateMetrics(t *testing.T) {
+	metricsConfig := &util.MetricConfig{
+		MetricsLabels:               []string{"namespace"},
+		MetricsStateDurationBuckets: []float64{30, 60, 120},
+	}
+	now := time.Now()
+	newApp := func(name string, state v1beta2.ApplicationStateType, lastTransitionTime *time.Time) *v1beta2.SparkApplication {
+		app := &v1beta2.SparkApplication{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.NewTime(now.Add(-time.Minute)),
+			},
+			Status: v1beta2.SparkApplicationStatus{
+				AppState: v1beta2.ApplicationState{State: state},
+			},
+		}
+		if lastTransitionTime != nil {
+			t := metav1.NewTime(*lastTransitionTime)
+			app.Status.AppState.LastTransitionTime = &t
+		}
+		return app
+	}
+	submittedAt := now.Add(-45 * time.Second)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	indexer.Add(newApp("foo", v1beta2.RunningState, &now))
+	indexer.Add(newApp("bar", v1beta2.RunningState, &now))
+	indexer.Add(newApp("baz", v1beta2.SubmittedState, &now))
+	metrics := newSparkAppMetrics(metricsConfig, crdlisters.NewSparkApplicationLister(indexer))
+
+	submitted := newApp("foo", v1beta2.SubmittedState, &submittedAt)
+	running := newApp("foo", v1beta2.RunningState, &now)
+	metrics.exportMetrics(submitted, running)
+	// The time the application entered the previous state is unknown.
+	metrics.exportMetrics(newApp("bar", v1beta2.SubmittedState, nil), newApp("bar", v1beta2.RunningState, &now))
+	// A new application entered its first state when it was created.
+	metrics.exportMetrics(newApp("baz", v1beta2.NewState, nil), newApp("baz", v1beta2.SubmittedState, &now))
+
+	histogram := fetchHistogram(metrics.sparkAppStateDuration, map[string]string{"namespace": "default", "state": "SUBMITTED"})
+	assert.Equal(t, uint64(1), histogram.GetSampleCount())
+	assert.InDelta(t, 45, histogram.GetSampleSum(), 0.001)
+	assert.Equal(t, uint64(0), histogram.GetBucket()[0].GetCumulativeCount())
+	assert.Equal(t, uint64(1), histogram.GetBucket()[1].GetCumulativeCount())
+	histogram = fetchHistogram(metrics.sparkAppStateDuration, map[string]string{"namespace": "default", "state": "NEW"})
+	assert.Equal(t, uint64(1), histogram.GetSampleCount())
+	assert.InDelta(t, 60, histogram.GetSampleSum(), 0.001)
+
+	ch := make(chan prometheus.Metric, 10)
+	metrics.sparkAppStateCount.Collect(ch)
+	close(ch)
+	counts := make(map[string]float64)
+	for m := range ch {
+		pb := &prometheus_model.Metric{}
+		m.Write(pb)
+		for _, label := range pb.GetLabel() {
+			if label.GetName() == stateMetricLabel {
+				counts[label.GetValue()] = pb.GetGauge().GetValue()
+			}
+		}
+	}
+	assert.Equal(t, map[string]float64{"RUNNING": 2, "SUBMITTED": 1}, counts)
+}
+
+func fetchHistogram(m *prometheus.HistogramVec, labels map[string]string) *prometheus_model.Histogram {
+	pb := &prometheus_model.Metric{}
+	m.With(labels).(prometheus.Metric).Write(pb)
+	return pb.GetHistogram()
+}
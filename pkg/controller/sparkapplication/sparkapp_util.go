@@ -72,6 +72,32 @@ func getDefaultUIIngressName(app *v1beta2.SparkApplication) string {
 	return fmt.Sprintf("%s-ui-ingress", app.Name)
 }
 
+func getDefaultUIHTTPRouteName(app *v1beta2.SparkApplication) string {
+	return fmt.Sprintf("%s-ui-httproute", app.Name)
+}
+
+// getUIExposure returns how the UI of the application is exposed, given the operator-wide default.
+func getUIExposure(app *v1beta2.SparkApplication, defaultExposure v1beta2.SparkUIExposure) v1beta2.SparkUIExposure {
+	if app.Spec.SparkUIOptions != nil && app.Spec.SparkUIOptions.Exposure != nil {
+		return *app.Spec.SparkUIOptions.Exposure
+	}
+	if defaultExposure == "" {
+		return v1beta2.IngressExposure
+	}
+	return defaultExposure
+}
+
+// getSubmissionBackend returns how the driver of the application is created, given the operator-wide default.
+func getSubmissionBackend(app *v1beta2.SparkApplication, defaultBackend v1beta2.SubmissionBackend) v1beta2.SubmissionBackend {
+	if app.Spec.SubmissionBackend != nil {
+		return *app.Spec.SubmissionBackend
+	}
+	if defaultBackend == "" {
+		return v1beta2.SparkSubmitBackend
+	}
+	return defaultBackend
+}
+
 func getResourceLabels(app *v1beta2.SparkApplication) map[string]string {
 	labels := map[string]string{config.SparkAppNameLabel: app.Name}
 	if app.Status.SubmissionID != "" {
@@ -183,6 +209,28 @@ func podStatusToDriverState(podStatus apiv1.PodStatus) v1beta2.DriverState {
 	}
 }
 
+// getDriverPendingMessage describes why a pending driver pod isn't running yet, using the waiting
+// state of the driver container or the scheduling condition of the pod.
+func getDriverPendingMessage(podStatus apiv1.PodStatus) string {
+	for _, c := range podStatus.ContainerStatuses {
+		if c.Name == config.SparkDriverContainerName && c.State.Waiting != nil && c.State.Waiting.Reason != "" {
+			if c.State.Waiting.Message != "" {
+				return fmt.Sprintf("%s: %s", c.State.Waiting.Reason, c.State.Waiting.Message)
+			}
+			return c.State.Waiting.Reason
+		}
+	}
+	for _, condition := range podStatus.Conditions {
+		if condition.Type == apiv1.PodScheduled && condition.Status == apiv1.ConditionFalse {
+			if condition.Message != "" {
+				return fmt.Sprintf("%s: %s", condition.Reason, condition.Message)
+			}
+			return condition.Reason
+		}
+	}
+	return "pod is pending"
+}
+
 func hasDriverTerminated(driverState v1beta2.DriverState) bool {
 	return driverState == v1beta2.DriverCompletedState || driverState == v1beta2.DriverFailedState
 }
@@ -0,0 +1,180 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/util"
+)
+
+const gatewayAPIGroup = "gateway.networking.k8s.io"
+
+// Gateway API versions serving HTTPRoutes, in order of preference.
+var gatewayAPIVersions = []string{"v1", "v1beta1", "v1alpha2"}
+
+// SparkHTTPRoute encapsulates information about the driver UI HTTPRoute.
+type SparkHTTPRoute struct {
+	routeName   string
+	routeURL    *url.URL
+	annotations map[string]string
+}
+
+// getHTTPRouteResource returns the resource of the preferred Gateway API version available in the cluster.
+func getHTTPRouteResource() (schema.GroupVersionResource, error) {
+	for _, version := range gatewayAPIVersions {
+		if util.HTTPRouteCapabilities.Has(gatewayAPIGroup + "/" + version) {
+			return schema.GroupVersionResource{Group: gatewayAPIGroup, Version: version, Resource: "httproutes"}, nil
+		}
+	}
+	return schema.GroupVersionResource{}, fmt.Errorf("the Gateway API HTTPRoute resource is not available in the cluster")
+}
+
+// createSparkUIHTTPRoute creates an HTTPRoute for the UI service attached to the given Gateway, which
+// is referenced as namespace/name. Annotations and TLS hosts are taken from the Ingress options of
+// the application. TLS itself is terminated by the Gateway.
+func createSparkUIHTTPRoute(app *v1beta2.SparkApplication, service SparkService, routeURL *url.URL, gateway string, dynamicClient dynamic.Interface) (*SparkHTTPRoute, error) {
+	if gateway == "" {
+		return nil, fmt.Errorf("no Gateway is configured for HTTPRoutes")
+	}
+	gatewayNamespace, gatewayName, err := cache.SplitMetaNamespaceKey(gateway)
+	if err != nil {
+		return nil, err
+	}
+	if gatewayNamespace == "" {
+		gatewayNamespace = app.Namespace
+	}
+	resource, err := getHTTPRouteResource()
+	if err != nil {
+		return nil, err
+	}
+
+	var hostnames []interface{}
+	if routeURL.Hostname() != "" {
+		hostnames = append(hostnames, routeURL.Hostname())
+	}
+	tlsHosts := getIngressTlsHosts(app)
+	for _, tls := range tlsHosts {
+		for _, host := range tls.Hosts {
+			if host != routeURL.Hostname() {
+				hostnames = append(hostnames, host)
+			}
+		}
+	}
+
+	routePath := routeURL.Path
+	if routePath == "" {
+		routePath = "/"
+	}
+	rule := map[string]interface{}{
+		"matches": []interface{}{
+			map[string]interface{}{
+				"path": map[string]interface{}{"type": "PathPrefix", "value": routePath},
+			},
+		},
+		"backendRefs": []interface{}{
+			map[string]interface{}{"name": service.serviceName, "port": int64(service.servicePort)},
+		},
+	}
+	// If we're serving on a subpath, strip it before forwarding to the UI like the Ingress does.
+	if routePath != "/" {
+		rule["filters"] = []interface{}{
+			map[string]interface{}{
+				"type": "URLRewrite",
+				"urlRewrite": map[string]interface{}{
+					"path": map[string]interface{}{"type": "ReplacePrefixMatch", "replacePrefixMatch": "/"},
+				},
+			},
+		}
+	}
+
+	spec := map[string]interface{}{
+		"parentRefs": []interface{}{
+			map[string]interface{}{
+				"group":     gatewayAPIGroup,
+				"kind":      "Gateway",
+				"namespace": gatewayNamespace,
+				"name":      gatewayName,
+			},
+		},
+		"rules": []interface{}{rule},
+	}
+	if len(hostnames) > 0 {
+		spec["hostnames"] = hostnames
+	}
+
+	route := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	route.SetAPIVersion(resource.GroupVersion().String())
+	route.SetKind("HTTPRoute")
+	route.SetName(getDefaultUIHTTPRouteName(app))
+	route.SetNamespace(app.Namespace)
+	route.SetLabels(getResourceLabels(app))
+	route.SetOwnerReferences([]metav1.OwnerReference{*getOwnerReference(app)})
+	annotations := getIngressResourceAnnotations(app)
+	if len(annotations) != 0 {
+		route.SetAnnotations(annotations)
+	}
+
+	glog.Infof("Creating an HTTPRoute %s for the Spark UI for application %s", route.GetName(), app.Name)
+	if _, err := dynamicClient.Resource(resource).Namespace(app.Namespace).Create(context.TODO(), route, metav1.CreateOptions{}); err != nil {
+		return nil, err
+	}
+
+	reportedURL := *routeURL
+	if len(tlsHosts) != 0 {
+		reportedURL.Scheme = "https"
+	}
+	return &SparkHTTPRoute{
+		routeName:   route.GetName(),
+		routeURL:    &reportedURL,
+		annotations: annotations,
+	}, nil
+}
+
+// deleteSparkUIHTTPRoute deletes the given HTTPRoute. There is nothing to delete if HTTPRoutes are not
+// available in the cluster.
+func deleteSparkUIHTTPRoute(namespace, name string, dynamicClient dynamic.Interface) error {
+	resource, err := getHTTPRouteResource()
+	if err != nil {
+		glog.V(2).Infof("Not deleting Spark UI HTTPRoute %s in namespace %s: %v", name, namespace, err)
+		return nil
+	}
+	glog.V(2).Infof("Deleting Spark UI HTTPRoute %s in namespace %s", name, namespace)
+	return dynamicClient.Resource(resource).Namespace(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+}
+
+// getSparkUIHTTPRoute gets the given HTTPRoute. It returns a NotFound error if HTTPRoutes are not available in
+// the cluster.
+func getSparkUIHTTPRoute(namespace, name string, dynamicClient dynamic.Interface) (runtime.Object, error) {
+	resource, err := getHTTPRouteResource()
+	if err != nil {
+		return nil, errors.NewNotFound(schema.GroupResource{Group: gatewayAPIGroup, Resource: "httproutes"}, name)
+	}
+	return dynamicClient.Resource(resource).Namespace(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
@@ -23,11 +23,16 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	apiv1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
 
 	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
 	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
@@ -573,6 +578,76 @@ func TestCreateSparkUIIngress(t *testing.T) {
 	}
 }
 
+// setHTTPRouteCapabilities sets the Gateway API versions serving HTTPRoutes for the duration of the given test.
+func setHTTPRouteCapabilities(t *testing.T, capabilities util.Capabilities) {
+	previous := util.HTTPRouteCapabilities
+	t.Cleanup(func() { util.HTTPRouteCapabilities = previous })
+	util.HTTPRouteCapabilities = capabilities
+}
+
+func TestCreateSparkUIHTTPRoute(t *testing.T) {
+	setHTTPRouteCapabilities(t, util.Capabilities{"gateway.networking.k8s.io/v1": true})
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+			UID:       "foo-123",
+		},
+		Spec: v1beta2.SparkApplicationSpec{
+			SparkUIOptions: &v1beta2.SparkUIConfiguration{
+				IngressAnnotations: map[string]string{"example.com/annotation": "value"},
+				IngressTLS: []networkingv1.IngressTLS{
+					{Hosts: []string{"spark.example.com", "spark-alt.example.com"}, SecretName: "secret"},
+				},
+			},
+		},
+	}
+	service := SparkService{serviceName: "foo-ui-svc", servicePort: 4041}
+	routeURL := parseURLAndAssertError("spark.example.com/default/foo", t)
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(scheme.Scheme)
+
+	_, err := createSparkUIHTTPRoute(app, service, routeURL, "", dynamicClient)
+	assert.NotNil(t, err)
+
+	route, err := createSparkUIHTTPRoute(app, service, routeURL, "gateways/spark", dynamicClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "foo-ui-httproute", route.routeName)
+	assert.Equal(t, "https://spark.example.com/default/foo", route.routeURL.String())
+
+	obj, err := getSparkUIHTTPRoute("default", "foo-ui-httproute", dynamicClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := obj.(*unstructured.Unstructured)
+	assert.Equal(t, "gateway.networking.k8s.io/v1", created.GetAPIVersion())
+	assert.Equal(t, map[string]string{"example.com/annotation": "value"}, created.GetAnnotations())
+	assert.Equal(t, "foo-123", string(created.GetOwnerReferences()[0].UID))
+	hostnames, _, _ := unstructured.NestedStringSlice(created.Object, "spec", "hostnames")
+	assert.Equal(t, []string{"spark.example.com", "spark-alt.example.com"}, hostnames)
+	parentRefs, _, _ := unstructured.NestedSlice(created.Object, "spec", "parentRefs")
+	assert.Equal(t, "gateways", parentRefs[0].(map[string]interface{})["namespace"])
+	assert.Equal(t, "spark", parentRefs[0].(map[string]interface{})["name"])
+	rules, _, _ := unstructured.NestedSlice(created.Object, "spec", "rules")
+	rule := rules[0].(map[string]interface{})
+	path, _, _ := unstructured.NestedString(rule["matches"].([]interface{})[0].(map[string]interface{}), "path", "value")
+	assert.Equal(t, "/default/foo", path)
+	backend := rule["backendRefs"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "foo-ui-svc", backend["name"])
+	assert.Equal(t, int64(4041), backend["port"])
+	assert.Equal(t, 1, len(rule["filters"].([]interface{})))
+}
+
+func TestDeleteSparkUIHTTPRouteWithoutGatewayAPI(t *testing.T) {
+	setHTTPRouteCapabilities(t, nil)
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(scheme.Scheme)
+
+	assert.Nil(t, deleteSparkUIHTTPRoute("default", "foo-ui-httproute", dynamicClient))
+	_, err := getSparkUIHTTPRoute("default", "foo-ui-httproute", dynamicClient)
+	assert.True(t, errors.IsNotFound(err))
+}
+
 func parseURLAndAssertError(testURL string, t *testing.T) *url.URL {
 	fallbackURL, _ := url.Parse("http://example.com")
 	parsedURL, err := url.Parse(testURL)
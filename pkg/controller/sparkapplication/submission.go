@@ -17,12 +17,15 @@ limitations under the License.
 package sparkapplication
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/golang/glog"
 	v1 "k8s.io/api/core/v1"
@@ -44,6 +47,16 @@ type submission struct {
 	namespace string
 	name      string
 	args      []string
+	// sparkHome is the Spark installation to run spark-submit from, or empty for the one in SPARK_HOME.
+	sparkHome string
+	// patchDriverPod patches the driver pod created by the native submission backend, if set.
+	patchDriverPod func(pod *v1.Pod) (*v1.Pod, error)
+	// executorPodTemplate is the executor pod template the native submission backend mounts into the driver
+	// pod, if set.
+	executorPodTemplate []byte
+	// stdout and stderr are the output of spark-submit once it has run.
+	stdout []byte
+	stderr []byte
 }
 
 func newSubmission(args []string, app *v1beta2.SparkApplication) *submission {
@@ -54,21 +67,52 @@ func newSubmission(args []string, app *v1beta2.SparkApplication) *submission {
 	}
 }
 
-func runSparkSubmit(submission *submission) (bool, error) {
-	sparkHome, present := os.LookupEnv(sparkHomeEnvVar)
-	if !present {
-		glog.Error("SPARK_HOME is not specified")
+// submissionTimeoutError is returned when spark-submit doesn't complete within the submission timeout.
+type submissionTimeoutError struct {
+	namespace string
+	name      string
+	timeout   time.Duration
+}
+
+func (e *submissionTimeoutError) Error() string {
+	return fmt.Sprintf("spark-submit for SparkApplication %s/%s did not complete within %v and was killed", e.namespace, e.name, e.timeout)
+}
+
+func isSubmissionTimeout(err error) bool {
+	_, ok := err.(*submissionTimeoutError)
+	return ok
+}
+
+// runSparkSubmit runs spark-submit for the given submission. If timeout is positive, spark-submit
+// and all processes it started are killed if it doesn't complete in time.
+func runSparkSubmit(submission *submission, timeout time.Duration) (bool, error) {
+	sparkHome := submission.sparkHome
+	if sparkHome == "" {
+		var present bool
+		if sparkHome, present = os.LookupEnv(sparkHomeEnvVar); !present {
+			glog.Error("SPARK_HOME is not specified")
+		}
 	}
 	var command = filepath.Join(sparkHome, "/bin/spark-submit")
 
 	cmd := execCommand(command, submission.args...)
 	glog.V(2).Infof("spark-submit arguments: %v", cmd.Args)
-	output, err := cmd.Output()
-	glog.V(3).Infof("spark-submit output: %s", string(output))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Run spark-submit in its own process group, so that the JVM and any process it forks can be killed together.
+	setProcessGroup(cmd)
+	err := runWithTimeout(cmd, timeout)
+	glog.V(3).Infof("spark-submit output: %s", stdout.String())
+	submission.stdout = stdout.Bytes()
+	submission.stderr = stderr.Bytes()
+	if err == errCommandTimedOut {
+		return false, &submissionTimeoutError{namespace: submission.namespace, name: submission.name, timeout: timeout}
+	}
 	if err != nil {
 		var errorMsg string
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			errorMsg = string(exitErr.Stderr)
+		if _, ok := err.(*exec.ExitError); ok {
+			errorMsg = stderr.String()
 		}
 		// The driver pod of the application already exists.
 		if strings.Contains(errorMsg, podAlreadyExistsErrorCode) {
@@ -84,15 +128,54 @@ func runSparkSubmit(submission *submission) (bool, error) {
 	return true, nil
 }
 
-func buildSubmissionCommandArgs(app *v1beta2.SparkApplication, driverPodName string, submissionID string) ([]string, error) {
-	var args []string
-	if app.Spec.MainClass != nil {
-		args = append(args, "--class", *app.Spec.MainClass)
+var errCommandTimedOut = errors.New("command timed out")
+
+// runWithTimeout starts the given command and waits for it to complete. If timeout is positive and the
+// command doesn't complete in time, its process group is killed and errCommandTimedOut is returned.
+func runWithTimeout(cmd *exec.Cmd, timeout time.Duration) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if timeout <= 0 {
+		return cmd.Wait()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		if err := killProcessGroup(cmd); err != nil {
+			glog.Errorf("failed to kill the process group of %s: %v", cmd.Path, err)
+		}
+		<-done
+		return errCommandTimedOut
 	}
+}
+
+func buildSubmissionCommandArgs(app *v1beta2.SparkApplication, driverPodName string, submissionID string) ([]string, error) {
 	masterURL, err := getMasterURL()
 	if err != nil {
 		return nil, err
 	}
+	return buildSubmissionCommandArgsForMaster(app, masterURL, driverPodName, submissionID)
+}
+
+// buildSubmissionCommandArgsForMaster builds the arguments of spark-submit for the given master URL.
+func buildSubmissionCommandArgsForMaster(
+	app *v1beta2.SparkApplication,
+	masterURL string,
+	driverPodName string,
+	submissionID string) ([]string, error) {
+	var args []string
+	if app.Spec.MainClass != nil {
+		args = append(args, "--class", *app.Spec.MainClass)
+	}
 
 	args = append(args, "--master", masterURL)
 	args = append(args, "--deploy-mode", string(app.Spec.Mode))
@@ -0,0 +1,298 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/util"
+)
+
+// appSubmission is a submission of an application, made for a given version of the application.
+type appSubmission struct {
+	// uid, generation and state identify the version of the application the submission was made for.
+	uid        types.UID
+	generation int64
+	state      v1beta2.ApplicationStateType
+	// app is the application prepared for submission, whose status is updated from the result of the submission.
+	app           *v1beta2.SparkApplication
+	driverPodName string
+	submissionID  string
+}
+
+func newAppSubmission(app *v1beta2.SparkApplication, driverPodName string, submissionID string) appSubmission {
+	return appSubmission{
+		uid:           app.UID,
+		generation:    app.Generation,
+		state:         app.Status.AppState.State,
+		app:           app,
+		driverPodName: driverPodName,
+		submissionID:  submissionID,
+	}
+}
+
+// isFor tells if the submission was made for the given version of the application.
+func (s *appSubmission) isFor(app *v1beta2.SparkApplication) bool {
+	return s.uid == app.UID && s.generation == app.Generation && s.state == app.Status.AppState.State
+}
+
+// submissionJob is the submission of an application run by the submissionExecutor.
+type submissionJob struct {
+	appSubmission
+	key string
+	run func() (bool, error)
+
+	enqueueTime time.Time
+	started     bool
+	done        bool
+	submitted   bool
+	err         error
+}
+
+// submissionExecutor runs submissions on a fixed number of workers, separate from the controller
+// workers, so that slow or hung submissions don't stop the controller from syncing other applications.
+// It keeps at most one job per application. Once a job is done, onComplete is called with the key of the
+// application, which is expected to sync the application and take the result of the job.
+type submissionExecutor struct {
+	mutex      sync.Mutex
+	jobs       map[string]*submissionJob
+	queue      workqueue.Interface
+	workers    int
+	onComplete func(key string)
+	metrics    *submissionMetrics
+}
+
+func newSubmissionExecutor(workers int, onComplete func(key string), metricsConfig *util.MetricConfig) *submissionExecutor {
+	e := &submissionExecutor{
+		jobs:       make(map[string]*submissionJob),
+		queue:      workqueue.NewNamed("spark-application-submission"),
+		workers:    workers,
+		onComplete: onComplete,
+	}
+	if metricsConfig != nil {
+		e.metrics = newSubmissionMetrics(metricsConfig.MetricsPrefix)
+		e.metrics.registerMetrics()
+	}
+	return e
+}
+
+// start starts the workers of the executor. It is a no-op on a nil executor.
+func (e *submissionExecutor) start(stopCh <-chan struct{}) {
+	if e == nil {
+		return
+	}
+	glog.Infof("Starting %d submission workers", e.workers)
+	for i := 0; i < e.workers; i++ {
+		go wait.Until(e.runWorker, time.Second, stopCh)
+	}
+}
+
+// stop stops the workers of the executor once the running jobs are done. It is a no-op on a nil executor.
+func (e *submissionExecutor) stop() {
+	if e == nil {
+		return
+	}
+	e.queue.ShutDown()
+}
+
+// submit queues the given job unless a job is already queued, running or done for the same application.
+func (e *submissionExecutor) submit(job *submissionJob) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if _, exists := e.jobs[job.key]; exists {
+		return false
+	}
+	job.enqueueTime = time.Now()
+	e.jobs[job.key] = job
+	e.queue.Add(job.key)
+	e.metrics.queued()
+	return true
+}
+
+// isPending tells if a job of the application with the given key is queued or running. It is always
+// false on a nil executor.
+func (e *submissionExecutor) isPending(key string) bool {
+	if e == nil {
+		return false
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	job, exists := e.jobs[key]
+	return exists && !job.done
+}
+
+// takeResult removes and returns the done job of the application with the given key, if any. It always
+// returns nil on a nil executor.
+func (e *submissionExecutor) takeResult(key string) *submissionJob {
+	if e == nil {
+		return nil
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	job, exists := e.jobs[key]
+	if !exists || !job.done {
+		return nil
+	}
+	delete(e.jobs, key)
+	return job
+}
+
+// forget drops the job of the application with the given key, e.g., because the application was deleted.
+// A queued job is not run, and the result of a running job is discarded.
+func (e *submissionExecutor) forget(key string) {
+	if e == nil {
+		return
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if job, exists := e.jobs[key]; exists {
+		if !job.started {
+			e.metrics.dropped()
+		}
+		delete(e.jobs, key)
+	}
+}
+
+func (e *submissionExecutor) runWorker() {
+	for e.processNextJob() {
+	}
+}
+
+func (e *submissionExecutor) processNextJob() bool {
+	item, quit := e.queue.Get()
+	if quit {
+		return false
+	}
+	key := item.(string)
+	defer e.queue.Done(key)
+
+	e.mutex.Lock()
+	job, exists := e.jobs[key]
+	if !exists || job.started {
+		e.mutex.Unlock()
+		return true
+	}
+	job.started = true
+	e.metrics.dequeued(job.enqueueTime)
+	e.mutex.Unlock()
+
+	e.metrics.started()
+	start := time.Now()
+	submitted, err := job.run()
+	e.metrics.finished(start, isSubmissionTimeout(err))
+
+	e.mutex.Lock()
+	job.submitted = submitted
+	job.err = err
+	job.done = true
+	// The job may have been forgotten while it was running.
+	current := e.jobs[key] == job
+	e.mutex.Unlock()
+
+	if current {
+		e.onComplete(key)
+	}
+	return true
+}
+
+// submissionMetrics are the metrics of the submissionExecutor.
+type submissionMetrics struct {
+	queueLength   prometheus.Gauge
+	inFlight      prometheus.Gauge
+	queueWaitTime prometheus.Histogram
+	duration      prometheus.Histogram
+	timeoutCount  prometheus.Counter
+}
+
+func newSubmissionMetrics(prefix string) *submissionMetrics {
+	return &submissionMetrics{
+		queueLength: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: util.CreateValidMetricNameLabel(prefix, "spark_app_submission_queue_length"),
+			Help: "Number of Spark App submissions waiting for a submission worker",
+		}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: util.CreateValidMetricNameLabel(prefix, "spark_app_submission_in_flight"),
+			Help: "Number of Spark App submissions currently running",
+		}),
+		queueWaitTime: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    util.CreateValidMetricNameLabel(prefix, "spark_app_submission_queue_wait_seconds"),
+			Help:    "Time Spark App submissions waited for a submission worker",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 14),
+		}),
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    util.CreateValidMetricNameLabel(prefix, "spark_app_submission_duration_seconds"),
+			Help:    "Time taken by Spark App submissions",
+			Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+		}),
+		timeoutCount: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: util.CreateValidMetricNameLabel(prefix, "spark_app_submission_timeout_count"),
+			Help: "Spark App submissions killed for exceeding the submission timeout",
+		}),
+	}
+}
+
+func (m *submissionMetrics) registerMetrics() {
+	util.RegisterMetric(m.queueLength)
+	util.RegisterMetric(m.inFlight)
+	util.RegisterMetric(m.queueWaitTime)
+	util.RegisterMetric(m.duration)
+	util.RegisterMetric(m.timeoutCount)
+}
+
+func (m *submissionMetrics) queued() {
+	if m != nil {
+		m.queueLength.Inc()
+	}
+}
+
+func (m *submissionMetrics) dequeued(enqueueTime time.Time) {
+	if m != nil {
+		m.queueLength.Dec()
+		m.queueWaitTime.Observe(time.Since(enqueueTime).Seconds())
+	}
+}
+
+func (m *submissionMetrics) dropped() {
+	if m != nil {
+		m.queueLength.Dec()
+	}
+}
+
+func (m *submissionMetrics) started() {
+	if m != nil {
+		m.inFlight.Inc()
+	}
+}
+
+func (m *submissionMetrics) finished(start time.Time, timedOut bool) {
+	if m == nil {
+		return
+	}
+	m.inFlight.Dec()
+	m.duration.Observe(time.Since(start).Seconds())
+	if timedOut {
+		m.timeoutCount.Inc()
+	}
+}
@@ -0,0 +1,270 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+)
+
+func waitForKeys(t *testing.T, completed <-chan string, n int) []string {
+	var keys []string
+	for i := 0; i < n; i++ {
+		select {
+		case key := <-completed:
+			keys = append(keys, key)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out waiting for submission %d", i+1)
+		}
+	}
+	return keys
+}
+
+func TestSubmissionExecutorConcurrencyLimit(t *testing.T) {
+	completed := make(chan string, 10)
+	executor := newSubmissionExecutor(2, func(key string) { completed <- key }, nil)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	executor.start(stopCh)
+	defer executor.stop()
+
+	var mutex sync.Mutex
+	running, maxRunning := 0, 0
+	started := make(chan struct{}, 5)
+	release := make(chan struct{})
+	for i := 0; i < 5; i++ {
+		submitted := executor.submit(&submissionJob{
+			key: fmt.Sprintf("default/app-%d", i),
+			run: func() (bool, error) {
+				mutex.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				mutex.Unlock()
+				started <- struct{}{}
+				<-release
+				mutex.Lock()
+				running--
+				mutex.Unlock()
+				return true, nil
+			},
+		})
+		assert.True(t, submitted)
+	}
+	// Only one job at a time per application.
+	assert.False(t, executor.submit(&submissionJob{key: "default/app-0"}))
+	assert.True(t, executor.isPending("default/app-0"))
+
+	// Two jobs start, the others wait for a worker.
+	<-started
+	<-started
+	select {
+	case <-started:
+		t.Fatal("more jobs running than workers")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	keys := waitForKeys(t, completed, 5)
+	assert.Len(t, keys, 5)
+	assert.Equal(t, 2, maxRunning)
+
+	for _, key := range keys {
+		assert.False(t, executor.isPending(key))
+		job := executor.takeResult(key)
+		assert.NotNil(t, job)
+		assert.True(t, job.submitted)
+		assert.Nil(t, executor.takeResult(key))
+	}
+}
+
+func TestSubmissionExecutorForget(t *testing.T) {
+	completed := make(chan string, 10)
+	executor := newSubmissionExecutor(1, func(key string) { completed <- key }, nil)
+
+	ran := false
+	executor.submit(&submissionJob{key: "default/foo", run: func() (bool, error) {
+		ran = true
+		return true, nil
+	}})
+	executor.forget("default/foo")
+	assert.False(t, executor.isPending("default/foo"))
+
+	executor.submit(&submissionJob{key: "default/bar", run: func() (bool, error) { return true, nil }})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	executor.start(stopCh)
+	defer executor.stop()
+
+	assert.Equal(t, []string{"default/bar"}, waitForKeys(t, completed, 1))
+	assert.False(t, ran)
+	assert.Nil(t, executor.takeResult("default/foo"))
+}
+
+func TestNilSubmissionExecutor(t *testing.T) {
+	var executor *submissionExecutor
+	executor.start(nil)
+	executor.forget("default/foo")
+	assert.False(t, executor.isPending("default/foo"))
+	assert.Nil(t, executor.takeResult("default/foo"))
+	executor.stop()
+}
+
+func TestHelperProcessHang(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	time.Sleep(time.Minute)
+	os.Exit(0)
+}
+
+func TestRunSparkSubmitTimeout(t *testing.T) {
+	os.Setenv(sparkHomeEnvVar, "/spark")
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		cs := []string{"-test.run=TestHelperProcessHang", "--", command}
+		cs = append(cs, args...)
+		cmd := exec.Command(os.Args[0], cs...)
+		cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
+		return cmd
+	}
+
+	start := time.Now()
+	submitted, err := runSparkSubmit(&submission{namespace: "default", name: "foo"}, 200*time.Millisecond)
+	assert.False(t, submitted)
+	assert.True(t, isSubmissionTimeout(err))
+	assert.True(t, time.Since(start) < 30*time.Second)
+}
+
+func TestSyncSparkApplication_SubmissionWorkers(t *testing.T) {
+	os.Setenv(sparkHomeEnvVar, "/spark")
+	os.Setenv(kubernetesServiceHostEnvVar, "localhost")
+	os.Setenv(kubernetesServicePortEnvVar, "443")
+
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+		},
+		Spec: v1beta2.SparkApplicationSpec{
+			RestartPolicy: v1beta2.RestartPolicy{
+				Type: v1beta2.Never,
+			},
+		},
+	}
+	ctrl, _ := newFakeController(app)
+	completed := make(chan string, 1)
+	ctrl.submissionExecutor = newSubmissionExecutor(1, func(key string) { completed <- key }, nil)
+	_, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Create(context.TODO(), app, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		cs := []string{"-test.run=TestHelperProcessSuccess", "--", command}
+		cs = append(cs, args...)
+		cmd := exec.Command(os.Args[0], cs...)
+		cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
+		return cmd
+	}
+
+	// The submission is queued and the status of the application is left unchanged.
+	err = ctrl.syncSparkApplication("default/foo")
+	assert.Nil(t, err)
+	assert.True(t, ctrl.submissionExecutor.isPending("default/foo"))
+	updatedApp, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, v1beta2.NewState, updatedApp.Status.AppState.State)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	ctrl.submissionExecutor.start(stopCh)
+	defer ctrl.submissionExecutor.stop()
+	assert.Equal(t, []string{"default/foo"}, waitForKeys(t, completed, 1))
+
+	// The next sync takes the result of the submission.
+	err = ctrl.syncSparkApplication("default/foo")
+	assert.Nil(t, err)
+	updatedApp, err = ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, v1beta2.SubmittedState, updatedApp.Status.AppState.State)
+	assert.Equal(t, int32(1), updatedApp.Status.SubmissionAttempts)
+	assert.Equal(t, "foo-driver", updatedApp.Status.DriverInfo.PodName)
+}
+
+func TestHandleSubmissionResult_OutdatedSubmission(t *testing.T) {
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "foo",
+			Namespace:  "default",
+			Generation: 2,
+		},
+		Status: v1beta2.SparkApplicationStatus{
+			AppState: v1beta2.ApplicationState{State: v1beta2.InvalidatingState},
+		},
+	}
+	ctrl, _ := newFakeController(app)
+	_, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Create(context.TODO(), app, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := &submissionJob{
+		appSubmission: appSubmission{
+			generation:    1,
+			state:         v1beta2.NewState,
+			app:           app.DeepCopy(),
+			driverPodName: "foo-driver",
+		},
+		key:       "default/foo",
+		submitted: true,
+		done:      true,
+	}
+	err = ctrl.handleSubmissionResult(app, job)
+	assert.Nil(t, err)
+
+	updatedApp, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, v1beta2.InvalidatingState, updatedApp.Status.AppState.State)
+	assert.Equal(t, 1, ctrl.queue.Len())
+}
+
+func TestCompleteSubmission_Timeout(t *testing.T) {
+	ctrl, _ := newFakeController(nil)
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+		},
+	}
+	err := &submissionTimeoutError{namespace: "default", name: "foo", timeout: time.Minute}
+
+	app = ctrl.completeSubmission(app, "foo-driver", "id", false, err)
+	assert.Equal(t, v1beta2.FailedSubmissionState, app.Status.AppState.State)
+	assert.Equal(t, v1beta2.TimeoutFailure, app.Status.FailureReason)
+	assert.Equal(t, int32(1), app.Status.SubmissionAttempts)
+}
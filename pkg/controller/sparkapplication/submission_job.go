@@ -0,0 +1,419 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+)
+
+const (
+	// submissionJobContainerName is the name of the container running spark-submit in a submission Job.
+	submissionJobContainerName = "spark-submit"
+	// submissionJobSparkSubmit is the path of spark-submit in the Spark images.
+	submissionJobSparkSubmit = "/opt/spark/bin/spark-submit"
+	// submissionJobNameLabel is the label the Job controller sets on the pods of a Job.
+	submissionJobNameLabel = "job-name"
+	// submissionJobGracePeriod is how long a submission Job is waited for after its active deadline, for
+	// the Job controller to fail it.
+	submissionJobGracePeriod = time.Minute
+	// submissionJobDeadlineExceeded is the reason of the failure of a Job that exceeded its active deadline.
+	submissionJobDeadlineExceeded = "DeadlineExceeded"
+	// submissionJobIDLength is how many characters of the submission ID the name of a submission Job includes.
+	submissionJobIDLength = 8
+)
+
+// trackedSubmissionJob is a submission running in a Job, whose result is taken once the Job finishes.
+type trackedSubmissionJob struct {
+	appSubmission
+	jobName   string
+	startTime time.Time
+	// observed tells if the Job was seen by the Job informer, so that its absence means it was deleted.
+	observed bool
+}
+
+// submissionJobTracker keeps the submissions running in Jobs by the key of their application. Instead of
+// a worker waiting for a Job, the application is synced when its Job changes, and the submission is
+// completed once the Job finishes.
+type submissionJobTracker struct {
+	mutex sync.Mutex
+	jobs  map[string]*trackedSubmissionJob
+}
+
+func newSubmissionJobTracker() *submissionJobTracker {
+	return &submissionJobTracker{jobs: make(map[string]*trackedSubmissionJob)}
+}
+
+func (t *submissionJobTracker) track(key string, job *trackedSubmissionJob) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.jobs[key] = job
+}
+
+func (t *submissionJobTracker) get(key string) *trackedSubmissionJob {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.jobs[key]
+}
+
+func (t *submissionJobTracker) forget(key string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.jobs, key)
+}
+
+// startSubmissionJob runs spark-submit in a Job in the namespace of the application, with the service account
+// of the driver and the image of the driver, and tracks the Job until it finishes. A Job of the application
+// created since its last submission attempt, e.g., before the operator restarted, is tracked instead of
+// creating a new one, and the submission ID of that Job is used.
+func (c *Controller) startSubmissionJob(
+	app *v1beta2.SparkApplication,
+	driverPodName string,
+	submissionID string,
+	args []string) error {
+	job, err := c.findSubmissionJob(app)
+	if err != nil {
+		return fmt.Errorf("failed to list the submission Jobs of SparkApplication %s/%s: %v", app.Namespace, app.Name, err)
+	}
+	if job != nil {
+		glog.Infof("tracking the existing submission Job %s/%s", app.Namespace, job.Name)
+		submissionID = job.Labels[config.SubmissionIDLabel]
+	} else {
+		var templates map[podTemplateRole][]byte
+		var templateRoles []podTemplateRole
+		if c.podTemplateDir != "" {
+			if templates, err = renderPodTemplates(app, c.kubeClient); err != nil {
+				return fmt.Errorf("failed to build the pod templates of SparkApplication %s/%s: %v", app.Namespace, app.Name, err)
+			}
+			var templateArgs []string
+			for _, role := range podTemplateRoles {
+				if _, ok := templates[role]; ok {
+					templateRoles = append(templateRoles, role)
+					templateArgs = append(templateArgs, role.args(podTemplateMountPath+"/"+role.fileName())...)
+				}
+			}
+			args = append(templateArgs, args...)
+		}
+		if job, err = buildSubmissionJob(app, submissionID, args, c.submissionTimeout); err != nil {
+			return fmt.Errorf("failed to build the submission Job of SparkApplication %s/%s: %v", app.Namespace, app.Name, err)
+		}
+		if len(templateRoles) > 0 {
+			mountPodTemplates(&job.Spec.Template.Spec, submissionJobContainerName, getSubmissionJobPodTemplatesName(job.Name), templateRoles)
+		}
+		if job, err = c.kubeClient.BatchV1().Jobs(app.Namespace).Create(context.TODO(), job, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create the submission Job of SparkApplication %s/%s: %v", app.Namespace, app.Name, err)
+		}
+		if len(templateRoles) > 0 {
+			if err = createSubmissionJobPodTemplates(c.kubeClient, job, templates); err != nil {
+				deleteSubmissionJob(c.kubeClient, app.Namespace, job.Name)
+				return fmt.Errorf("failed to create the pod templates of SparkApplication %s/%s: %v", app.Namespace, app.Name, err)
+			}
+		}
+	}
+
+	key := createMetaNamespaceKey(app.Namespace, app.Name)
+	c.submissionJobs.track(key, &trackedSubmissionJob{
+		appSubmission: newAppSubmission(app, driverPodName, submissionID),
+		jobName:       job.Name,
+		startTime:     time.Now(),
+	})
+	if c.submissionTimeout > 0 {
+		// Check on the Job in case the Job controller doesn't fail it at its active deadline.
+		c.queue.AddAfter(key, c.submissionTimeout+submissionJobGracePeriod)
+	}
+	return nil
+}
+
+// findSubmissionJob returns the submission Job of the application created since its last submission attempt,
+// if any. Jobs of earlier attempts, which are left behind if deleting them failed, are deleted.
+func (c *Controller) findSubmissionJob(app *v1beta2.SparkApplication) (*batchv1.Job, error) {
+	jobs, err := c.jobLister.Jobs(app.Namespace).List(labels.SelectorFromSet(labels.Set{config.SparkAppNameLabel: app.Name}))
+	if err != nil {
+		return nil, err
+	}
+	var current *batchv1.Job
+	for _, job := range jobs {
+		if !metav1.IsControlledBy(job, app) {
+			continue
+		}
+		if current == nil && job.Labels[config.SubmissionIDLabel] != "" &&
+			!job.CreationTimestamp.Before(&app.Status.LastSubmissionAttemptTime) {
+			current = job
+			continue
+		}
+		deleteSubmissionJob(c.kubeClient, app.Namespace, job.Name)
+	}
+	return current, nil
+}
+
+// syncSubmissionJob completes the submission of the application once its Job finished.
+func (c *Controller) syncSubmissionJob(app *v1beta2.SparkApplication, tracked *trackedSubmissionJob) error {
+	key := createMetaNamespaceKey(app.Namespace, app.Name)
+	if !tracked.isFor(app) {
+		glog.Warningf("dropping the outdated submission Job %s/%s of SparkApplication %s/%s", app.Namespace, tracked.jobName, app.Namespace, app.Name)
+		c.submissionJobs.forget(key)
+		deleteSubmissionJob(c.kubeClient, app.Namespace, tracked.jobName)
+		c.enqueue(app)
+		return nil
+	}
+	done, submitted, err := c.getSubmissionJobResult(tracked)
+	if !done {
+		glog.V(2).Infof("SparkApplication %s/%s is waiting for its submission Job %s", app.Namespace, app.Name, tracked.jobName)
+		return nil
+	}
+	c.recordSpan(tracked.app, sparkSubmitSpanName, tracked.startTime, err)
+	newApp := c.completeSubmission(tracked.app, tracked.driverPodName, tracked.submissionID, submitted, err)
+	if err := c.updateStatusAndExportMetrics(app, newApp); err != nil {
+		glog.Errorf("failed to update SparkApplication %s/%s: %v", app.Namespace, app.Name, err)
+		return err
+	}
+	// The Job is only deleted once its result is recorded, so that it is tracked again if the update failed.
+	c.submissionJobs.forget(key)
+	deleteSubmissionJob(c.kubeClient, app.Namespace, tracked.jobName)
+	return nil
+}
+
+// getSubmissionJobResult tells if the Job of the submission finished, and if so whether it submitted the
+// application. The logs of the Job are kept as the output of the submission.
+func (c *Controller) getSubmissionJobResult(tracked *trackedSubmissionJob) (bool, bool, error) {
+	app := tracked.app
+	job, err := c.jobLister.Jobs(app.Namespace).Get(tracked.jobName)
+	if errors.IsNotFound(err) {
+		if tracked.observed {
+			return true, false, fmt.Errorf("the submission Job %s/%s of SparkApplication %s/%s was deleted", app.Namespace, tracked.jobName, app.Namespace, app.Name)
+		}
+		// The Job informer hasn't seen the Job yet, and syncs the application once it does.
+		return c.hasSubmissionJobTimedOut(tracked)
+	}
+	if err != nil {
+		return false, false, err
+	}
+	tracked.observed = true
+
+	var failure *batchv1.JobCondition
+	finished := false
+	for i := range job.Status.Conditions {
+		condition := &job.Status.Conditions[i]
+		if condition.Status != apiv1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			finished = true
+		case batchv1.JobFailed:
+			finished = true
+			failure = condition
+		}
+	}
+	if !finished {
+		return c.hasSubmissionJobTimedOut(tracked)
+	}
+
+	// The logs of the Job interleave the standard output and error of spark-submit.
+	submission := newSubmission(job.Spec.Template.Spec.Containers[0].Args, app)
+	logs, err := getSubmissionJobLogs(c.kubeClient, app.Namespace, job.Name)
+	if err != nil {
+		glog.Errorf("failed to get the logs of the submission Job %s/%s: %v", app.Namespace, job.Name, err)
+	}
+	submission.stdout = logs
+	c.recordSubmissionOutput(app, submission)
+
+	if failure == nil {
+		return true, true, nil
+	}
+	if failure.Reason == submissionJobDeadlineExceeded {
+		return true, false, &submissionTimeoutError{namespace: app.Namespace, name: app.Name, timeout: c.submissionTimeout}
+	}
+	// The driver pod of the application already exists.
+	if strings.Contains(string(logs), podAlreadyExistsErrorCode) {
+		glog.Warningf("trying to resubmit an already submitted SparkApplication %s/%s", app.Namespace, app.Name)
+		return true, false, nil
+	}
+	if len(logs) > 0 {
+		return true, false, fmt.Errorf("failed to run spark-submit for SparkApplication %s/%s in Job %s: %s", app.Namespace, app.Name, job.Name, logs)
+	}
+	return true, false, fmt.Errorf("failed to run spark-submit for SparkApplication %s/%s in Job %s: %s", app.Namespace, app.Name, job.Name, failure.Message)
+}
+
+// hasSubmissionJobTimedOut tells if the submission Job ran past its active deadline and the grace period
+// the Job controller has to fail it.
+func (c *Controller) hasSubmissionJobTimedOut(tracked *trackedSubmissionJob) (bool, bool, error) {
+	if c.submissionTimeout <= 0 || time.Since(tracked.startTime) < c.submissionTimeout+submissionJobGracePeriod {
+		return false, false, nil
+	}
+	return true, false, &submissionTimeoutError{namespace: tracked.app.Namespace, name: tracked.app.Name, timeout: c.submissionTimeout}
+}
+
+// onSubmissionJobChanged syncs the application of a tracked submission Job when the Job changes.
+func (c *Controller) onSubmissionJobChanged(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	job, ok := obj.(*batchv1.Job)
+	if !ok {
+		return
+	}
+	key := createMetaNamespaceKey(job.Namespace, job.Labels[config.SparkAppNameLabel])
+	if tracked := c.submissionJobs.get(key); tracked != nil && tracked.jobName == job.Name {
+		c.queue.AddRateLimited(key)
+	}
+}
+
+// buildSubmissionJob builds the Job running spark-submit with the given arguments for the submission with the
+// given ID.
+func buildSubmissionJob(app *v1beta2.SparkApplication, submissionID string, args []string, timeout time.Duration) (*batchv1.Job, error) {
+	image := app.Spec.Image
+	if app.Spec.Driver.Image != nil {
+		image = app.Spec.Driver.Image
+	}
+	if image == nil || *image == "" {
+		return nil, fmt.Errorf("no container image is set for the driver")
+	}
+
+	podLabels := map[string]string{config.SparkAppNameLabel: app.Name}
+	container := apiv1.Container{
+		Name:    submissionJobContainerName,
+		Image:   *image,
+		Command: []string{submissionJobSparkSubmit},
+		Args:    args,
+	}
+	if app.Spec.ImagePullPolicy != nil {
+		container.ImagePullPolicy = apiv1.PullPolicy(*app.Spec.ImagePullPolicy)
+	}
+	podSpec := apiv1.PodSpec{
+		Containers:    []apiv1.Container{container},
+		RestartPolicy: apiv1.RestartPolicyNever,
+	}
+	if app.Spec.Driver.ServiceAccount != nil {
+		podSpec.ServiceAccountName = *app.Spec.Driver.ServiceAccount
+	}
+	for _, secret := range app.Spec.ImagePullSecrets {
+		podSpec.ImagePullSecrets = append(podSpec.ImagePullSecrets, apiv1.LocalObjectReference{Name: secret})
+	}
+
+	backoffLimit := int32(0)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      getSubmissionJobName(app, submissionID),
+			Namespace: app.Namespace,
+			Labels: map[string]string{
+				config.SparkAppNameLabel:            app.Name,
+				config.LaunchedBySparkOperatorLabel: "true",
+				config.SubmissionIDLabel:            submissionID,
+			},
+			OwnerReferences: []metav1.OwnerReference{*getOwnerReference(app)},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: apiv1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: podLabels},
+				Spec:       podSpec,
+			},
+		},
+	}
+	if timeout > 0 {
+		deadline := int64(timeout.Seconds())
+		job.Spec.ActiveDeadlineSeconds = &deadline
+	}
+	return job, nil
+}
+
+// getSubmissionJobName returns the name of the submission Job of the submission with the given ID, which is
+// at most 63 characters long to fit in the job-name label of its pods.
+func getSubmissionJobName(app *v1beta2.SparkApplication, submissionID string) string {
+	if len(submissionID) > submissionJobIDLength {
+		submissionID = submissionID[:submissionJobIDLength]
+	}
+	suffix := "-submit-" + submissionID
+	name := app.Name
+	if len(name)+len(suffix) > maxKubernetesServiceNameLen {
+		name = strings.TrimRight(name[:maxKubernetesServiceNameLen-len(suffix)], "-.")
+	}
+	return name + suffix
+}
+
+// getSubmissionJobPodTemplatesName returns the name of the ConfigMap holding the pod templates mounted into
+// the submission Job with the given name.
+func getSubmissionJobPodTemplatesName(jobName string) string {
+	return jobName + "-pod-templates"
+}
+
+// createSubmissionJobPodTemplates creates the ConfigMap holding the pod templates mounted into the given
+// submission Job. The ConfigMap is owned by the Job, so it is deleted along with it.
+func createSubmissionJobPodTemplates(kubeClient clientset.Interface, job *batchv1.Job, templates map[podTemplateRole][]byte) error {
+	data := make(map[string]string)
+	for role, template := range templates {
+		data[role.fileName()] = string(template)
+	}
+	configMap := &apiv1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      getSubmissionJobPodTemplatesName(job.Name),
+			Namespace: job.Namespace,
+			Labels:    map[string]string{config.SparkAppNameLabel: job.Labels[config.SparkAppNameLabel]},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: batchv1.SchemeGroupVersion.String(),
+				Kind:       "Job",
+				Name:       job.Name,
+				UID:        job.UID,
+			}},
+		},
+		Data: data,
+	}
+	_, err := kubeClient.CoreV1().ConfigMaps(job.Namespace).Create(context.TODO(), configMap, metav1.CreateOptions{})
+	return err
+}
+
+func getSubmissionJobLogs(kubeClient clientset.Interface, namespace string, jobName string) ([]byte, error) {
+	pods, err := kubeClient.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", submissionJobNameLabel, jobName),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(pods.Items) == 0 {
+		return nil, nil
+	}
+	// The Job runs a single pod as it is never retried.
+	return kubeClient.CoreV1().Pods(namespace).GetLogs(pods.Items[0].Name, &apiv1.PodLogOptions{
+		Container: submissionJobContainerName,
+	}).Do(context.TODO()).Raw()
+}
+
+func deleteSubmissionJob(kubeClient clientset.Interface, namespace string, name string) {
+	propagation := metav1.DeletePropagationBackground
+	err := kubeClient.BatchV1().Jobs(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	})
+	if err != nil && !errors.IsNotFound(err) {
+		glog.Errorf("failed to delete the submission Job %s/%s: %v", namespace, name, err)
+	}
+}
@@ -0,0 +1,331 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeclientfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+)
+
+// startTestSubmissionJob submits the application with the Job backend and the given submission timeout, and
+// returns the controller and the created submission Job.
+func startTestSubmissionJob(t *testing.T, app *v1beta2.SparkApplication, timeout time.Duration) (*Controller, *batchv1.Job) {
+	setSubmissionEnv()
+	backend := v1beta2.JobBackend
+	app.Spec.SubmissionBackend = &backend
+	ctrl, _ := newFakeController(app)
+	ctrl.submissionTimeout = timeout
+	ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Create(context.TODO(), app, metav1.CreateOptions{})
+
+	assert.Nil(t, ctrl.submitSparkApplication(app.DeepCopy()))
+	jobs, err := ctrl.kubeClient.BatchV1().Jobs(app.Namespace).List(context.TODO(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, jobs.Items, 1)
+	return ctrl, &jobs.Items[0]
+}
+
+// finishSubmissionJob makes the Job informer observe the Job with the given condition, along with the pod
+// the Job controller would run for it.
+func finishSubmissionJob(ctrl *Controller, job *batchv1.Job, conditionType batchv1.JobConditionType, reason string) {
+	job.Status.Conditions = []batchv1.JobCondition{
+		{Type: conditionType, Status: apiv1.ConditionTrue, Reason: reason, Message: "Job has reached the specified backoff limit"},
+	}
+	ctrl.jobInformer.GetIndexer().Add(job)
+	ctrl.kubeClient.(*kubeclientfake.Clientset).Tracker().Add(&apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      job.Name + "-abcde",
+			Namespace: job.Namespace,
+			Labels:    map[string]string{submissionJobNameLabel: job.Name},
+		},
+	})
+}
+
+func getTestApp(t *testing.T, ctrl *Controller, app *v1beta2.SparkApplication) *v1beta2.SparkApplication {
+	updated, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	return updated
+}
+
+func TestSubmissionJob(t *testing.T) {
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "spark-pi", Namespace: "default", UID: "app-uid"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type:             v1beta2.ScalaApplicationType,
+			Mode:             v1beta2.ClusterMode,
+			Image:            stringptr("gcr.io/spark-operator/spark:v3.1.1"),
+			ImagePullPolicy:  stringptr("Always"),
+			ImagePullSecrets: []string{"registry-secret"},
+			MainClass:        stringptr("org.apache.spark.examples.SparkPi"),
+			Driver: v1beta2.DriverSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{ServiceAccount: stringptr("spark")},
+			},
+		},
+		Status: v1beta2.SparkApplicationStatus{
+			AppState:           v1beta2.ApplicationState{State: v1beta2.FailedSubmissionState},
+			SubmissionAttempts: 1,
+		},
+	}
+	// The submission only creates the Job and leaves the status of the application unchanged.
+	ctrl, job := startTestSubmissionJob(t, app, 2*time.Minute)
+	tracked := ctrl.submissionJobs.get("default/spark-pi")
+	assert.NotNil(t, tracked)
+	assert.Equal(t, "spark-pi-submit-"+tracked.submissionID[:submissionJobIDLength], job.Name)
+	assert.Equal(t, tracked.jobName, job.Name)
+	assert.Equal(t, app.Name, job.Labels[config.SparkAppNameLabel])
+	assert.Equal(t, tracked.submissionID, job.Labels[config.SubmissionIDLabel])
+	assert.True(t, metav1.IsControlledBy(job, app))
+	assert.Equal(t, int32(0), *job.Spec.BackoffLimit)
+	assert.Equal(t, int64(120), *job.Spec.ActiveDeadlineSeconds)
+	podSpec := job.Spec.Template.Spec
+	assert.Equal(t, apiv1.RestartPolicyNever, podSpec.RestartPolicy)
+	assert.Equal(t, "spark", podSpec.ServiceAccountName)
+	assert.Equal(t, []apiv1.LocalObjectReference{{Name: "registry-secret"}}, podSpec.ImagePullSecrets)
+	container := podSpec.Containers[0]
+	assert.Equal(t, *app.Spec.Image, container.Image)
+	assert.Equal(t, apiv1.PullAlways, container.ImagePullPolicy)
+	assert.Equal(t, []string{submissionJobSparkSubmit}, container.Command)
+	assert.Contains(t, container.Args, "org.apache.spark.examples.SparkPi")
+
+	// The application waits while the Job runs.
+	ctrl.jobInformer.GetIndexer().Add(job)
+	assert.NoError(t, ctrl.syncSparkApplication("default/spark-pi"))
+	assert.Equal(t, v1beta2.FailedSubmissionState, getTestApp(t, ctrl, app).Status.AppState.State)
+	assert.NotNil(t, ctrl.submissionJobs.get("default/spark-pi"))
+
+	// Changes of the Job sync the application.
+	finishSubmissionJob(ctrl, job, batchv1.JobComplete, "")
+	ctrl.onSubmissionJobChanged(job)
+	assert.Equal(t, 1, ctrl.queue.Len())
+
+	assert.NoError(t, ctrl.syncSparkApplication("default/spark-pi"))
+	updated := getTestApp(t, ctrl, app)
+	assert.Equal(t, v1beta2.SubmittedState, updated.Status.AppState.State)
+	assert.Equal(t, tracked.submissionID, updated.Status.SubmissionID)
+	assert.Equal(t, int32(2), updated.Status.SubmissionAttempts)
+	assert.NotEmpty(t, updated.Status.SubmissionOutputConfigMap)
+	assert.Nil(t, ctrl.submissionJobs.get("default/spark-pi"))
+
+	// The Job is deleted once its result is recorded.
+	_, err := ctrl.kubeClient.BatchV1().Jobs(app.Namespace).Get(context.TODO(), job.Name, metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+}
+
+func TestSubmissionJobFailure(t *testing.T) {
+	type testcase struct {
+		name           string
+		reason         string
+		deleted        bool
+		expectedReason v1beta2.FailureReason
+		expectedError  string
+	}
+	testcases := []testcase{
+		{
+			name:           "failed",
+			reason:         "BackoffLimitExceeded",
+			expectedReason: v1beta2.SubmissionFailure,
+			expectedError:  ": fake logs",
+		},
+		{
+			name:           "deadline exceeded",
+			reason:         submissionJobDeadlineExceeded,
+			expectedReason: v1beta2.TimeoutFailure,
+			expectedError:  "did not complete within",
+		},
+		{
+			name:           "deleted",
+			deleted:        true,
+			expectedReason: v1beta2.SubmissionFailure,
+			expectedError:  "was deleted",
+		},
+	}
+	for _, test := range testcases {
+		app := &v1beta2.SparkApplication{
+			ObjectMeta: metav1.ObjectMeta{Name: "spark-pi", Namespace: "default", UID: "app-uid"},
+			Spec: v1beta2.SparkApplicationSpec{
+				Type:  v1beta2.ScalaApplicationType,
+				Mode:  v1beta2.ClusterMode,
+				Image: stringptr("gcr.io/spark-operator/spark:v3.1.1"),
+			},
+		}
+		ctrl, job := startTestSubmissionJob(t, app, time.Minute)
+		if test.deleted {
+			ctrl.jobInformer.GetIndexer().Add(job)
+			assert.NoError(t, ctrl.syncSparkApplication("default/spark-pi"))
+			ctrl.jobInformer.GetIndexer().Delete(job)
+		} else {
+			finishSubmissionJob(ctrl, job, batchv1.JobFailed, test.reason)
+		}
+
+		assert.NoError(t, ctrl.syncSparkApplication("default/spark-pi"), test.name)
+		updated := getTestApp(t, ctrl, app)
+		assert.Equal(t, v1beta2.FailedSubmissionState, updated.Status.AppState.State, test.name)
+		assert.Equal(t, test.expectedReason, updated.Status.FailureReason, test.name)
+		assert.Contains(t, updated.Status.AppState.ErrorMessage, test.expectedError, test.name)
+		assert.Nil(t, ctrl.submissionJobs.get("default/spark-pi"), test.name)
+	}
+}
+
+func TestSubmissionJobExisting(t *testing.T) {
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "spark-pi", Namespace: "default", UID: "app-uid"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type:  v1beta2.ScalaApplicationType,
+			Mode:  v1beta2.ClusterMode,
+			Image: stringptr("gcr.io/spark-operator/spark:v3.1.1"),
+		},
+		Status: v1beta2.SparkApplicationStatus{
+			AppState:                  v1beta2.ApplicationState{State: v1beta2.FailedSubmissionState},
+			SubmissionAttempts:        1,
+			LastSubmissionAttemptTime: metav1.NewTime(time.Now().Add(-time.Hour)),
+		},
+	}
+	setSubmissionEnv()
+	backend := v1beta2.JobBackend
+	app.Spec.SubmissionBackend = &backend
+	ctrl, _ := newFakeController(app)
+
+	// The Job of the previous attempt is deleted, and the Job started since then, e.g., before the operator
+	// restarted, is tracked instead of creating a new one.
+	previous, err := buildSubmissionJob(app, "11111111-previous", nil, 0)
+	assert.NoError(t, err)
+	previous.CreationTimestamp = metav1.NewTime(time.Now().Add(-2 * time.Hour))
+	current, err := buildSubmissionJob(app, "22222222-current", nil, 0)
+	assert.NoError(t, err)
+	current.CreationTimestamp = metav1.Now()
+	for _, job := range []*batchv1.Job{previous, current} {
+		ctrl.kubeClient.BatchV1().Jobs(app.Namespace).Create(context.TODO(), job, metav1.CreateOptions{})
+		ctrl.jobInformer.GetIndexer().Add(job)
+	}
+
+	assert.Nil(t, ctrl.submitSparkApplication(app.DeepCopy()))
+	tracked := ctrl.submissionJobs.get("default/spark-pi")
+	assert.Equal(t, current.Name, tracked.jobName)
+	assert.Equal(t, "22222222-current", tracked.submissionID)
+	jobs, err := ctrl.kubeClient.BatchV1().Jobs(app.Namespace).List(context.TODO(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, jobs.Items, 1)
+	assert.Equal(t, current.Name, jobs.Items[0].Name)
+}
+
+func TestSubmissionJobOutdated(t *testing.T) {
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "spark-pi", Namespace: "default", UID: "app-uid", Generation: 1},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type:  v1beta2.ScalaApplicationType,
+			Mode:  v1beta2.ClusterMode,
+			Image: stringptr("gcr.io/spark-operator/spark:v3.1.1"),
+		},
+	}
+	ctrl, job := startTestSubmissionJob(t, app, 0)
+
+	// The spec of the application changed while the Job was running.
+	updated := app.DeepCopy()
+	updated.Generation = 2
+	assert.NoError(t, ctrl.syncSubmissionJob(updated, ctrl.submissionJobs.get("default/spark-pi")))
+	assert.Nil(t, ctrl.submissionJobs.get("default/spark-pi"))
+	_, err := ctrl.kubeClient.BatchV1().Jobs(app.Namespace).Get(context.TODO(), job.Name, metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+}
+
+func TestSubmissionJobPodTemplates(t *testing.T) {
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "spark-pi", Namespace: "default", UID: "app-uid"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Type:      v1beta2.ScalaApplicationType,
+			Mode:      v1beta2.ClusterMode,
+			Image:     stringptr("gcr.io/spark-operator/spark:v3.1.1"),
+			SparkConf: map[string]string{config.SparkExecutorPodTemplateFileKey: "/opt/templates/executor.yaml"},
+			Driver: v1beta2.DriverSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{NodeSelector: map[string]string{"disktype": "ssd"}},
+			},
+		},
+	}
+	setSubmissionEnv()
+	backend := v1beta2.JobBackend
+	app.Spec.SubmissionBackend = &backend
+	ctrl, _ := newFakeController(app)
+	ctrl.podTemplateDir = os.TempDir()
+	ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Create(context.TODO(), app, metav1.CreateOptions{})
+
+	assert.Nil(t, ctrl.submitSparkApplication(app.DeepCopy()))
+	jobs, err := ctrl.kubeClient.BatchV1().Jobs(app.Namespace).List(context.TODO(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, jobs.Items, 1)
+	job := jobs.Items[0]
+
+	// Only the driver pod template is rendered since the application sets its own executor pod template, and
+	// it is mounted into the Job from a ConfigMap owned by the Job.
+	configMap, err := ctrl.kubeClient.CoreV1().ConfigMaps(app.Namespace).Get(context.TODO(), job.Name+"-pod-templates", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, job.Name, configMap.OwnerReferences[0].Name)
+	assert.Equal(t, "Job", configMap.OwnerReferences[0].Kind)
+	assert.Len(t, configMap.Data, 1)
+	assert.Contains(t, configMap.Data[driverPodTemplateRole.fileName()], "disktype: ssd")
+
+	podSpec := job.Spec.Template.Spec
+	assert.Equal(t, configMap.Name, podSpec.Volumes[0].ConfigMap.Name)
+	assert.Equal(t, []apiv1.VolumeMount{{Name: podTemplateVolumeName, MountPath: podTemplateMountPath, ReadOnly: true}},
+		podSpec.Containers[0].VolumeMounts)
+	args := strings.Join(podSpec.Containers[0].Args, " ")
+	assert.Contains(t, args, config.SparkDriverPodTemplateFileKey+"="+podTemplateMountPath+"/"+driverPodTemplateRole.fileName())
+	assert.NotContains(t, args, podTemplateMountPath+"/"+executorPodTemplateRole.fileName())
+}
+
+func TestBuildSubmissionJob(t *testing.T) {
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "spark-pi", Namespace: "default"},
+		Spec: v1beta2.SparkApplicationSpec{
+			Image: stringptr("gcr.io/spark-operator/spark:v3.1.1"),
+			Driver: v1beta2.DriverSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{Image: stringptr("gcr.io/spark-operator/spark-driver:v3.1.1")},
+			},
+		},
+	}
+	job, err := buildSubmissionJob(app, "0123456789", nil, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, *app.Spec.Driver.Image, job.Spec.Template.Spec.Containers[0].Image)
+	assert.Nil(t, job.Spec.ActiveDeadlineSeconds)
+	assert.Equal(t, "true", job.Labels[config.LaunchedBySparkOperatorLabel])
+	assert.Equal(t, map[string]string{config.SparkAppNameLabel: "spark-pi"}, job.Spec.Template.Labels)
+
+	app.Spec.Image = nil
+	app.Spec.Driver.Image = nil
+	_, err = buildSubmissionJob(app, "0123456789", nil, 0)
+	assert.Error(t, err)
+}
+
+func TestGetSubmissionJobName(t *testing.T) {
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: strings.Repeat("a", 46) + "-" + strings.Repeat("b", 20)},
+	}
+	name := getSubmissionJobName(app, "0123456789abcdef")
+	assert.Equal(t, strings.Repeat("a", 46)+"-submit-01234567", name)
+	assert.True(t, len(name) <= maxKubernetesServiceNameLen)
+}
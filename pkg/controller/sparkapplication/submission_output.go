@@ -0,0 +1,119 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"context"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+)
+
+const (
+	// submissionOutputMaxBytes is how much of the standard output and of the standard error of spark-submit
+	// is kept. The beginning of longer output is dropped, as the end of it usually tells why a submission failed.
+	submissionOutputMaxBytes = 64 * 1024
+	// submissionOutputMaxAttempts is the number of latest submission attempts whose output is kept, which
+	// keeps the ConfigMap well below the size limit of 1MiB.
+	submissionOutputMaxAttempts = 5
+)
+
+// recordSubmissionOutput saves the output of spark-submit for the current submission attempt of the
+// application, and references the ConfigMap holding it in the status of the application.
+func (c *Controller) recordSubmissionOutput(app *v1beta2.SparkApplication, submission *submission) {
+	attempt := app.Status.SubmissionAttempts + 1
+	name, err := saveSubmissionOutput(c.kubeClient, app, attempt, submission.stdout, submission.stderr)
+	if err != nil {
+		glog.Errorf("failed to save the output of spark-submit for SparkApplication %s/%s: %v", app.Namespace, app.Name, err)
+		return
+	}
+	app.Status.SubmissionOutputConfigMap = name
+}
+
+// saveSubmissionOutput stores the output of the given submission attempt in the submission output ConfigMap
+// of the application, which is owned by the application. The output of the first attempt of a run replaces
+// that of any previous run, and only the output of the latest submissionOutputMaxAttempts attempts is kept.
+func saveSubmissionOutput(
+	kubeClient clientset.Interface,
+	app *v1beta2.SparkApplication,
+	attempt int32,
+	stdout []byte,
+	stderr []byte) (string, error) {
+	name := config.GetSubmissionOutputConfigMapName(app)
+	configMaps := kubeClient.CoreV1().ConfigMaps(app.Namespace)
+	configMap, err := configMaps.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return "", err
+	}
+
+	exists := err == nil
+	if !exists {
+		configMap = &apiv1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       app.Namespace,
+				Labels:          map[string]string{config.SparkAppNameLabel: app.Name},
+				OwnerReferences: []metav1.OwnerReference{*getOwnerReference(app)},
+			},
+		}
+	}
+	if attempt == 1 || configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+	// Drop the output of attempts that are too old.
+	for oldAttempt := attempt - submissionOutputMaxAttempts; oldAttempt > 0; oldAttempt-- {
+		stdoutKey := fmt.Sprintf(config.SubmissionOutputStdoutKeyFormat, oldAttempt)
+		if _, ok := configMap.Data[stdoutKey]; !ok {
+			break
+		}
+		delete(configMap.Data, stdoutKey)
+		delete(configMap.Data, fmt.Sprintf(config.SubmissionOutputStderrKeyFormat, oldAttempt))
+	}
+	configMap.Data[fmt.Sprintf(config.SubmissionOutputStdoutKeyFormat, attempt)] = truncateSubmissionOutput(stdout)
+	configMap.Data[fmt.Sprintf(config.SubmissionOutputStderrKeyFormat, attempt)] = truncateSubmissionOutput(stderr)
+
+	if exists {
+		_, err = configMaps.Update(context.TODO(), configMap, metav1.UpdateOptions{})
+	} else {
+		_, err = configMaps.Create(context.TODO(), configMap, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// truncateSubmissionOutput keeps the last submissionOutputMaxBytes bytes of the given output.
+func truncateSubmissionOutput(output []byte) string {
+	if len(output) <= submissionOutputMaxBytes {
+		return string(output)
+	}
+	dropped := len(output) - submissionOutputMaxBytes
+	// Don't split a multi-byte character.
+	for dropped < len(output) && !utf8.RuneStart(output[dropped]) {
+		dropped++
+	}
+	return fmt.Sprintf("[%d bytes truncated]\n%s", dropped, output[dropped:])
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeclientfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+)
+
+func TestSaveSubmissionOutput(t *testing.T) {
+	kubeClient := kubeclientfake.NewSimpleClientset()
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", UID: "uid"},
+	}
+
+	for attempt := int32(1); attempt <= 7; attempt++ {
+		name, err := saveSubmissionOutput(kubeClient, app, attempt, []byte("out"), []byte(fmt.Sprintf("err %d", attempt)))
+		assert.NoError(t, err)
+		assert.Equal(t, "foo-submission-output", name)
+	}
+
+	configMap, err := kubeClient.CoreV1().ConfigMaps("default").Get(context.TODO(), "foo-submission-output", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "uid", string(configMap.OwnerReferences[0].UID))
+	// Only the latest attempts are kept.
+	assert.Len(t, configMap.Data, 2*submissionOutputMaxAttempts)
+	assert.NotContains(t, configMap.Data, "attempt-2.stdout")
+	assert.Equal(t, "out", configMap.Data["attempt-3.stdout"])
+	assert.Equal(t, "err 7", configMap.Data["attempt-7.stderr"])
+
+	// The first attempt of a rerun replaces the output of the previous run.
+	_, err = saveSubmissionOutput(kubeClient, app, 1, nil, []byte("rerun"))
+	assert.NoError(t, err)
+	configMap, err = kubeClient.CoreV1().ConfigMaps("default").Get(context.TODO(), "foo-submission-output", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"attempt-1.stdout": "", "attempt-1.stderr": "rerun"}, configMap.Data)
+}
+
+func TestTruncateSubmissionOutput(t *testing.T) {
+	assert.Equal(t, "short", truncateSubmissionOutput([]byte("short")))
+
+	// The first byte kept would be the second byte of the "é".
+	output := "aaaé" + strings.Repeat("a", submissionOutputMaxBytes-4) + "end"
+	truncated := truncateSubmissionOutput([]byte(output))
+	assert.True(t, strings.HasPrefix(truncated, "[5 bytes truncated]\n"))
+	assert.True(t, strings.HasSuffix(truncated, "aend"))
+	assert.Equal(t, submissionOutputMaxBytes-1, len(strings.TrimPrefix(truncated, "[5 bytes truncated]\n")))
+}
+
+func TestHelperProcessWarning(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	fmt.Fprintln(os.Stderr, "WARN deprecated configuration")
+	os.Exit(0)
+}
+
+func TestSyncSparkApplication_SubmissionOutput(t *testing.T) {
+	os.Setenv(sparkHomeEnvVar, "/spark")
+	os.Setenv(kubernetesServiceHostEnvVar, "localhost")
+	os.Setenv(kubernetesServicePortEnvVar, "443")
+
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+		},
+		Spec: v1beta2.SparkApplicationSpec{
+			RestartPolicy: v1beta2.RestartPolicy{
+				Type: v1beta2.Never,
+			},
+		},
+	}
+	ctrl, _ := newFakeController(app)
+	_, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Create(context.TODO(), app, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		cs := []string{"-test.run=TestHelperProcessWarning", "--", command}
+		cs = append(cs, args...)
+		cmd := exec.Command(os.Args[0], cs...)
+		cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
+		return cmd
+	}
+
+	err = ctrl.syncSparkApplication("default/foo")
+	assert.Nil(t, err)
+	updatedApp, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, v1beta2.SubmittedState, updatedApp.Status.AppState.State)
+	assert.Equal(t, "foo-submission-output", updatedApp.Status.SubmissionOutputConfigMap)
+
+	configMap, err := ctrl.kubeClient.CoreV1().ConfigMaps(app.Namespace).Get(context.TODO(), "foo-submission-output", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "WARN deprecated configuration\n", configMap.Data["attempt-1.stderr"])
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/tracing"
+)
+
+// Names of the spans recorded for the phases of the lifecycle of an application. All of them are
+// children of the span covering the whole application.
+const (
+	applicationSpanName     = "SparkApplication"
+	validationSpanName      = "validation"
+	batchSchedulingSpanName = "batch-scheduling"
+	sparkSubmitSpanName     = "spark-submit"
+	driverPendingSpanName   = "driver-pending"
+	driverRunningSpanName   = "driver-running"
+	cleanupSpanName         = "cleanup"
+)
+
+func getTraceID(app *v1beta2.SparkApplication) string {
+	return app.Annotations[config.TraceIDAnnotation]
+}
+
+// ensureTraceID assigns a new trace ID to the application if tracing is enabled and the application
+// doesn't have one yet, and returns the updated application.
+func (c *Controller) ensureTraceID(app *v1beta2.SparkApplication) (*v1beta2.SparkApplication, error) {
+	if c.tracer == nil || getTraceID(app) != "" {
+		return app, nil
+	}
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, config.TraceIDAnnotation, tracing.NewTraceID())
+	updatedApp, err := c.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Patch(
+		context.TODO(), app.Name, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set the trace ID of SparkApplication %s/%s: %v", app.Namespace, app.Name, err)
+	}
+	return updatedApp, nil
+}
+
+// addTraceContext propagates the trace of the application to the driver and executor pods through
+// the W3C TRACEPARENT environment variable.
+func (c *Controller) addTraceContext(app *v1beta2.SparkApplication) {
+	traceID := getTraceID(app)
+	if c.tracer == nil || traceID == "" {
+		return
+	}
+	if app.Spec.SparkConf == nil {
+		app.Spec.SparkConf = make(map[string]string)
+	}
+	traceParent := tracing.TraceParent(traceID, tracing.RootSpanID(traceID))
+	app.Spec.SparkConf[config.SparkDriverEnvVarConfigKeyPrefix+tracing.TraceParentEnvVar] = traceParent
+	app.Spec.SparkConf[config.SparkExecutorEnvVarConfigKeyPrefix+tracing.TraceParentEnvVar] = traceParent
+}
+
+// recordSpan records a span for a phase of the application that started at the given time and has
+// just ended.
+func (c *Controller) recordSpan(app *v1beta2.SparkApplication, name string, start time.Time, err error) {
+	c.exportSpan(app, name, start, time.Now(), err)
+}
+
+func (c *Controller) exportSpan(app *v1beta2.SparkApplication, name string, start time.Time, end time.Time, err error) {
+	traceID := getTraceID(app)
+	if c.tracer == nil || traceID == "" {
+		return
+	}
+	c.tracer.Export(&tracing.Span{
+		TraceID:      traceID,
+		ParentSpanID: tracing.RootSpanID(traceID),
+		Name:         name,
+		Start:        start,
+		End:          end,
+		Attributes:   getSpanAttributes(app),
+		Err:          err,
+	})
+}
+
+// traceStateTransition records the spans of the phases of the application that ended with its
+// transition from the state of oldApp to the state of newApp.
+func (c *Controller) traceStateTransition(oldApp, newApp *v1beta2.SparkApplication) {
+	traceID := getTraceID(newApp)
+	oldState, newState := oldApp.Status.AppState.State, newApp.Status.AppState.State
+	if c.tracer == nil || traceID == "" || oldState == newState {
+		return
+	}
+
+	now := time.Now()
+	switch oldState {
+	case v1beta2.SubmittedState:
+		var err error
+		if newState != v1beta2.RunningState {
+			err = getSpanError(newApp)
+		}
+		c.exportSpan(newApp, driverPendingSpanName, oldApp.Status.LastSubmissionAttemptTime.Time, now, err)
+	case v1beta2.RunningState:
+		start := oldApp.Status.LastSubmissionAttemptTime.Time
+		if driverPod, err := c.getDriverPod(newApp); err == nil && driverPod != nil {
+			if startTime := getDriverStartTime(driverPod); startTime != nil && !startTime.IsZero() {
+				start = startTime.Time
+			}
+		}
+		c.exportSpan(newApp, driverRunningSpanName, start, now, getSpanError(newApp))
+	}
+
+	if hasApplicationSpanEnded(newApp) {
+		c.exportApplicationSpan(newApp, now, getSpanError(newApp))
+	}
+}
+
+// traceDeletion ends the span covering the whole application if the application is deleted before it
+// completed or failed, so that the spans of its phases are not left without their parent.
+func (c *Controller) traceDeletion(app *v1beta2.SparkApplication) {
+	if c.tracer == nil || getTraceID(app) == "" || hasApplicationSpanEnded(app) {
+		return
+	}
+	c.exportApplicationSpan(app, time.Now(), fmt.Errorf("application deleted in state %s", app.Status.AppState.State))
+}
+
+func (c *Controller) exportApplicationSpan(app *v1beta2.SparkApplication, end time.Time, err error) {
+	traceID := getTraceID(app)
+	c.tracer.Export(&tracing.Span{
+		TraceID:    traceID,
+		SpanID:     tracing.RootSpanID(traceID),
+		Name:       applicationSpanName,
+		Start:      app.CreationTimestamp.Time,
+		End:        end,
+		Attributes: getSpanAttributes(app),
+		Err:        err,
+	})
+}
+
+// hasApplicationSpanEnded tells if the span covering the whole application has already been exported
+// because the application completed or failed.
+func hasApplicationSpanEnded(app *v1beta2.SparkApplication) bool {
+	state := app.Status.AppState.State
+	return state == v1beta2.CompletedState || state == v1beta2.FailedState
+}
+
+func getSpanAttributes(app *v1beta2.SparkApplication) map[string]string {
+	attributes := map[string]string{
+		"sparkapplication.namespace":          app.Namespace,
+		"sparkapplication.name":               app.Name,
+		"sparkapplication.state":              string(app.Status.AppState.State),
+		"sparkapplication.submission_attempt": strconv.Itoa(int(app.Status.SubmissionAttempts)),
+	}
+	if app.Status.SubmissionID != "" {
+		attributes["sparkapplication.submission_id"] = app.Status.SubmissionID
+	}
+	if app.Status.FailureReason != "" {
+		attributes["sparkapplication.failure_reason"] = string(app.Status.FailureReason)
+	}
+	return attributes
+}
+
+func getSpanError(app *v1beta2.SparkApplication) error {
+	switch app.Status.AppState.State {
+	case v1beta2.FailingState, v1beta2.FailedState, v1beta2.FailedSubmissionState:
+		if app.Status.AppState.ErrorMessage != "" {
+			return fmt.Errorf("%s", app.Status.AppState.ErrorMessage)
+		}
+		return fmt.Errorf("application %s", app.Status.AppState.State)
+	}
+	return nil
+}
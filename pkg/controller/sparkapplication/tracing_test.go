@@ -0,0 +1,177 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkapplication
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/tracing"
+)
+
+// recordingExporter keeps the exported spans after the Tracer is stopped.
+type recordingExporter struct {
+	*tracetest.InMemoryExporter
+}
+
+func (recordingExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+// spansByName returns the spans exported to the given exporter by their names.
+func spansByName(exporter recordingExporter) map[string]tracetest.SpanStub {
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	return spans
+}
+
+func TestTraceApplicationLifecycle(t *testing.T) {
+	os.Setenv(sparkHomeEnvVar, "/spark")
+	os.Setenv(kubernetesServiceHostEnvVar, "localhost")
+	os.Setenv(kubernetesServicePortEnvVar, "443")
+
+	exporter := recordingExporter{tracetest.NewInMemoryExporter()}
+
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "test",
+		},
+		Spec: v1beta2.SparkApplicationSpec{
+			RestartPolicy: v1beta2.RestartPolicy{
+				Type: v1beta2.Never,
+			},
+		},
+	}
+	ctrl, _ := newFakeController(app)
+	ctrl.tracer = tracing.NewWithExporter(exporter, "spark-operator")
+	_, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Create(context.TODO(), app, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		cs := []string{"-test.run=TestHelperProcessSuccess", "--", command}
+		cs = append(cs, args...)
+		cmd := exec.Command(os.Args[0], cs...)
+		cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
+		return cmd
+	}
+
+	assert.Nil(t, ctrl.syncSparkApplication(fmt.Sprintf("%s/%s", app.Namespace, app.Name)))
+	submittedApp, err := ctrl.crdClient.SparkoperatorV1beta2().SparkApplications(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, v1beta2.SubmittedState, submittedApp.Status.AppState.State)
+	traceID := getTraceID(submittedApp)
+	assert.Equal(t, 32, len(traceID))
+
+	runningApp := submittedApp.DeepCopy()
+	runningApp.Status.AppState.State = v1beta2.RunningState
+	ctrl.traceStateTransition(submittedApp, runningApp)
+	failedApp := runningApp.DeepCopy()
+	failedApp.Status.AppState.State = v1beta2.FailedState
+	failedApp.Status.AppState.ErrorMessage = "driver failed"
+	ctrl.traceStateTransition(runningApp, failedApp)
+	ctrl.tracer.Stop()
+
+	spans := spansByName(exporter)
+	for _, name := range []string{validationSpanName, sparkSubmitSpanName, driverPendingSpanName, driverRunningSpanName} {
+		span, ok := spans[name]
+		assert.True(t, ok, name)
+		assert.Equal(t, traceID, span.SpanContext.TraceID().String(), name)
+		assert.Equal(t, tracing.RootSpanID(traceID), span.Parent.SpanID().String(), name)
+	}
+	assert.Equal(t, codes.Ok, spans[driverPendingSpanName].Status.Code)
+	assert.Equal(t, codes.Error, spans[driverRunningSpanName].Status.Code)
+	root := spans[applicationSpanName]
+	assert.Equal(t, tracing.RootSpanID(traceID), root.SpanContext.SpanID().String())
+	assert.False(t, root.Parent.IsValid())
+	assert.Equal(t, codes.Error, root.Status.Code)
+
+	// Resources of the failed application are cleaned up after its span ended.
+	exporter = recordingExporter{tracetest.NewInMemoryExporter()}
+	ctrl.tracer = tracing.NewWithExporter(exporter, "spark-operator")
+	ctrl.handleSparkApplicationDeletion(failedApp)
+	ctrl.tracer.Stop()
+	assert.Equal(t, 0, len(exporter.GetSpans()))
+}
+
+func TestTraceApplicationDeletion(t *testing.T) {
+	exporter := recordingExporter{tracetest.NewInMemoryExporter()}
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "foo",
+			Namespace:   "test",
+			Annotations: map[string]string{config.TraceIDAnnotation: traceID},
+		},
+		Status: v1beta2.SparkApplicationStatus{
+			AppState: v1beta2.ApplicationState{
+				State: v1beta2.RunningState,
+			},
+			DriverInfo: v1beta2.DriverInfo{
+				PodName: "foo-driver",
+			},
+		},
+	}
+	ctrl, _ := newFakeController(app)
+	ctrl.tracer = tracing.NewWithExporter(exporter, "spark-operator")
+
+	ctrl.handleSparkApplicationDeletion(app)
+	ctrl.tracer.Stop()
+
+	spans := exporter.GetSpans()
+	assert.Equal(t, 2, len(spans))
+	cleanup, root := spans[0], spans[1]
+	assert.Equal(t, cleanupSpanName, cleanup.Name)
+	assert.Equal(t, tracing.RootSpanID(traceID), cleanup.Parent.SpanID().String())
+	assert.Equal(t, applicationSpanName, root.Name)
+	assert.Equal(t, tracing.RootSpanID(traceID), root.SpanContext.SpanID().String())
+	assert.Equal(t, codes.Error, root.Status.Code)
+	assert.False(t, root.EndTime.Before(cleanup.EndTime))
+}
+
+func TestAddTraceContext(t *testing.T) {
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "foo",
+			Namespace:   "test",
+			Annotations: map[string]string{config.TraceIDAnnotation: "4bf92f3577b34da6a3ce929d0e0e4736"},
+		},
+	}
+	ctrl, _ := newFakeController(nil)
+	ctrl.addTraceContext(app)
+	assert.Nil(t, app.Spec.SparkConf)
+
+	ctrl.tracer = tracing.NewWithExporter(tracetest.NewNoopExporter(), "spark-operator")
+	ctrl.addTraceContext(app)
+	traceParent := tracing.TraceParent("4bf92f3577b34da6a3ce929d0e0e4736", tracing.RootSpanID("4bf92f3577b34da6a3ce929d0e0e4736"))
+	assert.Equal(t, traceParent, app.Spec.SparkConf["spark.kubernetes.driverEnv.TRACEPARENT"])
+	assert.Equal(t, traceParent, app.Spec.SparkConf["spark.executorEnv.TRACEPARENT"])
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkquota
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	crdclientset "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/clientset/versioned"
+	crdinformers "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/informers/externalversions"
+	crdlisters "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/listers/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/webhook/resourceusage"
+)
+
+// Controller keeps the status of SparkQuotas up to date with the usage of the applications in the namespaces
+// they select.
+type Controller struct {
+	crdClient   crdclientset.Interface
+	queue       workqueue.RateLimitingInterface
+	cacheSynced cache.InformerSynced
+	quotaLister crdlisters.SparkQuotaLister
+	enforcer    *resourceusage.SparkQuotaEnforcer
+}
+
+// NewController creates a new Controller. The core informer factory must not be limited to a namespace.
+func NewController(
+	crdClient crdclientset.Interface,
+	crdInformerFactory crdinformers.SharedInformerFactory,
+	coreV1InformerFactory informers.SharedInformerFactory,
+	enforcer *resourceusage.SparkQuotaEnforcer) *Controller {
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(),
+		"spark-quota-controller")
+
+	controller := &Controller{
+		crdClient: crdClient,
+		queue:     queue,
+		enforcer:  enforcer,
+	}
+
+	informer := crdInformerFactory.Sparkoperator().V1beta2().SparkQuotas()
+	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    controller.enqueue,
+		UpdateFunc: func(oldObj, newObj interface{}) { controller.enqueue(newObj) },
+	})
+	controller.quotaLister = informer.Lister()
+	controller.cacheSynced = informer.Informer().HasSynced
+
+	// Any change to an application or a namespace may change the usage of any quota.
+	enqueueAll := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { controller.enqueueAll() },
+		UpdateFunc: func(oldObj, newObj interface{}) { controller.enqueueAll() },
+		DeleteFunc: func(obj interface{}) { controller.enqueueAll() },
+	}
+	crdInformerFactory.Sparkoperator().V1beta2().SparkApplications().Informer().AddEventHandler(enqueueAll)
+	coreV1InformerFactory.Core().V1().Namespaces().Informer().AddEventHandler(enqueueAll)
+
+	return controller
+}
+
+func (c *Controller) Start(workers int, stopCh <-chan struct{}) error {
+	glog.Info("Starting the SparkQuota controller")
+
+	if !cache.WaitForCacheSync(stopCh, c.cacheSynced) {
+		return fmt.Errorf("timed out waiting for cache to sync")
+	}
+	if err := c.enforcer.WaitForCacheSync(stopCh); err != nil {
+		return err
+	}
+
+	glog.Info("Starting the workers of the SparkQuota controller")
+	for i := 0; i < workers; i++ {
+		go wait.Until(c.runWorker, time.Second, stopCh)
+	}
+
+	return nil
+}
+
+func (c *Controller) Stop() {
+	glog.Info("Stopping the SparkQuota controller")
+	c.queue.ShutDown()
+}
+
+func (c *Controller) runWorker() {
+	defer utilruntime.HandleCrash()
+	for c.processNextItem() {
+	}
+}
+
+func (c *Controller) processNextItem() bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	err := c.syncSparkQuota(key.(string))
+	if err == nil {
+		c.queue.Forget(key)
+		return true
+	}
+
+	utilruntime.HandleError(fmt.Errorf("failed to sync SparkQuota %q: %v", key, err))
+	c.queue.AddRateLimited(key)
+
+	return true
+}
+
+func (c *Controller) syncSparkQuota(name string) error {
+	quota, err := c.quotaLister.Get(name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	status, err := c.enforcer.Status(quota)
+	if err != nil {
+		return err
+	}
+	if isStatusEqual(&status, &quota.Status) {
+		return nil
+	}
+
+	glog.V(2).Infof("Updating the usage of SparkQuota %s: %d applications, %s cores, %s memory", name, status.Applications, status.Cores.String(), status.Memory.String())
+	toUpdate := quota.DeepCopy()
+	toUpdate.Status = status
+	toUpdate.Status.LastUpdateTime = metav1.Now()
+	_, err = c.crdClient.SparkoperatorV1beta2().SparkQuotas().UpdateStatus(context.TODO(), toUpdate, metav1.UpdateOptions{})
+	return err
+}
+
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		glog.Errorf("failed to get key for %v: %v", obj, err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+func (c *Controller) enqueueAll() {
+	quotas, err := c.quotaLister.List(labels.Everything())
+	if err != nil {
+		glog.Errorf("failed to list SparkQuotas: %v", err)
+		return
+	}
+	for _, quota := range quotas {
+		c.queue.Add(quota.Name)
+	}
+}
+
+// isStatusEqual tells if the given statuses show the same usage, regardless of when it was computed.
+func isStatusEqual(newStatus, currentStatus *v1beta2.SparkQuotaStatus) bool {
+	return newStatus.Applications == currentStatus.Applications &&
+		newStatus.Cores.Cmp(currentStatus.Cores) == 0 &&
+		newStatus.Memory.Cmp(currentStatus.Memory) == 0 &&
+		reflect.DeepEqual(newStatus.Namespaces, currentStatus.Namespaces)
+}
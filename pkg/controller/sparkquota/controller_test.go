@@ -0,0 +1,72 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sparkquota
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	kubeclientfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	crdclientfake "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/clientset/versioned/fake"
+	crdinformers "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/informers/externalversions"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/webhook/resourceusage"
+)
+
+func TestSyncSparkQuota(t *testing.T) {
+	quota := &v1beta2.SparkQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-x"},
+		Spec: v1beta2.SparkQuotaSpec{
+			NamespaceSelector: metav1.LabelSelector{MatchLabels: map[string]string{"team": "x"}},
+		},
+	}
+	crdClient := crdclientfake.NewSimpleClientset(quota)
+	crdInformerFactory := crdinformers.NewSharedInformerFactory(crdClient, 0)
+	coreV1InformerFactory := informers.NewSharedInformerFactory(kubeclientfake.NewSimpleClientset(), 0)
+	enforcer := resourceusage.NewSparkQuotaEnforcer(crdInformerFactory, coreV1InformerFactory, resourceusage.DynamicAllocationChargeMax)
+	controller := NewController(crdClient, crdInformerFactory, coreV1InformerFactory, enforcer)
+
+	crdInformerFactory.Sparkoperator().V1beta2().SparkQuotas().Informer().GetIndexer().Add(quota)
+	apps := crdInformerFactory.Sparkoperator().V1beta2().SparkApplications().Informer().GetIndexer()
+	apps.Add(&v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "running", Namespace: "team-x"},
+		Status:     v1beta2.SparkApplicationStatus{AppState: v1beta2.ApplicationState{State: v1beta2.RunningState}},
+	})
+	apps.Add(&v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "other"},
+		Status:     v1beta2.SparkApplicationStatus{AppState: v1beta2.ApplicationState{State: v1beta2.RunningState}},
+	})
+	namespaces := coreV1InformerFactory.Core().V1().Namespaces().Informer().GetIndexer()
+	namespaces.Add(&apiv1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-x", Labels: map[string]string{"team": "x"}}})
+	namespaces.Add(&apiv1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}})
+
+	assert.NoError(t, controller.syncSparkQuota("team-x"))
+	updated, err := crdClient.SparkoperatorV1beta2().SparkQuotas().Get(context.TODO(), "team-x", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"team-x"}, updated.Status.Namespaces)
+	assert.Equal(t, int32(1), updated.Status.Applications)
+	assert.Equal(t, int64(2000), updated.Status.Cores.MilliValue())
+	assert.False(t, updated.Status.LastUpdateTime.IsZero())
+
+	// Deleted quotas are ignored.
+	assert.NoError(t, controller.syncSparkQuota("deleted"))
+}
@@ -0,0 +1,473 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/uuid"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	v1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+)
+
+const (
+	// SinksConfigMapKey is the key in the sinks ConfigMaps holding the list of sinks.
+	SinksConfigMapKey = "sinks.yaml"
+	// EventTypePrefix is the prefix of the type of all events, which is followed by the lowercase
+	// kind of the object and its new state, e.g., sparkoperator.k8s.io.sparkapplication.failed.
+	EventTypePrefix = "sparkoperator.k8s.io."
+
+	cloudEventsSpecVersion = "1.0"
+	defaultContentType     = "application/json"
+	defaultMaxRetries      = 5
+	maxQueuedDeliveries    = 1024
+	numWorkers             = 4
+	sendTimeout            = 10 * time.Second
+	initialBackoff         = time.Second
+	maxBackoff             = time.Minute
+)
+
+// Sink is an HTTP endpoint receiving CloudEvents in binary content mode. Sinks are defined by the
+// operator and by namespaces in sinks ConfigMaps, and applications refer to them by name.
+type Sink struct {
+	// Name is the name applications refer to the sink by.
+	Name string `json:"name"`
+	// URL is the URL the events are posted to.
+	URL string `json:"url"`
+	// States limits the notifications to transitions into the given states, e.g., FAILED.
+	// Notifications are sent for every transition if empty.
+	States []string `json:"states,omitempty"`
+	// Headers are additional HTTP headers sent with every event, e.g., for authentication.
+	Headers []Header `json:"headers,omitempty"`
+	// PayloadTemplate is a Go template rendering the data of the events. The data is the JSON
+	// encoding of the notification if not set.
+	PayloadTemplate *string `json:"payloadTemplate,omitempty"`
+	// ContentType is the content type of the data of the events. Defaults to application/json.
+	ContentType *string `json:"contentType,omitempty"`
+	// MaxRetries is the number of times sending an event is retried with exponential backoff
+	// if it fails. Defaults to 5.
+	MaxRetries *int32 `json:"maxRetries,omitempty"`
+}
+
+// Header is an HTTP header whose value is either given literally, or read from a key of a Secret in
+// the namespace of the ConfigMap defining the sink for credentials.
+type Header struct {
+	Name         string                   `json:"name"`
+	Value        string                   `json:"value,omitempty"`
+	SecretKeyRef *apiv1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+}
+
+// Event is a lifecycle transition of a SparkApplication or a ScheduledSparkApplication. It is the
+// data of the CloudEvents sent to the sinks, and the input of payload templates.
+type Event struct {
+	Kind          string            `json:"kind"`
+	Namespace     string            `json:"namespace"`
+	Name          string            `json:"name"`
+	State         string            `json:"state"`
+	PreviousState string            `json:"previousState,omitempty"`
+	Message       string            `json:"message,omitempty"`
+	FailureReason string            `json:"failureReason,omitempty"`
+	SubmissionID  string            `json:"submissionID,omitempty"`
+	DriverPodName string            `json:"driverPodName,omitempty"`
+	WebUIAddress  string            `json:"webUIAddress,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	Time          time.Time         `json:"time"`
+}
+
+// Type returns the CloudEvents type of the event.
+func (e *Event) Type() string {
+	return EventTypePrefix + strings.ToLower(e.Kind) + "." + strings.ToLower(e.State)
+}
+
+// Source returns the CloudEvents source of the event, which is the API path of the object.
+func (e *Event) Source() string {
+	return fmt.Sprintf("/apis/%s/namespaces/%s/%ss/%s",
+		v1beta2.SchemeGroupVersion.String(), e.Namespace, strings.ToLower(e.Kind), e.Name)
+}
+
+// delivery is a rendered event to be sent to a sink.
+type delivery struct {
+	url     string
+	headers []Header
+	// namespace is the namespace of the Secrets referenced by the headers.
+	namespace   string
+	contentType string
+	payload     []byte
+	maxRetries  int
+	event       *Event
+	id          string
+}
+
+// Notifier sends events to the sinks in the background, retrying failed sends with exponential
+// backoff. A nil Notifier drops all events, so callers don't have to check whether notifications
+// are enabled.
+type Notifier struct {
+	kubeClient clientset.Interface
+	// sinksConfigMap is the name of the ConfigMaps holding the sinks of the operator and of namespaces.
+	sinksConfigMap string
+	// operatorNamespace is the namespace of the ConfigMap holding the sinks of the operator.
+	operatorNamespace string
+	sinksInformer     cache.SharedIndexInformer
+	sinksLister       v1.ConfigMapLister
+	client            *http.Client
+	deliveries        chan *delivery
+	stopCh            chan struct{}
+	wg                sync.WaitGroup
+	stopOnce          sync.Once
+	initialBackoff    time.Duration
+	maxBackoff        time.Duration
+}
+
+// New creates a Notifier that sends events to the sinks objects refer to, which are defined in the
+// ConfigMaps with the given name in the namespace of the object and in operatorNamespace.
+func New(kubeClient clientset.Interface, sinksConfigMap string, operatorNamespace string) *Notifier {
+	informer := coreinformers.NewFilteredConfigMapInformer(kubeClient, metav1.NamespaceAll, 0, cache.Indexers{},
+		func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", sinksConfigMap).String()
+		})
+	return &Notifier{
+		kubeClient:        kubeClient,
+		sinksConfigMap:    sinksConfigMap,
+		operatorNamespace: operatorNamespace,
+		sinksInformer:     informer,
+		sinksLister:       v1.NewConfigMapLister(informer.GetIndexer()),
+		client:            &http.Client{Timeout: sendTimeout},
+		deliveries:        make(chan *delivery, maxQueuedDeliveries),
+		stopCh:            make(chan struct{}),
+		initialBackoff:    initialBackoff,
+		maxBackoff:        maxBackoff,
+	}
+}
+
+// Start starts watching the sinks ConfigMaps and, once they are synced, sending events in the background.
+func (n *Notifier) Start() error {
+	if n == nil {
+		return nil
+	}
+	go n.sinksInformer.Run(n.stopCh)
+	if !cache.WaitForCacheSync(n.stopCh, n.sinksInformer.HasSynced) {
+		return fmt.Errorf("timed out waiting for the notification sinks cache to sync")
+	}
+	glog.Info("Starting the notification workers")
+	for i := 0; i < numWorkers; i++ {
+		n.wg.Add(1)
+		go n.runWorker()
+	}
+	return nil
+}
+
+// Stop stops sending events. Events still queued or being retried are dropped.
+func (n *Notifier) Stop() {
+	if n == nil {
+		return
+	}
+	n.stopOnce.Do(func() {
+		close(n.stopCh)
+		n.wg.Wait()
+	})
+}
+
+// Notify queues the event for the given sinks of the object whose state filters match the state of
+// the event.
+func (n *Notifier) Notify(event *Event, refs []v1beta2.NotificationSinkReference) {
+	if n == nil || event == nil {
+		return
+	}
+	for _, ref := range refs {
+		sink, namespace, err := n.findSink(event.Namespace, ref.Name)
+		if err != nil {
+			glog.Errorf("failed to find the notification sink %s of %s %s/%s: %v", ref.Name, event.Kind, event.Namespace, event.Name, err)
+			continue
+		}
+		if !matchesState(sink.States, event.State) || !matchesState(ref.States, event.State) {
+			continue
+		}
+		d, err := newDelivery(sink, namespace, event)
+		if err != nil {
+			glog.Errorf("failed to render the notification of %s %s/%s for %s: %v", event.Kind, event.Namespace, event.Name, sink.Name, err)
+			continue
+		}
+		select {
+		case n.deliveries <- d:
+		default:
+			glog.Warningf("dropping the notification of %s %s/%s for %s as the queue is full", event.Kind, event.Namespace, event.Name, sink.Name)
+		}
+	}
+}
+
+// findSink looks up the sink with the given name among the sinks of the namespace and then among the
+// sinks of the operator, and returns it with the namespace it is defined in.
+func (n *Notifier) findSink(namespace, name string) (*Sink, string, error) {
+	for _, ns := range []string{namespace, n.operatorNamespace} {
+		if ns == "" {
+			continue
+		}
+		sinks, err := n.loadSinks(ns)
+		if err != nil {
+			return nil, "", err
+		}
+		for i := range sinks {
+			if sinks[i].Name == name {
+				return &sinks[i], ns, nil
+			}
+		}
+	}
+	return nil, "", fmt.Errorf("no sink named %s is defined in namespace %s or by the operator", name, namespace)
+}
+
+// loadSinks reads the sinks of the given namespace from the cached sinks ConfigMap.
+func (n *Notifier) loadSinks(namespace string) ([]Sink, error) {
+	cm, err := n.sinksLister.ConfigMaps(namespace).Get(n.sinksConfigMap)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseSinks(cm.Data[SinksConfigMapKey])
+}
+
+func parseSinks(data string) ([]Sink, error) {
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+	var sinks []Sink
+	decoder := yaml.NewYAMLOrJSONDecoder(strings.NewReader(data), len(data))
+	if err := decoder.Decode(&sinks); err != nil {
+		return nil, fmt.Errorf("failed to parse notification sinks: %v", err)
+	}
+	for i, sink := range sinks {
+		if sink.Name == "" {
+			return nil, fmt.Errorf("notification sink %d has no name", i)
+		}
+		if sink.URL == "" {
+			return nil, fmt.Errorf("notification sink %s has no url", sink.Name)
+		}
+		for _, header := range sink.Headers {
+			if header.Name == "" || (header.Value == "") == (header.SecretKeyRef == nil) {
+				return nil, fmt.Errorf("header %q of notification sink %s must have either a value or a secretKeyRef", header.Name, sink.Name)
+			}
+		}
+	}
+	return sinks, nil
+}
+
+func matchesState(states []string, state string) bool {
+	if len(states) == 0 {
+		return true
+	}
+	for _, s := range states {
+		if strings.EqualFold(s, state) {
+			return true
+		}
+	}
+	return false
+}
+
+var templateFuncs = template.FuncMap{
+	// json encodes a value as JSON, e.g., to embed a message as a string in a JSON payload.
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+func renderPayload(sink *Sink, event *Event) ([]byte, error) {
+	if sink.PayloadTemplate == nil {
+		return json.Marshal(event)
+	}
+	tmpl, err := template.New("payload").Funcs(templateFuncs).Parse(*sink.PayloadTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, event); err != nil {
+		return nil, fmt.Errorf("failed to execute payload template: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func newDelivery(sink *Sink, namespace string, event *Event) (*delivery, error) {
+	payload, err := renderPayload(sink, event)
+	if err != nil {
+		return nil, err
+	}
+	d := &delivery{
+		url:         sink.URL,
+		headers:     sink.Headers,
+		namespace:   namespace,
+		contentType: defaultContentType,
+		payload:     payload,
+		maxRetries:  defaultMaxRetries,
+		event:       event,
+		id:          uuid.New().String(),
+	}
+	if sink.ContentType != nil {
+		d.contentType = *sink.ContentType
+	}
+	if sink.MaxRetries != nil {
+		d.maxRetries = int(*sink.MaxRetries)
+	}
+	return d, nil
+}
+
+func (n *Notifier) runWorker() {
+	defer n.wg.Done()
+	for {
+		select {
+		case d := <-n.deliveries:
+			n.deliver(d)
+		case <-n.stopCh:
+			return
+		}
+	}
+}
+
+// deliver sends the event, retrying with exponential backoff as long as the failure is transient.
+func (n *Notifier) deliver(d *delivery) {
+	backoff := n.initialBackoff
+	for attempt := 0; ; attempt++ {
+		retryable, err := n.send(d)
+		if err == nil {
+			glog.V(2).Infof("Sent %s for %s/%s to %s", d.event.Type(), d.event.Namespace, d.event.Name, d.url)
+			return
+		}
+		if !retryable || attempt >= d.maxRetries {
+			glog.Errorf("failed to send %s for %s/%s to %s after %d attempts: %v", d.event.Type(), d.event.Namespace, d.event.Name, d.url, attempt+1, err)
+			return
+		}
+		glog.V(2).Infof("failed to send %s for %s/%s to %s, retrying in %v: %v", d.event.Type(), d.event.Namespace, d.event.Name, d.url, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-n.stopCh:
+			return
+		}
+		backoff *= 2
+		if backoff > n.maxBackoff {
+			backoff = n.maxBackoff
+		}
+	}
+}
+
+// send posts the event in binary content mode and tells whether a failure is worth retrying.
+func (n *Notifier) send(d *delivery) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, d.url, bytes.NewReader(d.payload))
+	if err != nil {
+		return false, err
+	}
+	for _, header := range d.headers {
+		value, err := n.headerValue(d.namespace, header)
+		if err != nil {
+			return !errors.IsNotFound(err), err
+		}
+		req.Header.Set(header.Name, value)
+	}
+	req.Header.Set("Content-Type", d.contentType)
+	req.Header.Set("ce-specversion", cloudEventsSpecVersion)
+	req.Header.Set("ce-id", d.id)
+	req.Header.Set("ce-type", d.event.Type())
+	req.Header.Set("ce-source", d.event.Source())
+	req.Header.Set("ce-subject", d.event.Name)
+	req.Header.Set("ce-time", d.event.Time.UTC().Format(time.RFC3339Nano))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	retryable := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode == http.StatusRequestTimeout
+	return retryable, fmt.Errorf("unexpected response %s", resp.Status)
+}
+
+// headerValue returns the value of the header, reading it from its Secret if it refers to one. Secrets
+// are read for every send so rotated credentials take effect immediately.
+func (n *Notifier) headerValue(namespace string, header Header) (string, error) {
+	if header.SecretKeyRef == nil {
+		return header.Value, nil
+	}
+	secret, err := n.kubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), header.SecretKeyRef.Name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	value, ok := secret.Data[header.SecretKeyRef.Key]
+	if !ok {
+		return "", fmt.Errorf("secret %s/%s has no key %s", namespace, header.SecretKeyRef.Name, header.SecretKeyRef.Key)
+	}
+	return string(value), nil
+}
+
+// NewSparkApplicationEvent returns the event for the transition of the given application from the
+// state of oldApp to the state of newApp.
+func NewSparkApplicationEvent(oldApp, newApp *v1beta2.SparkApplication) *Event {
+	return &Event{
+		Kind:          "SparkApplication",
+		Namespace:     newApp.Namespace,
+		Name:          newApp.Name,
+		State:         string(newApp.Status.AppState.State),
+		PreviousState: string(oldApp.Status.AppState.State),
+		Message:       newApp.Status.AppState.ErrorMessage,
+		FailureReason: string(newApp.Status.FailureReason),
+		SubmissionID:  newApp.Status.SubmissionID,
+		DriverPodName: newApp.Status.DriverInfo.PodName,
+		WebUIAddress:  newApp.Status.DriverInfo.WebUIAddress,
+		Labels:        newApp.Labels,
+		Time:          time.Now(),
+	}
+}
+
+// NewScheduledSparkApplicationEvent returns the event for the transition of the given application
+// from oldState to the schedule state in newStatus.
+func NewScheduledSparkApplicationEvent(
+	app *v1beta2.ScheduledSparkApplication,
+	oldState v1beta2.ScheduleState,
+	newStatus *v1beta2.ScheduledSparkApplicationStatus) *Event {
+	return &Event{
+		Kind:          "ScheduledSparkApplication",
+		Namespace:     app.Namespace,
+		Name:          app.Name,
+		State:         string(newStatus.ScheduleState),
+		PreviousState: string(oldState),
+		Message:       newStatus.Reason,
+		Labels:        app.Labels,
+		Time:          time.Now(),
+	}
+}
@@ -0,0 +1,267 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notification
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeclientfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+)
+
+type receivedEvent struct {
+	path   string
+	header http.Header
+	body   string
+}
+
+// fakeSink is an HTTP sink recording the events it receives. It fails the first failures requests
+// with the given status code.
+type fakeSink struct {
+	mutex      sync.Mutex
+	events     []receivedEvent
+	failures   int
+	failStatus int
+	received   chan struct{}
+}
+
+func newFakeSink() *fakeSink {
+	return &fakeSink{received: make(chan struct{}, 10)}
+}
+
+func (s *fakeSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		w.WriteHeader(s.failStatus)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	s.events = append(s.events, receivedEvent{path: r.URL.Path, header: r.Header, body: string(body)})
+	s.received <- struct{}{}
+}
+
+func (s *fakeSink) waitForEvents(t *testing.T, n int) []receivedEvent {
+	for i := 0; i < n; i++ {
+		select {
+		case <-s.received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for event %d", i+1)
+		}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.events
+}
+
+func newTestNotifier(objects ...runtime.Object) *Notifier {
+	kubeClient := kubeclientfake.NewSimpleClientset(objects...)
+	n := New(kubeClient, "spark-notification-sinks", "spark-operator")
+	n.initialBackoff = time.Millisecond
+	n.maxBackoff = 10 * time.Millisecond
+	return n
+}
+
+func newSinksConfigMap(namespace, sinks string) *apiv1.ConfigMap {
+	return &apiv1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "spark-notification-sinks"},
+		Data:       map[string]string{SinksConfigMapKey: sinks},
+	}
+}
+
+func newTestEvent() *Event {
+	oldApp := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "spark-pi"},
+		Status:     v1beta2.SparkApplicationStatus{AppState: v1beta2.ApplicationState{State: v1beta2.RunningState}},
+	}
+	newApp := oldApp.DeepCopy()
+	newApp.Status.AppState = v1beta2.ApplicationState{State: v1beta2.FailedState, ErrorMessage: `driver "failed"`}
+	newApp.Status.FailureReason = v1beta2.DriverOOMKilledFailure
+	return NewSparkApplicationEvent(oldApp, newApp)
+}
+
+func TestNotifyBinaryMode(t *testing.T) {
+	sink := newFakeSink()
+	server := httptest.NewServer(sink)
+	defer server.Close()
+
+	n := newTestNotifier(
+		newSinksConfigMap("default", `
+- name: alerts
+  url: `+server.URL+`
+  headers:
+  - name: Authorization
+    secretKeyRef:
+      name: alerts-token
+      key: token
+  - name: X-Team
+    value: data
+`),
+		&apiv1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "alerts-token"},
+			Data:       map[string][]byte{"token": []byte("Bearer token")},
+		})
+	assert.NoError(t, n.Start())
+	defer n.Stop()
+
+	n.Notify(newTestEvent(), []v1beta2.NotificationSinkReference{{Name: "alerts"}})
+
+	events := sink.waitForEvents(t, 1)
+	header := events[0].header
+	assert.Equal(t, "1.0", header.Get("ce-specversion"))
+	assert.Equal(t, "sparkoperator.k8s.io.sparkapplication.failed", header.Get("ce-type"))
+	assert.Equal(t, "/apis/sparkoperator.k8s.io/v1beta2/namespaces/default/sparkapplications/spark-pi", header.Get("ce-source"))
+	assert.Equal(t, "spark-pi", header.Get("ce-subject"))
+	assert.NotEmpty(t, header.Get("ce-id"))
+	assert.NotEmpty(t, header.Get("ce-time"))
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", header.Get("Authorization"))
+	assert.Equal(t, "data", header.Get("X-Team"))
+
+	var data Event
+	assert.NoError(t, json.Unmarshal([]byte(events[0].body), &data))
+	assert.Equal(t, "FAILED", data.State)
+	assert.Equal(t, "RUNNING", data.PreviousState)
+	assert.Equal(t, "DriverOOMKilled", data.FailureReason)
+}
+
+func TestNotifyStateFilterAndOperatorSinks(t *testing.T) {
+	sink := newFakeSink()
+	server := httptest.NewServer(sink)
+	defer server.Close()
+
+	n := newTestNotifier(
+		newSinksConfigMap("spark-operator", `
+- name: team
+  url: `+server.URL+`/operator
+- name: audit
+  url: `+server.URL+`/audit
+- name: oncall
+  url: `+server.URL+`/oncall
+  states: ["FAILED"]
+  payloadTemplate: '{"text": {{ printf "%s/%s failed: %s" .Namespace .Name .Message | json }}}'
+`),
+		newSinksConfigMap("default", `
+- name: team
+  url: `+server.URL+`/namespace
+  states: ["COMPLETED"]
+`))
+	assert.NoError(t, n.Start())
+	defer n.Stop()
+
+	// The sink of the namespace shadows the operator sink named team and only wants completed
+	// applications, the reference to audit only wants completed applications, and there is no sink
+	// named unknown, so only the operator sink oncall is notified.
+	n.Notify(newTestEvent(), []v1beta2.NotificationSinkReference{
+		{Name: "team"},
+		{Name: "audit", States: []string{"COMPLETED"}},
+		{Name: "unknown"},
+		{Name: "oncall"},
+	})
+
+	events := sink.waitForEvents(t, 1)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "/oncall", events[0].path)
+	assert.Equal(t, `{"text": "default/spark-pi failed: driver \"failed\""}`, events[0].body)
+}
+
+func TestNotifyRetries(t *testing.T) {
+	sink := newFakeSink()
+	sink.failures = 2
+	sink.failStatus = http.StatusServiceUnavailable
+	server := httptest.NewServer(sink)
+	defer server.Close()
+
+	n := newTestNotifier(newSinksConfigMap("default", `[{"name": "alerts", "url": "`+server.URL+`"}]`))
+	assert.NoError(t, n.Start())
+	defer n.Stop()
+
+	n.Notify(newTestEvent(), []v1beta2.NotificationSinkReference{{Name: "alerts"}})
+	events := sink.waitForEvents(t, 1)
+	assert.Len(t, events, 1)
+}
+
+func TestSendDoesNotRetryClientErrors(t *testing.T) {
+	sink := newFakeSink()
+	sink.failures = 1
+	sink.failStatus = http.StatusBadRequest
+	server := httptest.NewServer(sink)
+	defer server.Close()
+
+	n := newTestNotifier()
+	d, err := newDelivery(&Sink{Name: "alerts", URL: server.URL}, "default", newTestEvent())
+	assert.NoError(t, err)
+	retryable, err := n.send(d)
+	assert.Error(t, err)
+	assert.False(t, retryable)
+
+	sink.failures = 1
+	sink.failStatus = http.StatusTooManyRequests
+	retryable, err = n.send(d)
+	assert.Error(t, err)
+	assert.True(t, retryable)
+
+	// Sends with credentials from a missing Secret fail without reaching the sink.
+	d, err = newDelivery(&Sink{Name: "alerts", URL: server.URL, Headers: []Header{{
+		Name:         "Authorization",
+		SecretKeyRef: &apiv1.SecretKeySelector{LocalObjectReference: apiv1.LocalObjectReference{Name: "missing"}, Key: "token"},
+	}}}, "default", newTestEvent())
+	assert.NoError(t, err)
+	retryable, err = n.send(d)
+	assert.Error(t, err)
+	assert.False(t, retryable)
+	assert.Empty(t, sink.events)
+}
+
+func TestParseSinks(t *testing.T) {
+	sinks, err := parseSinks(`[{"name": "alerts", "url": "http://sink", "states": ["FAILED"], "maxRetries": 3}]`)
+	assert.NoError(t, err)
+	assert.Len(t, sinks, 1)
+	assert.Equal(t, int32(3), *sinks[0].MaxRetries)
+
+	_, err = parseSinks(`[{"url": "http://sink"}]`)
+	assert.Error(t, err)
+	_, err = parseSinks(`[{"name": "alerts", "states": ["FAILED"]}]`)
+	assert.Error(t, err)
+	_, err = parseSinks(`[{"name": "alerts", "url": "http://sink", "headers": [{"name": "Authorization"}]}]`)
+	assert.Error(t, err)
+}
+
+func TestRenderPayloadInvalidTemplate(t *testing.T) {
+	template := "{{ .Name "
+	_, err := renderPayload(&Sink{Name: "alerts", URL: "http://sink", PayloadTemplate: &template}, newTestEvent())
+	assert.Error(t, err)
+}
+
+func TestNilNotifier(t *testing.T) {
+	var n *Notifier
+	assert.NoError(t, n.Start())
+	n.Notify(newTestEvent(), []v1beta2.NotificationSinkReference{{Name: "alerts"}})
+	n.Stop()
+}
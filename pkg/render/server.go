@@ -0,0 +1,115 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	clientset "k8s.io/client-go/kubernetes"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/controller/sparkapplication"
+)
+
+const (
+	// Path is the path of the endpoint.
+	Path = "/render"
+	// maxRequestBytes is the maximum size of a SparkApplication in a request.
+	maxRequestBytes = 1024 * 1024
+)
+
+// Server serves dry runs of the submission of SparkApplications. A POST request to Path with a
+// SparkApplication in YAML or JSON is answered with its sparkapplication.Rendering in JSON.
+type Server struct {
+	server     *http.Server
+	kubeClient clientset.Interface
+}
+
+// New creates a new Server listening on the given address and port. The server isn't authenticated, so the
+// address should only be reachable from trusted clients, e.g., the loopback interface. An empty address
+// listens on all interfaces.
+func New(kubeClient clientset.Interface, address string, port int) *Server {
+	server := &Server{kubeClient: kubeClient}
+	server.server = &http.Server{
+		Addr:    net.JoinHostPort(address, strconv.Itoa(port)),
+		Handler: server,
+	}
+	return server
+}
+
+// Start starts serving in the background.
+func (s *Server) Start() {
+	go func() {
+		glog.Infof("Starting the render endpoint on %s", s.server.Addr)
+		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			glog.Errorf("error while serving the render endpoint: %v", err)
+		}
+	}()
+}
+
+// Stop stops the server.
+func (s *Server) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	glog.Info("Stopping the render endpoint")
+	return s.server.Shutdown(ctx)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != Path {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, fmt.Sprintf("method %s is not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	app := &v1beta2.SparkApplication{}
+	decoder := yaml.NewYAMLOrJSONDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes), 4096)
+	if err := decoder.Decode(app); err != nil {
+		http.Error(w, fmt.Sprintf("failed to read a SparkApplication: %v", err), http.StatusBadRequest)
+		return
+	}
+	if app.Name == "" {
+		http.Error(w, "the SparkApplication has no name", http.StatusBadRequest)
+		return
+	}
+	if app.Namespace == "" {
+		app.Namespace = apiv1.NamespaceDefault
+	}
+
+	rendering, err := sparkapplication.Render(app, "", s.kubeClient)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to render SparkApplication %s/%s: %v", app.Namespace, app.Name, err), http.StatusUnprocessableEntity)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(rendering); err != nil {
+		glog.Errorf("failed to write the rendering of SparkApplication %s/%s: %v", app.Namespace, app.Name, err)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	kubeclientfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/controller/sparkapplication"
+)
+
+const testApp = `
+apiVersion: sparkoperator.k8s.io/v1beta2
+kind: SparkApplication
+metadata:
+  name: spark-pi
+spec:
+  type: Scala
+  mode: cluster
+  image: gcr.io/spark-operator/spark:v3.1.1
+  mainClass: org.apache.spark.examples.SparkPi
+  mainApplicationFile: local:///opt/spark/examples/jars/spark-examples_2.12-3.1.1.jar
+  driver:
+    env:
+    - name: FOO
+      value: bar
+`
+
+func TestServeHTTP(t *testing.T) {
+	os.Setenv("KUBERNETES_SERVICE_HOST", "localhost")
+	os.Setenv("KUBERNETES_SERVICE_PORT", "443")
+	kubeClient := kubeclientfake.NewSimpleClientset()
+	server := New(kubeClient, "", 0)
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, Path, strings.NewReader(testApp)))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+	rendering := &sparkapplication.Rendering{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), rendering))
+	assert.Contains(t, rendering.SparkSubmitArgs, "org.apache.spark.examples.SparkPi")
+	assert.Equal(t, "spark-pi-driver", rendering.DriverPod.Name)
+	assert.Equal(t, "default", rendering.DriverPod.Namespace)
+	assert.Equal(t, "FOO", rendering.DriverPod.Spec.Containers[0].Env[0].Name)
+	assert.Equal(t, "spark-pi-exec-1", rendering.ExecutorPod.Name)
+	assert.Empty(t, kubeClient.Actions())
+}
+
+func TestServeHTTPErrors(t *testing.T) {
+	server := New(kubeclientfake.NewSimpleClientset(), "", 0)
+
+	testcases := []struct {
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{method: http.MethodGet, path: Path, code: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, path: "/other", body: testApp, code: http.StatusNotFound},
+		{method: http.MethodPost, path: Path, body: "spec: [", code: http.StatusBadRequest},
+		{method: http.MethodPost, path: Path, body: "spec: {}", code: http.StatusBadRequest},
+	}
+	for _, test := range testcases {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(test.method, test.path, strings.NewReader(test.body)))
+		assert.Equal(t, test.code, recorder.Code, "%s %s %q", test.method, test.path, test.body)
+	}
+}
@@ -0,0 +1,249 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// TraceParentEnvVar is the environment variable carrying the W3C trace context to Spark pods.
+	TraceParentEnvVar = "TRACEPARENT"
+
+	tracesPath      = "/v1/traces"
+	maxQueuedSpans  = 2048
+	maxBatchSize    = 256
+	exportInterval  = 5 * time.Second
+	exportTimeout   = 10 * time.Second
+	shutdownTimeout = 30 * time.Second
+	scopeName       = "github.com/GoogleCloudPlatform/spark-on-k8s-operator"
+)
+
+// Span is a finished operation in the lifecycle of an application. Operations span several syncs of
+// an application, so they are recorded once they have ended, with their actual start and end times.
+type Span struct {
+	TraceID string
+	// SpanID is the ID of the span, or empty to generate a random ID.
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]string
+	// Err is set if the operation failed.
+	Err error
+}
+
+// Tracer records spans with the OpenTelemetry SDK, which exports them in batches. A nil Tracer drops
+// all spans, so callers don't have to check whether tracing is enabled.
+type Tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+// New creates a Tracer exporting with OTLP/HTTP to the collector at the given base URL, e.g.,
+// http://otel-collector:4318. Spans are posted to <endpoint>/v1/traces.
+func New(endpoint string, serviceName string) (*Tracer, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid tracing endpoint %q, must be a URL such as http://otel-collector:4318", endpoint)
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	if !strings.HasSuffix(path, tracesPath) {
+		path += tracesPath
+	}
+	options := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(path),
+		otlptracehttp.WithTimeout(exportTimeout),
+	}
+	if u.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the OTLP exporter for %s: %v", endpoint, err)
+	}
+	glog.Infof("Exporting traces to %s://%s%s", u.Scheme, u.Host, path)
+	return NewWithExporter(exporter, serviceName), nil
+}
+
+// NewWithExporter creates a Tracer exporting to the given exporter.
+func NewWithExporter(exporter sdktrace.SpanExporter, serviceName string) *Tracer {
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter,
+			sdktrace.WithMaxQueueSize(maxQueuedSpans),
+			sdktrace.WithMaxExportBatchSize(maxBatchSize),
+			sdktrace.WithBatchTimeout(exportInterval)),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithIDGenerator(idGenerator{}))
+	return &Tracer{
+		provider: provider,
+		tracer:   provider.Tracer(scopeName),
+	}
+}
+
+// Stop exports the remaining queued spans and stops the exporter.
+func (t *Tracer) Stop() {
+	if t == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := t.provider.Shutdown(ctx); err != nil {
+		glog.Errorf("failed to shut down tracing: %v", err)
+	}
+}
+
+// Export records the given span, which is queued for export. The span is dropped if the queue is full.
+func (t *Tracer) Export(span *Span) {
+	if t == nil || span == nil || span.TraceID == "" {
+		return
+	}
+	ids, err := parseIDs(span.TraceID, span.SpanID)
+	if err != nil {
+		glog.Errorf("dropping span %s: %v", span.Name, err)
+		return
+	}
+	ctx := context.WithValue(context.Background(), idsKey{}, ids)
+	if span.ParentSpanID != "" {
+		parentID, err := trace.SpanIDFromHex(span.ParentSpanID)
+		if err != nil {
+			glog.Errorf("dropping span %s with invalid parent span ID %s: %v", span.Name, span.ParentSpanID, err)
+			return
+		}
+		ctx = trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    ids.traceID,
+			SpanID:     parentID,
+			TraceFlags: trace.FlagsSampled,
+			Remote:     true,
+		}))
+	}
+
+	_, s := t.tracer.Start(ctx, span.Name,
+		trace.WithTimestamp(span.Start),
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(toAttributes(span.Attributes)...))
+	if span.Err != nil {
+		s.SetStatus(codes.Error, span.Err.Error())
+	} else {
+		s.SetStatus(codes.Ok, "")
+	}
+	s.End(trace.WithTimestamp(span.End))
+}
+
+func toAttributes(attributes map[string]string) []attribute.KeyValue {
+	var keys []string
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var kvs []attribute.KeyValue
+	for _, key := range keys {
+		kvs = append(kvs, attribute.String(key, attributes[key]))
+	}
+	return kvs
+}
+
+// idsKey is the context key of the IDs a span is started with.
+type idsKey struct{}
+
+// ids are the trace ID and, unless it is invalid, the span ID a span is started with.
+type ids struct {
+	traceID trace.TraceID
+	spanID  trace.SpanID
+}
+
+func parseIDs(traceID, spanID string) (ids, error) {
+	var result ids
+	var err error
+	if result.traceID, err = trace.TraceIDFromHex(traceID); err != nil {
+		return ids{}, fmt.Errorf("invalid trace ID %s: %v", traceID, err)
+	}
+	if spanID != "" {
+		if result.spanID, err = trace.SpanIDFromHex(spanID); err != nil {
+			return ids{}, fmt.Errorf("invalid span ID %s: %v", spanID, err)
+		}
+	}
+	return result, nil
+}
+
+// idGenerator generates the IDs given in the context a span is started with, and random IDs otherwise.
+// The traces of applications are recorded across syncs and restarts of the operator, so their trace IDs
+// are stored in the applications, and the IDs of their root spans are derived from the trace IDs.
+type idGenerator struct{}
+
+func (idGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	given, _ := ctx.Value(idsKey{}).(ids)
+	traceID := given.traceID
+	if !traceID.IsValid() {
+		rand.Read(traceID[:])
+	}
+	return traceID, idGenerator{}.NewSpanID(ctx, traceID)
+}
+
+func (idGenerator) NewSpanID(ctx context.Context, _ trace.TraceID) trace.SpanID {
+	given, _ := ctx.Value(idsKey{}).(ids)
+	spanID := given.spanID
+	if !spanID.IsValid() {
+		rand.Read(spanID[:])
+	}
+	return spanID
+}
+
+// NewTraceID returns a random 16-byte trace ID in hex.
+func NewTraceID() string {
+	return randomHex(16)
+}
+
+// RootSpanID returns the ID of the span covering the whole application, which is derived from the
+// trace ID so that it doesn't need to be stored.
+func RootSpanID(traceID string) string {
+	sum := sha256.Sum256([]byte(traceID))
+	return hex.EncodeToString(sum[:8])
+}
+
+// TraceParent returns the W3C traceparent header value for the given sampled span.
+func TraceParent(traceID, spanID string) string {
+	return fmt.Sprintf("00-%s-%s-01", traceID, spanID)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		glog.Errorf("failed to generate a random ID: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordingExporter keeps the exported spans after the Tracer is stopped.
+type recordingExporter struct {
+	*tracetest.InMemoryExporter
+}
+
+func (recordingExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+func TestTracerExport(t *testing.T) {
+	exporter := recordingExporter{tracetest.NewInMemoryExporter()}
+	tracer := NewWithExporter(exporter, "spark-operator")
+	traceID := NewTraceID()
+	start := time.Unix(100, 0)
+	tracer.Export(&Span{
+		TraceID:      traceID,
+		ParentSpanID: RootSpanID(traceID),
+		Name:         "spark-submit",
+		Start:        start,
+		End:          start.Add(time.Second),
+		Attributes:   map[string]string{"sparkapplication.name": "foo"},
+		Err:          fmt.Errorf("failed"),
+	})
+	tracer.Export(&Span{TraceID: traceID, SpanID: RootSpanID(traceID), Name: "SparkApplication", Start: start, End: start})
+	// Spans without a trace ID are dropped.
+	tracer.Export(&Span{Name: "untraced"})
+	tracer.Stop()
+
+	spans := exporter.GetSpans()
+	assert.Equal(t, 2, len(spans))
+	submit := spans[0]
+	assert.Equal(t, "spark-submit", submit.Name)
+	assert.Equal(t, traceID, submit.SpanContext.TraceID().String())
+	assert.True(t, submit.SpanContext.SpanID().IsValid())
+	assert.Equal(t, RootSpanID(traceID), submit.Parent.SpanID().String())
+	assert.Equal(t, start, submit.StartTime)
+	assert.Equal(t, start.Add(time.Second), submit.EndTime)
+	assert.Equal(t, []attribute.KeyValue{attribute.String("sparkapplication.name", "foo")}, submit.Attributes)
+	assert.Equal(t, codes.Error, submit.Status.Code)
+	assert.Equal(t, "failed", submit.Status.Description)
+	root := spans[1]
+	assert.Equal(t, traceID, root.SpanContext.TraceID().String())
+	assert.Equal(t, RootSpanID(traceID), root.SpanContext.SpanID().String())
+	assert.False(t, root.Parent.IsValid())
+	assert.Equal(t, codes.Ok, root.Status.Code)
+}
+
+func TestTracerExportOverOTLP(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		requests = append(requests, r)
+	}))
+	defer server.Close()
+
+	tracer, err := New(server.URL+"/", "spark-operator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(100, 0)
+	tracer.Export(&Span{TraceID: NewTraceID(), Name: "SparkApplication", Start: start, End: start})
+	tracer.Stop()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, 1, len(requests))
+	assert.Equal(t, tracesPath, requests[0].URL.Path)
+	assert.Equal(t, "application/x-protobuf", requests[0].Header.Get("Content-Type"))
+
+	_, err = New("otel-collector", "spark-operator")
+	assert.NotNil(t, err)
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+	tracer.Export(&Span{TraceID: NewTraceID(), Name: "ignored"})
+	tracer.Stop()
+}
+
+func TestTraceParent(t *testing.T) {
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", TraceParent(traceID, "00f067aa0ba902b7"))
+	assert.Equal(t, RootSpanID(traceID), RootSpanID(traceID))
+	assert.NotEqual(t, NewTraceID(), NewTraceID())
+}
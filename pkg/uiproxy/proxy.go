@@ -0,0 +1,270 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uiproxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/informers"
+	v1 "k8s.io/client-go/listers/core/v1"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	crinformers "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/informers/externalversions"
+	crdlisters "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/listers/sparkoperator.k8s.io/v1beta2"
+)
+
+const (
+	sparkUIPortConfigurationKey       = "spark.ui.port"
+	defaultSparkWebUIPort       int32 = 4040
+)
+
+// AppPath returns the path under which the proxy serves the UI of the given application.
+func AppPath(namespace, name string) string {
+	return fmt.Sprintf("/%s/%s/", namespace, name)
+}
+
+// Proxy is a reverse proxy for the web UIs of running Spark drivers. It forwards requests for
+// /<namespace>/<name>/<path> to <path> on the UI port of the driver pod of the application.
+// It doesn't authenticate or authorize requests, which is left to whatever exposes the proxy.
+type Proxy struct {
+	server    *http.Server
+	appLister crdlisters.SparkApplicationLister
+	podLister v1.PodLister
+	// namespaces are the namespaces whose applications are served, or empty to serve all namespaces.
+	namespaces map[string]bool
+	transport  http.RoundTripper
+}
+
+// New creates a new Proxy listening on the given port that serves the UIs of applications in the
+// given namespaces, or in all namespaces if none are given. It must be called before the informer
+// factories are started.
+func New(
+	crInformerFactory crinformers.SharedInformerFactory,
+	podInformerFactory informers.SharedInformerFactory,
+	port int,
+	namespaces []string) *Proxy {
+	proxy := newProxy(
+		crInformerFactory.Sparkoperator().V1beta2().SparkApplications().Lister(),
+		podInformerFactory.Core().V1().Pods().Lister(),
+		namespaces)
+	proxy.server = &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: proxy,
+	}
+	return proxy
+}
+
+func newProxy(appLister crdlisters.SparkApplicationLister, podLister v1.PodLister, namespaces []string) *Proxy {
+	proxy := &Proxy{
+		appLister:  appLister,
+		podLister:  podLister,
+		namespaces: make(map[string]bool),
+		transport:  http.DefaultTransport,
+	}
+	for _, namespace := range namespaces {
+		proxy.namespaces[namespace] = true
+	}
+	return proxy
+}
+
+// Start starts serving in the background.
+func (p *Proxy) Start() {
+	go func() {
+		glog.Infof("Starting the Spark UI proxy on %s", p.server.Addr)
+		if err := p.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			glog.Errorf("error while serving the Spark UI proxy: %v", err)
+		}
+	}()
+}
+
+// Stop stops the proxy server.
+func (p *Proxy) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	glog.Info("Stopping the Spark UI proxy")
+	return p.server.Shutdown(ctx)
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	namespace, name := parts[0], parts[1]
+	if len(p.namespaces) > 0 && !p.namespaces[namespace] {
+		http.NotFound(w, r)
+		return
+	}
+	prefix := AppPath(namespace, name)
+	if len(parts) == 2 {
+		// Make relative links in the UI resolve under the prefix.
+		http.Redirect(w, r, prefix, http.StatusFound)
+		return
+	}
+
+	target, err := p.getDriverUIURL(namespace, name)
+	if err != nil {
+		glog.V(2).Infof("Spark UI of SparkApplication %s/%s is not available: %v", namespace, name, err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.URL.Path = "/" + parts[2]
+			req.URL.RawPath = ""
+			req.Host = target.Host
+			// Ask for an uncompressed response so that links can be rewritten.
+			req.Header.Del("Accept-Encoding")
+			req.Header.Set("X-Forwarded-Prefix", strings.TrimSuffix(prefix, "/"))
+		},
+		Transport: p.transport,
+		ModifyResponse: func(resp *http.Response) error {
+			return rewriteResponse(resp, target, prefix)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// getDriverUIURL returns the URL of the UI of the running driver of the given application.
+func (p *Proxy) getDriverUIURL(namespace, name string) (*url.URL, error) {
+	app, err := p.appLister.SparkApplications(namespace).Get(name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, fmt.Errorf("SparkApplication %s/%s not found", namespace, name)
+		}
+		return nil, err
+	}
+	if app.Status.DriverInfo.PodName == "" {
+		return nil, fmt.Errorf("SparkApplication %s/%s has no driver", namespace, name)
+	}
+	pod, err := p.podLister.Pods(namespace).Get(app.Status.DriverInfo.PodName)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, fmt.Errorf("driver pod %s/%s not found", namespace, app.Status.DriverInfo.PodName)
+		}
+		return nil, err
+	}
+	if pod.Status.Phase != apiv1.PodRunning || pod.Status.PodIP == "" {
+		return nil, fmt.Errorf("driver pod %s/%s is not running", namespace, pod.Name)
+	}
+	port, err := getUIPort(app)
+	if err != nil {
+		return nil, err
+	}
+	return &url.URL{Scheme: "http", Host: net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(port)))}, nil
+}
+
+// getUIPort returns the Spark web UI port from spark.ui.port in Spec.SparkConf if it is present,
+// otherwise the default port.
+func getUIPort(app *v1beta2.SparkApplication) (int32, error) {
+	portStr, ok := app.Spec.SparkConf[sparkUIPortConfigurationKey]
+	if !ok {
+		return defaultSparkWebUIPort, nil
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", sparkUIPortConfigurationKey, err)
+	}
+	return int32(port), nil
+}
+
+// rewriteResponse rewrites redirects and absolute links in HTML pages of the driver UI to go
+// through the proxy. Links that already have the prefix, because spark.ui.proxyBase was set for
+// the application, are left alone.
+func rewriteResponse(resp *http.Response, target *url.URL, prefix string) error {
+	if location := resp.Header.Get("Location"); location != "" {
+		resp.Header.Set("Location", rewriteLocation(location, target, prefix))
+	}
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") || resp.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	body = rewriteLinks(body, prefix)
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+func rewriteLocation(location string, target *url.URL, prefix string) string {
+	u, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+	if u.IsAbs() {
+		if u.Host != target.Host {
+			return location
+		}
+		u.Scheme = ""
+		u.Host = ""
+	}
+	if strings.HasPrefix(u.Path, "/") && !strings.HasPrefix(u.Path, prefix) && u.Path+"/" != prefix {
+		u.Path = prefix + strings.TrimPrefix(u.Path, "/")
+	}
+	return u.String()
+}
+
+var linkAttributes = []string{`href="/`, `src="/`, `action="/`}
+
+func rewriteLinks(body []byte, prefix string) []byte {
+	var out bytes.Buffer
+	for len(body) > 0 {
+		index, attribute := -1, ""
+		for _, a := range linkAttributes {
+			if i := bytes.Index(body, []byte(a)); i >= 0 && (index < 0 || i < index) {
+				index, attribute = i, a
+			}
+		}
+		if index < 0 {
+			out.Write(body)
+			break
+		}
+		end := index + len(attribute)
+		out.Write(body[:end-1])
+		rest := body[end-1:]
+		// Leave protocol-relative URLs and links that already have the prefix alone.
+		if !bytes.HasPrefix(rest, []byte("//")) && !bytes.HasPrefix(rest, []byte(prefix)) {
+			out.WriteString(strings.TrimSuffix(prefix, "/"))
+		}
+		body = rest
+		out.WriteByte('/')
+		body = body[1:]
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uiproxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	crdlisters "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/listers/sparkoperator.k8s.io/v1beta2"
+)
+
+func TestRewriteLinks(t *testing.T) {
+	prefix := AppPath("default", "foo")
+	in := `<a href="/jobs/">Jobs</a><script src="/static/app.js"></script>` +
+		`<a href="/default/foo/stages/">Stages</a><a href="//cdn.example.com/x.js"></a><a href="jobs/">rel</a>`
+	expected := `<a href="/default/foo/jobs/">Jobs</a><script src="/default/foo/static/app.js"></script>` +
+		`<a href="/default/foo/stages/">Stages</a><a href="//cdn.example.com/x.js"></a><a href="jobs/">rel</a>`
+	assert.Equal(t, expected, string(rewriteLinks([]byte(in), prefix)))
+}
+
+func TestRewriteLocation(t *testing.T) {
+	target := &url.URL{Scheme: "http", Host: "10.0.0.1:4040"}
+	prefix := AppPath("default", "foo")
+	assert.Equal(t, "/default/foo/jobs/", rewriteLocation("http://10.0.0.1:4040/jobs/", target, prefix))
+	assert.Equal(t, "/default/foo/jobs/", rewriteLocation("/jobs/", target, prefix))
+	assert.Equal(t, "/default/foo/jobs/", rewriteLocation("/default/foo/jobs/", target, prefix))
+	assert.Equal(t, "https://example.com/login", rewriteLocation("https://example.com/login", target, prefix))
+}
+
+func TestServeHTTP(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/jobs/", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html;charset=utf-8")
+		fmt.Fprintf(w, `<a href="/stages/">%s</a>`, r.URL.Path)
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+	host, port, _ := net.SplitHostPort(backendURL.Host)
+
+	appIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	podIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	appIndexer.Add(&v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec: v1beta2.SparkApplicationSpec{
+			SparkConf: map[string]string{sparkUIPortConfigurationKey: port},
+		},
+		Status: v1beta2.SparkApplicationStatus{
+			DriverInfo: v1beta2.DriverInfo{PodName: "foo-driver"},
+		},
+	})
+	appIndexer.Add(&v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "default"},
+		Status: v1beta2.SparkApplicationStatus{
+			DriverInfo: v1beta2.DriverInfo{PodName: "bar-driver"},
+		},
+	})
+	podIndexer.Add(&apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo-driver", Namespace: "default"},
+		Status:     apiv1.PodStatus{Phase: apiv1.PodRunning, PodIP: host},
+	})
+	podIndexer.Add(&apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "bar-driver", Namespace: "default"},
+		Status:     apiv1.PodStatus{Phase: apiv1.PodPending},
+	})
+
+	proxy := httptest.NewServer(newProxy(crdlisters.NewSparkApplicationLister(appIndexer), v1.NewPodLister(podIndexer), nil))
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/default/foo")
+	assert.Nil(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, proxy.URL+"/default/foo/jobs/", resp.Request.URL.String())
+	assert.Equal(t, `<a href="/default/foo/stages/">/jobs/</a>`, string(body))
+
+	resp, err = http.Get(proxy.URL + "/default/bar/jobs/")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	resp, err = http.Get(proxy.URL + "/default/baz/jobs/")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	scopedProxy := httptest.NewServer(newProxy(crdlisters.NewSparkApplicationLister(appIndexer), v1.NewPodLister(podIndexer), []string{"spark"}))
+	defer scopedProxy.Close()
+	resp, err = http.Get(scopedProxy.URL + "/default/foo/jobs/")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -76,3 +76,16 @@ func InitializeIngressCapabilities(client kubernetes.Interface) (err error) {
 	IngressCapabilities, err = getPreferredAvailableAPIs(client, "Ingress")
 	return
 }
+
+var (
+	// HTTPRouteCapabilities holds the Gateway API versions serving HTTPRoutes, if any.
+	HTTPRouteCapabilities Capabilities
+)
+
+func InitializeHTTPRouteCapabilities(client kubernetes.Interface) (err error) {
+	if HTTPRouteCapabilities != nil {
+		return
+	}
+	HTTPRouteCapabilities, err = getPreferredAvailableAPIs(client, "HTTPRoute")
+	return
+}
@@ -24,6 +24,8 @@ import (
 
 var DefaultJobStartLatencyBuckets = []float64{30, 60, 90, 120, 150, 180, 210, 240, 270, 300}
 
+var DefaultStateDurationBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600, 7200, 21600}
+
 type HistogramBuckets []float64
 
 func (hb *HistogramBuckets) String() string {
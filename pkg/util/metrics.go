@@ -54,6 +54,7 @@ type MetricConfig struct {
 	MetricsPrefix                 string
 	MetricsLabels                 []string
 	MetricsJobStartLatencyBuckets []float64
+	MetricsStateDurationBuckets   []float64
 }
 
 // A variant of Prometheus Gauge that only holds non-negative values.
@@ -0,0 +1,300 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Keys of the certificates in the Secret, the same as those written by hack/gencerts.sh, so that the operator
+// can take over a Secret created by the script.
+const (
+	caCertSecretKey     = "ca-cert.pem"
+	caKeySecretKey      = "ca-key.pem"
+	serverCertSecretKey = "server-cert.pem"
+	serverKeySecretKey  = "server-key.pem"
+	// caBundleSecretKey holds the CA certificates the API server should trust: the current CA certificate
+	// followed by the staged one while certificates are staged, and by the previous one while it is still valid
+	// once they are switched, so that the API server trusts servers that haven't reloaded the certificate yet.
+	caBundleSecretKey = "ca-bundle.pem"
+	// stagedSecretKeyPrefix prefixes the keys of the certificates generated by a rotation until the server
+	// certificate is switched to them.
+	stagedSecretKeyPrefix = "next-"
+)
+
+// certSecretKeys are the keys of the certificates and keys generated by a rotation.
+var certSecretKeys = []string{caCertSecretKey, caKeySecretKey, serverCertSecretKey, serverKeySecretKey}
+
+// certManager generates a CA certificate and a server certificate signed by it for the webhook into a Secret,
+// and rotates both before the server certificate expires. A rotation first stages the new certificates and
+// adds the new CA certificate to the CA bundle, and only switches the server certificate once the API server
+// trusts the new CA, so that the API server always trusts the certificate served by the webhook.
+type certManager struct {
+	client      kubernetes.Interface
+	namespace   string
+	secretName  string
+	dnsNames    []string
+	validity    time.Duration
+	renewBefore time.Duration
+	now         func() time.Time
+}
+
+func newCertManager(client kubernetes.Interface, namespace, secretName, serviceName string, validity, renewBefore time.Duration) *certManager {
+	return &certManager{
+		client:     client,
+		namespace:  namespace,
+		secretName: secretName,
+		dnsNames: []string{
+			serviceName,
+			fmt.Sprintf("%s.%s", serviceName, namespace),
+			fmt.Sprintf("%s.%s.svc", serviceName, namespace),
+			fmt.Sprintf("%s.%s.svc.cluster.local", serviceName, namespace),
+		},
+		validity:    validity,
+		renewBefore: renewBefore,
+		now:         time.Now,
+	}
+}
+
+// ensureCerts generates the certificates if the Secret doesn't exist, or stages new certificates if its server
+// certificate expires within renewBefore, and returns the CA bundle the API server should trust.
+func (m *certManager) ensureCerts() ([]byte, error) {
+	secrets := m.client.CoreV1().Secrets(m.namespace)
+	secret, err := secrets.Get(context.TODO(), m.secretName, metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+		glog.Infof("Generating webhook certificates into secret %s/%s", m.namespace, m.secretName)
+		data, err := m.generateCerts()
+		if err != nil {
+			return nil, err
+		}
+		data[caBundleSecretKey] = data[caCertSecretKey]
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: m.secretName, Namespace: m.namespace},
+			Data:       data,
+		}
+		if secret, err = secrets.Create(context.TODO(), secret, metav1.CreateOptions{}); err != nil {
+			return nil, err
+		}
+		return caBundleOf(secret), nil
+	}
+
+	if stagedCACert(secret) != nil {
+		return caBundleOf(secret), nil
+	}
+	if reason := m.renewalReason(secret); reason != "" {
+		glog.Infof("Staging new webhook certificates in secret %s/%s: %s", m.namespace, m.secretName, reason)
+		data, err := m.generateCerts()
+		if err != nil {
+			return nil, err
+		}
+		secret = secret.DeepCopy()
+		for _, key := range certSecretKeys {
+			secret.Data[stagedSecretKeyPrefix+key] = data[key]
+		}
+		secret.Data[caBundleSecretKey] = append(append([]byte{}, secret.Data[caCertSecretKey]...), data[caCertSecretKey]...)
+		if secret, err = secrets.Update(context.TODO(), secret, metav1.UpdateOptions{}); err != nil {
+			return nil, err
+		}
+	}
+	return caBundleOf(secret), nil
+}
+
+// stagedCACert returns the CA certificate of the certificates staged in the Secret, or nil if none are staged.
+func (m *certManager) stagedCACert() ([]byte, error) {
+	secret, err := m.client.CoreV1().Secrets(m.namespace).Get(context.TODO(), m.secretName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return stagedCACert(secret), nil
+}
+
+func stagedCACert(secret *corev1.Secret) []byte {
+	if caCert := secret.Data[stagedSecretKeyPrefix+caCertSecretKey]; len(bytes.TrimSpace(caCert)) > 0 {
+		return caCert
+	}
+	return nil
+}
+
+// switchCerts switches the certificates in the Secret to the staged ones, keeping the previous CA certificate
+// in the CA bundle while it is still valid. It must only be called once the API server trusts the staged CA.
+func (m *certManager) switchCerts() error {
+	secrets := m.client.CoreV1().Secrets(m.namespace)
+	secret, err := secrets.Get(context.TODO(), m.secretName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if stagedCACert(secret) == nil {
+		return nil
+	}
+	glog.Infof("Switching to the staged webhook certificates in secret %s/%s", m.namespace, m.secretName)
+	secret = secret.DeepCopy()
+	previousCACert := secret.Data[caCertSecretKey]
+	for _, key := range certSecretKeys {
+		secret.Data[key] = secret.Data[stagedSecretKeyPrefix+key]
+		delete(secret.Data, stagedSecretKeyPrefix+key)
+	}
+	caBundle := secret.Data[caCertSecretKey]
+	if previous, err := parseCertificate(previousCACert); err == nil && m.now().Before(previous.NotAfter) {
+		caBundle = append(append([]byte{}, caBundle...), previousCACert...)
+	}
+	secret.Data[caBundleSecretKey] = caBundle
+	_, err = secrets.Update(context.TODO(), secret, metav1.UpdateOptions{})
+	return err
+}
+
+// renewalReason returns why the certificates in the given Secret need to be generated again, or an empty
+// string if they don't.
+func (m *certManager) renewalReason(secret *corev1.Secret) string {
+	if _, err := tls.X509KeyPair(secret.Data[serverCertSecretKey], secret.Data[serverKeySecretKey]); err != nil {
+		return fmt.Sprintf("invalid server certificate: %v", err)
+	}
+	cert, err := parseCertificate(secret.Data[serverCertSecretKey])
+	if err != nil {
+		return fmt.Sprintf("invalid server certificate: %v", err)
+	}
+	if m.now().Add(m.renewBefore).After(cert.NotAfter) {
+		return fmt.Sprintf("the server certificate expires at %s", cert.NotAfter.Format(time.RFC3339))
+	}
+	for _, name := range m.dnsNames {
+		if cert.VerifyHostname(name) != nil {
+			return fmt.Sprintf("the server certificate isn't valid for %s", name)
+		}
+	}
+	return ""
+}
+
+// generateCerts generates a new CA certificate and a server certificate signed by it, and returns them along
+// with their keys by their keys in the Secret.
+func (m *certManager) generateCerts() (map[string][]byte, error) {
+	notBefore := m.now().Add(-time.Hour)
+	notAfter := m.now().Add(m.validity)
+
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          newSerialNumber(),
+		Subject:               pkix.Name{CommonName: fmt.Sprintf("spark-operator-webhook-ca@%d", m.now().Unix())},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	serverKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	serverTemplate := &x509.Certificate{
+		SerialNumber: newSerialNumber(),
+		Subject:      pkix.Name{CommonName: m.dnsNames[2]},
+		DNSNames:     m.dnsNames,
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	serverDER, err := x509.CreateCertificate(rand.Reader, serverTemplate, caCert, &serverKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string][]byte{
+		caCertSecretKey:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		caKeySecretKey:      pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(caKey)}),
+		serverCertSecretKey: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverDER}),
+		serverKeySecretKey:  pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(serverKey)}),
+	}, nil
+}
+
+// loadServerCert reads the server certificate and key from the Secret.
+func (m *certManager) loadServerCert() (tls.Certificate, error) {
+	secret, err := m.client.CoreV1().Secrets(m.namespace).Get(context.TODO(), m.secretName, metav1.GetOptions{})
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(secret.Data[serverCertSecretKey], secret.Data[serverKeySecretKey])
+}
+
+// loadCABundle reads the CA bundle from the Secret, which is empty if the Secret doesn't exist yet.
+func (m *certManager) loadCABundle() ([]byte, error) {
+	secret, err := m.client.CoreV1().Secrets(m.namespace).Get(context.TODO(), m.secretName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return caBundleOf(secret), nil
+}
+
+// caBundleOf returns the CA bundle of the given Secret, which is only the CA certificate if the Secret was
+// created by hack/gencerts.sh.
+func caBundleOf(secret *corev1.Secret) []byte {
+	if bundle := secret.Data[caBundleSecretKey]; len(bytes.TrimSpace(bundle)) > 0 {
+		return bundle
+	}
+	return secret.Data[caCertSecretKey]
+}
+
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no PEM-encoded certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func newSerialNumber() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	arv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func verifyServerCert(t *testing.T, serverCert []byte, caBundle []byte, dnsName string, now time.Time) {
+	cert, err := parseCertificate(serverCert)
+	if !assert.NoError(t, err) {
+		return
+	}
+	roots := x509.NewCertPool()
+	assert.True(t, roots.AppendCertsFromPEM(caBundle))
+	_, err = cert.Verify(x509.VerifyOptions{DNSName: dnsName, Roots: roots, CurrentTime: now})
+	assert.NoError(t, err)
+}
+
+func TestCertManagerEnsureCerts(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	manager := newCertManager(client, "spark-operator", "spark-webhook-certs", "spark-webhook", 365*24*time.Hour, 30*24*time.Hour)
+
+	// The certificates are generated if the Secret doesn't exist.
+	caBundle, err := manager.ensureCerts()
+	assert.NoError(t, err)
+	secret, err := client.CoreV1().Secrets("spark-operator").Get(context.TODO(), "spark-webhook-certs", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, secret.Data[caCertSecretKey], caBundle)
+	verifyServerCert(t, secret.Data[serverCertSecretKey], caBundle, "spark-webhook.spark-operator.svc", time.Now())
+	_, err = manager.loadServerCert()
+	assert.NoError(t, err)
+	loaded, err := manager.loadCABundle()
+	assert.NoError(t, err)
+	assert.Equal(t, caBundle, loaded)
+
+	// Valid certificates are kept.
+	again, err := manager.ensureCerts()
+	assert.NoError(t, err)
+	assert.Equal(t, caBundle, again)
+
+	// Certificates expiring soon are staged, and their CA is trusted along with the current one, while the
+	// current server certificate is still served.
+	serverCert := secret.Data[serverCertSecretKey]
+	manager.now = func() time.Time { return time.Now().Add(340 * 24 * time.Hour) }
+	staged, err := manager.ensureCerts()
+	assert.NoError(t, err)
+	secret, err = client.CoreV1().Secrets("spark-operator").Get(context.TODO(), "spark-webhook-certs", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, serverCert, secret.Data[serverCertSecretKey])
+	stagedCA := secret.Data[stagedSecretKeyPrefix+caCertSecretKey]
+	assert.Equal(t, append(append([]byte{}, caBundle...), stagedCA...), staged)
+	verifyServerCert(t, secret.Data[stagedSecretKeyPrefix+serverCertSecretKey], staged, "spark-webhook.spark-operator.svc", manager.now())
+	loadedStagedCA, err := manager.stagedCACert()
+	assert.NoError(t, err)
+	assert.Equal(t, stagedCA, loadedStagedCA)
+
+	// Staged certificates are kept until the server certificate is switched to them.
+	again, err = manager.ensureCerts()
+	assert.NoError(t, err)
+	assert.Equal(t, staged, again)
+
+	// Once switched, the staged certificates are served, and the previous CA is still trusted.
+	assert.NoError(t, manager.switchCerts())
+	secret, err = client.CoreV1().Secrets("spark-operator").Get(context.TODO(), "spark-webhook-certs", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, stagedCA, secret.Data[caCertSecretKey])
+	assert.Nil(t, stagedCACert(secret))
+	rotated, err := manager.ensureCerts()
+	assert.NoError(t, err)
+	assert.Equal(t, append(append([]byte{}, stagedCA...), caBundle...), rotated)
+	verifyServerCert(t, secret.Data[serverCertSecretKey], stagedCA, "spark-webhook.spark-operator.svc", manager.now())
+
+	// Certificates not valid for the Service are generated again.
+	other := newCertManager(client, "spark-operator", "spark-webhook-certs", "other-webhook", 365*24*time.Hour, 30*24*time.Hour)
+	assert.Contains(t, other.renewalReason(secret), "isn't valid for other-webhook")
+}
+
+func TestCertManagerLoadCABundleWithoutSecret(t *testing.T) {
+	manager := newCertManager(fake.NewSimpleClientset(), "spark-operator", "spark-webhook-certs", "spark-webhook", time.Hour, time.Minute)
+	caBundle, err := manager.loadCABundle()
+	assert.NoError(t, err)
+	assert.Empty(t, caBundle)
+
+	provider := newSecretCertProvider(manager, time.Hour)
+	defer provider.Stop()
+	_, err = provider.tlsConfig().GetCertificate(nil)
+	assert.Error(t, err)
+
+	// The certificate is loaded once it is generated, without reading the Secret on every handshake.
+	_, err = manager.ensureCerts()
+	assert.NoError(t, err)
+	_, err = provider.tlsConfig().GetCertificate(nil)
+	assert.Error(t, err)
+	provider.lastMissingCertReload = time.Now().Add(-missingCertReloadInterval)
+	cert, err := provider.tlsConfig().GetCertificate(nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, cert)
+}
+
+func TestUpdateCABundle(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&arv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "spark-webhook-config"},
+			Webhooks:   []arv1.MutatingWebhook{{Name: webhookName, ClientConfig: arv1.WebhookClientConfig{CABundle: []byte("old")}}},
+		},
+		&arv1.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "spark-webhook-config"},
+			Webhooks:   []arv1.ValidatingWebhook{{Name: quotaWebhookName, ClientConfig: arv1.WebhookClientConfig{CABundle: []byte("old")}}},
+		})
+	hook := &WebHook{clientset: client, enableResourceQuotaEnforcement: true}
+
+	assert.NoError(t, hook.updateCABundle("spark-webhook-config", []byte("new")))
+	mutating, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), "spark-webhook-config", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("new"), mutating.Webhooks[0].ClientConfig.CABundle)
+	validating, err := client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(context.TODO(), "spark-webhook-config", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("new"), validating.Webhooks[0].ClientConfig.CABundle)
+
+	// Missing configurations are left to the registration of the webhook.
+	assert.NoError(t, hook.updateCABundle("other-config", []byte("new")))
+}
+
+func TestRotateCerts(t *testing.T) {
+	webhookConfigName := userConfig.webhookConfigName
+	userConfig.webhookConfigName = "spark-webhook-config"
+	defer func() { userConfig.webhookConfigName = webhookConfigName }()
+
+	client := fake.NewSimpleClientset(&arv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "spark-webhook-config"},
+		Webhooks:   []arv1.MutatingWebhook{{Name: webhookName}},
+	})
+	manager := newCertManager(client, "spark-operator", "spark-webhook-certs", "spark-webhook", 365*24*time.Hour, 30*24*time.Hour)
+	provider := newSecretCertProvider(manager, time.Hour)
+	defer provider.Stop()
+	hook := &WebHook{clientset: client, certManager: manager, certProvider: provider}
+	getCABundle := func() []byte {
+		config, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), "spark-webhook-config", metav1.GetOptions{})
+		assert.NoError(t, err)
+		return config.Webhooks[0].ClientConfig.CABundle
+	}
+	getServedCert := func() []byte {
+		cert, err := provider.tlsConfig().GetCertificate(nil)
+		assert.NoError(t, err)
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	}
+	getSecret := func() *corev1.Secret {
+		secret, err := client.CoreV1().Secrets("spark-operator").Get(context.TODO(), "spark-webhook-certs", metav1.GetOptions{})
+		assert.NoError(t, err)
+		return secret
+	}
+
+	hook.rotateCerts()
+	caCert := getSecret().Data[caCertSecretKey]
+	serverCert := getSecret().Data[serverCertSecretKey]
+	assert.Equal(t, caCert, getCABundle())
+	assert.Equal(t, serverCert, getServedCert())
+
+	// The first pass of a rotation only adds the new CA to the caBundle.
+	manager.now = func() time.Time { return time.Now().Add(340 * 24 * time.Hour) }
+	hook.rotateCerts()
+	stagedCA := getSecret().Data[stagedSecretKeyPrefix+caCertSecretKey]
+	assert.NotNil(t, stagedCA)
+	assert.Equal(t, append(append([]byte{}, caCert...), stagedCA...), getCABundle())
+	assert.Equal(t, serverCert, getServedCert())
+
+	// The server certificate isn't switched while the caBundle doesn't trust the new CA.
+	assert.NoError(t, hook.updateCABundle("spark-webhook-config", caCert))
+	hook.rotateCerts()
+	assert.Equal(t, serverCert, getServedCert())
+	assert.Equal(t, append(append([]byte{}, caCert...), stagedCA...), getCABundle())
+
+	// A later pass switches the server certificate, and keeps trusting the previous CA.
+	hook.rotateCerts()
+	secret := getSecret()
+	assert.Equal(t, stagedCA, secret.Data[caCertSecretKey])
+	assert.Equal(t, secret.Data[serverCertSecretKey], getServedCert())
+	assert.Equal(t, append(append([]byte{}, stagedCA...), caCert...), getCABundle())
+}
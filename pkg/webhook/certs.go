@@ -18,6 +18,7 @@ package webhook
 
 import (
 	"crypto/tls"
+	"fmt"
 	"io/ioutil"
 	"sync"
 	"time"
@@ -25,17 +26,26 @@ import (
 	"github.com/golang/glog"
 )
 
+// missingCertReloadInterval is how often a missing certificate is reloaded from its Secret at most during TLS
+// handshakes, so that handshakes don't all read the Secret from the API server until the leader generates it.
+const missingCertReloadInterval = 5 * time.Second
+
 // certProvider is a container of a X509 certificate file and a corresponding key file for the
 // webhook server, and a CA certificate file for the API server to verify the server certificate.
+// Alternatively, it reads the certificates from a Secret managed by a certManager.
 type certProvider struct {
 	serverCertFile   string
 	serverKeyFile    string
 	caCertFile       string
+	certSecret       *certManager
 	reloadInterval   time.Duration
 	ticker           *time.Ticker
 	stopChannel      chan interface{}
 	currentCert      *tls.Certificate
 	certPointerMutex *sync.RWMutex
+	// lastMissingCertReload is when a missing certificate was last reloaded during a TLS handshake.
+	lastMissingCertReload time.Time
+	reloadMutex           sync.Mutex
 }
 
 func NewCertProvider(serverCertFile, serverKeyFile, caCertFile string, reloadInterval time.Duration) (*certProvider, error) {
@@ -55,6 +65,21 @@ func NewCertProvider(serverCertFile, serverKeyFile, caCertFile string, reloadInt
 	}, nil
 }
 
+// newSecretCertProvider creates a certProvider reading the certificates from the Secret of the given
+// certManager. The Secret may not exist yet, in which case the webhook server has no certificate until
+// the leader generates it.
+func newSecretCertProvider(manager *certManager, reloadInterval time.Duration) *certProvider {
+	provider := &certProvider{
+		certSecret:       manager,
+		reloadInterval:   reloadInterval,
+		stopChannel:      make(chan interface{}),
+		ticker:           time.NewTicker(reloadInterval),
+		certPointerMutex: &sync.RWMutex{},
+	}
+	provider.updateCert()
+	return provider
+}
+
 func (c *certProvider) Start() {
 	go func() {
 		for {
@@ -72,28 +97,70 @@ func (c *certProvider) tlsConfig() *tls.Config {
 	return &tls.Config{
 		GetCertificate: func(ch *tls.ClientHelloInfo) (*tls.Certificate, error) {
 			c.certPointerMutex.RLock()
-			defer c.certPointerMutex.RUnlock()
-			return c.currentCert, nil
+			cert := c.currentCert
+			c.certPointerMutex.RUnlock()
+			if cert == nil && c.certSecret != nil && c.missingCertReloadDue() {
+				// The leader may have generated the certificate since the last reload.
+				c.updateCert()
+				c.certPointerMutex.RLock()
+				cert = c.currentCert
+				c.certPointerMutex.RUnlock()
+			}
+			if cert == nil {
+				return nil, fmt.Errorf("the webhook server certificate is not available yet")
+			}
+			return cert, nil
 		},
 	}
 }
 
+// missingCertReloadDue tells if a missing certificate is due to be reloaded during a TLS handshake, in which
+// case the time of the reload is recorded.
+func (c *certProvider) missingCertReloadDue() bool {
+	c.reloadMutex.Lock()
+	defer c.reloadMutex.Unlock()
+	now := time.Now()
+	if now.Sub(c.lastMissingCertReload) < missingCertReloadInterval {
+		return false
+	}
+	c.lastMissingCertReload = now
+	return true
+}
+
 func (c *certProvider) Stop() {
 	close(c.stopChannel)
 	c.ticker.Stop()
 }
 
 func (c *certProvider) updateCert() {
-	cert, err := tls.LoadX509KeyPair(c.serverCertFile, c.serverKeyFile)
-	if err != nil {
-		glog.Errorf("could not reload certificate %s (key %s): %v", c.serverCertFile, c.serverKeyFile, err)
-		return
+	var cert tls.Certificate
+	var err error
+	if c.certSecret != nil {
+		cert, err = c.certSecret.loadServerCert()
+		if err != nil {
+			glog.Errorf("could not load certificate from secret %s/%s: %v", c.certSecret.namespace, c.certSecret.secretName, err)
+			return
+		}
+	} else {
+		cert, err = tls.LoadX509KeyPair(c.serverCertFile, c.serverKeyFile)
+		if err != nil {
+			glog.Errorf("could not reload certificate %s (key %s): %v", c.serverCertFile, c.serverKeyFile, err)
+			return
+		}
 	}
 	c.certPointerMutex.Lock()
 	c.currentCert = &cert
 	c.certPointerMutex.Unlock()
 }
 
+// caBundle returns the PEM-encoded CA certificates for the API server to verify the server certificate.
+func (c *certProvider) caBundle() ([]byte, error) {
+	if c.certSecret != nil {
+		return c.certSecret.loadCABundle()
+	}
+	return readCertFile(c.caCertFile)
+}
+
 func readCertFile(certFile string) ([]byte, error) {
 	return ioutil.ReadFile(certFile)
 }
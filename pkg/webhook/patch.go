@@ -18,9 +18,11 @@ package webhook
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 
+	jsonpatch "github.com/evanphx/json-patch"
 	"github.com/golang/glog"
 
 	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
@@ -112,6 +114,34 @@ func patchSparkPod(pod *corev1.Pod, app *v1beta2.SparkApplication, client kubern
 	return patchOps
 }
 
+// PatchSparkPod returns a copy of the given pod with the patches the webhook makes to pods of the given
+// application applied, without admitting anything. The client is only used to read the Spark ConfigMap.
+func PatchSparkPod(pod *corev1.Pod, app *v1beta2.SparkApplication, client kubernetes.Interface) (*corev1.Pod, error) {
+	patchOps := patchSparkPod(pod.DeepCopy(), app, client)
+	patchBytes, err := json.Marshal(patchOps)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := jsonpatch.DecodePatch(patchBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	original, err := json.Marshal(pod)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := patch.Apply(original)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply the patches to pod %s/%s: %v", pod.Namespace, pod.Name, err)
+	}
+	patchedPod := &corev1.Pod{}
+	if err := json.Unmarshal(patched, patchedPod); err != nil {
+		return nil, err
+	}
+	return patchedPod, nil
+}
+
 func addOwnerReference(pod *corev1.Pod, app *v1beta2.SparkApplication) patchOperation {
 	ownerReference := util.GetOwnerReference(app)
 
@@ -512,6 +542,14 @@ func addTolerations(pod *corev1.Pod, app *v1beta2.SparkApplication) []patchOpera
 	} else if util.IsExecutorPod(pod) {
 		tolerations = app.Spec.Executor.SparkPodSpec.Tolerations
 	}
+	if value := getPodAnnotation(pod, app, config.TolerationsAnnotation); value != "" {
+		var batchSchedulerTolerations []corev1.Toleration
+		if err := json.Unmarshal([]byte(value), &batchSchedulerTolerations); err != nil {
+			glog.Errorf("failed to parse annotation %s of pod %s/%s: %v", config.TolerationsAnnotation, pod.Namespace, pod.Name, err)
+		} else {
+			tolerations = append(append([]corev1.Toleration{}, tolerations...), batchSchedulerTolerations...)
+		}
+	}
 
 	first := false
 	if len(pod.Spec.Tolerations) == 0 {
@@ -535,6 +573,21 @@ func addNodeSelectors(pod *corev1.Pod, app *v1beta2.SparkApplication) []patchOpe
 	} else if util.IsExecutorPod(pod) {
 		nodeSelector = app.Spec.Executor.NodeSelector
 	}
+	if value := getPodAnnotation(pod, app, config.NodeSelectorAnnotation); value != "" {
+		var batchSchedulerNodeSelector map[string]string
+		if err := json.Unmarshal([]byte(value), &batchSchedulerNodeSelector); err != nil {
+			glog.Errorf("failed to parse annotation %s of pod %s/%s: %v", config.NodeSelectorAnnotation, pod.Namespace, pod.Name, err)
+		} else if len(batchSchedulerNodeSelector) > 0 {
+			// The node selector Spark set on the pod is kept, as the one of the batch scheduler only adds to it.
+			merged := make(map[string]string)
+			for _, selector := range []map[string]string{pod.Spec.NodeSelector, nodeSelector, batchSchedulerNodeSelector} {
+				for key, value := range selector {
+					merged[key] = value
+				}
+			}
+			nodeSelector = merged
+		}
+	}
 
 	var ops []patchOperation
 	if len(nodeSelector) > 0 {
@@ -562,20 +615,37 @@ func addDNSConfig(pod *corev1.Pod, app *v1beta2.SparkApplication) []patchOperati
 func addSchedulerName(pod *corev1.Pod, app *v1beta2.SparkApplication) *patchOperation {
 	var schedulerName *string
 
-	//NOTE: Preferred to use `BatchScheduler` if application spec has it configured.
-	if app.Spec.BatchScheduler != nil {
-		schedulerName = app.Spec.BatchScheduler
-	} else if util.IsDriverPod(pod) {
+	if util.IsDriverPod(pod) {
 		schedulerName = app.Spec.Driver.SchedulerName
 	} else if util.IsExecutorPod(pod) {
 		schedulerName = app.Spec.Executor.SchedulerName
 	}
+
+	//NOTE: The scheduler the batch scheduler of the application has the pod scheduled by takes precedence.
+	if value := getPodAnnotation(pod, app, config.SchedulerNameAnnotation); value != "" {
+		schedulerName = &value
+	}
 	if schedulerName == nil || *schedulerName == "" {
 		return nil
 	}
 	return &patchOperation{Op: "add", Path: "/spec/schedulerName", Value: *schedulerName}
 }
 
+// getPodAnnotation returns the value of the annotation with the given key of the given pod. Pods patched before
+// Spark creates them, e.g., into pod templates, don't carry the annotations of the application yet, which are then
+// looked up on its driver or executor.
+func getPodAnnotation(pod *corev1.Pod, app *v1beta2.SparkApplication, key string) string {
+	if value, ok := pod.Annotations[key]; ok {
+		return value
+	}
+	if util.IsDriverPod(pod) {
+		return app.Spec.Driver.Annotations[key]
+	} else if util.IsExecutorPod(pod) {
+		return app.Spec.Executor.Annotations[key]
+	}
+	return ""
+}
+
 func addPriorityClassName(pod *corev1.Pod, app *v1beta2.SparkApplication) []patchOperation {
 	var priorityClassName *string
 
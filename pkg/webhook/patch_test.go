@@ -29,6 +29,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 	kubeclientfake "k8s.io/client-go/kubernetes/fake"
 )
 
@@ -439,7 +440,15 @@ func TestPatchSparkPod_SparkConfigMap(t *testing.T) {
 		},
 	}
 
-	modifiedPod, err := getModifiedPod(pod, app)
+	sparkConfMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: sparkConfMapName,
+		},
+		Data: map[string]string{
+			"spark-defaults.conf": "spark.ui.enabled true",
+		},
+	}
+	modifiedPod, err := getModifiedPodWithClient(pod, app, kubeclientfake.NewSimpleClientset(sparkConfMap))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -448,7 +457,8 @@ func TestPatchSparkPod_SparkConfigMap(t *testing.T) {
 	assert.Equal(t, config.SparkConfigMapVolumeName, modifiedPod.Spec.Volumes[0].Name)
 	assert.True(t, modifiedPod.Spec.Volumes[0].ConfigMap != nil)
 	assert.Equal(t, 1, len(modifiedPod.Spec.Containers[0].VolumeMounts))
-	assert.Equal(t, config.DefaultSparkConfDir, modifiedPod.Spec.Containers[0].VolumeMounts[0].MountPath)
+	assert.Equal(t, config.DefaultSparkConfDir+"/spark-defaults.conf", modifiedPod.Spec.Containers[0].VolumeMounts[0].MountPath)
+	assert.Equal(t, "spark-defaults.conf", modifiedPod.Spec.Containers[0].VolumeMounts[0].SubPath)
 	assert.Equal(t, 1, len(modifiedPod.Spec.Containers[0].Env))
 	assert.Equal(t, config.DefaultSparkConfDir, modifiedPod.Spec.Containers[0].Env[0].Value)
 }
@@ -774,6 +784,22 @@ func TestPatchSparkPod_SchedulerName(t *testing.T) {
 	}
 	//Executor scheduler name should remain the same as before when not specified in SparkApplicationSpec
 	assert.Equal(t, defaultScheduler, modifiedExecutorPod.Spec.SchedulerName)
+
+	//The scheduler the batch scheduler records on the pods takes precedence over the one of the application.
+	driverPod.Annotations = map[string]string{config.SchedulerNameAnnotation: "volcano"}
+	modifiedDriverPod, err = getModifiedPod(driverPod, app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "volcano", modifiedDriverPod.Spec.SchedulerName)
+
+	//Pods patched before Spark creates them get it from the application.
+	app.Spec.Executor.Annotations = map[string]string{config.SchedulerNameAnnotation: "scheduler-plugins-scheduler"}
+	modifiedExecutorPod, err = getModifiedPod(executorPod, app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "scheduler-plugins-scheduler", modifiedExecutorPod.Spec.SchedulerName)
 }
 
 func TestPatchSparkPod_PriorityClassName(t *testing.T) {
@@ -1187,6 +1213,58 @@ func TestPatchSparkPod_NodeSector(t *testing.T) {
 	assert.Equal(t, "secondvalue", modifiedExecutorPod.Spec.NodeSelector["secondkey"])
 }
 
+func TestPatchSparkPod_BatchSchedulerPlacement(t *testing.T) {
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "spark-test",
+			UID:  "spark-test-1",
+		},
+		Spec: v1beta2.SparkApplicationSpec{
+			Driver: v1beta2.DriverSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					NodeSelector: map[string]string{"disk": "ssd"},
+					Tolerations:  []corev1.Toleration{{Key: "Key1", Operator: corev1.TolerationOpExists}},
+				},
+			},
+		},
+	}
+
+	driverPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "spark-driver",
+			Labels: map[string]string{
+				config.SparkRoleLabel:               config.SparkDriverRole,
+				config.LaunchedBySparkOperatorLabel: "true",
+			},
+			Annotations: map[string]string{
+				config.NodeSelectorAnnotation: `{"instance-type":"spot"}`,
+				config.TolerationsAnnotation:  `[{"key":"spot","operator":"Exists"}]`,
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeSelector: map[string]string{"pool": "spark"},
+			Containers: []corev1.Container{
+				{
+					Name:  config.SparkDriverContainerName,
+					Image: "spark-driver:latest",
+				},
+			},
+		},
+	}
+
+	// The node selector and tolerations recorded by the batch scheduler add to the ones of the pod.
+	modifiedDriverPod, err := getModifiedPod(driverPod, app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]string{"pool": "spark", "disk": "ssd", "instance-type": "spot"}, modifiedDriverPod.Spec.NodeSelector)
+	assert.Equal(t, []corev1.Toleration{
+		{Key: "Key1", Operator: corev1.TolerationOpExists},
+		{Key: "spot", Operator: corev1.TolerationOpExists},
+	}, modifiedDriverPod.Spec.Tolerations)
+	assert.Len(t, app.Spec.Driver.Tolerations, 1)
+}
+
 func TestPatchSparkPod_GPU(t *testing.T) {
 	cpuLimit := int64(10)
 	cpuRequest := int64(5)
@@ -1792,8 +1870,11 @@ func TestPatchSparkPod_Lifecycle(t *testing.T) {
 }
 
 func getModifiedPod(pod *corev1.Pod, app *v1beta2.SparkApplication) (*corev1.Pod, error) {
-	fakeClient := kubeclientfake.NewSimpleClientset()
-	patchOps := patchSparkPod(pod.DeepCopy(), app, fakeClient)
+	return getModifiedPodWithClient(pod, app, kubeclientfake.NewSimpleClientset())
+}
+
+func getModifiedPodWithClient(pod *corev1.Pod, app *v1beta2.SparkApplication, client kubernetes.Interface) (*corev1.Pod, error) {
+	patchOps := patchSparkPod(pod.DeepCopy(), app, client)
 	patchBytes, err := json.Marshal(patchOps)
 	if err != nil {
 		return nil, err
@@ -1819,6 +1900,59 @@ func getModifiedPod(pod *corev1.Pod, app *v1beta2.SparkApplication) (*corev1.Pod
 	return modifiedPod, nil
 }
 
+func TestPatchSparkPod(t *testing.T) {
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "spark-test",
+			UID:  "spark-test-1",
+		},
+		Spec: v1beta2.SparkApplicationSpec{
+			Driver: v1beta2.DriverSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					NodeSelector: map[string]string{"disk": "ssd"},
+					Env:          []corev1.EnvVar{{Name: "FOO", Value: "bar"}},
+					Tolerations:  []corev1.Toleration{{Key: "spark", Operator: corev1.TolerationOpExists}},
+				},
+			},
+		},
+	}
+
+	driverPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "spark-driver",
+			Labels: map[string]string{
+				config.SparkRoleLabel:               config.SparkDriverRole,
+				config.LaunchedBySparkOperatorLabel: "true",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  config.SparkDriverContainerName,
+					Image: "spark-driver:latest",
+				},
+			},
+		},
+	}
+	original := driverPod.DeepCopy()
+
+	// The pod is patched the way the webhook patches it, without being changed itself.
+	patchedPod, err := PatchSparkPod(driverPod, app, kubeclientfake.NewSimpleClientset())
+	if err != nil {
+		t.Fatal(err)
+	}
+	modifiedPod, err := getModifiedPod(driverPod, app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, modifiedPod, patchedPod)
+	assert.Equal(t, original, driverPod)
+	assert.Equal(t, 1, len(patchedPod.OwnerReferences))
+	assert.Equal(t, "ssd", patchedPod.Spec.NodeSelector["disk"])
+	assert.Equal(t, 1, len(patchedPod.Spec.Tolerations))
+	assert.Equal(t, "bar", patchedPod.Spec.Containers[0].Env[0].Value)
+}
+
 func TestPatchSparkPod_HostAliases(t *testing.T) {
 	app := &v1beta2.SparkApplication{
 		ObjectMeta: metav1.ObjectMeta{
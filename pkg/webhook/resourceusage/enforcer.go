@@ -6,6 +6,7 @@ import (
 	crdinformers "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/informers/externalversions"
 	"github.com/golang/glog"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/informers"
 	corev1informers "k8s.io/client-go/informers/core/v1"
@@ -17,8 +18,8 @@ type ResourceQuotaEnforcer struct {
 	resourceQuotaInformer corev1informers.ResourceQuotaInformer
 }
 
-func NewResourceQuotaEnforcer(crdInformerFactory crdinformers.SharedInformerFactory, coreV1InformerFactory informers.SharedInformerFactory) ResourceQuotaEnforcer {
-	resourceUsageWatcher := newResourceUsageWatcher(crdInformerFactory, coreV1InformerFactory)
+func NewResourceQuotaEnforcer(crdInformerFactory crdinformers.SharedInformerFactory, coreV1InformerFactory informers.SharedInformerFactory, dynamicAllocationCharge DynamicAllocationCharge) ResourceQuotaEnforcer {
+	resourceUsageWatcher := newResourceUsageWatcher(crdInformerFactory, coreV1InformerFactory, dynamicAllocationCharge)
 	informer := coreV1InformerFactory.Core().V1().ResourceQuotas()
 	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{})
 	return ResourceQuotaEnforcer{
@@ -36,60 +37,88 @@ func (r ResourceQuotaEnforcer) WaitForCacheSync(stopCh <-chan struct{}) error {
 	return nil
 }
 
-func (r *ResourceQuotaEnforcer) admitResource(kind, namespace, name string, requestedResources ResourceList) (string, error) {
+func (r *ResourceQuotaEnforcer) admitResource(kind, namespace, name string, requestedResources ResourceList, scope usageScope) (string, error) {
 	glog.V(2).Infof("Processing admission request for %s %s/%s, requesting: %s", kind, namespace, name, requestedResources)
 	resourceQuotas, err := r.resourceQuotaInformer.Lister().ResourceQuotas(namespace).List(labels.Everything())
 	if err != nil {
 		return "", err
 	}
-	if (requestedResources.cpu.IsZero() && requestedResources.memory.IsZero()) || len(resourceQuotas) == 0 {
+	if requestedResources.isZero() || len(resourceQuotas) == 0 {
 		return "", nil
 	}
 
-	currentNamespaceUsage, currentApplicationUsage := r.watcher.GetCurrentResourceUsageWithApplication(namespace, kind, name)
+	namespaceUsage, namespaceApplicationUsage := r.watcher.GetCurrentResourceUsageWithApplication(namespace, kind, name)
 
 	for _, quota := range resourceQuotas {
-		// Scope selectors not currently supported, ignore any ResourceQuota that does not match everything.
+		currentNamespaceUsage, currentApplicationUsage := namespaceUsage, namespaceApplicationUsage
+		// A scoped ResourceQuota only counts the usage of objects in its scope.
 		if quota.Spec.ScopeSelector != nil || len(quota.Spec.Scopes) > 0 {
-			continue
-		}
-
-		// If an existing application has increased its usage, check it against the quota again. If its usage hasn't increased, always allow it.
-		if requestedResources.cpu.Cmp(currentApplicationUsage.cpu) == 1 {
-			if cpuLimit, present := quota.Spec.Hard[corev1.ResourceCPU]; present {
-				availableCpu := cpuLimit
-				availableCpu.Sub(currentNamespaceUsage.cpu)
-				if requestedResources.cpu.Cmp(availableCpu) == 1 {
-					return fmt.Sprintf("%s %s/%s requests too many cores (%.3f cores requested, %.3f available).", kind, namespace, name, float64(requestedResources.cpu.MilliValue())/1000.0, float64(availableCpu.MilliValue())/1000.0), nil
-				}
+			if !quotaMatchesScope(quota, scope) {
+				continue
 			}
+			currentNamespaceUsage, currentApplicationUsage = r.watcher.GetCurrentResourceUsageInScope(namespace, kind, name, func(s usageScope) bool {
+				return quotaMatchesScope(quota, s)
+			})
 		}
 
-		if requestedResources.memory.Cmp(currentApplicationUsage.memory) == 1 {
-			if memoryLimit, present := quota.Spec.Hard[corev1.ResourceMemory]; present {
-				availableMemory := memoryLimit
-				availableMemory.Sub(currentNamespaceUsage.memory)
-				if requestedResources.memory.Cmp(availableMemory) == 1 {
-					return fmt.Sprintf("%s %s/%s requests too much memory (%dMi requested, %dMi available).", kind, namespace, name, requestedResources.memory.Value()/(1<<20), availableMemory.Value()/(1<<20)), nil
-				}
+		for _, resourceName := range sortedResourceNames(quota.Spec.Hard) {
+			used, tracked := currentNamespaceUsage.quotaUsage(resourceName)
+			if !tracked {
+				continue
+			}
+			requested, _ := requestedResources.quotaUsage(resourceName)
+			current, _ := currentApplicationUsage.quotaUsage(resourceName)
+			// If an existing application has increased its usage, check it against the quota again. If its usage hasn't increased, always allow it.
+			if requested.Cmp(current) != 1 {
+				continue
+			}
+			available := quota.Spec.Hard[resourceName].DeepCopy()
+			available.Sub(used)
+			if requested.Cmp(available) == 1 {
+				return quotaExceededMessage(kind, namespace, name, resourceName, requested, available), nil
 			}
 		}
 	}
 	return "", nil
 }
 
+func quotaExceededMessage(kind, namespace, name string, resourceName corev1.ResourceName, requested, available resource.Quantity) string {
+	switch resourceName {
+	case corev1.ResourceCPU, corev1.ResourceRequestsCPU:
+		return fmt.Sprintf("%s %s/%s requests too many cores (%.3f cores requested, %.3f available).", kind, namespace, name, float64(requested.MilliValue())/1000.0, float64(available.MilliValue())/1000.0)
+	case corev1.ResourceMemory, corev1.ResourceRequestsMemory:
+		return fmt.Sprintf("%s %s/%s requests too much memory (%dMi requested, %dMi available).", kind, namespace, name, requested.Value()/(1<<20), available.Value()/(1<<20))
+	}
+	return fmt.Sprintf("%s %s/%s exceeds the quota of %s (%s requested, %s available).", kind, namespace, name, resourceName, requested.String(), available.String())
+}
+
 func (r *ResourceQuotaEnforcer) AdmitSparkApplication(app so.SparkApplication) (string, error) {
-	resourceUsage, err := sparkApplicationResourceUsage(app)
+	resourceUsage, err := sparkApplicationResourceUsage(app, r.watcher.dynamicAllocationCharge)
 	if err != nil {
 		return "", err
 	}
-	return r.admitResource(KindSparkApplication, app.ObjectMeta.Namespace, app.ObjectMeta.Name, resourceUsage)
+	return r.admitResource(KindSparkApplication, app.ObjectMeta.Namespace, app.ObjectMeta.Name, resourceUsage, sparkApplicationScope(app.Spec))
 }
 
 func (r *ResourceQuotaEnforcer) AdmitScheduledSparkApplication(app so.ScheduledSparkApplication) (string, error) {
-	resourceUsage, err := scheduledSparkApplicationResourceUsage(app)
+	resourceUsage, err := scheduledSparkApplicationResourceUsage(app, r.watcher.dynamicAllocationCharge)
+	if err != nil {
+		return "", err
+	}
+	return r.admitResource(KindScheduledSparkApplication, app.ObjectMeta.Namespace, app.ObjectMeta.Name, resourceUsage, sparkApplicationScope(app.Spec.Template))
+}
+
+// AdmitExecutorPod admits an executor pod of the given SparkApplication. Executors beyond those charged for the
+// application when it was admitted, e.g., requested by dynamic allocation, must fit into the ResourceQuotas of
+// the namespace.
+func (r *ResourceQuotaEnforcer) AdmitExecutorPod(pod *corev1.Pod, app so.SparkApplication) (string, error) {
+	namespace := namespaceOrDefault(app.ObjectMeta)
+	if r.watcher.reserveExecutorWithinCharge(namespace, app.Name, pod.Name, sparkApplicationChargedExecutors(app, r.watcher.dynamicAllocationCharge)) {
+		return "", nil
+	}
+	resourceUsage, err := executorResourceUsage(app.Spec, 1)
 	if err != nil {
 		return "", err
 	}
-	return r.admitResource(KindScheduledSparkApplication, app.ObjectMeta.Namespace, app.ObjectMeta.Name, resourceUsage)
+	return r.admitResource("Pod", namespace, pod.Name, resourceUsage, sparkApplicationScope(app.Spec))
 }
@@ -0,0 +1,370 @@
+package resourceusage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	kubeclientfake "k8s.io/client-go/kubernetes/fake"
+
+	so "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	crdclientfake "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/clientset/versioned/fake"
+	crdinformers "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/informers/externalversions"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+)
+
+func newTestEnforcer(quotas ...*corev1.ResourceQuota) ResourceQuotaEnforcer {
+	crdInformerFactory := crdinformers.NewSharedInformerFactory(crdclientfake.NewSimpleClientset(), 0)
+	coreV1InformerFactory := informers.NewSharedInformerFactory(kubeclientfake.NewSimpleClientset(), 0)
+	enforcer := NewResourceQuotaEnforcer(crdInformerFactory, coreV1InformerFactory, DynamicAllocationChargeMax)
+	for _, quota := range quotas {
+		enforcer.resourceQuotaInformer.Informer().GetIndexer().Add(quota)
+	}
+	return enforcer
+}
+
+func newTestQuota(name string, cpu string, scopes []corev1.ResourceQuotaScope, selector *corev1.ScopeSelector) *corev1.ResourceQuota {
+	return &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: corev1.ResourceQuotaSpec{
+			Hard:          corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)},
+			Scopes:        scopes,
+			ScopeSelector: selector,
+		},
+	}
+}
+
+// newTestApp returns a SparkApplication requesting 2 cores.
+func newTestApp(name string, priorityClassName string) *so.SparkApplication {
+	app := &so.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", ResourceVersion: "1"},
+	}
+	if priorityClassName != "" {
+		app.Spec.BatchSchedulerOptions = &so.BatchSchedulerConfiguration{PriorityClassName: &priorityClassName}
+	}
+	return app
+}
+
+func TestAdmitSparkApplicationWithScopedQuotas(t *testing.T) {
+	highPriority := &corev1.ScopeSelector{MatchExpressions: []corev1.ScopedResourceSelectorRequirement{
+		{ScopeName: corev1.ResourceQuotaScopePriorityClass, Operator: corev1.ScopeSelectorOpIn, Values: []string{"high"}},
+	}}
+	enforcer := newTestEnforcer(
+		newTestQuota("high", "4", nil, highPriority),
+		newTestQuota("best-effort", "0", []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeBestEffort}, nil),
+		newTestQuota("all", "10", nil, nil),
+	)
+
+	enforcer.watcher.onSparkApplicationAdded(newTestApp("a", "high"))
+	enforcer.watcher.onSparkApplicationAdded(newTestApp("b", ""))
+	enforcer.watcher.onPodAdded(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default"},
+		Spec: corev1.PodSpec{
+			PriorityClassName: "high",
+			Containers: []corev1.Container{{
+				Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")}},
+			}},
+		},
+	})
+
+	// 3 of the 4 cores of the high priority quota are used.
+	reason, err := enforcer.AdmitSparkApplication(*newTestApp("c", "high"))
+	assert.NoError(t, err)
+	assert.Equal(t, "SparkApplication default/c requests too many cores (2.000 cores requested, 1.000 available).", reason)
+
+	// Only the unscoped quota applies to applications without a priority class, of which 5 cores are used.
+	reason, err = enforcer.AdmitSparkApplication(*newTestApp("d", ""))
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+
+	// Existing applications whose usage hasn't increased are allowed.
+	reason, err = enforcer.AdmitSparkApplication(*newTestApp("a", "high"))
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+
+	// Moving an application into the scope of a quota counts it against the quota.
+	reason, err = enforcer.AdmitSparkApplication(*newTestApp("b", "high"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, reason)
+}
+
+func TestQuotaMatchesScope(t *testing.T) {
+	type testcase struct {
+		name     string
+		scopes   []corev1.ResourceQuotaScope
+		selector []corev1.ScopedResourceSelectorRequirement
+		scope    usageScope
+		expected bool
+	}
+	testcases := []testcase{
+		{name: "unscoped", scope: usageScope{priorityClassName: "high"}, expected: true},
+		{name: "not terminating", scopes: []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeNotTerminating}, expected: true},
+		{name: "terminating", scopes: []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeTerminating}, expected: false},
+		{name: "best effort", scopes: []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeBestEffort}, scope: usageScope{bestEffort: true}, expected: true},
+		{
+			name:     "not best effort and not terminating",
+			scopes:   []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeNotBestEffort, corev1.ResourceQuotaScopeNotTerminating},
+			scope:    usageScope{terminating: true},
+			expected: false,
+		},
+		{
+			name:     "priority class not in",
+			selector: []corev1.ScopedResourceSelectorRequirement{{ScopeName: corev1.ResourceQuotaScopePriorityClass, Operator: corev1.ScopeSelectorOpNotIn, Values: []string{"low"}}},
+			scope:    usageScope{priorityClassName: "high"},
+			expected: true,
+		},
+		{
+			name:     "priority class exists",
+			selector: []corev1.ScopedResourceSelectorRequirement{{ScopeName: corev1.ResourceQuotaScopePriorityClass, Operator: corev1.ScopeSelectorOpExists}},
+			expected: false,
+		},
+		{
+			name:     "terminating does not exist",
+			selector: []corev1.ScopedResourceSelectorRequirement{{ScopeName: corev1.ResourceQuotaScopeTerminating, Operator: corev1.ScopeSelectorOpDoesNotExist}},
+			expected: true,
+		},
+		{
+			name:     "unsupported scope",
+			selector: []corev1.ScopedResourceSelectorRequirement{{ScopeName: "CrossNamespacePodAffinity", Operator: corev1.ScopeSelectorOpExists}},
+			expected: false,
+		},
+	}
+	for _, test := range testcases {
+		quota := newTestQuota(test.name, "1", test.scopes, nil)
+		if test.selector != nil {
+			quota.Spec.ScopeSelector = &corev1.ScopeSelector{MatchExpressions: test.selector}
+		}
+		assert.Equal(t, test.expected, quotaMatchesScope(quota, test.scope), test.name)
+	}
+}
+
+func TestPodScope(t *testing.T) {
+	var deadline int64 = 60
+	pod := &corev1.Pod{Spec: corev1.PodSpec{
+		PriorityClassName:     "high",
+		ActiveDeadlineSeconds: &deadline,
+		Containers:            []corev1.Container{{Name: "main"}},
+	}}
+	assert.Equal(t, usageScope{priorityClassName: "high", terminating: true, bestEffort: true}, podScope(pod))
+
+	pod.Spec.InitContainers = []corev1.Container{{
+		Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")}},
+	}}
+	assert.False(t, podScope(pod).bestEffort)
+}
+
+func TestAdmitSparkApplicationWithMixedQuotas(t *testing.T) {
+	int32ptr := func(n int32) *int32 { return &n }
+	newApp := func(name string, instances int32, gpus int64, sidecarStorage string) *so.SparkApplication {
+		app := newTestApp(name, "")
+		app.Spec.Executor.Instances = int32ptr(instances)
+		if gpus > 0 {
+			app.Spec.Executor.GPU = &so.GPUSpec{Name: "nvidia.com/gpu", Quantity: gpus}
+		}
+		if sidecarStorage != "" {
+			app.Spec.Executor.Sidecars = []corev1.Container{{
+				Name:      "sidecar",
+				Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse(sidecarStorage)}},
+			}}
+		}
+		return app
+	}
+	quota := &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "mixed", Namespace: "default"},
+		Spec: corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{
+			"requests.nvidia.com/gpu":                               resource.MustParse("4"),
+			corev1.ResourceRequestsEphemeralStorage:                 resource.MustParse("10Gi"),
+			corev1.ResourcePods:                                     resource.MustParse("7"),
+			corev1.ResourceLimitsCPU:                                resource.MustParse("1"),
+			corev1.ResourceServices:                                 resource.MustParse("0"),
+			"count/scheduledsparkapplications.sparkoperator.k8s.io": resource.MustParse("0"),
+		}},
+	}
+	enforcer := newTestEnforcer(quota)
+
+	// 3 GPUs and 3 pods are used by the application, and 8Gi of ephemeral storage and 1 pod by the pod.
+	existing := newApp("a", 2, 1, "")
+	existing.Spec.Driver.GPU = &so.GPUSpec{Name: "nvidia.com/gpu", Quantity: 1}
+	enforcer.watcher.onSparkApplicationAdded(existing)
+	enforcer.watcher.onPodAdded(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default"},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse("8Gi")}},
+		}}},
+	})
+
+	reason, err := enforcer.AdmitSparkApplication(*newApp("gpu", 1, 2, ""))
+	assert.NoError(t, err)
+	assert.Equal(t, "SparkApplication default/gpu exceeds the quota of requests.nvidia.com/gpu (2 requested, 1 available).", reason)
+
+	reason, err = enforcer.AdmitSparkApplication(*newApp("storage", 1, 0, "4Gi"))
+	assert.NoError(t, err)
+	assert.Equal(t, "SparkApplication default/storage exceeds the quota of requests.ephemeral-storage (4Gi requested, 2Gi available).", reason)
+
+	reason, err = enforcer.AdmitSparkApplication(*newApp("pods", 3, 0, ""))
+	assert.NoError(t, err)
+	assert.Equal(t, "SparkApplication default/pods exceeds the quota of pods (4 requested, 3 available).", reason)
+
+	// Limits and resources other than those of pods aren't enforced.
+	reason, err = enforcer.AdmitSparkApplication(*newApp("fits", 1, 1, "2Gi"))
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+
+	// Object counts are enforced per kind.
+	reason, err = enforcer.AdmitScheduledSparkApplication(so.ScheduledSparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "scheduled", Namespace: "default"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "ScheduledSparkApplication default/scheduled exceeds the quota of count/scheduledsparkapplications.sparkoperator.k8s.io (1 requested, 0 available).", reason)
+}
+
+func TestAdmitSparkApplicationWithObjectCountQuota(t *testing.T) {
+	enforcer := newTestEnforcer(&corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "count", Namespace: "default"},
+		Spec: corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{
+			"count/sparkapplications.sparkoperator.k8s.io": resource.MustParse("1"),
+		}},
+	})
+	// Completed applications still count.
+	completed := newTestApp("a", "")
+	completed.Status.AppState.State = so.CompletedState
+	enforcer.watcher.onSparkApplicationAdded(completed)
+
+	reason, err := enforcer.AdmitSparkApplication(*newTestApp("b", ""))
+	assert.NoError(t, err)
+	assert.Equal(t, "SparkApplication default/b exceeds the quota of count/sparkapplications.sparkoperator.k8s.io (1 requested, 0 available).", reason)
+
+	reason, err = enforcer.AdmitSparkApplication(*newTestApp("a", ""))
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+}
+
+func newTestDynamicAllocationApp(name string, initialExecutors, maxExecutors int32) *so.SparkApplication {
+	app := newTestApp(name, "")
+	app.Spec.DynamicAllocation = &so.DynamicAllocation{
+		Enabled:          true,
+		InitialExecutors: &initialExecutors,
+		MaxExecutors:     &maxExecutors,
+	}
+	return app
+}
+
+func newTestExecutorPod(app *so.SparkApplication, name string, phase corev1.PodPhase) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: app.Namespace,
+			Labels: map[string]string{
+				config.SparkRoleLabel:               config.SparkExecutorRole,
+				config.SparkAppNameLabel:            app.Name,
+				config.LaunchedBySparkOperatorLabel: "true",
+			},
+		},
+		Status: corev1.PodStatus{Phase: phase},
+	}
+}
+
+func TestAdmitSparkApplicationWithDynamicAllocation(t *testing.T) {
+	app := newTestDynamicAllocationApp("a", 2, 8)
+
+	enforcer := newTestEnforcer(newTestQuota("cpu", "6", nil, nil))
+	reason, err := enforcer.AdmitSparkApplication(*app)
+	assert.NoError(t, err)
+	assert.Equal(t, "SparkApplication default/a requests too many cores (9.000 cores requested, 6.000 available).", reason)
+
+	enforcer.watcher.dynamicAllocationCharge = DynamicAllocationChargeInitial
+	reason, err = enforcer.AdmitSparkApplication(*app)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+}
+
+func TestAdmitExecutorPod(t *testing.T) {
+	enforcer := newTestEnforcer(newTestQuota("cpu", "5", nil, nil))
+	enforcer.watcher.dynamicAllocationCharge = DynamicAllocationChargeInitial
+	// The driver and 2 executors are charged for the application.
+	app := newTestDynamicAllocationApp("a", 2, 8)
+	enforcer.watcher.onSparkApplicationAdded(app)
+	enforcer.watcher.onPodAdded(newTestExecutorPod(app, "exec-1", corev1.PodRunning))
+
+	// Executors are admitted while the charged executors aren't all running, even if the quota is used up.
+	enforcer.watcher.onPodAdded(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default"},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")}},
+		}}},
+	})
+	reason, err := enforcer.AdmitExecutorPod(newTestExecutorPod(app, "exec-2", corev1.PodPending), *app)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+	enforcer.watcher.onPodDeleted(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default"}})
+	enforcer.watcher.onPodAdded(newTestExecutorPod(app, "exec-2", corev1.PodRunning))
+
+	// Executors beyond the charged ones must fit into the quota, and are charged once running.
+	reason, err = enforcer.AdmitExecutorPod(newTestExecutorPod(app, "exec-3", corev1.PodPending), *app)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+	enforcer.watcher.onPodAdded(newTestExecutorPod(app, "exec-3", corev1.PodRunning))
+	enforcer.watcher.onPodAdded(newTestExecutorPod(app, "exec-4", corev1.PodRunning))
+
+	exec5 := newTestExecutorPod(app, "exec-5", corev1.PodPending)
+	reason, err = enforcer.AdmitExecutorPod(exec5, *app)
+	assert.NoError(t, err)
+	assert.Equal(t, "Pod default/exec-5 requests too many cores (1.000 cores requested, 0.000 available).", reason)
+
+	// Other applications can't use the resources of the excess executors either.
+	reason, err = enforcer.AdmitSparkApplication(*newTestApp("b", ""))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, reason)
+
+	// Terminated executors no longer count.
+	enforcer.watcher.onPodUpdated(nil, newTestExecutorPod(app, "exec-4", corev1.PodFailed))
+	reason, err = enforcer.AdmitExecutorPod(exec5, *app)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+}
+
+func TestAdmitExecutorPodReservesCharge(t *testing.T) {
+	enforcer := newTestEnforcer(newTestQuota("cpu", "5", nil, nil))
+	enforcer.watcher.dynamicAllocationCharge = DynamicAllocationChargeInitial
+	// The driver and 2 executors are charged for the application, and the quota is used up.
+	app := newTestDynamicAllocationApp("a", 2, 8)
+	enforcer.watcher.onSparkApplicationAdded(app)
+	enforcer.watcher.onPodAdded(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default"},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")}},
+		}}},
+	})
+
+	// Executors admitted before the informer sees them take the charged executors.
+	for _, name := range []string{"exec-1", "exec-2"} {
+		reason, err := enforcer.AdmitExecutorPod(newTestExecutorPod(app, name, corev1.PodPending), *app)
+		assert.NoError(t, err)
+		assert.Empty(t, reason)
+	}
+	exec3 := newTestExecutorPod(app, "exec-3", corev1.PodPending)
+	reason, err := enforcer.AdmitExecutorPod(exec3, *app)
+	assert.NoError(t, err)
+	assert.Equal(t, "Pod default/exec-3 requests too many cores (1.000 cores requested, 0.000 available).", reason)
+
+	// A pod admitted again, e.g., after its creation was retried, keeps its reservation.
+	reason, err = enforcer.AdmitExecutorPod(newTestExecutorPod(app, "exec-1", corev1.PodPending), *app)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+
+	// Executors seen by the informer count as running instead.
+	enforcer.watcher.onPodAdded(newTestExecutorPod(app, "exec-1", corev1.PodRunning))
+	reason, err = enforcer.AdmitExecutorPod(exec3, *app)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, reason)
+
+	// Reservations of pods the informer never sees expire.
+	enforcer.watcher.now = func() time.Time { return time.Now().Add(2 * executorReservationTimeout) }
+	reason, err = enforcer.AdmitExecutorPod(exec3, *app)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+}
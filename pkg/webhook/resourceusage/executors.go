@@ -0,0 +1,143 @@
+package resourceusage
+
+import (
+	"time"
+
+	so "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// executorReservationTimeout bounds how long an executor pod admitted within the executors charged for its
+// application counts against the charge before the pod informer sees it, e.g., if its creation failed.
+const executorReservationTimeout = time.Minute
+
+// executorCharge is the number of executors of a SparkApplication charged against ResourceQuotas, together with
+// what is needed to charge executors created beyond it, e.g., by dynamic allocation.
+type executorCharge struct {
+	executors int64
+	spec      so.SparkApplicationSpec
+	scope     usageScope
+}
+
+// sparkApplicationChargedExecutors returns the number of executors charged for the given SparkApplication, which
+// is 0 once it has terminated.
+func sparkApplicationChargedExecutors(sparkApp so.SparkApplication, charge DynamicAllocationCharge) int64 {
+	if sparkApplicationTerminated(sparkApp) {
+		return 0
+	}
+	return chargedExecutors(sparkApp.Spec, charge)
+}
+
+func isSparkExecutorPod(pod *corev1.Pod) bool {
+	return launchedBySparkOperator(pod.ObjectMeta) && pod.Labels[config.SparkRoleLabel] == config.SparkExecutorRole && pod.Labels[config.SparkAppNameLabel] != ""
+}
+
+func (r *ResourceUsageWatcher) setExecutorCharge(namespace string, app *so.SparkApplication) {
+	r.currentUsageLock.Lock()
+	defer r.currentUsageLock.Unlock()
+	if _, present := r.executorChargeByNamespaceApplication[namespace]; !present {
+		r.executorChargeByNamespaceApplication[namespace] = make(map[string]*executorCharge)
+	}
+	r.executorChargeByNamespaceApplication[namespace][app.Name] = &executorCharge{
+		executors: sparkApplicationChargedExecutors(*app, r.dynamicAllocationCharge),
+		spec:      app.Spec,
+		scope:     sparkApplicationScope(app.Spec),
+	}
+	r.unsafeUpdateExcessExecutors(namespace, app.Name)
+}
+
+func (r *ResourceUsageWatcher) deleteExecutorCharge(namespace, appName string) {
+	r.currentUsageLock.Lock()
+	defer r.currentUsageLock.Unlock()
+	delete(r.executorChargeByNamespaceApplication[namespace], appName)
+	delete(r.executorReservationsByNamespace[namespace], appName)
+	r.unsafeUpdateExcessExecutors(namespace, appName)
+}
+
+// setExecutorPod records whether the given executor pod is running or about to run.
+func (r *ResourceUsageWatcher) setExecutorPod(pod *corev1.Pod, active bool) {
+	namespace := namespaceOrDefault(pod.ObjectMeta)
+	appName := pod.Labels[config.SparkAppNameLabel]
+	r.currentUsageLock.Lock()
+	defer r.currentUsageLock.Unlock()
+	if reservations, present := r.executorReservationsByNamespace[namespace][appName]; present {
+		delete(reservations, pod.Name)
+		if len(reservations) == 0 {
+			delete(r.executorReservationsByNamespace[namespace], appName)
+		}
+	}
+	if active {
+		if _, present := r.executorPodsByNamespaceApplication[namespace]; !present {
+			r.executorPodsByNamespaceApplication[namespace] = make(map[string]map[string]struct{})
+		}
+		if _, present := r.executorPodsByNamespaceApplication[namespace][appName]; !present {
+			r.executorPodsByNamespaceApplication[namespace][appName] = make(map[string]struct{})
+		}
+		r.executorPodsByNamespaceApplication[namespace][appName][pod.Name] = struct{}{}
+	} else if pods, present := r.executorPodsByNamespaceApplication[namespace][appName]; present {
+		delete(pods, pod.Name)
+		if len(pods) == 0 {
+			delete(r.executorPodsByNamespaceApplication[namespace], appName)
+		}
+	}
+	r.unsafeUpdateExcessExecutors(namespace, appName)
+}
+
+// unsafeUpdateExcessExecutors charges the executors of the given application running beyond the number of
+// executors charged for the application itself.
+func (r *ResourceUsageWatcher) unsafeUpdateExcessExecutors(namespace, appName string) {
+	charge, present := r.executorChargeByNamespaceApplication[namespace][appName]
+	excess := int64(len(r.executorPodsByNamespaceApplication[namespace][appName]))
+	if present {
+		excess -= charge.executors
+	}
+	if !present || excess <= 0 {
+		r.unsafeDeleteResources(namespace, appName, r.usageByNamespaceExcessExecutors)
+		return
+	}
+	resources, err := executorResourceUsage(charge.spec, excess)
+	if err != nil {
+		glog.Errorf("failed to determine resource usage of the executors of SparkApplication %s/%s: %v", namespace, appName, err)
+		return
+	}
+	glog.V(3).Infof("Charging %d executors of SparkApplication %s/%s beyond its %d admitted executors", excess, namespace, appName, charge.executors)
+	r.unsafeSetResources(namespace, appName, resources, charge.scope, r.usageByNamespaceExcessExecutors)
+}
+
+// reserveExecutorWithinCharge tells if another executor of the given application, besides the given pod, is
+// still covered by the executors charged for the application when it was admitted. If so, the pod is reserved
+// one of these executors until the pod informer sees it, so that executors admitted concurrently don't all
+// take the same one.
+func (r *ResourceUsageWatcher) reserveExecutorWithinCharge(namespace, appName, podName string, chargedExecutors int64) bool {
+	r.currentUsageLock.Lock()
+	defer r.currentUsageLock.Unlock()
+	pods := r.executorPodsByNamespaceApplication[namespace][appName]
+	executors := int64(len(pods))
+	if _, present := pods[podName]; present {
+		executors--
+	}
+	reservations := r.executorReservationsByNamespace[namespace][appName]
+	for name, admitted := range reservations {
+		if r.now().Sub(admitted) > executorReservationTimeout {
+			delete(reservations, name)
+			continue
+		}
+		if _, present := pods[name]; !present && name != podName {
+			executors++
+		}
+	}
+	if executors >= chargedExecutors {
+		return false
+	}
+	if reservations == nil {
+		if _, present := r.executorReservationsByNamespace[namespace]; !present {
+			r.executorReservationsByNamespace[namespace] = make(map[string]map[string]time.Time)
+		}
+		reservations = make(map[string]time.Time)
+		r.executorReservationsByNamespace[namespace][appName] = reservations
+	}
+	reservations[podName] = r.now()
+	return true
+}
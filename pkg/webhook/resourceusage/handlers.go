@@ -12,7 +12,10 @@ func (r *ResourceUsageWatcher) onPodAdded(obj interface{}) {
 	pod := obj.(*corev1.Pod)
 	// A pod launched by the Spark operator will already be accounted for by the CRD informer callback
 	if !launchedBySparkOperator(pod.ObjectMeta) {
-		r.setResources("Pod", namespaceOrDefault(pod.ObjectMeta), pod.ObjectMeta.Name, podResourceUsage(pod), r.usageByNamespacePod)
+		r.setResources("Pod", namespaceOrDefault(pod.ObjectMeta), pod.ObjectMeta.Name, podResourceUsage(pod), podScope(pod), r.usageByNamespacePod)
+	} else if isSparkExecutorPod(pod) {
+		// Executors beyond those charged for their application, e.g., added by dynamic allocation, are charged separately
+		r.setExecutorPod(pod, pod.Status.Phase != corev1.PodFailed && pod.Status.Phase != corev1.PodSucceeded)
 	}
 }
 
@@ -22,8 +25,10 @@ func (r *ResourceUsageWatcher) onPodUpdated(oldObj, newObj interface{}) {
 		if newPod.Status.Phase == corev1.PodFailed || newPod.Status.Phase == corev1.PodSucceeded {
 			r.deleteResources("Pod", namespaceOrDefault(newPod.ObjectMeta), newPod.ObjectMeta.Name, r.usageByNamespacePod)
 		} else {
-			r.setResources("Pod", namespaceOrDefault(newPod.ObjectMeta), newPod.ObjectMeta.Name, podResourceUsage(newPod), r.usageByNamespacePod)
+			r.setResources("Pod", namespaceOrDefault(newPod.ObjectMeta), newPod.ObjectMeta.Name, podResourceUsage(newPod), podScope(newPod), r.usageByNamespacePod)
 		}
+	} else if isSparkExecutorPod(newPod) {
+		r.setExecutorPod(newPod, newPod.Status.Phase != corev1.PodFailed && newPod.Status.Phase != corev1.PodSucceeded)
 	}
 }
 
@@ -39,18 +44,21 @@ func (r *ResourceUsageWatcher) onPodDeleted(obj interface{}) {
 	}
 	if !launchedBySparkOperator(pod.ObjectMeta) {
 		r.deleteResources("Pod", namespaceOrDefault(pod.ObjectMeta), pod.ObjectMeta.Name, r.usageByNamespacePod)
+	} else if isSparkExecutorPod(pod) {
+		r.setExecutorPod(pod, false)
 	}
 }
 
 func (r *ResourceUsageWatcher) onSparkApplicationAdded(obj interface{}) {
 	app := obj.(*so.SparkApplication)
 	namespace := namespaceOrDefault(app.ObjectMeta)
-	resources, err := sparkApplicationResourceUsage(*app)
+	resources, err := sparkApplicationResourceUsage(*app, r.dynamicAllocationCharge)
 	if err != nil {
 		glog.Errorf("failed to determine resource usage of SparkApplication %s/%s: %v", namespace, app.ObjectMeta.Name, err)
 	} else {
-		r.setResources(KindSparkApplication, namespace, app.ObjectMeta.Name, resources, r.usageByNamespaceApplication)
+		r.setResources(KindSparkApplication, namespace, app.ObjectMeta.Name, resources, sparkApplicationScope(app.Spec), r.usageByNamespaceApplication)
 	}
+	r.setExecutorCharge(namespace, app)
 }
 
 func (r *ResourceUsageWatcher) onSparkApplicationUpdated(oldObj, newObj interface{}) {
@@ -60,12 +68,13 @@ func (r *ResourceUsageWatcher) onSparkApplicationUpdated(oldObj, newObj interfac
 		return
 	}
 	namespace := namespaceOrDefault(newApp.ObjectMeta)
-	newResources, err := sparkApplicationResourceUsage(*newApp)
+	newResources, err := sparkApplicationResourceUsage(*newApp, r.dynamicAllocationCharge)
 	if err != nil {
 		glog.Errorf("failed to determine resource usage of SparkApplication %s/%s: %v", namespace, newApp.ObjectMeta.Name, err)
 	} else {
-		r.setResources(KindSparkApplication, namespace, newApp.ObjectMeta.Name, newResources, r.usageByNamespaceApplication)
+		r.setResources(KindSparkApplication, namespace, newApp.ObjectMeta.Name, newResources, sparkApplicationScope(newApp.Spec), r.usageByNamespaceApplication)
 	}
+	r.setExecutorCharge(namespace, newApp)
 }
 
 func (r *ResourceUsageWatcher) onSparkApplicationDeleted(obj interface{}) {
@@ -80,27 +89,28 @@ func (r *ResourceUsageWatcher) onSparkApplicationDeleted(obj interface{}) {
 	}
 	namespace := namespaceOrDefault(app.ObjectMeta)
 	r.deleteResources(KindSparkApplication, namespace, app.ObjectMeta.Name, r.usageByNamespaceApplication)
+	r.deleteExecutorCharge(namespace, app.ObjectMeta.Name)
 }
 
 func (r *ResourceUsageWatcher) onScheduledSparkApplicationAdded(obj interface{}) {
 	app := obj.(*so.ScheduledSparkApplication)
 	namespace := namespaceOrDefault(app.ObjectMeta)
-	resources, err := scheduledSparkApplicationResourceUsage(*app)
+	resources, err := scheduledSparkApplicationResourceUsage(*app, r.dynamicAllocationCharge)
 	if err != nil {
 		glog.Errorf("failed to determine resource usage of ScheduledSparkApplication %s/%s: %v", namespace, app.ObjectMeta.Name, err)
 	} else {
-		r.setResources(KindScheduledSparkApplication, namespace, app.ObjectMeta.Name, resources, r.usageByNamespaceScheduledApplication)
+		r.setResources(KindScheduledSparkApplication, namespace, app.ObjectMeta.Name, resources, sparkApplicationScope(app.Spec.Template), r.usageByNamespaceScheduledApplication)
 	}
 }
 
 func (r *ResourceUsageWatcher) onScheduledSparkApplicationUpdated(oldObj, newObj interface{}) {
-	newApp := oldObj.(*so.ScheduledSparkApplication)
+	newApp := newObj.(*so.ScheduledSparkApplication)
 	namespace := namespaceOrDefault(newApp.ObjectMeta)
-	newResources, err := scheduledSparkApplicationResourceUsage(*newApp)
+	newResources, err := scheduledSparkApplicationResourceUsage(*newApp, r.dynamicAllocationCharge)
 	if err != nil {
 		glog.Errorf("failed to determine resource usage of ScheduledSparkApplication %s/%s: %v", namespace, newApp.ObjectMeta.Name, err)
 	} else {
-		r.setResources(KindSparkApplication, namespace, newApp.ObjectMeta.Name, newResources, r.usageByNamespaceScheduledApplication)
+		r.setResources(KindScheduledSparkApplication, namespace, newApp.ObjectMeta.Name, newResources, sparkApplicationScope(newApp.Spec.Template), r.usageByNamespaceScheduledApplication)
 	}
 }
 
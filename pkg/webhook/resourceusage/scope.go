@@ -0,0 +1,110 @@
+package resourceusage
+
+import (
+	so "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// usageScope holds the attributes of an object ResourceQuota scopes select objects by.
+type usageScope struct {
+	priorityClassName string
+	// terminating is true for pods with an active deadline.
+	terminating bool
+	// bestEffort is true for pods without any resource requests or limits.
+	bestEffort bool
+}
+
+// scopedResourceList is the resource usage of an object together with its scope.
+type scopedResourceList struct {
+	ResourceList
+	scope usageScope
+}
+
+// sparkApplicationScope returns the scope of the pods of a SparkApplication with the given spec. Spark pods
+// never have an active deadline, and always request memory, so they are neither terminating nor best-effort.
+func sparkApplicationScope(spec so.SparkApplicationSpec) usageScope {
+	var scope usageScope
+	if spec.BatchSchedulerOptions != nil && spec.BatchSchedulerOptions.PriorityClassName != nil {
+		scope.priorityClassName = *spec.BatchSchedulerOptions.PriorityClassName
+	}
+	return scope
+}
+
+func podScope(pod *corev1.Pod) usageScope {
+	scope := usageScope{
+		priorityClassName: pod.Spec.PriorityClassName,
+		terminating:       pod.Spec.ActiveDeadlineSeconds != nil && *pod.Spec.ActiveDeadlineSeconds >= 0,
+		bestEffort:        true,
+	}
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		if len(container.Resources.Requests) > 0 || len(container.Resources.Limits) > 0 {
+			scope.bestEffort = false
+			break
+		}
+	}
+	return scope
+}
+
+// quotaMatchesScope tells if the given ResourceQuota applies to objects of the given scope, i.e., if the scope
+// matches all scopes and scope selector requirements of the quota. Quotas with scopes that don't apply to
+// pods never match.
+func quotaMatchesScope(quota *corev1.ResourceQuota, scope usageScope) bool {
+	for _, quotaScope := range quota.Spec.Scopes {
+		if !scopeMatches(quotaScope, corev1.ScopeSelectorOpExists, nil, scope) {
+			return false
+		}
+	}
+	if quota.Spec.ScopeSelector != nil {
+		for _, requirement := range quota.Spec.ScopeSelector.MatchExpressions {
+			if !scopeMatches(requirement.ScopeName, requirement.Operator, requirement.Values, scope) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func scopeMatches(quotaScope corev1.ResourceQuotaScope, operator corev1.ScopeSelectorOperator, values []string, scope usageScope) bool {
+	var selected bool
+	switch quotaScope {
+	case corev1.ResourceQuotaScopeTerminating:
+		selected = scope.terminating
+	case corev1.ResourceQuotaScopeNotTerminating:
+		selected = !scope.terminating
+	case corev1.ResourceQuotaScopeBestEffort:
+		selected = scope.bestEffort
+	case corev1.ResourceQuotaScopeNotBestEffort:
+		selected = !scope.bestEffort
+	case corev1.ResourceQuotaScopePriorityClass:
+		switch operator {
+		case corev1.ScopeSelectorOpIn:
+			return containsString(values, scope.priorityClassName)
+		case corev1.ScopeSelectorOpNotIn:
+			return !containsString(values, scope.priorityClassName)
+		case corev1.ScopeSelectorOpExists:
+			return scope.priorityClassName != ""
+		case corev1.ScopeSelectorOpDoesNotExist:
+			return scope.priorityClassName == ""
+		}
+		return false
+	default:
+		return false
+	}
+	switch operator {
+	case corev1.ScopeSelectorOpExists:
+		return selected
+	case corev1.ScopeSelectorOpDoesNotExist:
+		return !selected
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
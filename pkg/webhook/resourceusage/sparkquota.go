@@ -0,0 +1,334 @@
+package resourceusage
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	so "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	crdinformers "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/informers/externalversions"
+	crdlisters "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/listers/sparkoperator.k8s.io/v1beta2"
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// sparkQuotaReservationTimeout bounds how long an application admitted for submission counts against
+// SparkQuotas before its status shows that it was submitted.
+const sparkQuotaReservationTimeout = 10 * time.Minute
+
+// SparkQuotaEnforcer enforces the SparkQuotas limiting the SparkApplications of the namespaces they select.
+// Applications that can never fit into a quota are rejected, and other applications are only admitted for
+// submission while the running applications leave room for them.
+type SparkQuotaEnforcer struct {
+	quotaLister             crdlisters.SparkQuotaLister
+	applicationLister       crdlisters.SparkApplicationLister
+	namespaceLister         corev1listers.NamespaceLister
+	cacheSynced             []cache.InformerSynced
+	dynamicAllocationCharge DynamicAllocationCharge
+	// mutex serializes admissions for submission, so that concurrently submitted applications don't all fit
+	// into the same room.
+	mutex sync.Mutex
+	// reservations holds the times applications were admitted for submission keyed by namespace/name, so that
+	// they count against the quotas until their status shows that they were submitted.
+	reservations map[string]time.Time
+	now          func() time.Time
+}
+
+// NewSparkQuotaEnforcer creates a SparkQuotaEnforcer. The core informer factory must not be limited to a
+// namespace, as SparkQuotas select namespaces by their labels.
+func NewSparkQuotaEnforcer(crdInformerFactory crdinformers.SharedInformerFactory, coreV1InformerFactory informers.SharedInformerFactory, dynamicAllocationCharge DynamicAllocationCharge) *SparkQuotaEnforcer {
+	quotaInformer := crdInformerFactory.Sparkoperator().V1beta2().SparkQuotas()
+	applicationInformer := crdInformerFactory.Sparkoperator().V1beta2().SparkApplications()
+	namespaceInformer := coreV1InformerFactory.Core().V1().Namespaces()
+	return &SparkQuotaEnforcer{
+		quotaLister:       quotaInformer.Lister(),
+		applicationLister: applicationInformer.Lister(),
+		namespaceLister:   namespaceInformer.Lister(),
+		cacheSynced: []cache.InformerSynced{
+			quotaInformer.Informer().HasSynced,
+			applicationInformer.Informer().HasSynced,
+			namespaceInformer.Informer().HasSynced,
+		},
+		dynamicAllocationCharge: dynamicAllocationCharge,
+		reservations:            make(map[string]time.Time),
+		now:                     time.Now,
+	}
+}
+
+// NewSparkQuotaEnforcerForObjects creates a SparkQuotaEnforcer that sees the given SparkQuotas, SparkApplications
+// and namespaces as they are instead of watching them, e.g., to check applications without an API server.
+func NewSparkQuotaEnforcerForObjects(
+	quotas []*so.SparkQuota,
+	apps []*so.SparkApplication,
+	namespaces []*corev1.Namespace,
+	dynamicAllocationCharge DynamicAllocationCharge) *SparkQuotaEnforcer {
+	newIndexer := func() cache.Indexer {
+		return cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	}
+	quotaIndexer, applicationIndexer, namespaceIndexer := newIndexer(), newIndexer(), newIndexer()
+	for _, quota := range quotas {
+		quotaIndexer.Add(quota)
+	}
+	for _, app := range apps {
+		applicationIndexer.Add(app)
+	}
+	for _, namespace := range namespaces {
+		namespaceIndexer.Add(namespace)
+	}
+	return &SparkQuotaEnforcer{
+		quotaLister:             crdlisters.NewSparkQuotaLister(quotaIndexer),
+		applicationLister:       crdlisters.NewSparkApplicationLister(applicationIndexer),
+		namespaceLister:         corev1listers.NewNamespaceLister(namespaceIndexer),
+		dynamicAllocationCharge: dynamicAllocationCharge,
+		reservations:            make(map[string]time.Time),
+		now:                     time.Now,
+	}
+}
+
+func (e *SparkQuotaEnforcer) WaitForCacheSync(stopCh <-chan struct{}) error {
+	if e == nil {
+		return nil
+	}
+	if !cache.WaitForCacheSync(stopCh, e.cacheSynced...) {
+		return fmt.Errorf("cache sync canceled")
+	}
+	return nil
+}
+
+// AdmitSparkApplication returns why the given SparkApplication can never run within the SparkQuotas selecting
+// its namespace, or an empty string if it fits into them once enough other applications have completed.
+func (e *SparkQuotaEnforcer) AdmitSparkApplication(app so.SparkApplication) (string, error) {
+	if e == nil {
+		return "", nil
+	}
+	quotas, err := e.quotasFor(namespaceOrDefault(app.ObjectMeta))
+	if err != nil || len(quotas) == 0 {
+		return "", err
+	}
+	usage, err := resourceUsage(app.Spec, e.dynamicAllocationCharge)
+	if err != nil {
+		return "", err
+	}
+	for _, quota := range quotas {
+		if reason := e.limitsExceeded(app, quota, usage); reason != "" {
+			return reason, nil
+		}
+	}
+	return "", nil
+}
+
+func (e *SparkQuotaEnforcer) limitsExceeded(app so.SparkApplication, quota *so.SparkQuota, usage ResourceList) string {
+	spec := quota.Spec
+	if spec.MaxApplications != nil && *spec.MaxApplications <= 0 {
+		return fmt.Sprintf("%s %s/%s isn't allowed to run by SparkQuota %s, which allows no applications.", KindSparkApplication, app.Namespace, app.Name, quota.Name)
+	}
+	if spec.MaxExecutorsPerApplication != nil {
+		maxExecutors := int64(*spec.MaxExecutorsPerApplication)
+		executors := chargedExecutors(app.Spec, DynamicAllocationChargeMax)
+		if app.Spec.DynamicAllocation != nil && app.Spec.DynamicAllocation.Enabled && app.Spec.DynamicAllocation.MaxExecutors == nil {
+			return fmt.Sprintf("%s %s/%s must set spec.dynamicAllocation.maxExecutors, as SparkQuota %s allows at most %d executors per application.", KindSparkApplication, app.Namespace, app.Name, quota.Name, maxExecutors)
+		}
+		if executors > maxExecutors {
+			return fmt.Sprintf("%s %s/%s requests too many executors (%d executors requested, SparkQuota %s allows %d).", KindSparkApplication, app.Namespace, app.Name, executors, quota.Name, maxExecutors)
+		}
+	}
+	if spec.Cores != nil && usage.cpu.Cmp(*spec.Cores) == 1 {
+		return sparkQuotaExceededMessage(app, quota, "cores", usage.cpu, *spec.Cores)
+	}
+	if spec.Memory != nil && usage.memory.Cmp(*spec.Memory) == 1 {
+		return sparkQuotaExceededMessage(app, quota, "memory", usage.memory, *spec.Memory)
+	}
+	return ""
+}
+
+func sparkQuotaExceededMessage(app so.SparkApplication, quota *so.SparkQuota, resourceName string, requested, available resource.Quantity) string {
+	if resourceName == "cores" {
+		return fmt.Sprintf("%s %s/%s requests too many cores under SparkQuota %s (%.3f cores requested, %.3f available).", KindSparkApplication, app.Namespace, app.Name, quota.Name, float64(requested.MilliValue())/1000.0, float64(available.MilliValue())/1000.0)
+	}
+	return fmt.Sprintf("%s %s/%s requests too much memory under SparkQuota %s (%dMi requested, %dMi available).", KindSparkApplication, app.Namespace, app.Name, quota.Name, requested.Value()/(1<<20), available.Value()/(1<<20))
+}
+
+// AdmitSubmission returns why the given SparkApplication has to wait for other applications in the namespaces
+// selected by its SparkQuotas to complete before it is submitted, or an empty string if it can be submitted
+// now. An admitted application counts against the quotas right away.
+func (e *SparkQuotaEnforcer) AdmitSubmission(app so.SparkApplication) (string, error) {
+	if e == nil {
+		return "", nil
+	}
+	namespace := namespaceOrDefault(app.ObjectMeta)
+	quotas, err := e.quotasFor(namespace)
+	if err != nil || len(quotas) == 0 {
+		return "", err
+	}
+	requested, err := resourceUsage(app.Spec, e.dynamicAllocationCharge)
+	if err != nil {
+		return "", err
+	}
+
+	key := namespace + "/" + app.Name
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for _, quota := range quotas {
+		_, applications, used, err := e.unsafeUsage(quota, key)
+		if err != nil {
+			return "", err
+		}
+		spec := quota.Spec
+		if spec.MaxApplications != nil && applications >= *spec.MaxApplications {
+			return fmt.Sprintf("%s %s/%s waits for one of the %d running applications of SparkQuota %s to complete.", KindSparkApplication, namespace, app.Name, applications, quota.Name), nil
+		}
+		if spec.Cores != nil {
+			available := spec.Cores.DeepCopy()
+			available.Sub(used.cpu)
+			if requested.cpu.Cmp(available) == 1 {
+				return sparkQuotaExceededMessage(app, quota, "cores", requested.cpu, available), nil
+			}
+		}
+		if spec.Memory != nil {
+			available := spec.Memory.DeepCopy()
+			available.Sub(used.memory)
+			if requested.memory.Cmp(available) == 1 {
+				return sparkQuotaExceededMessage(app, quota, "memory", requested.memory, available), nil
+			}
+		}
+	}
+	glog.V(2).Infof("Admitting %s %s for submission under %d SparkQuotas", KindSparkApplication, key, len(quotas))
+	e.reservations[key] = e.now()
+	return "", nil
+}
+
+// Release stops counting the given application against SparkQuotas until it is admitted again, e.g., after
+// its submission failed.
+func (e *SparkQuotaEnforcer) Release(namespace, name string) {
+	if e == nil {
+		return
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	delete(e.reservations, namespace+"/"+name)
+}
+
+// Status returns the current usage of the given SparkQuota.
+func (e *SparkQuotaEnforcer) Status(quota *so.SparkQuota) (so.SparkQuotaStatus, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	namespaces, applications, used, err := e.unsafeUsage(quota, "")
+	if err != nil {
+		return so.SparkQuotaStatus{}, err
+	}
+	return so.SparkQuotaStatus{
+		Namespaces:   namespaces,
+		Applications: applications,
+		Cores:        used.cpu,
+		Memory:       used.memory,
+	}, nil
+}
+
+// quotasFor returns the SparkQuotas selecting the given namespace.
+func (e *SparkQuotaEnforcer) quotasFor(namespace string) ([]*so.SparkQuota, error) {
+	quotas, err := e.quotaLister.List(labels.Everything())
+	if err != nil || len(quotas) == 0 {
+		return nil, err
+	}
+	var namespaceLabels labels.Set
+	ns, err := e.namespaceLister.Get(namespace)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+	} else {
+		namespaceLabels = ns.Labels
+	}
+
+	var selecting []*so.SparkQuota
+	for _, quota := range quotas {
+		selector, err := metav1.LabelSelectorAsSelector(&quota.Spec.NamespaceSelector)
+		if err != nil {
+			glog.Errorf("invalid namespace selector of SparkQuota %s: %v", quota.Name, err)
+			continue
+		}
+		if selector.Matches(namespaceLabels) {
+			selecting = append(selecting, quota)
+		}
+	}
+	sort.Slice(selecting, func(i, j int) bool { return selecting[i].Name < selecting[j].Name })
+	return selecting, nil
+}
+
+// unsafeUsage returns the namespaces selected by the given SparkQuota, and the number and resource usage of
+// the applications counting against it in those namespaces, except the application with the given key.
+func (e *SparkQuotaEnforcer) unsafeUsage(quota *so.SparkQuota, exceptKey string) ([]string, int32, ResourceList, error) {
+	selector, err := metav1.LabelSelectorAsSelector(&quota.Spec.NamespaceSelector)
+	if err != nil {
+		return nil, 0, ResourceList{}, err
+	}
+	namespaceList, err := e.namespaceLister.List(selector)
+	if err != nil {
+		return nil, 0, ResourceList{}, err
+	}
+	var namespaces []string
+	for _, ns := range namespaceList {
+		namespaces = append(namespaces, ns.Name)
+	}
+	sort.Strings(namespaces)
+
+	var applications int32
+	var used ResourceList
+	for _, namespace := range namespaces {
+		apps, err := e.applicationLister.SparkApplications(namespace).List(labels.Everything())
+		if err != nil {
+			return nil, 0, ResourceList{}, err
+		}
+		for _, app := range apps {
+			key := namespace + "/" + app.Name
+			if key == exceptKey || !e.unsafeCounts(key, app) {
+				continue
+			}
+			usage, err := resourceUsage(app.Spec, e.dynamicAllocationCharge)
+			if err != nil {
+				glog.Errorf("failed to determine resource usage of %s %s: %v", KindSparkApplication, key, err)
+				continue
+			}
+			applications++
+			used.add(usage)
+		}
+	}
+	return namespaces, applications, used, nil
+}
+
+// unsafeCounts tells if the given application counts against SparkQuotas, which it does from its admission
+// for submission until it terminates.
+func (e *SparkQuotaEnforcer) unsafeCounts(key string, app *so.SparkApplication) bool {
+	if sparkApplicationSubmitted(app) {
+		delete(e.reservations, key)
+		return true
+	}
+	admitted, reserved := e.reservations[key]
+	if !reserved {
+		return false
+	}
+	// The termination time of an application pending a rerun is still the one of its previous run.
+	state := app.Status.AppState.State
+	if state == so.CompletedState || state == so.FailedState || e.now().Sub(admitted) > sparkQuotaReservationTimeout {
+		delete(e.reservations, key)
+		return false
+	}
+	return true
+}
+
+// sparkApplicationSubmitted tells if the given SparkApplication has been submitted and hasn't terminated yet.
+func sparkApplicationSubmitted(app *so.SparkApplication) bool {
+	switch app.Status.AppState.State {
+	case so.SubmittedState, so.RunningState, so.UnknownState, so.SucceedingState, so.FailingState, so.InvalidatingState:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package resourceusage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	so "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+)
+
+func int32ptr(n int32) *int32 {
+	return &n
+}
+
+func quantityptr(value string) *resource.Quantity {
+	quantity := resource.MustParse(value)
+	return &quantity
+}
+
+// sparkQuotaTestNamespaces are the namespaces a and b of team x and the namespace c of no team.
+var sparkQuotaTestNamespaces = []*corev1.Namespace{
+	{ObjectMeta: metav1.ObjectMeta{Name: "a", Labels: map[string]string{"team": "x"}}},
+	{ObjectMeta: metav1.ObjectMeta{Name: "b", Labels: map[string]string{"team": "x"}}},
+	{ObjectMeta: metav1.ObjectMeta{Name: "c"}},
+}
+
+func newTestSparkQuota(spec so.SparkQuotaSpec) *so.SparkQuota {
+	spec.NamespaceSelector = metav1.LabelSelector{MatchLabels: map[string]string{"team": "x"}}
+	return &so.SparkQuota{ObjectMeta: metav1.ObjectMeta{Name: "team-x"}, Spec: spec}
+}
+
+// newTestSparkQuotaApp returns a SparkApplication requesting 2 cores in the given namespace and state.
+func newTestSparkQuotaApp(namespace, name string, state so.ApplicationStateType) *so.SparkApplication {
+	app := newTestApp(name, "")
+	app.Namespace = namespace
+	app.Status.AppState.State = state
+	return app
+}
+
+func TestSparkQuotaAdmitSparkApplication(t *testing.T) {
+	enforcer := NewSparkQuotaEnforcerForObjects(
+		[]*so.SparkQuota{newTestSparkQuota(so.SparkQuotaSpec{
+			MaxExecutorsPerApplication: int32ptr(3),
+			Cores:                      quantityptr("3"),
+		})},
+		nil,
+		sparkQuotaTestNamespaces,
+		DynamicAllocationChargeMax)
+
+	reason, err := enforcer.AdmitSparkApplication(*newTestSparkQuotaApp("a", "fits", so.NewState))
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+
+	app := newTestSparkQuotaApp("a", "executors", so.NewState)
+	app.Spec.Executor.Instances = int32ptr(5)
+	reason, err = enforcer.AdmitSparkApplication(*app)
+	assert.NoError(t, err)
+	assert.Equal(t, "SparkApplication a/executors requests too many executors (5 executors requested, SparkQuota team-x allows 3).", reason)
+
+	app = newTestSparkQuotaApp("a", "unbounded", so.NewState)
+	app.Spec.DynamicAllocation = &so.DynamicAllocation{Enabled: true}
+	reason, err = enforcer.AdmitSparkApplication(*app)
+	assert.NoError(t, err)
+	assert.Equal(t, "SparkApplication a/unbounded must set spec.dynamicAllocation.maxExecutors, as SparkQuota team-x allows at most 3 executors per application.", reason)
+
+	app = newTestSparkQuotaApp("a", "cores", so.NewState)
+	app.Spec.Executor.Instances = int32ptr(3)
+	reason, err = enforcer.AdmitSparkApplication(*app)
+	assert.NoError(t, err)
+	assert.Equal(t, "SparkApplication a/cores requests too many cores under SparkQuota team-x (4.000 cores requested, 3.000 available).", reason)
+
+	// Namespaces not selected by the quota are not limited.
+	app.Namespace = "c"
+	reason, err = enforcer.AdmitSparkApplication(*app)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+}
+
+func TestSparkQuotaAdmitSubmission(t *testing.T) {
+	enforcer := NewSparkQuotaEnforcerForObjects(
+		[]*so.SparkQuota{newTestSparkQuota(so.SparkQuotaSpec{MaxApplications: int32ptr(2), Cores: quantityptr("5")})},
+		[]*so.SparkApplication{
+			newTestSparkQuotaApp("a", "running", so.RunningState),
+			newTestSparkQuotaApp("a", "completed", so.CompletedState),
+			newTestSparkQuotaApp("b", "first", so.NewState),
+			newTestSparkQuotaApp("b", "second", so.NewState),
+			newTestSparkQuotaApp("c", "other", so.RunningState),
+		},
+		sparkQuotaTestNamespaces,
+		DynamicAllocationChargeMax)
+
+	// 1 application using 2 cores is running.
+	reason, err := enforcer.AdmitSubmission(*newTestSparkQuotaApp("b", "first", so.NewState))
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+
+	// The admitted application counts against the quota until it is submitted.
+	reason, err = enforcer.AdmitSubmission(*newTestSparkQuotaApp("b", "second", so.NewState))
+	assert.NoError(t, err)
+	assert.Equal(t, "SparkApplication b/second waits for one of the 2 running applications of SparkQuota team-x to complete.", reason)
+
+	// Admitting an application again doesn't count it twice.
+	reason, err = enforcer.AdmitSubmission(*newTestSparkQuotaApp("b", "first", so.NewState))
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+
+	enforcer.Release("b", "first")
+	reason, err = enforcer.AdmitSubmission(*newTestSparkQuotaApp("b", "second", so.NewState))
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+
+	// 4 of the 5 cores are used.
+	quota, _ := enforcer.quotaLister.Get("team-x")
+	quota.Spec.MaxApplications = nil
+	app := newTestSparkQuotaApp("b", "first", so.NewState)
+	reason, err = enforcer.AdmitSubmission(*app)
+	assert.NoError(t, err)
+	assert.Equal(t, "SparkApplication b/first requests too many cores under SparkQuota team-x (2.000 cores requested, 1.000 available).", reason)
+
+	// Reservations of applications that aren't submitted in time expire.
+	enforcer.now = func() time.Time { return time.Now().Add(sparkQuotaReservationTimeout + time.Minute) }
+	reason, err = enforcer.AdmitSubmission(*app)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+}
+
+func TestSparkQuotaStatus(t *testing.T) {
+	enforcer := NewSparkQuotaEnforcerForObjects(
+		[]*so.SparkQuota{newTestSparkQuota(so.SparkQuotaSpec{})},
+		[]*so.SparkApplication{
+			newTestSparkQuotaApp("a", "running", so.RunningState),
+			newTestSparkQuotaApp("b", "submitted", so.SubmittedState),
+			newTestSparkQuotaApp("b", "failed", so.FailedState),
+			newTestSparkQuotaApp("b", "new", so.NewState),
+			newTestSparkQuotaApp("c", "other", so.RunningState),
+		},
+		sparkQuotaTestNamespaces,
+		DynamicAllocationChargeMax)
+	quota, err := enforcer.quotaLister.Get("team-x")
+	assert.NoError(t, err)
+
+	status, err := enforcer.Status(quota)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, status.Namespaces)
+	assert.Equal(t, int32(2), status.Applications)
+	assert.Equal(t, int64(4000), status.Cores.MilliValue())
+	usage, err := resourceUsage(newTestSparkQuotaApp("a", "running", so.RunningState).Spec, DynamicAllocationChargeMax)
+	assert.NoError(t, err)
+	assert.Equal(t, 2*usage.memory.Value(), status.Memory.Value())
+}
@@ -59,6 +59,59 @@ func resourcesRequiredToSchedule(resourceRequirements corev1.ResourceRequirement
 	return cpu, memoryBytes
 }
 
+// otherResourcesRequiredToSchedule returns the requests, or limits if not requested, of the resources other than
+// cpu and memory, e.g., ephemeral-storage and extended resources.
+func otherResourcesRequiredToSchedule(resourceRequirements corev1.ResourceRequirements) corev1.ResourceList {
+	resources := make(corev1.ResourceList)
+	for name, quantity := range resourceRequirements.Limits {
+		resources[name] = quantity.DeepCopy()
+	}
+	for name, quantity := range resourceRequirements.Requests {
+		resources[name] = quantity.DeepCopy()
+	}
+	delete(resources, corev1.ResourceCPU)
+	delete(resources, corev1.ResourceMemory)
+	return resources
+}
+
+// addResources adds the given resources to total, or sets each to the maximum of both if useMax is true.
+func addResources(total corev1.ResourceList, resources corev1.ResourceList, useMax bool) {
+	for name, quantity := range resources {
+		current, present := total[name]
+		if !present {
+			total[name] = quantity.DeepCopy()
+		} else if !useMax {
+			current.Add(quantity)
+			total[name] = current
+		} else if quantity.Cmp(current) > 0 {
+			total[name] = quantity.DeepCopy()
+		}
+	}
+}
+
+// otherResourcesRequiredForSparkPod returns the resources other than cpu and memory requested by the given
+// number of Spark pods with the given spec, i.e., by their GPUs, sidecars and init containers.
+func otherResourcesRequiredForSparkPod(spec so.SparkPodSpec, instances int64) corev1.ResourceList {
+	initResources := make(corev1.ResourceList)
+	for _, container := range spec.InitContainers {
+		addResources(initResources, otherResourcesRequiredToSchedule(container.Resources), true)
+	}
+	resources := make(corev1.ResourceList)
+	for _, container := range spec.Sidecars {
+		addResources(resources, otherResourcesRequiredToSchedule(container.Resources), false)
+	}
+	if spec.GPU != nil && spec.GPU.Name != "" {
+		addResources(resources, corev1.ResourceList{corev1.ResourceName(spec.GPU.Name): *resource.NewQuantity(spec.GPU.Quantity, resource.DecimalSI)}, false)
+	}
+	addResources(resources, initResources, true)
+
+	total := make(corev1.ResourceList)
+	for name, quantity := range resources {
+		total[name] = *resource.NewMilliQuantity(quantity.MilliValue()*instances, quantity.Format)
+	}
+	return total
+}
+
 func coresRequiredForSparkPod(spec so.SparkPodSpec, instances int64) (int64, error) {
 	var cpu int64
 	if spec.Cores != nil {
@@ -150,59 +203,152 @@ func memoryRequiredForSparkPod(spec so.SparkPodSpec, memoryOverheadFactor *strin
 	return (memoryBytes + memoryOverheadBytes) * replicas, nil
 }
 
-func resourceUsage(spec so.SparkApplicationSpec) (ResourceList, error) {
-	driverMemoryOverheadFactor := spec.MemoryOverheadFactor
-	executorMemoryOverheadFactor := spec.MemoryOverheadFactor
-	driverMemory, err := memoryRequiredForSparkPod(spec.Driver.SparkPodSpec, driverMemoryOverheadFactor, spec.Type, 1)
-	if err != nil {
-		return ResourceList{}, err
+// DynamicAllocationCharge tells how many executors of applications with dynamic allocation enabled are charged
+// against ResourceQuotas when they are admitted.
+type DynamicAllocationCharge string
+
+const (
+	// DynamicAllocationChargeInitial charges the executors an application starts with.
+	DynamicAllocationChargeInitial DynamicAllocationCharge = "Initial"
+	// DynamicAllocationChargeMin charges the minimum number of executors of an application.
+	DynamicAllocationChargeMin DynamicAllocationCharge = "Min"
+	// DynamicAllocationChargeMax charges the maximum number of executors of an application.
+	DynamicAllocationChargeMax DynamicAllocationCharge = "Max"
+)
+
+// ParseDynamicAllocationCharge parses the value of the -resource-quota-dynamic-allocation-executors flag.
+func ParseDynamicAllocationCharge(value string) (DynamicAllocationCharge, error) {
+	switch charge := DynamicAllocationCharge(value); charge {
+	case DynamicAllocationChargeInitial, DynamicAllocationChargeMin, DynamicAllocationChargeMax:
+		return charge, nil
 	}
+	return "", fmt.Errorf("unknown number of dynamic allocation executors to charge %q, expected Initial, Min or Max", value)
+}
 
-	var instances int64 = 1
+// chargedExecutors returns the number of executors of an application with the given spec that are charged
+// against ResourceQuotas. Without dynamic allocation, that's the number of executor instances. With it, the
+// initial number of executors is the maximum of spec.executor.instances, initialExecutors and minExecutors as
+// in Spark, and it is charged instead of the maximum if maxExecutors isn't set, as Spark doesn't bound it then.
+func chargedExecutors(spec so.SparkApplicationSpec, charge DynamicAllocationCharge) int64 {
+	dynamicAllocation := spec.DynamicAllocation
+	if dynamicAllocation == nil || !dynamicAllocation.Enabled {
+		if spec.Executor.Instances != nil {
+			return int64(*spec.Executor.Instances)
+		}
+		return 1
+	}
+
+	var minExecutors, initialExecutors int64
+	if dynamicAllocation.MinExecutors != nil {
+		minExecutors = int64(*dynamicAllocation.MinExecutors)
+	}
+	initialExecutors = minExecutors
+	if dynamicAllocation.InitialExecutors != nil {
+		initialExecutors = max(initialExecutors, int64(*dynamicAllocation.InitialExecutors))
+	}
 	if spec.Executor.Instances != nil {
-		instances = int64(*spec.Executor.Instances)
+		initialExecutors = max(initialExecutors, int64(*spec.Executor.Instances))
+	}
+	switch charge {
+	case DynamicAllocationChargeMin:
+		return minExecutors
+	case DynamicAllocationChargeMax:
+		if dynamicAllocation.MaxExecutors != nil {
+			return int64(*dynamicAllocation.MaxExecutors)
+		}
+	}
+	return initialExecutors
+}
+
+// executorResourceUsage returns the resources used by the given number of executors of an application with the
+// given spec.
+func executorResourceUsage(spec so.SparkApplicationSpec, instances int64) (ResourceList, error) {
+	memory, err := memoryRequiredForSparkPod(spec.Executor.SparkPodSpec, spec.MemoryOverheadFactor, spec.Type, instances)
+	if err != nil {
+		return ResourceList{}, err
 	}
-	executorMemory, err := memoryRequiredForSparkPod(spec.Executor.SparkPodSpec, executorMemoryOverheadFactor, spec.Type, instances)
+	cores, err := coresRequiredForSparkPod(spec.Executor.SparkPodSpec, instances)
 	if err != nil {
 		return ResourceList{}, err
 	}
+	other := otherResourcesRequiredForSparkPod(spec.Executor.SparkPodSpec, instances)
+	other[corev1.ResourcePods] = *resource.NewQuantity(instances, resource.DecimalSI)
+	return ResourceList{
+		cpu:    *resource.NewMilliQuantity(cores, resource.DecimalSI),
+		memory: *resource.NewQuantity(memory, resource.DecimalSI),
+		other:  other,
+	}, nil
+}
 
+func resourceUsage(spec so.SparkApplicationSpec, charge DynamicAllocationCharge) (ResourceList, error) {
+	driverMemory, err := memoryRequiredForSparkPod(spec.Driver.SparkPodSpec, spec.MemoryOverheadFactor, spec.Type, 1)
+	if err != nil {
+		return ResourceList{}, err
+	}
 	driverCores, err := coresRequiredForSparkPod(spec.Driver.SparkPodSpec, 1)
 	if err != nil {
 		return ResourceList{}, err
 	}
+	other := otherResourcesRequiredForSparkPod(spec.Driver.SparkPodSpec, 1)
+	other[corev1.ResourcePods] = *resource.NewQuantity(1, resource.DecimalSI)
+	usage := ResourceList{
+		cpu:    *resource.NewMilliQuantity(driverCores, resource.DecimalSI),
+		memory: *resource.NewQuantity(driverMemory, resource.DecimalSI),
+		other:  other,
+	}
 
-	executorCores, err := coresRequiredForSparkPod(spec.Executor.SparkPodSpec, instances)
+	executors, err := executorResourceUsage(spec, chargedExecutors(spec, charge))
 	if err != nil {
 		return ResourceList{}, err
 	}
+	usage.add(executors)
+	return usage, nil
+}
 
-	return ResourceList{
-		cpu:    *resource.NewMilliQuantity(driverCores+executorCores, resource.DecimalSI),
-		memory: *resource.NewQuantity(driverMemory+executorMemory, resource.DecimalSI),
-	}, nil
+// objectCount returns the usage of a single object counted by ResourceQuotas under the given name.
+func objectCount(name corev1.ResourceName) ResourceList {
+	return ResourceList{other: corev1.ResourceList{name: *resource.NewQuantity(1, resource.DecimalSI)}}
+}
+
+// sparkApplicationTerminated tells if the given SparkApplication has completed or failed, so that it consumes no
+// resources besides the object itself.
+func sparkApplicationTerminated(sparkApp so.SparkApplication) bool {
+	return !sparkApp.Status.TerminationTime.IsZero() || sparkApp.Status.AppState.State == so.FailedState || sparkApp.Status.AppState.State == so.CompletedState
 }
 
-func sparkApplicationResourceUsage(sparkApp so.SparkApplication) (ResourceList, error) {
-	// A completed/failed SparkApplication consumes no resources
-	if !sparkApp.Status.TerminationTime.IsZero() || sparkApp.Status.AppState.State == so.FailedState || sparkApp.Status.AppState.State == so.CompletedState {
-		return ResourceList{}, nil
+func sparkApplicationResourceUsage(sparkApp so.SparkApplication, charge DynamicAllocationCharge) (ResourceList, error) {
+	usage := objectCount(countSparkApplications)
+	// A completed/failed SparkApplication consumes no resources besides the object itself
+	if sparkApplicationTerminated(sparkApp) {
+		return usage, nil
 	}
-	return resourceUsage(sparkApp.Spec)
+	resources, err := resourceUsage(sparkApp.Spec, charge)
+	if err != nil {
+		return ResourceList{}, err
+	}
+	usage.add(resources)
+	return usage, nil
 }
 
-func scheduledSparkApplicationResourceUsage(sparkApp so.ScheduledSparkApplication) (ResourceList, error) {
-	// Failed validation, will consume no resources
+func scheduledSparkApplicationResourceUsage(sparkApp so.ScheduledSparkApplication, charge DynamicAllocationCharge) (ResourceList, error) {
+	usage := objectCount(countScheduledSparkApplications)
+	// Failed validation, will consume no resources besides the object itself
 	if sparkApp.Status.ScheduleState == so.FailedValidationState {
-		return ResourceList{}, nil
+		return usage, nil
+	}
+	resources, err := resourceUsage(sparkApp.Spec.Template, charge)
+	if err != nil {
+		return ResourceList{}, err
 	}
-	return resourceUsage(sparkApp.Spec.Template)
+	usage.add(resources)
+	return usage, nil
 }
 
 func podResourceUsage(pod *corev1.Pod) ResourceList {
 	spec := pod.Spec
 	var initCores int64
 	var initMemoryBytes int64
+	initOther := make(corev1.ResourceList)
 	completed := make(map[string]struct{})
 
 	for _, containerStatus := range pod.Status.InitContainerStatuses {
@@ -221,21 +367,67 @@ func podResourceUsage(pod *corev1.Pod) ResourceList {
 			c, m := resourcesRequiredToSchedule(container.Resources)
 			initCores = max(c, initCores)
 			initMemoryBytes = max(m, initMemoryBytes)
+			addResources(initOther, otherResourcesRequiredToSchedule(container.Resources), true)
 		}
 	}
 	var cores int64
 	var memoryBytes int64
+	other := make(corev1.ResourceList)
 	for _, container := range spec.Containers {
 		if _, present := completed[container.Name]; !present {
 			c, m := resourcesRequiredToSchedule(container.Resources)
 			cores += c
 			memoryBytes += m
+			addResources(other, otherResourcesRequiredToSchedule(container.Resources), false)
 		}
 	}
 	cores = max(initCores, cores)
 	memoryBytes = max(initMemoryBytes, memoryBytes)
+	addResources(other, initOther, true)
+	other[corev1.ResourcePods] = *resource.NewQuantity(1, resource.DecimalSI)
 	return ResourceList{
 		cpu:    *resource.NewMilliQuantity(cores, resource.DecimalSI),
 		memory: *resource.NewQuantity(memoryBytes, resource.DecimalSI),
+		other:  other,
 	}
 }
+
+// DriverPodResources returns the resources requested by the driver pod of an application with the given spec.
+func DriverPodResources(spec so.SparkApplicationSpec) (corev1.ResourceList, error) {
+	return sparkPodResources(spec.Driver.SparkPodSpec, spec.Driver.CoreRequest, spec.MemoryOverheadFactor, spec.Type)
+}
+
+// ExecutorPodResources returns the resources requested by an executor pod of an application with the given spec.
+func ExecutorPodResources(spec so.SparkApplicationSpec) (corev1.ResourceList, error) {
+	return sparkPodResources(spec.Executor.SparkPodSpec, spec.Executor.CoreRequest, spec.MemoryOverheadFactor, spec.Type)
+}
+
+// sparkPodResources returns the resources requested by a single Spark pod with the given spec and core request.
+func sparkPodResources(spec so.SparkPodSpec, coreRequest *string, memoryOverheadFactor *string, appType so.SparkApplicationType) (corev1.ResourceList, error) {
+	memory, err := memoryRequiredForSparkPod(spec, memoryOverheadFactor, appType, 1)
+	if err != nil {
+		return nil, err
+	}
+	resources := otherResourcesRequiredForSparkPod(spec, 1)
+	resources[corev1.ResourceMemory] = *resource.NewQuantity(memory, resource.BinarySI)
+	// The core request takes precedence over the cores as the cpu request of the pod.
+	if coreRequest != nil {
+		cpu, err := resource.ParseQuantity(*coreRequest)
+		if err != nil {
+			return nil, err
+		}
+		resources[corev1.ResourceCPU] = cpu
+		return resources, nil
+	}
+	cores, err := coresRequiredForSparkPod(spec, 1)
+	if err != nil {
+		return nil, err
+	}
+	resources[corev1.ResourceCPU] = *resource.NewMilliQuantity(cores, resource.DecimalSI)
+	return resources, nil
+}
+
+// InitialExecutors returns the number of executors an application with the given spec starts with.
+func InitialExecutors(spec so.SparkApplicationSpec) int64 {
+	return chargedExecutors(spec, DynamicAllocationChargeInitial)
+}
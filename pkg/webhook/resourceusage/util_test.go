@@ -2,6 +2,11 @@ package resourceusage
 
 import (
 	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	so "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
 )
 
 func assertMemory(memoryString string, expectedBytes int64, t *testing.T) {
@@ -23,3 +28,83 @@ func TestJavaMemoryString(t *testing.T) {
 	assertMemory("10TB", 10*1024*1024*1024*1024, t)
 	assertMemory("10PB", 10*1024*1024*1024*1024*1024, t)
 }
+
+func TestPodResourceUsageOfOtherResources(t *testing.T) {
+	requests := func(storage, gpus string) corev1.ResourceRequirements {
+		return corev1.ResourceRequirements{Requests: corev1.ResourceList{
+			corev1.ResourceEphemeralStorage: resource.MustParse(storage),
+			"nvidia.com/gpu":                resource.MustParse(gpus),
+		}}
+	}
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "init", Resources: requests("5Gi", "0")}},
+			Containers: []corev1.Container{
+				{Name: "main", Resources: requests("1Gi", "1")},
+				{Name: "sidecar", Resources: requests("2Gi", "1")},
+			},
+		},
+	}
+	usage := podResourceUsage(pod)
+	for name, expected := range map[corev1.ResourceName]string{corev1.ResourceEphemeralStorage: "5Gi", "nvidia.com/gpu": "2", corev1.ResourcePods: "1"} {
+		if actual := usage.other[name]; actual.Cmp(resource.MustParse(expected)) != 0 {
+			t.Errorf("%s: expected %s, got %s", name, expected, actual.String())
+		}
+	}
+
+	// Completed containers don't count.
+	pod.Status.InitContainerStatuses = []corev1.ContainerStatus{{Name: "init", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}}}
+	usage = podResourceUsage(pod)
+	if actual := usage.other[corev1.ResourceEphemeralStorage]; actual.Cmp(resource.MustParse("3Gi")) != 0 {
+		t.Errorf("expected 3Gi of ephemeral storage, got %s", actual.String())
+	}
+}
+
+func TestChargedExecutors(t *testing.T) {
+	int32ptr := func(n int32) *int32 { return &n }
+	type testcase struct {
+		name     string
+		spec     so.SparkApplicationSpec
+		expected map[DynamicAllocationCharge]int64
+	}
+	testcases := []testcase{
+		{
+			name:     "default instances",
+			expected: map[DynamicAllocationCharge]int64{DynamicAllocationChargeInitial: 1, DynamicAllocationChargeMin: 1, DynamicAllocationChargeMax: 1},
+		},
+		{
+			name: "dynamic allocation disabled",
+			spec: so.SparkApplicationSpec{
+				Executor:          so.ExecutorSpec{Instances: int32ptr(3)},
+				DynamicAllocation: &so.DynamicAllocation{MaxExecutors: int32ptr(10)},
+			},
+			expected: map[DynamicAllocationCharge]int64{DynamicAllocationChargeInitial: 3, DynamicAllocationChargeMin: 3, DynamicAllocationChargeMax: 3},
+		},
+		{
+			name: "dynamic allocation",
+			spec: so.SparkApplicationSpec{
+				Executor:          so.ExecutorSpec{Instances: int32ptr(3)},
+				DynamicAllocation: &so.DynamicAllocation{Enabled: true, InitialExecutors: int32ptr(2), MinExecutors: int32ptr(1), MaxExecutors: int32ptr(10)},
+			},
+			expected: map[DynamicAllocationCharge]int64{DynamicAllocationChargeInitial: 3, DynamicAllocationChargeMin: 1, DynamicAllocationChargeMax: 10},
+		},
+		{
+			name: "dynamic allocation without bounds",
+			spec: so.SparkApplicationSpec{
+				DynamicAllocation: &so.DynamicAllocation{Enabled: true, InitialExecutors: int32ptr(2)},
+			},
+			expected: map[DynamicAllocationCharge]int64{DynamicAllocationChargeInitial: 2, DynamicAllocationChargeMin: 0, DynamicAllocationChargeMax: 2},
+		},
+	}
+	for _, test := range testcases {
+		for charge, expected := range test.expected {
+			if actual := chargedExecutors(test.spec, charge); actual != expected {
+				t.Errorf("%s: expected %d %s executors, got %d", test.name, expected, charge, actual)
+			}
+		}
+	}
+
+	if _, err := ParseDynamicAllocationCharge("All"); err == nil {
+		t.Error("expected an error parsing an unknown charge")
+	}
+}
@@ -2,11 +2,15 @@ package resourceusage
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	crdinformers "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/informers/externalversions"
 
 	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/client-go/informers"
 	corev1informers "k8s.io/client-go/informers/core/v1"
@@ -16,18 +20,32 @@ import (
 type ResourceUsageWatcher struct {
 	currentUsageLock                     *sync.RWMutex
 	currentUsageByNamespace              map[string]*ResourceList
-	usageByNamespacePod                  map[string]map[string]*ResourceList
-	usageByNamespaceScheduledApplication map[string]map[string]*ResourceList
-	usageByNamespaceApplication          map[string]map[string]*ResourceList
+	usageByNamespacePod                  map[string]map[string]*scopedResourceList
+	usageByNamespaceScheduledApplication map[string]map[string]*scopedResourceList
+	usageByNamespaceApplication          map[string]map[string]*scopedResourceList
+	// usageByNamespaceExcessExecutors holds the usage of the executors of applications running beyond the
+	// executors charged for the applications, keyed by application name.
+	usageByNamespaceExcessExecutors      map[string]map[string]*scopedResourceList
+	executorPodsByNamespaceApplication   map[string]map[string]map[string]struct{}
+	executorChargeByNamespaceApplication map[string]map[string]*executorCharge
+	dynamicAllocationCharge              DynamicAllocationCharge
 	crdInformerFactory                   crdinformers.SharedInformerFactory
 	coreV1InformerFactory                informers.SharedInformerFactory
 	podInformer                          corev1informers.PodInformer
+	// executorReservationsByNamespace holds the times executor pods were admitted within the executors
+	// charged for their application, keyed by namespace, application name and pod name, so that they count
+	// against the charge until the pod informer sees them.
+	executorReservationsByNamespace map[string]map[string]map[string]time.Time
+	now                             func() time.Time
 }
 
 // more convenient replacement for corev1.ResourceList
 type ResourceList struct {
 	cpu    resource.Quantity
 	memory resource.Quantity
+	// other holds the requests of other resources, e.g., ephemeral-storage and extended resources such as
+	// nvidia.com/gpu, the number of pods, and object counts keyed by count/<resource>.<group>.
+	other corev1.ResourceList
 }
 
 const (
@@ -35,20 +53,117 @@ const (
 	KindScheduledSparkApplication = "ScheduledSparkApplication"
 )
 
+// Names of the object counts ResourceQuotas limit that are tracked.
+const (
+	countSparkApplications          corev1.ResourceName = "count/sparkapplications.sparkoperator.k8s.io"
+	countScheduledSparkApplications corev1.ResourceName = "count/scheduledsparkapplications.sparkoperator.k8s.io"
+	countPods                       corev1.ResourceName = "count/pods"
+)
+
 func (r ResourceList) String() string {
-	return fmt.Sprintf("cpu: %v mcpu, memory %v bytes", r.cpu.MilliValue(), r.memory.Value())
+	str := fmt.Sprintf("cpu: %v mcpu, memory %v bytes", r.cpu.MilliValue(), r.memory.Value())
+	for _, name := range sortedResourceNames(r.other) {
+		quantity := r.other[name]
+		str += fmt.Sprintf(", %s: %s", name, quantity.String())
+	}
+	return str
+}
+
+func (r ResourceList) copy() ResourceList {
+	c := ResourceList{cpu: r.cpu.DeepCopy(), memory: r.memory.DeepCopy()}
+	if r.other != nil {
+		c.other = r.other.DeepCopy()
+	}
+	return c
+}
+
+func (r *ResourceList) add(o ResourceList) {
+	r.cpu.Add(o.cpu)
+	r.memory.Add(o.memory)
+	for name, quantity := range o.other {
+		if r.other == nil {
+			r.other = make(corev1.ResourceList)
+		}
+		current := r.other[name]
+		current.Add(quantity)
+		r.other[name] = current
+	}
 }
 
-func newResourceUsageWatcher(crdInformerFactory crdinformers.SharedInformerFactory, coreV1InformerFactory informers.SharedInformerFactory) ResourceUsageWatcher {
+func (r *ResourceList) sub(o ResourceList) {
+	r.cpu.Sub(o.cpu)
+	r.memory.Sub(o.memory)
+	for name, quantity := range o.other {
+		if r.other == nil {
+			r.other = make(corev1.ResourceList)
+		}
+		current := r.other[name]
+		current.Sub(quantity)
+		r.other[name] = current
+	}
+}
+
+func (r ResourceList) isZero() bool {
+	if !r.cpu.IsZero() || !r.memory.IsZero() {
+		return false
+	}
+	for _, quantity := range r.other {
+		if !quantity.IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// quotaUsage returns the usage of the resource limited by a ResourceQuota under the given name, or false if
+// the resource isn't tracked, e.g., limits and the storage of PersistentVolumeClaims.
+func (r ResourceList) quotaUsage(name corev1.ResourceName) (resource.Quantity, bool) {
+	switch name {
+	case corev1.ResourceCPU, corev1.ResourceRequestsCPU:
+		return r.cpu, true
+	case corev1.ResourceMemory, corev1.ResourceRequestsMemory:
+		return r.memory, true
+	case corev1.ResourcePods, countPods:
+		return r.other[corev1.ResourcePods], true
+	case corev1.ResourceEphemeralStorage, corev1.ResourceRequestsEphemeralStorage:
+		return r.other[corev1.ResourceEphemeralStorage], true
+	case countSparkApplications, countScheduledSparkApplications:
+		return r.other[name], true
+	}
+	// Extended resources and huge pages can only be limited by their requests.
+	if requested := strings.TrimPrefix(string(name), corev1.DefaultResourceRequestsPrefix); requested != string(name) {
+		if strings.Contains(requested, "/") || strings.HasPrefix(requested, corev1.ResourceHugePagesPrefix) {
+			return r.other[corev1.ResourceName(requested)], true
+		}
+	}
+	return resource.Quantity{}, false
+}
+
+func sortedResourceNames(resources corev1.ResourceList) []corev1.ResourceName {
+	var names []corev1.ResourceName
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+func newResourceUsageWatcher(crdInformerFactory crdinformers.SharedInformerFactory, coreV1InformerFactory informers.SharedInformerFactory, dynamicAllocationCharge DynamicAllocationCharge) ResourceUsageWatcher {
 	glog.V(2).Infof("Creating new resource usage watcher")
 	r := ResourceUsageWatcher{
 		crdInformerFactory:                   crdInformerFactory,
 		currentUsageLock:                     &sync.RWMutex{},
 		coreV1InformerFactory:                coreV1InformerFactory,
 		currentUsageByNamespace:              make(map[string]*ResourceList),
-		usageByNamespacePod:                  make(map[string]map[string]*ResourceList),
-		usageByNamespaceScheduledApplication: make(map[string]map[string]*ResourceList),
-		usageByNamespaceApplication:          make(map[string]map[string]*ResourceList),
+		usageByNamespacePod:                  make(map[string]map[string]*scopedResourceList),
+		usageByNamespaceScheduledApplication: make(map[string]map[string]*scopedResourceList),
+		usageByNamespaceApplication:          make(map[string]map[string]*scopedResourceList),
+		usageByNamespaceExcessExecutors:      make(map[string]map[string]*scopedResourceList),
+		executorPodsByNamespaceApplication:   make(map[string]map[string]map[string]struct{}),
+		executorReservationsByNamespace:      make(map[string]map[string]map[string]time.Time),
+		executorChargeByNamespaceApplication: make(map[string]map[string]*executorCharge),
+		dynamicAllocationCharge:              dynamicAllocationCharge,
+		now:                                  time.Now,
 	}
 	// Note: Events for each handler are processed serially, so no coordination is needed between
 	// the different callbacks. Coordination is still needed around updating the shared state.
@@ -77,10 +192,7 @@ func (r *ResourceUsageWatcher) GetCurrentResourceUsage(namespace string) Resourc
 	r.currentUsageLock.RLock()
 	defer r.currentUsageLock.RUnlock()
 	if resourceUsageInternal, present := r.currentUsageByNamespace[namespace]; present {
-		return ResourceList{
-			cpu:    resourceUsageInternal.cpu,
-			memory: resourceUsageInternal.memory,
-		}
+		return resourceUsageInternal.copy()
 	}
 	return ResourceList{}
 }
@@ -90,65 +202,92 @@ func (r *ResourceUsageWatcher) GetCurrentResourceUsageWithApplication(namespace,
 	defer r.currentUsageLock.RUnlock()
 	if resourceUsageInternal, present := r.currentUsageByNamespace[namespace]; present {
 		var applicationResources ResourceList
-		var namespaceMap map[string]map[string]*ResourceList
-		switch kind {
-		case KindSparkApplication:
-			namespaceMap = r.usageByNamespaceApplication
-		case KindScheduledSparkApplication:
-			namespaceMap = r.usageByNamespaceScheduledApplication
+		if ar, present := r.unsafeApplicationResources(namespace, kind, name); present {
+			applicationResources = ar.ResourceList.copy()
 		}
-		if applicationMap, present := namespaceMap[namespace]; present {
-			if ar, present := applicationMap[name]; present {
-				applicationResources = *ar
-			}
-		}
-		currentUsage := *resourceUsageInternal // Creates a copy
-		currentUsage.cpu.Sub(applicationResources.cpu)
-		currentUsage.memory.Sub(applicationResources.memory)
+		currentUsage := resourceUsageInternal.copy()
+		currentUsage.sub(applicationResources)
 		return currentUsage, applicationResources
 	}
 	return ResourceList{}, ResourceList{}
 }
 
-func (r *ResourceUsageWatcher) unsafeSetResources(namespace, name string, resources ResourceList, resourceMap map[string]map[string]*ResourceList) {
+// GetCurrentResourceUsageInScope returns the resource usage of the objects in the given namespace that match
+// the given scope, except the application of the given kind and name, and the resource usage of that
+// application if it matches the scope.
+func (r *ResourceUsageWatcher) GetCurrentResourceUsageInScope(namespace, kind, name string, inScope func(usageScope) bool) (namespaceResources, applicationResources ResourceList) {
+	r.currentUsageLock.RLock()
+	defer r.currentUsageLock.RUnlock()
+	application, _ := r.unsafeApplicationResources(namespace, kind, name)
+	for _, resourceMap := range []map[string]map[string]*scopedResourceList{
+		r.usageByNamespacePod,
+		r.usageByNamespaceApplication,
+		r.usageByNamespaceScheduledApplication,
+		r.usageByNamespaceExcessExecutors,
+	} {
+		for _, resources := range resourceMap[namespace] {
+			if resources != application && inScope(resources.scope) {
+				namespaceResources.add(resources.ResourceList)
+			}
+		}
+	}
+	if application != nil && inScope(application.scope) {
+		applicationResources = application.ResourceList.copy()
+	}
+	return namespaceResources, applicationResources
+}
+
+func (r *ResourceUsageWatcher) unsafeApplicationResources(namespace, kind, name string) (*scopedResourceList, bool) {
+	var namespaceMap map[string]map[string]*scopedResourceList
+	switch kind {
+	case KindSparkApplication:
+		namespaceMap = r.usageByNamespaceApplication
+	case KindScheduledSparkApplication:
+		namespaceMap = r.usageByNamespaceScheduledApplication
+	}
+	if applicationMap, present := namespaceMap[namespace]; present {
+		if ar, present := applicationMap[name]; present {
+			return ar, true
+		}
+	}
+	return nil, false
+}
+
+func (r *ResourceUsageWatcher) unsafeSetResources(namespace, name string, resources ResourceList, scope usageScope, resourceMap map[string]map[string]*scopedResourceList) {
 	if _, present := resourceMap[namespace]; !present {
-		resourceMap[namespace] = make(map[string]*ResourceList)
+		resourceMap[namespace] = make(map[string]*scopedResourceList)
 	}
 	// Clear any resource usage currently stored for this object
 	r.unsafeDeleteResources(namespace, name, resourceMap)
-	resourceMap[namespace][name] = &resources
+	resourceMap[namespace][name] = &scopedResourceList{ResourceList: resources, scope: scope}
 	if current, present := r.currentUsageByNamespace[namespace]; present {
-		current.cpu.Add(resources.cpu)
-		current.memory.Add(resources.memory)
+		current.add(resources)
 	} else {
-		r.currentUsageByNamespace[namespace] = &ResourceList{
-			cpu:    resources.cpu,
-			memory: resources.memory,
-		}
+		current := resources.copy()
+		r.currentUsageByNamespace[namespace] = &current
 	}
 }
 
-func (r *ResourceUsageWatcher) unsafeDeleteResources(namespace, name string, resourceMap map[string]map[string]*ResourceList) {
+func (r *ResourceUsageWatcher) unsafeDeleteResources(namespace, name string, resourceMap map[string]map[string]*scopedResourceList) {
 	if namespaceMap, present := resourceMap[namespace]; present {
 		if resources, present := namespaceMap[name]; present {
 			delete(resourceMap[namespace], name)
 			if current, present := r.currentUsageByNamespace[namespace]; present {
-				current.cpu.Sub(resources.cpu)
-				current.memory.Sub(resources.memory)
+				current.sub(resources.ResourceList)
 			}
 		}
 	}
 }
 
-func (r *ResourceUsageWatcher) setResources(typeName, namespace, name string, resources ResourceList, resourceMap map[string]map[string]*ResourceList) {
+func (r *ResourceUsageWatcher) setResources(typeName, namespace, name string, resources ResourceList, scope usageScope, resourceMap map[string]map[string]*scopedResourceList) {
 	glog.V(3).Infof("Updating object %s %s/%s with resources %v", typeName, namespace, name, resources)
 	r.currentUsageLock.Lock()
-	r.unsafeSetResources(namespace, name, resources, resourceMap)
+	r.unsafeSetResources(namespace, name, resources, scope, resourceMap)
 	r.currentUsageLock.Unlock()
 	glog.V(3).Infof("Current resources for namespace %s: %v", namespace, r.currentUsageByNamespace[namespace])
 }
 
-func (r *ResourceUsageWatcher) deleteResources(typeName, namespace, name string, resourceMap map[string]map[string]*ResourceList) {
+func (r *ResourceUsageWatcher) deleteResources(typeName, namespace, name string, resourceMap map[string]map[string]*scopedResourceList) {
 	glog.V(3).Infof("Deleting resources from object %s/%s", namespace, name)
 	r.currentUsageLock.Lock()
 	r.unsafeDeleteResources(namespace, name, resourceMap)
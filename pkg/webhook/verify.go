@@ -0,0 +1,160 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+)
+
+// MissingPatches returns the paths of the fields the webhook adds to pods of the given application that the
+// given pod doesn't carry, e.g., because it was admitted while the webhook was unavailable. A pod carries a
+// field if it has at least the values the webhook would set, so that fields defaulted by the API server don't
+// count as missing. Patches replacing or removing fields Spark sets are not verified. The client is only used
+// to read the Spark ConfigMap.
+func MissingPatches(pod *corev1.Pod, app *v1beta2.SparkApplication, client kubernetes.Interface) ([]string, error) {
+	actual, err := toJSONValue(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	seen := make(map[string]bool)
+	for _, op := range patchSparkPod(pod.DeepCopy(), app, client) {
+		if op.Op != "add" {
+			continue
+		}
+		expected, err := toJSONValue(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		path := strings.TrimSuffix(op.Path, "/-")
+		appended := path != op.Path
+
+		target, found := lookupJSONPointer(actual, path)
+		carried := found
+		if found {
+			if elements, ok := expected.([]interface{}); ok && (appended || isJSONList(target)) {
+				for _, element := range elements {
+					carried = carried && listContains(target, element)
+				}
+			} else if appended {
+				carried = listContains(target, expected)
+			} else {
+				carried = jsonContains(target, expected)
+			}
+		}
+		if !carried && !seen[path] {
+			seen[path] = true
+			missing = append(missing, path)
+		}
+	}
+	return missing, nil
+}
+
+func toJSONValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// lookupJSONPointer returns the value at the given RFC6901 JSON pointer.
+func lookupJSONPointer(value interface{}, pointer string) (interface{}, bool) {
+	if pointer == "" {
+		return value, true
+	}
+	decoder := strings.NewReplacer("~1", "/", "~0", "~")
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			next, ok := v[decoder.Replace(token)]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func isJSONList(value interface{}) bool {
+	_, ok := value.([]interface{})
+	return ok
+}
+
+func listContains(list interface{}, expected interface{}) bool {
+	elements, ok := list.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, element := range elements {
+		if jsonContains(element, expected) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonContains tells if actual has at least the values of expected, i.e., if expected is a subset of actual.
+func jsonContains(actual interface{}, expected interface{}) bool {
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			return len(e) == 0 && actual == nil
+		}
+		for key, value := range e {
+			if !jsonContains(a[key], value) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		if len(e) == 0 {
+			return true
+		}
+		for _, element := range e {
+			if !listContains(actual, element) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(actual, expected)
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
+)
+
+func newVerifyTestPod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "spark-driver",
+			Namespace: "default",
+			Labels: map[string]string{
+				config.SparkRoleLabel:               config.SparkDriverRole,
+				config.LaunchedBySparkOperatorLabel: "true",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  config.SparkDriverContainerName,
+					Image: "spark-driver:latest",
+					Env:   []corev1.EnvVar{{Name: config.SparkConfDirEnvVar, Value: config.DefaultSparkConfDir}},
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1408Mi")},
+					},
+					VolumeMounts: []corev1.VolumeMount{{Name: "spark-local-dir-1", MountPath: "/var/data/spark-1"}},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{Name: "spark-local-dir-1", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+			},
+		},
+	}
+}
+
+func TestMissingPatches(t *testing.T) {
+	var gracePeriod int64 = 30
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "spark-test",
+			Namespace: "default",
+			UID:       "spark-test-1",
+		},
+		Spec: v1beta2.SparkApplicationSpec{
+			Volumes: []corev1.Volume{
+				{Name: "data", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+			},
+			Driver: v1beta2.DriverSpec{
+				SparkPodSpec: v1beta2.SparkPodSpec{
+					VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: "/mnt/data"}},
+					Tolerations: []corev1.Toleration{
+						{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "spark", Effect: corev1.TaintEffectNoSchedule},
+					},
+					Sidecars:                      []corev1.Container{{Name: "sidecar", Image: "sidecar:latest"}},
+					GPU:                           &v1beta2.GPUSpec{Name: "nvidia.com/gpu", Quantity: 1},
+					NodeSelector:                  map[string]string{"pool": "drivers"},
+					TerminationGracePeriodSeconds: &gracePeriod,
+				},
+			},
+		},
+	}
+	client := fake.NewSimpleClientset()
+
+	missing, err := MissingPatches(newVerifyTestPod(), app, client)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"/metadata/ownerReferences",
+		"/spec/volumes",
+		"/spec/containers/0/volumeMounts",
+		"/spec/tolerations",
+		"/spec/containers",
+		"/spec/nodeSelector",
+		"/spec/containers/0/resources/limits/nvidia.com~1gpu",
+		"/spec/terminationGracePeriodSeconds",
+	}, missing)
+
+	// A pod mutated by the webhook carries everything, even with the defaults the API server sets.
+	mutated, err := PatchSparkPod(newVerifyTestPod(), app, client)
+	assert.NoError(t, err)
+	for i := range mutated.Spec.Containers {
+		mutated.Spec.Containers[i].ImagePullPolicy = corev1.PullIfNotPresent
+		mutated.Spec.Containers[i].TerminationMessagePath = corev1.TerminationMessagePathDefault
+	}
+	mutated.Spec.Tolerations = append(mutated.Spec.Tolerations, corev1.Toleration{
+		Key:      "node.kubernetes.io/not-ready",
+		Operator: corev1.TolerationOpExists,
+		Effect:   corev1.TaintEffectNoExecute,
+	})
+	missing, err = MissingPatches(mutated, app, client)
+	assert.NoError(t, err)
+	assert.Empty(t, missing)
+
+	// An executor pod whose application has no customizations of executors misses nothing.
+	executor := newVerifyTestPod()
+	executor.Labels[config.SparkRoleLabel] = config.SparkExecutorRole
+	executor.Spec.Containers[0].Name = config.Spark3DefaultExecutorContainerName
+	missing, err = MissingPatches(executor, app, client)
+	assert.NoError(t, err)
+	assert.Empty(t, missing)
+}
+
+func TestJSONContains(t *testing.T) {
+	actual := map[string]interface{}{
+		"name":  "spark",
+		"ports": []interface{}{map[string]interface{}{"containerPort": 8080.0, "protocol": "TCP"}},
+	}
+	assert.True(t, jsonContains(actual, map[string]interface{}{"name": "spark"}))
+	assert.True(t, jsonContains(actual, map[string]interface{}{"ports": []interface{}{map[string]interface{}{"containerPort": 8080.0}}}))
+	assert.False(t, jsonContains(actual, map[string]interface{}{"name": "other"}))
+	assert.False(t, jsonContains(actual, map[string]interface{}{"ports": []interface{}{map[string]interface{}{"containerPort": 9090.0}}}))
+	assert.True(t, jsonContains(nil, map[string]interface{}{}))
+	assert.False(t, jsonContains(nil, map[string]interface{}{"name": "spark"}))
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package webhook
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"flag"
@@ -34,6 +35,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 
@@ -76,6 +78,7 @@ type WebHook struct {
 	lister                         crdlisters.SparkApplicationLister
 	server                         *http.Server
 	certProvider                   *certProvider
+	certManager                    *certManager
 	serviceRef                     *arv1.ServiceReference
 	failurePolicy                  arv1.FailurePolicyType
 	selector                       *metav1.LabelSelector
@@ -83,8 +86,11 @@ type WebHook struct {
 	deregisterOnExit               bool
 	enableResourceQuotaEnforcement bool
 	resourceQuotaEnforcer          resourceusage.ResourceQuotaEnforcer
-	coreV1InformerFactory          informers.SharedInformerFactory
-	timeoutSeconds                 *int32
+	// sparkQuotaEnforcer rejects SparkApplications that can never run within their SparkQuotas, or is nil if
+	// SparkQuotas are not enforced.
+	sparkQuotaEnforcer    *resourceusage.SparkQuotaEnforcer
+	coreV1InformerFactory informers.SharedInformerFactory
+	timeoutSeconds        *int32
 }
 
 // Configuration parsed from command-line flags
@@ -93,6 +99,9 @@ type webhookFlags struct {
 	serverCertKey            string
 	caCert                   string
 	certReloadInterval       time.Duration
+	certSecretName           string
+	certValidity             time.Duration
+	certRenewBefore          time.Duration
 	webhookServiceNamespace  string
 	webhookServiceName       string
 	webhookPort              int
@@ -109,6 +118,9 @@ func init() {
 	flag.StringVar(&userConfig.serverCertKey, "webhook-server-cert-key", "/etc/webhook-certs/server-key.pem", "Path to the webhook certificate key.")
 	flag.StringVar(&userConfig.caCert, "webhook-ca-cert", "/etc/webhook-certs/ca-cert.pem", "Path to the X.509-formatted webhook CA certificate.")
 	flag.DurationVar(&userConfig.certReloadInterval, "webhook-cert-reload-interval", 15*time.Minute, "Time between webhook cert reloads.")
+	flag.StringVar(&userConfig.certSecretName, "webhook-cert-secret-name", "", "Name of a Secret in the namespace of the webhook Service into which the operator generates the webhook CA and server certificates itself, instead of reading them from files. The leader rotates them before they expire and keeps the caBundle of the webhook configurations in sync.")
+	flag.DurationVar(&userConfig.certValidity, "webhook-cert-validity", 365*24*time.Hour, "Validity of the webhook certificates generated by the operator.")
+	flag.DurationVar(&userConfig.certRenewBefore, "webhook-cert-renew-before", 30*24*time.Hour, "How long before they expire the webhook certificates generated by the operator are rotated.")
 	flag.StringVar(&userConfig.webhookServiceNamespace, "webhook-svc-namespace", "spark-operator", "The namespace of the Service for the webhook server.")
 	flag.StringVar(&userConfig.webhookServiceName, "webhook-svc-name", "spark-webhook", "The name of the Service for the webhook server.")
 	flag.IntVar(&userConfig.webhookPort, "webhook-port", 8080, "Service port of the webhook server.")
@@ -123,17 +135,34 @@ func New(
 	jobNamespace string,
 	deregisterOnExit bool,
 	enableResourceQuotaEnforcement bool,
+	dynamicAllocationCharge resourceusage.DynamicAllocationCharge,
 	coreV1InformerFactory informers.SharedInformerFactory,
+	sparkQuotaEnforcer *resourceusage.SparkQuotaEnforcer,
 	webhookTimeout *int) (*WebHook, error) {
 
-	cert, err := NewCertProvider(
-		userConfig.serverCert,
-		userConfig.serverCertKey,
-		userConfig.caCert,
-		userConfig.certReloadInterval,
-	)
-	if err != nil {
-		return nil, err
+	var cert *certProvider
+	var manager *certManager
+	if userConfig.certSecretName != "" {
+		manager = newCertManager(
+			clientset,
+			userConfig.webhookServiceNamespace,
+			userConfig.certSecretName,
+			userConfig.webhookServiceName,
+			userConfig.certValidity,
+			userConfig.certRenewBefore,
+		)
+		cert = newSecretCertProvider(manager, userConfig.certReloadInterval)
+	} else {
+		var err error
+		cert, err = NewCertProvider(
+			userConfig.serverCert,
+			userConfig.serverCertKey,
+			userConfig.caCert,
+			userConfig.certReloadInterval,
+		)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	path := "/webhook"
@@ -147,12 +176,14 @@ func New(
 		informerFactory:                informerFactory,
 		lister:                         informerFactory.Sparkoperator().V1beta2().SparkApplications().Lister(),
 		certProvider:                   cert,
+		certManager:                    manager,
 		serviceRef:                     serviceRef,
 		sparkJobNamespace:              jobNamespace,
 		deregisterOnExit:               deregisterOnExit,
 		failurePolicy:                  arv1.Ignore,
 		coreV1InformerFactory:          coreV1InformerFactory,
 		enableResourceQuotaEnforcement: enableResourceQuotaEnforcement,
+		sparkQuotaEnforcer:             sparkQuotaEnforcer,
 		timeoutSeconds:                 func(b int32) *int32 { return &b }(int32(*webhookTimeout)),
 	}
 
@@ -173,7 +204,7 @@ func New(
 	}
 
 	if enableResourceQuotaEnforcement {
-		hook.resourceQuotaEnforcer = resourceusage.NewResourceQuotaEnforcer(informerFactory, coreV1InformerFactory)
+		hook.resourceQuotaEnforcer = resourceusage.NewResourceQuotaEnforcer(informerFactory, coreV1InformerFactory, dynamicAllocationCharge)
 	}
 
 	mux := http.NewServeMux()
@@ -214,6 +245,9 @@ func (wh *WebHook) Start(stopCh <-chan struct{}) error {
 			return err
 		}
 	}
+	if err := wh.sparkQuotaEnforcer.WaitForCacheSync(stopCh); err != nil {
+		return err
+	}
 
 	go func() {
 		glog.Info("Starting the Spark admission webhook server")
@@ -225,6 +259,131 @@ func (wh *WebHook) Start(stopCh <-chan struct{}) error {
 	return wh.selfRegistration(userConfig.webhookConfigName)
 }
 
+// StartCertRotation generates the webhook certificates if the operator manages them, rotates them before
+// they expire, and keeps the caBundle of the webhook configurations in sync with them, until stopCh is closed.
+// It must only be called by the leader.
+func (wh *WebHook) StartCertRotation(stopCh <-chan struct{}) {
+	if wh.certManager == nil {
+		return
+	}
+	glog.Info("Starting the rotation of the webhook certificates")
+	go wait.Until(wh.rotateCerts, userConfig.certReloadInterval, stopCh)
+}
+
+func (wh *WebHook) rotateCerts() {
+	// Certificates staged by an earlier pass are only served once the webhook configurations trust their CA,
+	// which was added to their caBundle by that pass.
+	stagedCACert, err := wh.certManager.stagedCACert()
+	if err != nil {
+		glog.Errorf("failed to rotate the webhook certificates: %v", err)
+		return
+	}
+	if stagedCACert != nil {
+		trusted, err := wh.caBundleTrusts(userConfig.webhookConfigName, stagedCACert)
+		if err != nil {
+			glog.Errorf("failed to read the caBundle of the webhook configurations: %v", err)
+		} else if trusted {
+			if err := wh.certManager.switchCerts(); err != nil {
+				glog.Errorf("failed to switch to the staged webhook certificates: %v", err)
+				return
+			}
+		}
+	}
+
+	caBundle, err := wh.certManager.ensureCerts()
+	if err != nil {
+		glog.Errorf("failed to rotate the webhook certificates: %v", err)
+		return
+	}
+	wh.certProvider.updateCert()
+	if err := wh.updateCABundle(userConfig.webhookConfigName, caBundle); err != nil {
+		glog.Errorf("failed to update the caBundle of the webhook configurations: %v", err)
+	}
+}
+
+// caBundleTrusts returns whether the caBundle of every webhook in the webhook configurations contains the given
+// CA certificate. Configurations that don't exist don't need to trust it.
+func (wh *WebHook) caBundleTrusts(webhookConfigName string, caCert []byte) (bool, error) {
+	mutating, err := wh.clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), webhookConfigName, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+	if err == nil {
+		for _, webhook := range mutating.Webhooks {
+			if !bytes.Contains(webhook.ClientConfig.CABundle, caCert) {
+				return false, nil
+			}
+		}
+	}
+
+	if !wh.validatesApplications() {
+		return true, nil
+	}
+	validating, err := wh.clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(context.TODO(), webhookConfigName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	for _, webhook := range validating.Webhooks {
+		if !bytes.Contains(webhook.ClientConfig.CABundle, caCert) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// updateCABundle sets the caBundle of the webhooks in the webhook configurations, if they exist.
+func (wh *WebHook) updateCABundle(webhookConfigName string, caBundle []byte) error {
+	mwcClient := wh.clientset.AdmissionregistrationV1().MutatingWebhookConfigurations()
+	mutating, err := mwcClient.Get(context.TODO(), webhookConfigName, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err == nil {
+		changed := false
+		for i := range mutating.Webhooks {
+			if !bytes.Equal(mutating.Webhooks[i].ClientConfig.CABundle, caBundle) {
+				mutating.Webhooks[i].ClientConfig.CABundle = caBundle
+				changed = true
+			}
+		}
+		if changed {
+			glog.Info("Updating the caBundle of the MutatingWebhookConfiguration for the Spark pod admission webhook")
+			if _, err := mwcClient.Update(context.TODO(), mutating, metav1.UpdateOptions{}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !wh.validatesApplications() {
+		return nil
+	}
+	vwcClient := wh.clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations()
+	validating, err := vwcClient.Get(context.TODO(), webhookConfigName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	changed := false
+	for i := range validating.Webhooks {
+		if !bytes.Equal(validating.Webhooks[i].ClientConfig.CABundle, caBundle) {
+			validating.Webhooks[i].ClientConfig.CABundle = caBundle
+			changed = true
+		}
+	}
+	if changed {
+		glog.Info("Updating the caBundle of the ValidatingWebhookConfiguration for the SparkApplication resource quota enforcement webhook")
+		if _, err := vwcClient.Update(context.TODO(), validating, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Stop deregisters itself with the API server and stops the admission webhook server.
 func (wh *WebHook) Stop() error {
 	// Do not deregister if strict error handling is enabled; pod deletions are common, and we
@@ -276,13 +435,21 @@ func (wh *WebHook) serve(w http.ResponseWriter, r *http.Request) {
 	var reviewResponse *admissionv1.AdmissionResponse
 	switch review.Request.Resource {
 	case podResource:
-		reviewResponse, whErr = mutatePods(review, wh.lister, wh.sparkJobNamespace, wh.clientset)
+		var enforcer *resourceusage.ResourceQuotaEnforcer
+		if wh.enableResourceQuotaEnforcement {
+			enforcer = &wh.resourceQuotaEnforcer
+		}
+		reviewResponse, whErr = mutatePods(review, wh.lister, wh.sparkJobNamespace, wh.clientset, enforcer)
 	case sparkApplicationResource:
-		if !wh.enableResourceQuotaEnforcement {
+		if !wh.validatesApplications() {
 			unexpectedResourceType(w, review.Request.Resource.String())
 			return
 		}
-		reviewResponse, whErr = admitSparkApplications(review, wh.resourceQuotaEnforcer)
+		var enforcer *resourceusage.ResourceQuotaEnforcer
+		if wh.enableResourceQuotaEnforcement {
+			enforcer = &wh.resourceQuotaEnforcer
+		}
+		reviewResponse, whErr = admitSparkApplications(review, enforcer, wh.sparkQuotaEnforcer)
 	case scheduledSparkApplicationResource:
 		if !wh.enableResourceQuotaEnforcement {
 			unexpectedResourceType(w, review.Request.Resource.String())
@@ -354,7 +521,7 @@ func denyRequest(w http.ResponseWriter, reason string, code int) {
 func (wh *WebHook) selfRegistration(webhookConfigName string) error {
 	mwcClient := wh.clientset.AdmissionregistrationV1().MutatingWebhookConfigurations()
 	vwcClient := wh.clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations()
-	caCert, err := readCertFile(wh.certProvider.caCertFile)
+	caCert, err := wh.certProvider.caBundle()
 	if err != nil {
 		return err
 	}
@@ -370,13 +537,17 @@ func (wh *WebHook) selfRegistration(webhookConfigName string) error {
 		},
 	}
 
+	validatedResources := []string{sparkApplicationResource.Resource}
+	if wh.enableResourceQuotaEnforcement {
+		validatedResources = append(validatedResources, scheduledSparkApplicationResource.Resource)
+	}
 	validatingRules := []arv1.RuleWithOperations{
 		{
 			Operations: []arv1.OperationType{arv1.Create, arv1.Update},
 			Rule: arv1.Rule{
 				APIGroups:   []string{crdapi.GroupName},
 				APIVersions: []string{crdv1beta2.Version},
-				Resources:   []string{sparkApplicationResource.Resource, scheduledSparkApplicationResource.Resource},
+				Resources:   validatedResources,
 			},
 		},
 	}
@@ -441,7 +612,7 @@ func (wh *WebHook) selfRegistration(webhookConfigName string) error {
 		}
 	}
 
-	if wh.enableResourceQuotaEnforcement {
+	if wh.validatesApplications() {
 		validatingExisting, validatingGetErr := vwcClient.Get(context.TODO(), webhookConfigName, metav1.GetOptions{})
 		if validatingGetErr != nil {
 			if !errors.IsNotFound(validatingGetErr) {
@@ -476,7 +647,7 @@ func (wh *WebHook) selfRegistration(webhookConfigName string) error {
 func (wh *WebHook) selfDeregistration(webhookConfigName string) error {
 	mutatingConfigs := wh.clientset.AdmissionregistrationV1().MutatingWebhookConfigurations()
 	validatingConfigs := wh.clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations()
-	if wh.enableResourceQuotaEnforcement {
+	if wh.validatesApplications() {
 		err := validatingConfigs.Delete(context.TODO(), webhookConfigName, metav1.DeleteOptions{GracePeriodSeconds: int64ptr(0)})
 		if err != nil {
 			return err
@@ -485,7 +656,16 @@ func (wh *WebHook) selfDeregistration(webhookConfigName string) error {
 	return mutatingConfigs.Delete(context.TODO(), webhookConfigName, metav1.DeleteOptions{GracePeriodSeconds: int64ptr(0)})
 }
 
-func admitSparkApplications(review *admissionv1.AdmissionReview, enforcer resourceusage.ResourceQuotaEnforcer) (*admissionv1.AdmissionResponse, error) {
+// validatesApplications tells if the validating webhook admitting SparkApplications is needed, which is the case
+// if either ResourceQuotas or SparkQuotas are enforced.
+func (wh *WebHook) validatesApplications() bool {
+	return wh.enableResourceQuotaEnforcement || wh.sparkQuotaEnforcer != nil
+}
+
+func admitSparkApplications(
+	review *admissionv1.AdmissionReview,
+	enforcer *resourceusage.ResourceQuotaEnforcer,
+	sparkQuotaEnforcer *resourceusage.SparkQuotaEnforcer) (*admissionv1.AdmissionResponse, error) {
 	if review.Request.Resource != sparkApplicationResource {
 		return nil, fmt.Errorf("expected resource to be %s, got %s", sparkApplicationResource, review.Request.Resource)
 	}
@@ -496,9 +676,18 @@ func admitSparkApplications(review *admissionv1.AdmissionReview, enforcer resour
 		return nil, fmt.Errorf("failed to unmarshal a SparkApplication from the raw data in the admission request: %v", err)
 	}
 
-	reason, err := enforcer.AdmitSparkApplication(*app)
-	if err != nil {
-		return nil, fmt.Errorf("resource quota enforcement failed for SparkApplication: %v", err)
+	var reason string
+	if enforcer != nil {
+		var err error
+		if reason, err = enforcer.AdmitSparkApplication(*app); err != nil {
+			return nil, fmt.Errorf("resource quota enforcement failed for SparkApplication: %v", err)
+		}
+	}
+	if reason == "" {
+		var err error
+		if reason, err = sparkQuotaEnforcer.AdmitSparkApplication(*app); err != nil {
+			return nil, fmt.Errorf("SparkQuota enforcement failed for SparkApplication: %v", err)
+		}
 	}
 	response := &admissionv1.AdmissionResponse{Allowed: reason == ""}
 	if reason != "" {
@@ -535,10 +724,20 @@ func admitScheduledSparkApplications(review *admissionv1.AdmissionReview, enforc
 	return response, nil
 }
 
+// MutatePod returns the response of the webhook to the given admission review of the creation of a pod, whose
+// patch holds the customizations of the application of the pod, without enforcing resource quotas.
+func MutatePod(
+	review *admissionv1.AdmissionReview,
+	lister crdlisters.SparkApplicationLister,
+	client kubernetes.Interface) (*admissionv1.AdmissionResponse, error) {
+	return mutatePods(review, lister, corev1.NamespaceAll, client, nil)
+}
+
 func mutatePods(
 	review *admissionv1.AdmissionReview,
 	lister crdlisters.SparkApplicationLister,
-	sparkJobNs string, client kubernetes.Interface) (*admissionv1beta1.AdmissionResponse, error) {
+	sparkJobNs string, client kubernetes.Interface,
+	enforcer *resourceusage.ResourceQuotaEnforcer) (*admissionv1.AdmissionResponse, error) {
 	raw := review.Request.Object.Raw
 	pod := &corev1.Pod{}
 	if err := json.Unmarshal(raw, pod); err != nil {
@@ -552,6 +751,22 @@ func mutatePods(
 		return response, nil
 	}
 
+	// Executors created beyond those admitted with their application must fit into the ResourceQuotas.
+	if enforcer != nil && util.IsExecutorPod(pod) {
+		reason, err := admitExecutorPod(pod, review.Request.Namespace, lister, enforcer)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			response.Allowed = false
+			response.Result = &metav1.Status{
+				Message: reason,
+				Code:    400,
+			}
+			return response, nil
+		}
+	}
+
 	// Try getting the SparkApplication name from the annotation for that.
 	appName := pod.Labels[config.SparkAppNameLabel]
 	if appName == "" {
@@ -562,6 +777,20 @@ func mutatePods(
 		return nil, fmt.Errorf("failed to get SparkApplication %s/%s: %v", review.Request.Namespace, appName, err)
 	}
 
+	// The customizations of the application are already in the pod template the pod was created from. As
+	// anyone creating a pod can set the annotation, the pod is only left alone if it carries them all.
+	if pod.Annotations[config.PodTemplateMutationAnnotation] == "true" {
+		missing, err := MissingPatches(pod, app, client)
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify pod %s/%s: %v", review.Request.Namespace, pod.Name, err)
+		}
+		if len(missing) == 0 {
+			glog.V(2).Infof("Pod %s in namespace %s was created from a pod template of the operator", pod.GetObjectMeta().GetName(), review.Request.Namespace)
+			return response, nil
+		}
+		glog.Warningf("Pod %s in namespace %s is annotated with %s but misses %s", pod.GetObjectMeta().GetName(), review.Request.Namespace, config.PodTemplateMutationAnnotation, strings.Join(missing, ", "))
+	}
+
 	patchOps := patchSparkPod(pod, app, client)
 	if len(patchOps) > 0 {
 		glog.V(2).Infof("Pod %s in namespace %s is subject to mutation", pod.GetObjectMeta().GetName(), review.Request.Namespace)
@@ -578,6 +807,26 @@ func mutatePods(
 	return response, nil
 }
 
+func admitExecutorPod(
+	pod *corev1.Pod,
+	namespace string,
+	lister crdlisters.SparkApplicationLister,
+	enforcer *resourceusage.ResourceQuotaEnforcer) (string, error) {
+	appName := pod.Labels[config.SparkAppNameLabel]
+	if appName == "" {
+		return "", nil
+	}
+	app, err := lister.SparkApplications(namespace).Get(appName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get SparkApplication %s/%s: %v", namespace, appName, err)
+	}
+	reason, err := enforcer.AdmitExecutorPod(pod, *app)
+	if err != nil {
+		return "", fmt.Errorf("resource quota enforcement failed for Pod: %v", err)
+	}
+	return reason, nil
+}
+
 func inSparkJobNamespace(podNs string, sparkJobNamespace string) bool {
 	if sparkJobNamespace == corev1.NamespaceAll {
 		return true
@@ -78,7 +78,7 @@ func TestMutatePod(t *testing.T) {
 			Namespace: "default",
 		},
 	}
-	response, _ := mutatePods(review, lister, "default", kubeClient)
+	response, _ := mutatePods(review, lister, "default", kubeClient, nil)
 	assert.True(t, response.Allowed)
 
 	// 2. Test processing Spark pod with only one patch: adding an OwnerReference.
@@ -100,7 +100,7 @@ func TestMutatePod(t *testing.T) {
 		t.Error(err)
 	}
 	review.Request.Object.Raw = podBytes
-	response, _ = mutatePods(review, lister, "default", kubeClient)
+	response, _ = mutatePods(review, lister, "default", kubeClient, nil)
 	assert.True(t, response.Allowed)
 	assert.Equal(t, admissionv1.PatchTypeJSONPatch, *response.PatchType)
 	assert.True(t, len(response.Patch) > 0)
@@ -173,13 +173,43 @@ func TestMutatePod(t *testing.T) {
 		t.Error(err)
 	}
 	review.Request.Object.Raw = podBytes
-	response, _ = mutatePods(review, lister, "default", kubeClient)
+	response, _ = mutatePods(review, lister, "default", kubeClient, nil)
 	assert.True(t, response.Allowed)
 	assert.Equal(t, admissionv1.PatchTypeJSONPatch, *response.PatchType)
 	assert.True(t, len(response.Patch) > 0)
 	var patchOps []*patchOperation
 	json.Unmarshal(response.Patch, &patchOps)
-	assert.Equal(t, 6, len(patchOps))
+	assert.Equal(t, 7, len(patchOps))
+
+	// 4. Test processing Spark pod annotated as created from a pod template of the operator without the
+	// customizations of its application.
+	pod1.Annotations = map[string]string{config.PodTemplateMutationAnnotation: "true"}
+	podBytes, err = serializePod(pod1)
+	if err != nil {
+		t.Error(err)
+	}
+	review.Request.Object.Raw = podBytes
+	response, _ = mutatePods(review, lister, "default", kubeClient, nil)
+	assert.True(t, response.Allowed)
+	assert.Equal(t, admissionv1.PatchTypeJSONPatch, *response.PatchType)
+	patchOps = nil
+	json.Unmarshal(response.Patch, &patchOps)
+	assert.Equal(t, 7, len(patchOps))
+
+	// 5. Test processing Spark pod created from a pod template of the operator.
+	templatePod, err := PatchSparkPod(pod1, app2, kubeClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	podBytes, err = serializePod(templatePod)
+	if err != nil {
+		t.Error(err)
+	}
+	review.Request.Object.Raw = podBytes
+	response, _ = mutatePods(review, lister, "default", kubeClient, nil)
+	assert.True(t, response.Allowed)
+	assert.Nil(t, response.PatchType)
+	assert.Empty(t, response.Patch)
 }
 
 func serializePod(pod *corev1.Pod) ([]byte, error) {
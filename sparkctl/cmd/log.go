@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -29,11 +30,14 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clientset "k8s.io/client-go/kubernetes"
 
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
 	crdclientset "github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/client/clientset/versioned"
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/config"
 )
 
 var ExecutorId int32
 var FollowLogs bool
+var SubmissionOutput bool
 
 var logCommand = &cobra.Command{
 	Use:   "log <name>",
@@ -67,6 +71,8 @@ func init() {
 	logCommand.Flags().Int32VarP(&ExecutorId, "executor", "e", -1,
 		"id of the executor to fetch logs for")
 	logCommand.Flags().BoolVarP(&FollowLogs, "follow", "f", false, "whether to stream the logs")
+	logCommand.Flags().BoolVarP(&SubmissionOutput, "submission", "s", false,
+		"whether to print the output of spark-submit for the latest submission attempts instead of pod logs")
 }
 
 func doLog(name string, kubeClientset clientset.Interface, crdClientset crdclientset.Interface) error {
@@ -75,6 +81,10 @@ func doLog(name string, kubeClientset clientset.Interface, crdClientset crdclien
 		return fmt.Errorf("failed to get SparkApplication %s: %v", name, err)
 	}
 
+	if SubmissionOutput {
+		return printSubmissionOutput(os.Stdout, kubeClientset, app)
+	}
+
 	var podName string
 	if ExecutorId < 0 {
 		podName = app.Status.DriverInfo.PodName
@@ -124,3 +134,31 @@ func streamLogs(out io.Writer, kubeClientset clientset.Interface, podName string
 	}
 	return nil
 }
+
+// printSubmissionOutput prints the output of spark-submit recorded for the latest submission attempts of the
+// given application, oldest attempt first.
+func printSubmissionOutput(out io.Writer, kubeClientset clientset.Interface, app *v1beta2.SparkApplication) error {
+	if app.Status.SubmissionOutputConfigMap == "" {
+		return fmt.Errorf("no output of spark-submit is recorded for SparkApplication %s", app.Name)
+	}
+	configMap, err := kubeClientset.CoreV1().ConfigMaps(Namespace).Get(context.TODO(), app.Status.SubmissionOutputConfigMap, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	var attempts []int
+	for key := range configMap.Data {
+		var attempt int
+		if _, err := fmt.Sscanf(key, config.SubmissionOutputStdoutKeyFormat, &attempt); err == nil {
+			attempts = append(attempts, attempt)
+		}
+	}
+	sort.Ints(attempts)
+	for _, attempt := range attempts {
+		fmt.Fprintf(out, "==> submission attempt %d, stdout <==\n", attempt)
+		fmt.Fprintln(out, configMap.Data[fmt.Sprintf(config.SubmissionOutputStdoutKeyFormat, attempt)])
+		fmt.Fprintf(out, "==> submission attempt %d, stderr <==\n", attempt)
+		fmt.Fprintln(out, configMap.Data[fmt.Sprintf(config.SubmissionOutputStderrKeyFormat, attempt)])
+	}
+	return nil
+}
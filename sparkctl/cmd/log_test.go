@@ -0,0 +1,62 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeclientfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/apis/sparkoperator.k8s.io/v1beta2"
+)
+
+func TestPrintSubmissionOutput(t *testing.T) {
+	kubeClient := kubeclientfake.NewSimpleClientset()
+	kubeClient.CoreV1().ConfigMaps(Namespace).Create(context.TODO(), &apiv1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo-submission-output", Namespace: Namespace},
+		Data: map[string]string{
+			"attempt-10.stdout": "",
+			"attempt-10.stderr": "submitted",
+			"attempt-9.stdout":  "",
+			"attempt-9.stderr":  "connection refused",
+		},
+	}, metav1.CreateOptions{})
+
+	app := &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: Namespace},
+		Status:     v1beta2.SparkApplicationStatus{SubmissionOutputConfigMap: "foo-submission-output"},
+	}
+	var out bytes.Buffer
+	assert.NoError(t, printSubmissionOutput(&out, kubeClient, app))
+	assert.Equal(t, `==> submission attempt 9, stdout <==
+
+==> submission attempt 9, stderr <==
+connection refused
+==> submission attempt 10, stdout <==
+
+==> submission attempt 10, stderr <==
+submitted
+`, out.String())
+
+	app.Status.SubmissionOutputConfigMap = ""
+	assert.Error(t, printSubmissionOutput(&out, kubeClient, app))
+}
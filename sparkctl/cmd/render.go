@@ -0,0 +1,138 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	apiv1 "k8s.io/api/core/v1"
+	clientset "k8s.io/client-go/kubernetes"
+
+	"github.com/GoogleCloudPlatform/spark-on-k8s-operator/pkg/controller/sparkapplication"
+)
+
+// shellSafeArg matches arguments that don't need quoting in a shell.
+var shellSafeArg = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+var renderCmd = &cobra.Command{
+	Use:   "render <yaml file>",
+	Short: "Render the spark-submit command and the pods of a SparkApplication without creating anything",
+	Long: `Render the spark-submit command the operator would run for a SparkApplication in a given YAML file,
+and the driver and executor pods as patched by the webhook, without creating anything.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, "must specify a YAML file of a SparkApplication")
+			return
+		}
+
+		config, err := buildConfig(KubeConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to get Kubernetes client: %v\n", err)
+			return
+		}
+		kubeClient, err := getKubeClientForConfig(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to get Kubernetes client: %v\n", err)
+			return
+		}
+
+		if err := renderFromYaml(os.Stdout, args[0], config.Host, kubeClient); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+	},
+}
+
+func renderFromYaml(out io.Writer, yamlFile string, apiServerHost string, kubeClient clientset.Interface) error {
+	app, err := loadFromYAML(yamlFile)
+	if err != nil {
+		return fmt.Errorf("failed to read a SparkApplication from %s: %v", yamlFile, err)
+	}
+	app.Namespace = Namespace
+
+	// The operator runs spark-submit with the in-cluster address of the API server, for which the address
+	// in the kubeconfig is used instead.
+	masterURL, err := getMasterURL(apiServerHost)
+	if err != nil {
+		return err
+	}
+
+	rendering, err := sparkapplication.Render(app, masterURL, kubeClient)
+	if err != nil {
+		return fmt.Errorf("failed to render SparkApplication %s: %v", app.Name, err)
+	}
+	return printRendering(out, rendering)
+}
+
+// getMasterURL returns the master URL of spark-submit for the API server at the given address.
+func getMasterURL(apiServerHost string) (string, error) {
+	if !strings.Contains(apiServerHost, "://") {
+		apiServerHost = "https://" + apiServerHost
+	}
+	apiServerURL, err := url.Parse(apiServerHost)
+	if err != nil {
+		return "", fmt.Errorf("invalid address of the API server %q: %v", apiServerHost, err)
+	}
+	port := apiServerURL.Port()
+	if port == "" {
+		port = "443"
+	}
+	return fmt.Sprintf("k8s://https://%s", net.JoinHostPort(apiServerURL.Hostname(), port)), nil
+}
+
+func printRendering(out io.Writer, rendering *sparkapplication.Rendering) error {
+	fmt.Fprintln(out, "# spark-submit command")
+	fmt.Fprint(out, "spark-submit")
+	args := rendering.SparkSubmitArgs
+	for i := 0; i < len(args); i++ {
+		// Print an option and its value on a line.
+		line := quoteShellArg(args[i])
+		if strings.HasPrefix(args[i], "--") && i+1 < len(args) {
+			i++
+			line += " " + quoteShellArg(args[i])
+		}
+		fmt.Fprintf(out, " \\\n  %s", line)
+	}
+	fmt.Fprintln(out)
+
+	for _, pod := range []struct {
+		role string
+		pod  *apiv1.Pod
+	}{{"driver", rendering.DriverPod}, {"executor", rendering.ExecutorPod}} {
+		podJSON, err := json.MarshalIndent(pod.pod, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "\n# %s pod\n%s\n", pod.role, podJSON)
+	}
+	return nil
+}
+
+func quoteShellArg(arg string) string {
+	if shellSafeArg.MatchString(arg) {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'"'"'`) + "'"
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2021 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	kubeclientfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRenderFromYaml(t *testing.T) {
+	kubeClient := kubeclientfake.NewSimpleClientset()
+	var out bytes.Buffer
+	assert.NoError(t, renderFromYaml(&out, "testdata/test-app.yaml", "https://10.0.0.1:6443", kubeClient))
+	output := out.String()
+	assert.Contains(t, output, "# spark-submit command\nspark-submit \\\n  --class org.examples.SparkExample \\\n  --master k8s://https://10.0.0.1:6443 \\\n")
+	assert.Contains(t, output, " \\\n  local:///path/to/example.jar\n")
+	assert.Contains(t, output, "# driver pod\n{\n")
+	assert.Contains(t, output, `"name": "example-driver"`)
+	assert.Contains(t, output, "# executor pod\n{\n")
+	assert.Contains(t, output, `"name": "example-exec-1"`)
+	assert.Empty(t, kubeClient.Actions())
+}
+
+func TestGetMasterURL(t *testing.T) {
+	masterURL, err := getMasterURL("kubernetes.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "k8s://https://kubernetes.example.com:443", masterURL)
+
+	masterURL, err = getMasterURL("https://127.0.0.1:6443")
+	assert.NoError(t, err)
+	assert.Equal(t, "k8s://https://127.0.0.1:6443", masterURL)
+}
+
+func TestQuoteShellArg(t *testing.T) {
+	assert.Equal(t, "spark.executor.instances=1", quoteShellArg("spark.executor.instances=1"))
+	assert.Equal(t, "'a b'", quoteShellArg("a b"))
+	assert.Equal(t, `'it'"'"'s'`, quoteShellArg("it's"))
+	assert.Equal(t, "''", quoteShellArg(""))
+}
@@ -85,6 +85,20 @@ func printStatus(app *v1beta2.SparkApplication) {
 		table.Render()
 	}
 
+	if len(app.Status.PendingExecutors) > 0 {
+		fmt.Println("pending executors:")
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Count", "Reason", "Message"})
+		for _, pending := range app.Status.PendingExecutors {
+			table.Append([]string{fmt.Sprintf("%v", pending.Count), pending.Reason, pending.Message})
+		}
+		table.Render()
+	}
+
+	if app.Status.FailureReason != "" {
+		fmt.Printf("\napplication failure reason: %s\n", app.Status.FailureReason)
+	}
+
 	if app.Status.AppState.ErrorMessage != "" {
 		fmt.Printf("\napplication error message: %s\n", app.Status.AppState.ErrorMessage)
 	}